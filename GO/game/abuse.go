@@ -0,0 +1,439 @@
+package game
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// AbuseLimits configures the protection against abusive clients. A zero
+// limit is not enforced.
+type AbuseLimits struct {
+	MaxConnectionsPerIP int           // Open game connections allowed from one IP address
+	InputRate           int           // Messages a player may send per InputWindow
+	InputWindow         time.Duration // Window for InputRate
+	MaxMessageSize      int           // Longest message in bytes
+	BanAfter            int           // Violations within ViolationWindow that get an IP address banned
+	ViolationWindow     time.Duration // Window for BanAfter
+	BanDuration         time.Duration // How long a ban lasts
+}
+
+// DefaultAbuseLimits returns limits no honest player comes near
+func DefaultAbuseLimits() AbuseLimits {
+	return AbuseLimits{
+		MaxConnectionsPerIP: 8,
+		InputRate:           20,
+		InputWindow:         10 * time.Second,
+		MaxMessageSize:      512,
+		BanAfter:            10,
+		ViolationWindow:     time.Minute,
+		BanDuration:         5 * time.Minute,
+	}
+}
+
+// Errors returned when a connection is refused
+var (
+	ErrBanned             = errors.New("this address is temporarily banned")
+	ErrTooManyConnections = errors.New("too many connections from this address")
+)
+
+// AbuseStats counts what the AbuseGuard has stopped
+type AbuseStats struct {
+	RejectedConnections int
+	DroppedMessages     int
+	BansIssued          int
+}
+
+// AbuseGuard enforces AbuseLimits: it counts the open connections of every
+// IP address, records violations and bans addresses that commit too many. It
+// is safe for concurrent use.
+type AbuseGuard struct {
+	mutex       sync.Mutex
+	limits      AbuseLimits
+	connections map[string]int         // Open connections by IP address
+	violations  map[string][]time.Time // Recent violations by IP address
+	bans        map[string]time.Time   // End of each ban by IP address
+	trusted     map[string]bool        // Other server replicas, which relay the connections of many players
+	stats       AbuseStats
+}
+
+// NewAbuseGuard creates a guard enforcing the given limits
+func NewAbuseGuard(limits AbuseLimits) *AbuseGuard {
+	return &AbuseGuard{
+		limits:      limits,
+		connections: make(map[string]int),
+		violations:  make(map[string][]time.Time),
+		bans:        make(map[string]time.Time),
+		trusted:     make(map[string]bool),
+	}
+}
+
+// abuseGuard protects the game port of this server
+var abuseGuard = NewAbuseGuard(DefaultAbuseLimits())
+
+// ConfigureAbuseLimits sets the limits of the game port. It must be called
+// before a server starts.
+func ConfigureAbuseLimits(limits AbuseLimits) {
+	abuseGuard.SetLimits(limits)
+}
+
+// Limits returns the limits being enforced
+func (g *AbuseGuard) Limits() AbuseLimits {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	return g.limits
+}
+
+// SetLimits changes the limits; open connections are not affected
+func (g *AbuseGuard) SetLimits(limits AbuseLimits) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	g.limits = limits
+}
+
+// Admit counts a new connection from an IP address, or returns why it is
+// refused. Every admitted connection must be released with Release.
+func (g *AbuseGuard) Admit(ip string, now time.Time) error {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	if g.trusted[ip] {
+		g.connections[ip]++
+		return nil
+	}
+	if g.bannedLocked(ip, now) {
+		g.stats.RejectedConnections++
+		return ErrBanned
+	}
+	if limit := g.limits.MaxConnectionsPerIP; limit > 0 && g.connections[ip] >= limit {
+		g.stats.RejectedConnections++
+		g.violationLocked(ip, now)
+		return ErrTooManyConnections
+	}
+	g.connections[ip]++
+	return nil
+}
+
+// Release uncounts a connection admitted with Admit
+func (g *AbuseGuard) Release(ip string) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	if g.connections[ip]--; g.connections[ip] <= 0 {
+		delete(g.connections, ip)
+	}
+}
+
+// Violation records that an IP address broke a limit, which drops the
+// offending message, and reports whether the address is now banned
+func (g *AbuseGuard) Violation(ip string, now time.Time) bool {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	g.stats.DroppedMessages++
+	if g.trusted[ip] {
+		// The player behind a replica is not the replica's fault
+		return false
+	}
+	return g.violationLocked(ip, now)
+}
+
+// Trust exempts the IP addresses of the other server replicas from the
+// connection limit and from bans, replacing those trusted before. Their
+// players' messages are still limited.
+func (g *AbuseGuard) Trust(ips []string) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	g.trusted = make(map[string]bool, len(ips))
+	for _, ip := range ips {
+		g.trusted[ip] = true
+	}
+}
+
+// violationLocked records a violation and bans the address once it has too
+// many; the caller must hold g.mutex
+func (g *AbuseGuard) violationLocked(ip string, now time.Time) bool {
+	recent := g.violations[ip][:0]
+	for _, at := range g.violations[ip] {
+		if now.Sub(at) < g.limits.ViolationWindow {
+			recent = append(recent, at)
+		}
+	}
+	recent = append(recent, now)
+	g.violations[ip] = recent
+
+	if g.limits.BanAfter <= 0 || len(recent) < g.limits.BanAfter {
+		return false
+	}
+	delete(g.violations, ip)
+	g.bans[ip] = now.Add(g.limits.BanDuration)
+	g.stats.BansIssued++
+	return true
+}
+
+// Banned reports whether an IP address is banned at the given time
+func (g *AbuseGuard) Banned(ip string, now time.Time) bool {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	return g.bannedLocked(ip, now)
+}
+
+// bannedLocked reports whether an IP address is banned, forgetting bans
+// that are over; the caller must hold g.mutex
+func (g *AbuseGuard) bannedLocked(ip string, now time.Time) bool {
+	until, banned := g.bans[ip]
+	if banned && !now.Before(until) {
+		delete(g.bans, ip)
+		return false
+	}
+	return banned
+}
+
+// Ban bans an IP address until the given time
+func (g *AbuseGuard) Ban(ip string, until time.Time) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	g.bans[ip] = until
+	g.stats.BansIssued++
+}
+
+// Unban lifts the ban on an IP address; it reports false if there was none
+func (g *AbuseGuard) Unban(ip string) bool {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	_, banned := g.bans[ip]
+	delete(g.bans, ip)
+	delete(g.violations, ip)
+	return banned
+}
+
+// Stats returns what the guard has stopped so far
+func (g *AbuseGuard) Stats() AbuseStats {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	return g.stats
+}
+
+// Report describes the limits, the open connections and the active bans
+func (g *AbuseGuard) Report(now time.Time) string {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	limits := g.limits
+	report := "=== ABUSE PROTECTION ===\n\n"
+	report += "LIMITS:\n"
+	report += fmt.Sprintf("Connections per IP address: %s\n", describeLimit(limits.MaxConnectionsPerIP))
+	report += fmt.Sprintf("Messages per player: %s per %s\n", describeLimit(limits.InputRate), limits.InputWindow)
+	report += fmt.Sprintf("Message size: %s bytes\n", describeLimit(limits.MaxMessageSize))
+	report += fmt.Sprintf("Ban after: %s violations within %s, for %s\n\n",
+		describeLimit(limits.BanAfter), limits.ViolationWindow, limits.BanDuration)
+
+	open := 0
+	for _, count := range g.connections {
+		open += count
+	}
+	report += fmt.Sprintf("Open connections: %d from %d addresses\n", open, len(g.connections))
+	report += fmt.Sprintf("Trusted replica addresses: %d\n", len(g.trusted))
+	report += fmt.Sprintf("Rejected connections: %d\n", g.stats.RejectedConnections)
+	report += fmt.Sprintf("Dropped messages: %d\n", g.stats.DroppedMessages)
+	report += fmt.Sprintf("Bans issued: %d\n\n", g.stats.BansIssued)
+
+	ips := make([]string, 0, len(g.bans))
+	for ip := range g.bans {
+		if g.bannedLocked(ip, now) {
+			ips = append(ips, ip)
+		}
+	}
+	sort.Strings(ips)
+	report += "ACTIVE BANS:\n"
+	if len(ips) == 0 {
+		report += "None\n"
+	}
+	for _, ip := range ips {
+		report += fmt.Sprintf("%s - %s left\n", ip, g.bans[ip].Sub(now).Round(time.Second))
+	}
+	return report
+}
+
+// describeLimit shows a limit, or "unlimited" if it is not enforced
+func describeLimit(limit int) string {
+	if limit <= 0 {
+		return "unlimited"
+	}
+	return strconv.Itoa(limit)
+}
+
+// remoteIP returns the IP address a connection comes from
+func remoteIP(conn net.Conn) string {
+	address := conn.RemoteAddr().String()
+	if host, _, err := net.SplitHostPort(address); err == nil {
+		return host
+	}
+	return address
+}
+
+// guardedListener only hands out the connections the guard admits, and
+// releases them when they are closed
+type guardedListener struct {
+	net.Listener
+	guard *AbuseGuard
+}
+
+// Accept returns the next admitted connection; refused ones are told why
+// and closed
+func (l *guardedListener) Accept() (net.Conn, error) {
+	for {
+		conn, err := l.Listener.Accept()
+		if err != nil {
+			return nil, err
+		}
+
+		ip := remoteIP(conn)
+		if err := l.guard.Admit(ip, time.Now()); err != nil {
+			conn.SetWriteDeadline(time.Now().Add(time.Second))
+			conn.Write([]byte("Connection refused: " + err.Error() + ".\n"))
+			conn.Close()
+			continue
+		}
+		return &guardedConn{Conn: conn, release: func() { l.guard.Release(ip) }}, nil
+	}
+}
+
+// guardedConn releases its place in the guard's count when closed
+type guardedConn struct {
+	net.Conn
+	release func()
+	once    sync.Once
+}
+
+// Close closes the connection and releases it
+func (c *guardedConn) Close() error {
+	c.once.Do(c.release)
+	return c.Conn.Close()
+}
+
+// inputLimiter applies the per-player limits to a connection's messages. It
+// is only used by the connection's reader.
+type inputLimiter struct {
+	guard *AbuseGuard
+	ip    string
+	times []time.Time // When recent messages were received
+}
+
+// newInputLimiter creates a limiter for a connection's messages
+func newInputLimiter(guard *AbuseGuard, conn net.Conn) *inputLimiter {
+	return &inputLimiter{guard: guard, ip: remoteIP(conn)}
+}
+
+// check returns why a message must be dropped ("" if it may pass) and
+// whether the sender is now banned
+func (l *inputLimiter) check(message string, now time.Time) (string, bool) {
+	limits := l.guard.Limits()
+
+	reason := ""
+	if limits.MaxMessageSize > 0 && len(message) > limits.MaxMessageSize {
+		reason = fmt.Sprintf("Messages can be at most %d bytes long.", limits.MaxMessageSize)
+	} else if limits.InputRate > 0 {
+		recent := l.times[:0]
+		for _, at := range l.times {
+			if now.Sub(at) < limits.InputWindow {
+				recent = append(recent, at)
+			}
+		}
+		l.times = recent
+		if len(recent) >= limits.InputRate {
+			reason = fmt.Sprintf("You are sending messages too fast. You can send %d messages every %s.",
+				limits.InputRate, limits.InputWindow)
+		} else {
+			l.times = append(l.times, now)
+		}
+	}
+
+	if reason == "" {
+		return "", false
+	}
+	return reason, l.guard.Violation(l.ip, now)
+}
+
+// tooLong returns why a message longer than the reader's buffer of size
+// bytes is dropped, and whether the sender is now banned
+func (l *inputLimiter) tooLong(size int, now time.Time) (string, bool) {
+	limit := size
+	if maxSize := l.guard.Limits().MaxMessageSize; maxSize > 0 && maxSize < limit {
+		limit = maxSize
+	}
+	return fmt.Sprintf("Messages can be at most %d bytes long.", limit), l.guard.Violation(l.ip, now)
+}
+
+// handleAbuseCommand lets admins follow the abuse protection with "abuse",
+// ban and unban addresses and change the limits
+func handleAbuseCommand(args []string) string {
+	usage := "Usage: abuse | abuse ban <ip> [duration] | abuse unban <ip> | abuse set <limit> <value>\n" +
+		"Limits: connections, rate, window, message-size, ban-after, violation-window, ban-for"
+	now := time.Now()
+
+	switch {
+	case len(args) == 0:
+		return abuseGuard.Report(now)
+	case (len(args) == 2 || len(args) == 3) && args[0] == "ban":
+		duration := abuseGuard.Limits().BanDuration
+		if len(args) == 3 {
+			var err error
+			if duration, err = time.ParseDuration(args[2]); err != nil || duration <= 0 {
+				return "Invalid duration: " + args[2]
+			}
+		}
+		abuseGuard.Ban(args[1], now.Add(duration))
+		return fmt.Sprintf("Banned %s for %s.", args[1], duration)
+	case len(args) == 2 && args[0] == "unban":
+		if !abuseGuard.Unban(args[1]) {
+			return fmt.Sprintf("%s is not banned.", args[1])
+		}
+		return fmt.Sprintf("Lifted the ban on %s.", args[1])
+	case len(args) == 3 && args[0] == "set":
+		limits := abuseGuard.Limits()
+		if err := setAbuseLimit(&limits, args[1], args[2]); err != nil {
+			return err.Error() + "\n" + usage
+		}
+		abuseGuard.SetLimits(limits)
+		return "Limits updated.\n\n" + abuseGuard.Report(now)
+	default:
+		return usage
+	}
+}
+
+// setAbuseLimit changes one of the limits by name
+func setAbuseLimit(limits *AbuseLimits, name, value string) error {
+	counts := map[string]*int{
+		"connections":  &limits.MaxConnectionsPerIP,
+		"rate":         &limits.InputRate,
+		"message-size": &limits.MaxMessageSize,
+		"ban-after":    &limits.BanAfter,
+	}
+	durations := map[string]*time.Duration{
+		"window":           &limits.InputWindow,
+		"violation-window": &limits.ViolationWindow,
+		"ban-for":          &limits.BanDuration,
+	}
+
+	if count, ok := counts[name]; ok {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			return fmt.Errorf("%s must be a number (0 for unlimited)", name)
+		}
+		*count = n
+		return nil
+	}
+	if duration, ok := durations[name]; ok {
+		d, err := time.ParseDuration(value)
+		if err != nil || d <= 0 {
+			return fmt.Errorf("%s must be a duration such as 30s or 5m", name)
+		}
+		*duration = d
+		return nil
+	}
+	return fmt.Errorf("unknown limit %q", strings.TrimSpace(name))
+}
@@ -0,0 +1,117 @@
+package game
+
+import (
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testAbuseLimits() AbuseLimits {
+	return AbuseLimits{
+		MaxConnectionsPerIP: 2,
+		InputRate:           3,
+		InputWindow:         time.Second,
+		MaxMessageSize:      10,
+		BanAfter:            3,
+		ViolationWindow:     time.Minute,
+		BanDuration:         time.Minute,
+	}
+}
+
+func TestAbuseGuard_LimitsConnectionsPerIP(t *testing.T) {
+	guard := NewAbuseGuard(testAbuseLimits())
+	now := time.Now()
+
+	assert.NoError(t, guard.Admit("10.0.0.1", now))
+	assert.NoError(t, guard.Admit("10.0.0.1", now))
+	assert.ErrorIs(t, guard.Admit("10.0.0.1", now), ErrTooManyConnections)
+	assert.NoError(t, guard.Admit("10.0.0.2", now))
+
+	// A closed connection makes room for another
+	guard.Release("10.0.0.1")
+	assert.NoError(t, guard.Admit("10.0.0.1", now))
+	assert.Equal(t, 1, guard.Stats().RejectedConnections)
+}
+
+func TestAbuseGuard_BansRepeatedViolations(t *testing.T) {
+	guard := NewAbuseGuard(testAbuseLimits())
+	now := time.Now()
+
+	assert.False(t, guard.Violation("10.0.0.1", now))
+	assert.False(t, guard.Violation("10.0.0.1", now.Add(time.Second)))
+	assert.True(t, guard.Violation("10.0.0.1", now.Add(2*time.Second)))
+	assert.ErrorIs(t, guard.Admit("10.0.0.1", now.Add(3*time.Second)), ErrBanned)
+	assert.Contains(t, guard.Report(now.Add(3*time.Second)), "10.0.0.1 - ")
+
+	// Bans run out, and old violations are forgotten
+	assert.NoError(t, guard.Admit("10.0.0.1", now.Add(2*time.Minute)))
+	assert.False(t, guard.Violation("10.0.0.2", now))
+	assert.False(t, guard.Violation("10.0.0.2", now.Add(time.Minute)))
+	assert.False(t, guard.Violation("10.0.0.2", now.Add(2*time.Minute)))
+
+	guard.Ban("10.0.0.3", now.Add(time.Hour))
+	assert.True(t, guard.Banned("10.0.0.3", now))
+	assert.True(t, guard.Unban("10.0.0.3"))
+	assert.False(t, guard.Banned("10.0.0.3", now))
+}
+
+func TestInputLimiter_DropsFloodsAndLongMessages(t *testing.T) {
+	guard := NewAbuseGuard(testAbuseLimits())
+	limiter := &inputLimiter{guard: guard, ip: "10.0.0.1"}
+	now := time.Now()
+
+	for i := 0; i < 3; i++ {
+		reason, _ := limiter.check("1234", now)
+		assert.Empty(t, reason)
+	}
+	reason, banned := limiter.check("1234", now)
+	assert.Contains(t, reason, "too fast")
+	assert.False(t, banned)
+
+	// The window moves on
+	reason, _ = limiter.check("1234", now.Add(2*time.Second))
+	assert.Empty(t, reason)
+
+	reason, banned = limiter.check(strings.Repeat("x", 11), now.Add(2*time.Second))
+	assert.Contains(t, reason, "at most 10 bytes")
+	assert.False(t, banned)
+	_, banned = limiter.check(strings.Repeat("x", 11), now.Add(2*time.Second))
+	assert.True(t, banned)
+}
+
+func TestGuardedListener_RefusesBannedAddresses(t *testing.T) {
+	guard := NewAbuseGuard(testAbuseLimits())
+	guard.Ban("127.0.0.1", time.Now().Add(time.Minute))
+
+	listener, err := listen("127.0.0.1:0", nil, guard)
+	assert.NoError(t, err)
+	defer listener.Close()
+	go func() {
+		if conn, err := listener.Accept(); err == nil {
+			conn.Close()
+		}
+	}()
+
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	assert.NoError(t, err)
+	defer conn.Close()
+	reply := make([]byte, 128)
+	n, _ := conn.Read(reply)
+	assert.Contains(t, string(reply[:n]), "banned")
+}
+
+func TestHandleAbuseCommand_ChangesLimits(t *testing.T) {
+	saved := abuseGuard.Limits()
+	defer abuseGuard.SetLimits(saved)
+
+	assert.Contains(t, handleAbuseCommand([]string{"set", "rate", "7"}), "7 per")
+	assert.Equal(t, 7, abuseGuard.Limits().InputRate)
+	assert.Contains(t, handleAbuseCommand([]string{"set", "ban-for", "soon"}), "must be a duration")
+	assert.Contains(t, handleAbuseCommand([]string{"set", "speed", "1"}), "unknown limit")
+
+	assert.Equal(t, "Banned 192.0.2.1 for 1m0s.", handleAbuseCommand([]string{"ban", "192.0.2.1", "1m"}))
+	assert.Equal(t, "Lifted the ban on 192.0.2.1.", handleAbuseCommand([]string{"unban", "192.0.2.1"}))
+}
@@ -3,47 +3,108 @@ package game
 import (
 	"fmt"
 	"sort"
+	"strings"
 	"sync"
 	"time"
 )
 
 // GameStats represents statistics for a single game
 type GameStats struct {
-	SecretCode    int           // The secret code for this game
-	GuessCount    int           // Number of guesses made
-	Won           bool          // Whether the game was won or not
-	StartTime     time.Time     // When the game started
-	EndTime       time.Time     // When the game ended
-	PlayerCount   int           // Number of players in this game
-	PlayerGuesses map[int][]int // Guesses made by each player (player ID -> []guesses)
+	ID            int                 // Numbers the games in the order they started, from 1
+	SecretCode    int                 // The secret code for this game
+	GuessCount    int                 // Number of guesses made
+	Won           bool                // Whether the game was won or not
+	StartTime     time.Time           // When the game started
+	EndTime       time.Time           // When the game ended
+	PlayerCount   int                 // Number of players in this game
+	PlayerGuesses map[int][]int       // Guesses made by each player (player ID -> []guesses)
+	Lost          bool                // Whether everyone ran out of guesses or time
+	Draw          bool                // Whether a duel ended with both codes cracked in as many guesses
+	Score         int                 // Total points scored in this game
+	PlayerScores  map[int]int         // Points scored by each player (player ID -> points)
+	Duel          bool                // Whether players set the codes for each other
+	ChosenSecrets map[int]int         // Duel codes chosen by players (setter ID -> code)
+	Teams         map[string][]int    // Team mode: members of each team (team name -> player IDs)
+	WinningTeam   string              // Team mode: the team that won, if any
+	WinnerID      int                 // The player who won, if anyone did
+	Guesses       []GuessStat         // Every guess in the order it was made
+	Efficiency    map[int]*Efficiency // The solver's analysis of each player's guesses (player ID -> efficiency)
+	Timeouts      map[int]int         // Turns each player ran out of time for (player ID -> timeouts)
 }
 
-// GameAnalytics stores and manages game statistics
+// GuessStat is a guess recorded in a game's statistics
+type GuessStat struct {
+	PlayerID int       // The player who guessed
+	Guess    int       // The code guessed
+	Secret   int       // The code the player was trying to crack
+	Feedback Feedback  // How close the guess was
+	Time     time.Time // When the guess was made
+}
+
+// GameAnalytics stores and manages game statistics. The all-time totals
+// are kept up to date as games are played, so reading them takes the same
+// time however many games there have been. Only the most recent games are
+// kept whole; older ones are rolled up into hourly and daily summaries.
 type GameAnalytics struct {
-	mu           sync.RWMutex
-	gamesPlayed  int                  // Total number of games played
-	gamesWon     int                  // Total number of games won
-	gameHistory  []*GameStats         // History of all games
-	secretCounts map[int]int          // Count of each secret code
-	guessCounts  map[int]int          // Count of each guess made
-	playerStats  map[int]*PlayerStats // Statistics by player ID
+	mu            sync.RWMutex
+	gamesPlayed   int                   // Total number of games played
+	gamesWon      int                   // Total number of games won
+	gamesLost     int                   // Total number of games lost to guess or time limits
+	totalGuesses  int                   // Guesses made in all games
+	winGuesses    int                   // Guesses made in won games
+	playerSlots   int                   // Players added up over all games
+	totalDuration time.Duration         // Length of all finished games
+	players       map[int]struct{}      // Every player who took part in a game
+	secretWins    map[int]*secretTally  // Won games by secret code, not counting duels
+	gameHistory   []*GameStats          // Recent games, oldest first
+	openGames     int                   // Games in gameHistory still being played
+	recentLimit   int                   // Finished games kept in gameHistory before rolling them up
+	rollups       map[rollupKey]*rollup // Games rolled out of gameHistory, by the hour or day they started
+	compacted     time.Time             // Hour the old hourly rollups were last merged into daily ones
+	secretCounts  map[int]int           // Count of each generated secret code
+	chosenCounts  map[int]int           // Count of each code chosen by a duel player
+	guessCounts   map[int]int           // Count of each guess made
+	playerStats   map[int]*PlayerStats  // Statistics by player ID
+	teamStats     map[string]*TeamStats // Statistics by team name
 }
 
 // PlayerStats tracks statistics for a specific player
 type PlayerStats struct {
-	GamesPlayed  int // Total games played
-	GamesWon     int // Games won by this player
-	TotalGuesses int // Total guesses made
-	BestGame     int // Fewest guesses to win (0 if never won)
+	GamesPlayed  int        `json:"games_played"`  // Total games played
+	GamesWon     int        `json:"games_won"`     // Games won by this player
+	TotalGuesses int        `json:"total_guesses"` // Total guesses made
+	BestGame     int        `json:"best_game"`     // Fewest guesses to win (0 if never won)
+	TotalScore   int        `json:"total_score"`   // Total points scored
+	BestScore    int        `json:"best_score"`    // Most points scored in a single game
+	Timeouts     int        `json:"timeouts"`      // Turns they ran out of time for
+	Efficiency   Efficiency `json:"efficiency"`    // The solver's analysis of all their guesses
+
+	DailyStreak     int    `json:"daily_streak"`      // Consecutive days the daily challenge was solved
+	BestDailyStreak int    `json:"best_daily_streak"` // Longest daily challenge streak
+	LastDailySolved string `json:"last_daily_solved"` // Day the daily challenge was last solved ("2006-01-02")
+}
+
+// TeamStats tracks statistics for a named team
+type TeamStats struct {
+	GamesPlayed int // Total games played
+	GamesWon    int // Games won by a member of this team
+	TotalScore  int // Total points scored by the team's winning guesses
 }
 
-// NewGameAnalytics creates a new analytics tracker
+// NewGameAnalytics creates a new analytics tracker that keeps the last
+// DefaultRecentGames games whole
 func NewGameAnalytics() *GameAnalytics {
 	return &GameAnalytics{
+		players:      make(map[int]struct{}),
+		secretWins:   make(map[int]*secretTally),
 		gameHistory:  make([]*GameStats, 0),
+		recentLimit:  DefaultRecentGames,
+		rollups:      make(map[rollupKey]*rollup),
 		secretCounts: make(map[int]int),
+		chosenCounts: make(map[int]int),
 		guessCounts:  make(map[int]int),
 		playerStats:  make(map[int]*PlayerStats),
+		teamStats:    make(map[string]*TeamStats),
 	}
 }
 
@@ -54,30 +115,79 @@ func (ga *GameAnalytics) StartGame(secretCode int, playerCount int) *GameStats {
 
 	// Increment the count for this secret code
 	ga.secretCounts[secretCode]++
+
+	stats := ga.newGame(playerCount)
+	stats.SecretCode = secretCode
+	return stats
+}
+
+// StartDuel begins tracking a duel, whose codes are recorded as the players
+// set them
+func (ga *GameAnalytics) StartDuel(playerCount int) *GameStats {
+	ga.mu.Lock()
+	defer ga.mu.Unlock()
+
+	stats := ga.newGame(playerCount)
+	stats.Duel = true
+	return stats
+}
+
+// newGame adds a new game to the history; the caller must hold ga.mu
+func (ga *GameAnalytics) newGame(playerCount int) *GameStats {
 	ga.gamesPlayed++
+	ga.playerSlots += playerCount
 
 	// Create new game stats
 	stats := &GameStats{
-		SecretCode:    secretCode,
+		ID:            ga.gamesPlayed,
 		GuessCount:    0,
 		Won:           false,
 		StartTime:     time.Now(),
 		PlayerCount:   playerCount,
 		PlayerGuesses: make(map[int][]int),
+		PlayerScores:  make(map[int]int),
+		ChosenSecrets: make(map[int]int),
+		Teams:         make(map[string][]int),
+		Timeouts:      make(map[int]int),
 	}
 
-	// Add to history
+	// Add to history, making room by rolling up the oldest games
 	ga.gameHistory = append(ga.gameHistory, stats)
+	ga.openGames++
+	ga.rollUpLocked(stats.StartTime)
 	return stats
 }
 
-// RecordGuess tracks a player's guess
-func (ga *GameAnalytics) RecordGuess(stats *GameStats, playerID int, guess int) {
+// RecordChosenSecret tracks a code a duel player chose for their opponent
+func (ga *GameAnalytics) RecordChosenSecret(stats *GameStats, playerID int, code int) {
+	ga.mu.Lock()
+	defer ga.mu.Unlock()
+
+	stats.ChosenSecrets[playerID] = code
+	ga.chosenCounts[code]++
+}
+
+// RecordGeneratedSecret tracks a code generated for a duel player who did not
+// choose one in time
+func (ga *GameAnalytics) RecordGeneratedSecret(stats *GameStats, code int) {
+	ga.mu.Lock()
+	defer ga.mu.Unlock()
+
+	ga.secretCounts[code]++
+}
+
+// RecordGuess tracks a player's guess at the secret code they were trying
+// to crack
+func (ga *GameAnalytics) RecordGuess(stats *GameStats, playerID int, guess int, secret int) {
 	ga.mu.Lock()
 	defer ga.mu.Unlock()
 
 	// Increment total guesses for this game
 	stats.GuessCount++
+	ga.totalGuesses++
+	ga.players[playerID] = struct{}{}
+	stats.Guesses = append(stats.Guesses, GuessStat{PlayerID: playerID, Guess: guess, Secret: secret,
+		Feedback: ScoreGuess(guess, secret), Time: time.Now()})
 
 	// Record player's guess
 	if _, exists := stats.PlayerGuesses[playerID]; !exists {
@@ -101,16 +211,168 @@ func (ga *GameAnalytics) RecordGuess(stats *GameStats, playerID int, guess int)
 	ga.playerStats[playerID].TotalGuesses++
 }
 
+// RecordScore credits points earned in a game to a player
+func (ga *GameAnalytics) RecordScore(stats *GameStats, playerID int, points int) {
+	ga.mu.Lock()
+	defer ga.mu.Unlock()
+
+	stats.Score += points
+	stats.PlayerScores[playerID] += points
+
+	// Initialize player stats if not exists
+	if _, exists := ga.playerStats[playerID]; !exists {
+		ga.playerStats[playerID] = &PlayerStats{}
+	}
+
+	playerStats := ga.playerStats[playerID]
+	playerStats.TotalScore += points
+	if stats.PlayerScores[playerID] > playerStats.BestScore {
+		playerStats.BestScore = stats.PlayerScores[playerID]
+	}
+}
+
+// RecordTimeout tracks a player running out of time for a turn
+func (ga *GameAnalytics) RecordTimeout(stats *GameStats, playerID int) {
+	ga.mu.Lock()
+	defer ga.mu.Unlock()
+
+	stats.Timeouts[playerID]++
+	if _, exists := ga.playerStats[playerID]; !exists {
+		ga.playerStats[playerID] = &PlayerStats{}
+	}
+	ga.playerStats[playerID].Timeouts++
+}
+
+// RecordTeams tracks the teams taking part in a team game
+func (ga *GameAnalytics) RecordTeams(stats *GameStats, teams []Team) {
+	ga.mu.Lock()
+	defer ga.mu.Unlock()
+
+	for _, team := range teams {
+		stats.Teams[team.Name] = append([]int(nil), team.Members...)
+		for _, playerID := range team.Members {
+			// Every member takes part in the game, even without guessing
+			if _, exists := stats.PlayerGuesses[playerID]; !exists {
+				stats.PlayerGuesses[playerID] = make([]int, 0)
+			}
+			ga.players[playerID] = struct{}{}
+		}
+
+		if _, exists := ga.teamStats[team.Name]; !exists {
+			ga.teamStats[team.Name] = &TeamStats{}
+		}
+		ga.teamStats[team.Name].GamesPlayed++
+	}
+}
+
+// EndTeamGame completes tracking for a team game won by winnerID; the win is
+// credited to their team and to each of their teammates
+func (ga *GameAnalytics) EndTeamGame(stats *GameStats, winnerID int, team string) {
+	ga.mu.Lock()
+	defer ga.mu.Unlock()
+
+	stats.WinningTeam = team
+	if teamStats, exists := ga.teamStats[team]; exists {
+		teamStats.GamesWon++
+		teamStats.TotalScore += stats.PlayerScores[winnerID]
+	}
+
+	for _, playerID := range stats.Teams[team] {
+		if playerID == winnerID {
+			continue
+		}
+		if _, exists := ga.playerStats[playerID]; !exists {
+			ga.playerStats[playerID] = &PlayerStats{}
+		}
+		ga.playerStats[playerID].GamesWon++
+	}
+
+	ga.endGame(stats, winnerID)
+}
+
+// RecordDailyResult updates a player's daily challenge streak with their
+// attempt at the given day's challenge and returns the new streak
+func (ga *GameAnalytics) RecordDailyResult(playerID int, day time.Time, solved bool) int {
+	ga.mu.Lock()
+	defer ga.mu.Unlock()
+
+	if _, exists := ga.playerStats[playerID]; !exists {
+		ga.playerStats[playerID] = &PlayerStats{}
+	}
+	playerStats := ga.playerStats[playerID]
+
+	today := day.UTC().Format(dailyDateFormat)
+	yesterday := day.UTC().AddDate(0, 0, -1).Format(dailyDateFormat)
+	switch {
+	case !solved:
+		playerStats.DailyStreak = 0
+	case playerStats.LastDailySolved == today:
+		// Already counted
+	case playerStats.LastDailySolved == yesterday:
+		playerStats.DailyStreak++
+	default:
+		playerStats.DailyStreak = 1
+	}
+	if solved {
+		playerStats.LastDailySolved = today
+	}
+	if playerStats.DailyStreak > playerStats.BestDailyStreak {
+		playerStats.BestDailyStreak = playerStats.DailyStreak
+	}
+	return playerStats.DailyStreak
+}
+
 // EndGame completes tracking for a game
 func (ga *GameAnalytics) EndGame(stats *GameStats, winnerID int) {
 	ga.mu.Lock()
 	defer ga.mu.Unlock()
 
+	ga.endGame(stats, winnerID)
+}
+
+// EndGameLost completes tracking for a game that everyone lost by running
+// out of guesses or time
+func (ga *GameAnalytics) EndGameLost(stats *GameStats) {
+	ga.mu.Lock()
+	defer ga.mu.Unlock()
+
+	stats.Lost = true
+	ga.gamesLost++
+	ga.endGame(stats, 0)
+}
+
+// EndGameDrawn completes tracking for a duel that ended in a draw
+func (ga *GameAnalytics) EndGameDrawn(stats *GameStats) {
+	ga.mu.Lock()
+	defer ga.mu.Unlock()
+
+	stats.Draw = true
+	ga.endGame(stats, 0)
+}
+
+// endGame records the end of a game; the caller must hold ga.mu
+func (ga *GameAnalytics) endGame(stats *GameStats, winnerID int) {
+	if stats.EndTime.IsZero() {
+		ga.openGames--
+	}
 	stats.EndTime = time.Now()
 	stats.Won = (winnerID > 0) // If winnerID is 0, game was abandoned or lost
+	stats.WinnerID = winnerID
+	ga.totalDuration += stats.EndTime.Sub(stats.StartTime)
 
 	if winnerID > 0 {
 		ga.gamesWon++
+		ga.winGuesses += stats.GuessCount
+		if !stats.Duel {
+			// A duel has no single secret code
+			tally, exists := ga.secretWins[stats.SecretCode]
+			if !exists {
+				tally = &secretTally{}
+				ga.secretWins[stats.SecretCode] = tally
+			}
+			tally.wins++
+			tally.guesses += stats.GuessCount
+		}
 
 		// Update player stats
 		if _, exists := ga.playerStats[winnerID]; !exists {
@@ -147,14 +409,13 @@ func (ga *GameAnalytics) EndGame(stats *GameStats, winnerID int) {
 		}
 		ga.playerStats[playerID].GamesPlayed++
 	}
+
+	// A finished game may take the recent games over the limit
+	ga.rollUpLocked(stats.EndTime)
 }
 
 // GetHardestNumbers returns the top N hardest numbers to guess
-func (ga *GameAnalytics) GetHardestNumbers(n int) []struct {
-	Number     int
-	AvgGuesses float64
-	Frequency  int
-} {
+func (ga *GameAnalytics) GetHardestNumbers(n int) []NumberStat {
 	ga.mu.RLock()
 	defer ga.mu.RUnlock()
 
@@ -164,32 +425,15 @@ func (ga *GameAnalytics) GetHardestNumbers(n int) []struct {
 		frequency  int
 	}
 
-	// Map to store number -> total guesses and frequency
-	numberData := make(map[int]struct {
-		totalGuesses int
-		frequency    int
-	})
-
-	// Compile data for each secret code
-	for _, game := range ga.gameHistory {
-		if game.Won {
-			number := game.SecretCode
-			data := numberData[number]
-			data.totalGuesses += game.GuessCount
-			data.frequency++
-			numberData[number] = data
-		}
-	}
-
 	// Convert to slice and calculate average guesses
-	stats := make([]numberStats, 0, len(numberData))
-	for number, data := range numberData {
-		if data.frequency > 0 {
-			avg := float64(data.totalGuesses) / float64(data.frequency)
+	stats := make([]numberStats, 0, len(ga.secretWins))
+	for number, data := range ga.secretWins {
+		if data.wins > 0 {
+			avg := float64(data.guesses) / float64(data.wins)
 			stats = append(stats, numberStats{
 				number:     number,
 				avgGuesses: avg,
-				frequency:  data.frequency,
+				frequency:  data.wins,
 			})
 		}
 	}
@@ -206,18 +450,9 @@ func (ga *GameAnalytics) GetHardestNumbers(n int) []struct {
 	stats = stats[:n]
 
 	// Convert to return format
-	result := make([]struct {
-		Number     int
-		AvgGuesses float64
-		Frequency  int
-	}, len(stats))
-
+	result := make([]NumberStat, len(stats))
 	for i, stat := range stats {
-		result[i] = struct {
-			Number     int
-			AvgGuesses float64
-			Frequency  int
-		}{
+		result[i] = NumberStat{
 			Number:     stat.number,
 			AvgGuesses: stat.avgGuesses,
 			Frequency:  stat.frequency,
@@ -228,10 +463,7 @@ func (ga *GameAnalytics) GetHardestNumbers(n int) []struct {
 }
 
 // GetMostCommonGuesses returns the top N most common guesses
-func (ga *GameAnalytics) GetMostCommonGuesses(n int) []struct {
-	Guess     int
-	Frequency int
-} {
+func (ga *GameAnalytics) GetMostCommonGuesses(n int) []GuessFrequency {
 	ga.mu.RLock()
 	defer ga.mu.RUnlock()
 
@@ -263,16 +495,9 @@ func (ga *GameAnalytics) GetMostCommonGuesses(n int) []struct {
 	guesses = guesses[:n]
 
 	// Convert to return format
-	result := make([]struct {
-		Guess     int
-		Frequency int
-	}, len(guesses))
-
+	result := make([]GuessFrequency, len(guesses))
 	for i, g := range guesses {
-		result[i] = struct {
-			Guess     int
-			Frequency int
-		}{
+		result[i] = GuessFrequency{
 			Guess:     g.guess,
 			Frequency: g.frequency,
 		}
@@ -281,79 +506,126 @@ func (ga *GameAnalytics) GetMostCommonGuesses(n int) []struct {
 	return result
 }
 
-// GetOverallStats returns overall game statistics
-func (ga *GameAnalytics) GetOverallStats() struct {
-	GamesPlayed       int
-	GamesWon          int
-	AvgGuessesPerGame float64
-	AvgGuessesPerWin  float64
-	TotalPlayers      int
-	AvgPlayersPerGame float64
-	TotalDuration     time.Duration
-	AvgGameDuration   time.Duration
+// GetMostChosenSecrets returns the top N codes chosen by duel players
+func (ga *GameAnalytics) GetMostChosenSecrets(n int) []struct {
+	Code      int
+	Frequency int
 } {
 	ga.mu.RLock()
 	defer ga.mu.RUnlock()
 
-	result := struct {
-		GamesPlayed       int
-		GamesWon          int
-		AvgGuessesPerGame float64
-		AvgGuessesPerWin  float64
-		TotalPlayers      int
-		AvgPlayersPerGame float64
-		TotalDuration     time.Duration
-		AvgGameDuration   time.Duration
-	}{
-		GamesPlayed: ga.gamesPlayed,
-		GamesWon:    ga.gamesWon,
-	}
+	codes := make([]struct {
+		Code      int
+		Frequency int
+	}, 0, len(ga.chosenCounts))
 
-	// Calculate other stats
-	totalGuesses := 0
-	winGuesses := 0
-	totalPlayers := 0
-	totalDuration := time.Duration(0)
-	playersSet := make(map[int]struct{})
+	for code, count := range ga.chosenCounts {
+		codes = append(codes, struct {
+			Code      int
+			Frequency int
+		}{
+			Code:      code,
+			Frequency: count,
+		})
+	}
 
-	for _, game := range ga.gameHistory {
-		totalGuesses += game.GuessCount
-		if game.Won {
-			winGuesses += game.GuessCount
+	// Sort by frequency (descending), then by code for a stable report
+	sort.Slice(codes, func(i, j int) bool {
+		if codes[i].Frequency == codes[j].Frequency {
+			return codes[i].Code < codes[j].Code
 		}
+		return codes[i].Frequency > codes[j].Frequency
+	})
 
-		// Count unique players
-		for playerID := range game.PlayerGuesses {
-			playersSet[playerID] = struct{}{}
-		}
+	// Take top N
+	if n > len(codes) {
+		n = len(codes)
+	}
+	return codes[:n]
+}
 
-		// Add to player count
-		totalPlayers += game.PlayerCount
+// GetOverallStats returns overall game statistics
+func (ga *GameAnalytics) GetOverallStats() OverallStats {
+	ga.mu.RLock()
+	defer ga.mu.RUnlock()
 
-		// Add duration if game is completed
-		if !game.EndTime.IsZero() {
-			duration := game.EndTime.Sub(game.StartTime)
-			totalDuration += duration
-		}
+	result := OverallStats{
+		GamesPlayed: ga.gamesPlayed,
+		GamesWon:    ga.gamesWon,
+		GamesLost:   ga.gamesLost,
 	}
 
-	// Calculate averages
+	// Calculate averages from the running totals
 	if ga.gamesPlayed > 0 {
-		result.AvgGuessesPerGame = float64(totalGuesses) / float64(ga.gamesPlayed)
-		result.AvgPlayersPerGame = float64(totalPlayers) / float64(ga.gamesPlayed)
-		result.AvgGameDuration = totalDuration / time.Duration(ga.gamesPlayed)
+		result.AvgGuessesPerGame = float64(ga.totalGuesses) / float64(ga.gamesPlayed)
+		result.AvgPlayersPerGame = float64(ga.playerSlots) / float64(ga.gamesPlayed)
+		result.AvgGameDuration = ga.totalDuration / time.Duration(ga.gamesPlayed)
 	}
 
 	if ga.gamesWon > 0 {
-		result.AvgGuessesPerWin = float64(winGuesses) / float64(ga.gamesWon)
+		result.AvgGuessesPerWin = float64(ga.winGuesses) / float64(ga.gamesWon)
 	}
 
-	result.TotalPlayers = len(playersSet)
-	result.TotalDuration = totalDuration
+	result.TotalPlayers = len(ga.players)
+	result.TotalDuration = ga.totalDuration
 
 	return result
 }
 
+// AnalyticsSummary holds the totals of a GameAnalytics, which add up across
+// server replicas
+type AnalyticsSummary struct {
+	GamesPlayed   int           `json:"games_played"`
+	GamesWon      int           `json:"games_won"`
+	GamesLost     int           `json:"games_lost"`     // Lost to guess or time limits
+	TotalGuesses  int           `json:"total_guesses"`  // Guesses made in all games
+	WinGuesses    int           `json:"win_guesses"`    // Guesses made in won games
+	PlayerSlots   int           `json:"player_slots"`   // Players added up over all games
+	TotalDuration time.Duration `json:"total_duration"` // Length of all finished games
+}
+
+// Summary returns the totals of the games played so far
+func (ga *GameAnalytics) Summary() AnalyticsSummary {
+	ga.mu.RLock()
+	defer ga.mu.RUnlock()
+
+	return AnalyticsSummary{
+		GamesPlayed:   ga.gamesPlayed,
+		GamesWon:      ga.gamesWon,
+		GamesLost:     ga.gamesLost,
+		TotalGuesses:  ga.totalGuesses,
+		WinGuesses:    ga.winGuesses,
+		PlayerSlots:   ga.playerSlots,
+		TotalDuration: ga.totalDuration,
+	}
+}
+
+// Add adds the totals of another summary to these
+func (s *AnalyticsSummary) Add(other AnalyticsSummary) {
+	s.GamesPlayed += other.GamesPlayed
+	s.GamesWon += other.GamesWon
+	s.GamesLost += other.GamesLost
+	s.TotalGuesses += other.TotalGuesses
+	s.WinGuesses += other.WinGuesses
+	s.PlayerSlots += other.PlayerSlots
+	s.TotalDuration += other.TotalDuration
+}
+
+// Describe presents the totals and the averages they give
+func (s AnalyticsSummary) Describe() string {
+	description := fmt.Sprintf("Games Played: %d\nGames Won: %d\nGames Lost (out of guesses or time): %d\n",
+		s.GamesPlayed, s.GamesWon, s.GamesLost)
+	if s.GamesPlayed > 0 {
+		description += fmt.Sprintf("Average Guesses Per Game: %.2f\n", float64(s.TotalGuesses)/float64(s.GamesPlayed))
+		description += fmt.Sprintf("Average Players Per Game: %.2f\n", float64(s.PlayerSlots)/float64(s.GamesPlayed))
+		description += fmt.Sprintf("Average Game Duration: %s\n", (s.TotalDuration / time.Duration(s.GamesPlayed)).Round(time.Second))
+	}
+	if s.GamesWon > 0 {
+		description += fmt.Sprintf("Average Guesses Per Win: %.2f\n", float64(s.WinGuesses)/float64(s.GamesWon))
+	}
+	return description
+}
+
 // GetPlayerStats returns statistics for a specific player
 func (ga *GameAnalytics) GetPlayerStats(playerID int) *PlayerStats {
 	ga.mu.RLock()
@@ -366,18 +638,15 @@ func (ga *GameAnalytics) GetPlayerStats(playerID int) *PlayerStats {
 }
 
 // GetTopPlayers returns the top N players by win rate
-func (ga *GameAnalytics) GetTopPlayers(n int) []struct {
-	PlayerID int
-	WinRate  float64
-	GamesWon int
-} {
+func (ga *GameAnalytics) GetTopPlayers(n int) []PlayerRanking {
 	ga.mu.RLock()
 	defer ga.mu.RUnlock()
 
 	type playerStat struct {
-		id       int
-		winRate  float64
-		gamesWon int
+		id         int
+		winRate    float64
+		gamesWon   int
+		totalScore int
 	}
 
 	// Get players with at least one game
@@ -386,9 +655,10 @@ func (ga *GameAnalytics) GetTopPlayers(n int) []struct {
 		if stats.GamesPlayed > 0 {
 			winRate := float64(stats.GamesWon) / float64(stats.GamesPlayed)
 			playerStats = append(playerStats, playerStat{
-				id:       id,
-				winRate:  winRate,
-				gamesWon: stats.GamesWon,
+				id:         id,
+				winRate:    winRate,
+				gamesWon:   stats.GamesWon,
+				totalScore: stats.TotalScore,
 			})
 		}
 	}
@@ -408,80 +678,146 @@ func (ga *GameAnalytics) GetTopPlayers(n int) []struct {
 	playerStats = playerStats[:n]
 
 	// Convert to return format
-	result := make([]struct {
-		PlayerID int
-		WinRate  float64
-		GamesWon int
-	}, len(playerStats))
-
+	result := make([]PlayerRanking, len(playerStats))
 	for i, p := range playerStats {
-		result[i] = struct {
-			PlayerID int
-			WinRate  float64
-			GamesWon int
-		}{
-			PlayerID: p.id,
-			WinRate:  p.winRate,
-			GamesWon: p.gamesWon,
+		result[i] = PlayerRanking{
+			PlayerID:   p.id,
+			WinRate:    p.winRate,
+			GamesWon:   p.gamesWon,
+			TotalScore: p.totalScore,
 		}
 	}
 
 	return result
 }
 
-// GetAnalyticsReport generates a formatted analytics report
-func (ga *GameAnalytics) GetAnalyticsReport() string {
-	overallStats := ga.GetOverallStats()
-	hardestNumbers := ga.GetHardestNumbers(5)
-	mostCommonGuesses := ga.GetMostCommonGuesses(5)
-	topPlayers := ga.GetTopPlayers(5)
-
-	report := "=== CODE BREAKER GAME ANALYTICS ===\n\n"
-
-	// Overall stats
-	report += fmt.Sprintf("OVERALL STATISTICS:\n")
-	report += fmt.Sprintf("Games Played: %d\n", overallStats.GamesPlayed)
-	report += fmt.Sprintf("Games Won: %d (%.1f%%)\n", overallStats.GamesWon, float64(overallStats.GamesWon)/float64(overallStats.GamesPlayed)*100)
-	report += fmt.Sprintf("Average Guesses Per Game: %.2f\n", overallStats.AvgGuessesPerGame)
-	report += fmt.Sprintf("Average Guesses Per Win: %.2f\n", overallStats.AvgGuessesPerWin)
-	report += fmt.Sprintf("Total Unique Players: %d\n", overallStats.TotalPlayers)
-	report += fmt.Sprintf("Average Players Per Game: %.2f\n", overallStats.AvgPlayersPerGame)
-	report += fmt.Sprintf("Average Game Duration: %s\n\n", overallStats.AvgGameDuration.Round(time.Second))
-
-	// Hardest numbers
-	report += fmt.Sprintf("TOP 5 HARDEST NUMBERS TO GUESS:\n")
-	if len(hardestNumbers) == 0 {
-		report += "No data available yet\n"
-	} else {
-		for i, num := range hardestNumbers {
-			report += fmt.Sprintf("%d. Number %d - %.2f guesses on average (appeared %d times)\n",
-				i+1, num.Number, num.AvgGuesses, num.Frequency)
+// GetTopDailyStreaks returns the N players with the longest current daily
+// challenge streaks
+func (ga *GameAnalytics) GetTopDailyStreaks(n int) []struct {
+	PlayerID   int
+	Streak     int
+	BestStreak int
+} {
+	ga.mu.RLock()
+	defer ga.mu.RUnlock()
+
+	streaks := make([]struct {
+		PlayerID   int
+		Streak     int
+		BestStreak int
+	}, 0)
+
+	for id, stats := range ga.playerStats {
+		if stats.BestDailyStreak > 0 {
+			streaks = append(streaks, struct {
+				PlayerID   int
+				Streak     int
+				BestStreak int
+			}{
+				PlayerID:   id,
+				Streak:     stats.DailyStreak,
+				BestStreak: stats.BestDailyStreak,
+			})
+		}
+	}
+
+	// Sort by current streak (descending), then by best streak and ID
+	sort.Slice(streaks, func(i, j int) bool {
+		if streaks[i].Streak != streaks[j].Streak {
+			return streaks[i].Streak > streaks[j].Streak
+		}
+		if streaks[i].BestStreak != streaks[j].BestStreak {
+			return streaks[i].BestStreak > streaks[j].BestStreak
 		}
+		return streaks[i].PlayerID < streaks[j].PlayerID
+	})
+
+	// Take top N
+	if n > len(streaks) {
+		n = len(streaks)
 	}
-	report += "\n"
+	return streaks[:n]
+}
 
-	// Most common guesses
-	report += fmt.Sprintf("TOP 5 MOST COMMON GUESSES:\n")
-	if len(mostCommonGuesses) == 0 {
-		report += "No data available yet\n"
-	} else {
-		for i, guess := range mostCommonGuesses {
-			report += fmt.Sprintf("%d. %d - guessed %d times\n",
-				i+1, guess.Guess, guess.Frequency)
+// GetTopTeams returns the top N teams by win rate
+func (ga *GameAnalytics) GetTopTeams(n int) []struct {
+	Name       string
+	WinRate    float64
+	GamesWon   int
+	TotalScore int
+} {
+	ga.mu.RLock()
+	defer ga.mu.RUnlock()
+
+	teams := make([]struct {
+		Name       string
+		WinRate    float64
+		GamesWon   int
+		TotalScore int
+	}, 0, len(ga.teamStats))
+
+	for name, stats := range ga.teamStats {
+		if stats.GamesPlayed > 0 {
+			teams = append(teams, struct {
+				Name       string
+				WinRate    float64
+				GamesWon   int
+				TotalScore int
+			}{
+				Name:       name,
+				WinRate:    float64(stats.GamesWon) / float64(stats.GamesPlayed),
+				GamesWon:   stats.GamesWon,
+				TotalScore: stats.TotalScore,
+			})
 		}
 	}
-	report += "\n"
 
-	// Top players
-	report += fmt.Sprintf("TOP 5 PLAYERS BY WIN RATE:\n")
-	if len(topPlayers) == 0 {
-		report += "No data available yet\n"
-	} else {
-		for i, player := range topPlayers {
-			report += fmt.Sprintf("%d. Player %d - %.1f%% win rate (%d wins)\n",
-				i+1, player.PlayerID, player.WinRate*100, player.GamesWon)
+	// Sort by win rate (descending), then by wins and name
+	sort.Slice(teams, func(i, j int) bool {
+		if teams[i].WinRate != teams[j].WinRate {
+			return teams[i].WinRate > teams[j].WinRate
 		}
+		if teams[i].GamesWon != teams[j].GamesWon {
+			return teams[i].GamesWon > teams[j].GamesWon
+		}
+		return teams[i].Name < teams[j].Name
+	})
+
+	// Take top N
+	if n > len(teams) {
+		n = len(teams)
 	}
+	return teams[:n]
+}
 
-	return report
+// GetAnalyticsReport generates a formatted analytics report of all the
+// games, with the sections only the all-time totals have
+func (ga *GameAnalytics) GetAnalyticsReport() string {
+	var report strings.Builder
+	writeReport(&report, TimeRange{}, ga.GetOverallStats(), ga.GetHardestNumbers(5), ga.GetMostCommonGuesses(5),
+		ga.GetTopPlayers(5))
+
+	// Codes chosen by duel players
+	lines := make([]string, 0)
+	for _, code := range ga.GetMostChosenSecrets(5) {
+		lines = append(lines, fmt.Sprintf("%04d - chosen %d times", code.Code, code.Frequency))
+	}
+	writeSection(&report, "TOP 5 PLAYER-CHOSEN SECRETS (DUELS)", lines)
+
+	// Top teams
+	lines = make([]string, 0)
+	for _, team := range ga.GetTopTeams(5) {
+		lines = append(lines, fmt.Sprintf("Team %s - %.1f%% win rate (%d wins, %d points)",
+			team.Name, team.WinRate*100, team.GamesWon, team.TotalScore))
+	}
+	writeSection(&report, "TOP 5 TEAMS BY WIN RATE", lines)
+
+	// Daily challenge streaks
+	lines = make([]string, 0)
+	for _, streak := range ga.GetTopDailyStreaks(5) {
+		lines = append(lines, fmt.Sprintf("Player %d - %d day streak (best %d)",
+			streak.PlayerID, streak.Streak, streak.BestStreak))
+	}
+	writeSection(&report, "TOP 5 DAILY CHALLENGE STREAKS", lines)
+	return report.String()
 }
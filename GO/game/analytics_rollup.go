@@ -0,0 +1,218 @@
+package game
+
+import (
+	"time"
+)
+
+// DefaultRecentGames is how many finished games analytics keeps whole, for
+// exports and exact time-range queries, before rolling them up
+const DefaultRecentGames = 10000
+
+// Games are rolled up by the hour they started, and rollups older than
+// hourlyRollupRetention are merged by the day, so a year of play takes a
+// week of hourly rollups and a year of daily ones
+const hourlyRollupRetention = 7 * 24 * time.Hour
+
+// analyticsRecentGames is how many games InitAnalytics keeps whole
+var analyticsRecentGames = DefaultRecentGames
+
+// ConfigureAnalytics sets how many finished games the server's analytics
+// keep whole before rolling them up; older games still count in every
+// total and time-range query, at the resolution of an hour or a day
+func ConfigureAnalytics(recentGames int) {
+	analyticsRecentGames = max(recentGames, 0)
+	if globalAnalytics != nil {
+		globalAnalytics.SetRecentLimit(analyticsRecentGames)
+	}
+}
+
+// SetRecentLimit sets how many finished games are kept whole, rolling up
+// any beyond that straight away
+func (ga *GameAnalytics) SetRecentLimit(recentGames int) {
+	ga.mu.Lock()
+	defer ga.mu.Unlock()
+
+	ga.recentLimit = recentGames
+	ga.rollUpLocked(time.Now())
+}
+
+// secretTally counts the won games of a secret code
+type secretTally struct {
+	wins    int // Games won
+	guesses int // Guesses they took
+}
+
+// playerTally is a player's record in the games of a rollup
+type playerTally struct {
+	played int // Finished games played
+	won    int // Of those, games won, alone or with a team
+	score  int // Points scored
+}
+
+// rollupKey names the hour or day whose games a rollup sums up
+type rollupKey struct {
+	start time.Time     // Start of the hour or day, in UTC
+	size  time.Duration // An hour or a day
+}
+
+// rollup sums up the games that started in an hour or a day, keeping what
+// the time-range queries need once the games themselves are gone. Its maps
+// are bounded by the number of codes and of player IDs, not of games.
+type rollup struct {
+	totals   AnalyticsSummary     // Totals of the games
+	finished int                  // Games that have ended
+	secrets  map[int]*secretTally // Won games by secret code, not counting duels
+	guesses  map[int]int          // Count of each guess made
+	players  map[int]*playerTally // Records by player ID
+}
+
+// newRollup creates an empty rollup
+func newRollup() *rollup {
+	return &rollup{
+		secrets: make(map[int]*secretTally),
+		guesses: make(map[int]int),
+		players: make(map[int]*playerTally),
+	}
+}
+
+// player returns the record of a player, adding it if needed
+func (r *rollup) player(playerID int) *playerTally {
+	tally, exists := r.players[playerID]
+	if !exists {
+		tally = &playerTally{}
+		r.players[playerID] = tally
+	}
+	return tally
+}
+
+// addGame adds a game to the rollup. As in the all-time player stats, a game
+// counts toward the players' records once it has ended, and a team's win
+// counts for every member.
+func (r *rollup) addGame(game *GameStats) {
+	r.totals.GamesPlayed++
+	r.totals.TotalGuesses += game.GuessCount
+	r.totals.PlayerSlots += game.PlayerCount
+	if game.Lost {
+		r.totals.GamesLost++
+	}
+	if game.Won {
+		r.totals.GamesWon++
+		r.totals.WinGuesses += game.GuessCount
+		if !game.Duel {
+			tally, exists := r.secrets[game.SecretCode]
+			if !exists {
+				tally = &secretTally{}
+				r.secrets[game.SecretCode] = tally
+			}
+			tally.wins++
+			tally.guesses += game.GuessCount
+		}
+	}
+
+	for playerID, guesses := range game.PlayerGuesses {
+		for _, guess := range guesses {
+			r.guesses[guess]++
+		}
+		r.player(playerID)
+	}
+	for playerID, points := range game.PlayerScores {
+		r.player(playerID).score += points
+	}
+	if game.EndTime.IsZero() {
+		return
+	}
+	r.finished++
+	r.totals.TotalDuration += game.EndTime.Sub(game.StartTime)
+	for playerID := range game.PlayerGuesses {
+		r.player(playerID).played++
+	}
+	if game.WinningTeam != "" {
+		for _, playerID := range game.Teams[game.WinningTeam] {
+			r.player(playerID).won++
+		}
+	} else if game.WinnerID > 0 {
+		r.player(game.WinnerID).won++
+	}
+}
+
+// merge adds the games of another rollup to this one, with their secrets
+// and guesses if codes is set
+func (r *rollup) merge(other *rollup, codes bool) {
+	r.totals.Add(other.totals)
+	r.finished += other.finished
+	for playerID, tally := range other.players {
+		mine := r.player(playerID)
+		mine.played += tally.played
+		mine.won += tally.won
+		mine.score += tally.score
+	}
+	if !codes {
+		return
+	}
+	for code, tally := range other.secrets {
+		mine, exists := r.secrets[code]
+		if !exists {
+			mine = &secretTally{}
+			r.secrets[code] = mine
+		}
+		mine.wins += tally.wins
+		mine.guesses += tally.guesses
+	}
+	for guess, count := range other.guesses {
+		r.guesses[guess] += count
+	}
+}
+
+// rollUpLocked rolls the oldest finished games out of gameHistory until at
+// most recentLimit are left, and merges hourly rollups older than
+// hourlyRollupRetention into daily ones; the caller must hold ga.mu. Games
+// still being played are passed over and kept, however long they last.
+func (ga *GameAnalytics) rollUpLocked(now time.Time) {
+	excess := len(ga.gameHistory) - ga.openGames - ga.recentLimit
+	var open []*GameStats
+	rolled := 0
+	for ; excess > 0; rolled++ {
+		game := ga.gameHistory[rolled]
+		if game.EndTime.IsZero() {
+			open = append(open, game)
+			continue
+		}
+		ga.rollupFor(game.StartTime, now).addGame(game)
+		excess--
+	}
+	if rolled > 0 {
+		// The open games passed over move up to just before the games left
+		start := rolled - len(open)
+		clear(ga.gameHistory[:start])
+		copy(ga.gameHistory[start:rolled], open)
+		ga.gameHistory = ga.gameHistory[start:]
+	}
+
+	hour := now.UTC().Truncate(time.Hour)
+	if hour.Equal(ga.compacted) {
+		return
+	}
+	ga.compacted = hour
+	for key, hourly := range ga.rollups {
+		if key.size == time.Hour && key.start.Before(now.Add(-hourlyRollupRetention)) {
+			delete(ga.rollups, key)
+			ga.rollupFor(key.start, now).merge(hourly, true)
+		}
+	}
+}
+
+// rollupFor returns the rollup of games that started at start: hourly for
+// recent ones and daily for those older than hourlyRollupRetention
+func (ga *GameAnalytics) rollupFor(start time.Time, now time.Time) *rollup {
+	size := time.Hour
+	if start.Before(now.Add(-hourlyRollupRetention)) {
+		size = 24 * time.Hour
+	}
+	key := rollupKey{start: start.UTC().Truncate(size), size: size}
+	r, exists := ga.rollups[key]
+	if !exists {
+		r = newRollup()
+		ga.rollups[key] = r
+	}
+	return r
+}
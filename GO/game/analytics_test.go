@@ -0,0 +1,185 @@
+package game
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// playAnalyticsGame records a finished game: player 1 cracks the code in
+// one guess when won is set, and player 2 guesses wrong twice otherwise
+func playAnalyticsGame(ga *GameAnalytics, secret int, started time.Time, won bool) *GameStats {
+	stats := ga.StartGame(secret, 2)
+	stats.StartTime = started
+	if won {
+		ga.RecordGuess(stats, 1, secret, secret)
+		ga.EndGame(stats, 1)
+	} else {
+		ga.RecordGuess(stats, 2, 9999, secret)
+		ga.RecordGuess(stats, 2, 9999, secret)
+		ga.EndGameLost(stats)
+	}
+	return stats
+}
+
+func TestGameAnalytics_RolledUpGamesStillCount(t *testing.T) {
+	ga := NewGameAnalytics()
+	ga.SetRecentLimit(2)
+	now := time.Now()
+	for i := 0; i < 6; i++ {
+		playAnalyticsGame(ga, 1000+i%2, now.Add(-time.Duration(6-i)*time.Minute), i%2 == 0)
+	}
+	// The last game is rolled up once the next one starts
+	ga.SetRecentLimit(2)
+	assert.Len(t, ga.gameHistory, 2)
+
+	stats := ga.GetOverallStats()
+	assert.Equal(t, 6, stats.GamesPlayed)
+	assert.Equal(t, 3, stats.GamesWon)
+	assert.Equal(t, 3, stats.GamesLost)
+	assert.Equal(t, 1.5, stats.AvgGuessesPerGame)
+	assert.Equal(t, 2, stats.TotalPlayers)
+
+	// Time-range queries see the rolled-up games too
+	windowed := ga.OverallStatsIn(LastWindow(time.Hour, now))
+	assert.Equal(t, stats.GamesPlayed, windowed.GamesPlayed)
+	assert.Equal(t, stats.AvgGuessesPerGame, windowed.AvgGuessesPerGame)
+	assert.Equal(t, []NumberStat{{Number: 1000, AvgGuesses: 1, Frequency: 3}}, ga.HardestNumbersIn(TimeRange{}, 5))
+	assert.Equal(t, []GuessFrequency{{Guess: 9999, Frequency: 6}}, ga.CommonGuessesIn(TimeRange{}, 1))
+	assert.Equal(t, PlayerRanking{PlayerID: 1, WinRate: 1, GamesWon: 3}, ga.TopPlayersIn(TimeRange{}, 5)[0])
+	assert.Equal(t, 6, sumGames(ga.WinRatePerDay(TimeRange{})))
+
+	// Only the recent games can be exported
+	assert.Len(t, ga.GameRows(TimeRange{}), 2)
+}
+
+// sumGames adds up the games of some buckets
+func sumGames(buckets []TimeBucket) int {
+	games := 0
+	for _, bucket := range buckets {
+		games += bucket.Games
+	}
+	return games
+}
+
+func TestGameAnalytics_KeepsGamesBeingPlayed(t *testing.T) {
+	ga := NewGameAnalytics()
+	ga.SetRecentLimit(2)
+	playing := ga.StartGame(1234, 1)
+	for i := 0; i < 100; i++ {
+		playAnalyticsGame(ga, 5678, time.Now(), true)
+	}
+	// The game being played is kept, while the games finished after it
+	// still roll up
+	assert.Len(t, ga.gameHistory, 3)
+	assert.Same(t, playing, ga.gameHistory[0])
+
+	// Once it ends it rolls up in turn
+	ga.EndGame(playing, 0)
+	assert.Len(t, ga.gameHistory, 2)
+	assert.NotContains(t, ga.gameHistory, playing)
+	assert.Equal(t, 101, ga.GetOverallStats().GamesPlayed)
+	assert.Equal(t, 101, ga.OverallStatsIn(TimeRange{}).GamesPlayed)
+}
+
+func TestGameAnalytics_CompactsOldHourlyRollups(t *testing.T) {
+	ga := NewGameAnalytics()
+	ga.SetRecentLimit(0)
+	now := time.Now()
+	playAnalyticsGame(ga, 1234, now.Add(-2*time.Hour), true)
+	playAnalyticsGame(ga, 1234, now.Add(-90*time.Minute), false)
+	playAnalyticsGame(ga, 1234, now.Add(-10*24*time.Hour), true)
+	ga.SetRecentLimit(0)
+	assert.Empty(t, ga.gameHistory)
+
+	sizes := func() map[time.Duration]int {
+		counts := make(map[time.Duration]int)
+		for key := range ga.rollups {
+			counts[key.size]++
+		}
+		return counts
+	}
+	assert.Equal(t, 1, sizes()[24*time.Hour])
+	assert.GreaterOrEqual(t, sizes()[time.Hour], 1)
+
+	// A week later the hourly rollups are merged by the day
+	ga.mu.Lock()
+	ga.rollUpLocked(now.Add(8 * 24 * time.Hour))
+	ga.mu.Unlock()
+	assert.Equal(t, 0, sizes()[time.Hour])
+	assert.Equal(t, 3, ga.OverallStatsIn(TimeRange{}).GamesPlayed)
+	assert.Equal(t, 3, sumGames(ga.WinRatePerDay(TimeRange{})))
+}
+
+func TestGameAnalytics_MemoryStaysBounded(t *testing.T) {
+	ga := NewGameAnalytics()
+	ga.SetRecentLimit(100)
+	now := time.Now()
+	for i := 0; i < 20000; i++ {
+		playAnalyticsGame(ga, i%10000, now.Add(time.Duration(i)*time.Second), i%3 == 0)
+	}
+	assert.LessOrEqual(t, len(ga.gameHistory), 100)
+	// 20000 seconds of games fall in at most 7 hourly rollups
+	assert.LessOrEqual(t, len(ga.rollups), 7)
+	assert.Equal(t, 20000, ga.Summary().GamesPlayed)
+	assert.Equal(t, 20000, ga.OverallStatsIn(TimeRange{}).GamesPlayed)
+}
+
+// benchmarkAnalytics returns analytics that have recorded the given number
+// of games, spread over the last week
+func benchmarkAnalytics(b *testing.B, games int) *GameAnalytics {
+	b.Helper()
+	ga := NewGameAnalytics()
+	start := time.Now().Add(-7 * 24 * time.Hour)
+	step := 7 * 24 * time.Hour / time.Duration(games)
+	for i := 0; i < games; i++ {
+		playAnalyticsGame(ga, i%10000, start.Add(time.Duration(i)*step), i%3 != 0)
+	}
+	return ga
+}
+
+// BenchmarkGameAnalytics_OverallStats shows that the all-time stats take the
+// same time however many games have been played
+func BenchmarkGameAnalytics_OverallStats(b *testing.B) {
+	for _, games := range []int{1000, 100000, 1000000} {
+		b.Run(fmt.Sprintf("games=%d", games), func(b *testing.B) {
+			ga := benchmarkAnalytics(b, games)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				ga.GetOverallStats()
+				ga.Summary()
+			}
+		})
+	}
+}
+
+// BenchmarkGameAnalytics_AnalyticsReport measures the admin stats command,
+// bounded by the number of codes and players rather than of games
+func BenchmarkGameAnalytics_AnalyticsReport(b *testing.B) {
+	for _, games := range []int{1000, 100000, 1000000} {
+		b.Run(fmt.Sprintf("games=%d", games), func(b *testing.B) {
+			ga := benchmarkAnalytics(b, games)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				ga.GetAnalyticsReport()
+			}
+		})
+	}
+}
+
+// BenchmarkGameAnalytics_LastDay measures a rolling-window query, bounded by
+// the recent games kept whole and the number of rollups
+func BenchmarkGameAnalytics_LastDay(b *testing.B) {
+	for _, games := range []int{1000, 100000, 1000000} {
+		b.Run(fmt.Sprintf("games=%d", games), func(b *testing.B) {
+			ga := benchmarkAnalytics(b, games)
+			window := LastWindow(24*time.Hour, time.Now())
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				ga.OverallStatsIn(window)
+			}
+		})
+	}
+}
@@ -0,0 +1,421 @@
+package game
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// rangeDateFormat is the layout of a date-only time range bound
+const rangeDateFormat = "2006-01-02"
+
+// rollingWindows are the rolling windows the admin stats command knows
+var rollingWindows = map[string]time.Duration{
+	"hour": time.Hour,
+	"day":  24 * time.Hour,
+	"week": 7 * 24 * time.Hour,
+}
+
+// TimeRange picks games by when they started: at or after From and before
+// To. A zero bound is unbounded, so the zero TimeRange picks every game.
+type TimeRange struct {
+	From time.Time
+	To   time.Time
+}
+
+// LastWindow returns the rolling window of length d ending at now
+func LastWindow(d time.Duration, now time.Time) TimeRange {
+	return TimeRange{From: now.Add(-d), To: now}
+}
+
+// includes reports whether a game that started at start is in the range
+func (r TimeRange) includes(start time.Time) bool {
+	return (r.From.IsZero() || !start.Before(r.From)) && (r.To.IsZero() || start.Before(r.To))
+}
+
+// Describe presents the range for a report
+func (r TimeRange) Describe() string {
+	format := func(t time.Time) string { return t.UTC().Format("2006-01-02 15:04 UTC") }
+	switch {
+	case r.From.IsZero() && r.To.IsZero():
+		return "all time"
+	case r.To.IsZero():
+		return "since " + format(r.From)
+	case r.From.IsZero():
+		return "before " + format(r.To)
+	default:
+		return format(r.From) + " to " + format(r.To)
+	}
+}
+
+// ParseTimeRange reads a time range from up to two bounds, each an RFC 3339
+// time, a date (a whole day, in UTC) or "-" for unbounded
+func ParseTimeRange(bounds []string) (TimeRange, error) {
+	var period TimeRange
+	if len(bounds) > 2 {
+		return period, fmt.Errorf("expected at most two times, got %d", len(bounds))
+	}
+	for i, bound := range bounds {
+		if bound == "-" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, bound)
+		if err != nil {
+			day, dayErr := time.Parse(rangeDateFormat, bound)
+			if dayErr != nil {
+				return period, fmt.Errorf("invalid time %q; use 2006-01-02 or 2006-01-02T15:04:05Z", bound)
+			}
+			t = day
+			if i == 1 {
+				// A date ends the range after that whole day
+				t = day.AddDate(0, 0, 1)
+			}
+		}
+		if i == 0 {
+			period.From = t
+		} else {
+			period.To = t
+		}
+	}
+	if !period.From.IsZero() && !period.To.IsZero() && !period.From.Before(period.To) {
+		return period, fmt.Errorf("the range ends before it starts")
+	}
+	return period, nil
+}
+
+// OverallStats are the totals and averages of the games, all of them or
+// those in a time range
+type OverallStats struct {
+	GamesPlayed       int
+	GamesWon          int
+	GamesLost         int
+	AvgGuessesPerGame float64
+	AvgGuessesPerWin  float64
+	TotalPlayers      int
+	AvgPlayersPerGame float64
+	TotalDuration     time.Duration
+	AvgGameDuration   time.Duration
+}
+
+// NumberStat tells how many guesses a secret code took to crack on average
+type NumberStat struct {
+	Number     int
+	AvgGuesses float64
+	Frequency  int
+}
+
+// GuessFrequency tells how often a code was guessed
+type GuessFrequency struct {
+	Guess     int
+	Frequency int
+}
+
+// PlayerRanking is a player's record, over all their games or those in a
+// time range
+type PlayerRanking struct {
+	PlayerID   int
+	WinRate    float64
+	GamesWon   int
+	TotalScore int
+}
+
+// TimeBucket counts the games that started in one hour or day
+type TimeBucket struct {
+	Start    time.Time // Start of the bucket, in UTC
+	Games    int       // Games started
+	Finished int       // Of those, games that have ended
+	Won      int       // Of those, games someone won
+}
+
+// WinRate is the share of the bucket's finished games that someone won
+func (b TimeBucket) WinRate() float64 {
+	if b.Finished == 0 {
+		return 0
+	}
+	return float64(b.Won) / float64(b.Finished)
+}
+
+// rollupIn sums up the games that started in the range: the recent ones
+// exactly, and the rolled-up ones by the hour or day they started in.
+// Unless codes is set, the rolled-up secrets and guesses are left out.
+func (ga *GameAnalytics) rollupIn(period TimeRange, codes bool) *rollup {
+	ga.mu.RLock()
+	defer ga.mu.RUnlock()
+
+	total := newRollup()
+	for key, r := range ga.rollups {
+		if period.includes(key.start) {
+			total.merge(r, codes)
+		}
+	}
+	for _, game := range ga.gameHistory {
+		if period.includes(game.StartTime) {
+			total.addGame(game)
+		}
+	}
+	return total
+}
+
+// OverallStatsIn returns the totals and averages of the games that started
+// in the range
+func (ga *GameAnalytics) OverallStatsIn(period TimeRange) OverallStats {
+	games := ga.rollupIn(period, false)
+	totals := games.totals
+
+	result := OverallStats{
+		GamesPlayed:   totals.GamesPlayed,
+		GamesWon:      totals.GamesWon,
+		GamesLost:     totals.GamesLost,
+		TotalPlayers:  len(games.players),
+		TotalDuration: totals.TotalDuration,
+	}
+	if totals.GamesPlayed > 0 {
+		result.AvgGuessesPerGame = float64(totals.TotalGuesses) / float64(totals.GamesPlayed)
+		result.AvgPlayersPerGame = float64(totals.PlayerSlots) / float64(totals.GamesPlayed)
+		result.AvgGameDuration = totals.TotalDuration / time.Duration(totals.GamesPlayed)
+	}
+	if totals.GamesWon > 0 {
+		result.AvgGuessesPerWin = float64(totals.WinGuesses) / float64(totals.GamesWon)
+	}
+	return result
+}
+
+// HardestNumbersIn returns the N secret codes that took the most guesses to
+// crack in the games that started in the range
+func (ga *GameAnalytics) HardestNumbersIn(period TimeRange, n int) []NumberStat {
+	secrets := ga.rollupIn(period, true).secrets
+
+	stats := make([]NumberStat, 0, len(secrets))
+	for code, tally := range secrets {
+		stats = append(stats, NumberStat{Number: code, Frequency: tally.wins,
+			AvgGuesses: float64(tally.guesses) / float64(tally.wins)})
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].AvgGuesses == stats[j].AvgGuesses {
+			return stats[i].Number < stats[j].Number
+		}
+		return stats[i].AvgGuesses > stats[j].AvgGuesses
+	})
+	return stats[:min(n, len(stats))]
+}
+
+// CommonGuessesIn returns the N codes guessed most often in the games that
+// started in the range
+func (ga *GameAnalytics) CommonGuessesIn(period TimeRange, n int) []GuessFrequency {
+	counts := ga.rollupIn(period, true).guesses
+
+	guesses := make([]GuessFrequency, 0, len(counts))
+	for guess, count := range counts {
+		guesses = append(guesses, GuessFrequency{Guess: guess, Frequency: count})
+	}
+	sort.Slice(guesses, func(i, j int) bool {
+		if guesses[i].Frequency == guesses[j].Frequency {
+			return guesses[i].Guess < guesses[j].Guess
+		}
+		return guesses[i].Frequency > guesses[j].Frequency
+	})
+	return guesses[:min(n, len(guesses))]
+}
+
+// TopPlayersIn returns the N players with the best win rate in the games
+// that started in the range. As in the all-time stats, a game counts once
+// it has ended, and a team's win counts for every member.
+func (ga *GameAnalytics) TopPlayersIn(period TimeRange, n int) []PlayerRanking {
+	players := ga.rollupIn(period, false).players
+
+	rankings := make([]PlayerRanking, 0, len(players))
+	for playerID, record := range players {
+		if record.played > 0 {
+			rankings = append(rankings, PlayerRanking{PlayerID: playerID, GamesWon: record.won,
+				WinRate: float64(record.won) / float64(record.played), TotalScore: record.score})
+		}
+	}
+	sort.Slice(rankings, func(i, j int) bool {
+		if rankings[i].WinRate != rankings[j].WinRate {
+			return rankings[i].WinRate > rankings[j].WinRate
+		}
+		if rankings[i].GamesWon != rankings[j].GamesWon {
+			return rankings[i].GamesWon > rankings[j].GamesWon
+		}
+		return rankings[i].PlayerID < rankings[j].PlayerID
+	})
+	return rankings[:min(n, len(rankings))]
+}
+
+// GamesPerHour counts the games that started in the range in each hour,
+// from the range's start (or the first game) to its end (or the last game)
+func (ga *GameAnalytics) GamesPerHour(period TimeRange) []TimeBucket {
+	return ga.bucketGames(period, time.Hour)
+}
+
+// WinRatePerDay counts the games that started in the range, and those won,
+// on each day in UTC
+func (ga *GameAnalytics) WinRatePerDay(period TimeRange) []TimeBucket {
+	return ga.bucketGames(period, 24*time.Hour)
+}
+
+// bucketGames counts the games that started in the range in buckets of the
+// given size, including the empty ones. Games rolled up by the day count in
+// the first hour of their day.
+func (ga *GameAnalytics) bucketGames(period TimeRange, size time.Duration) []TimeBucket {
+	ga.mu.RLock()
+	defer ga.mu.RUnlock()
+
+	var first, last time.Time
+	counts := make(map[time.Time]*TimeBucket)
+	count := func(started time.Time, games, finished, won int) {
+		start := started.UTC().Truncate(size)
+		bucket, exists := counts[start]
+		if !exists {
+			bucket = &TimeBucket{Start: start}
+			counts[start] = bucket
+		}
+		bucket.Games += games
+		bucket.Finished += finished
+		bucket.Won += won
+		if first.IsZero() || start.Before(first) {
+			first = start
+		}
+		if start.After(last) {
+			last = start
+		}
+	}
+	for key, r := range ga.rollups {
+		if period.includes(key.start) {
+			count(key.start, r.totals.GamesPlayed, r.finished, r.totals.GamesWon)
+		}
+	}
+	for _, game := range ga.gameHistory {
+		if !period.includes(game.StartTime) {
+			continue
+		}
+		finished, won := 0, 0
+		if !game.EndTime.IsZero() {
+			finished = 1
+		}
+		if game.Won {
+			won = 1
+		}
+		count(game.StartTime, 1, finished, won)
+	}
+
+	if !period.From.IsZero() {
+		first = period.From.UTC().Truncate(size)
+	}
+	if !period.To.IsZero() {
+		last = period.To.Add(-time.Nanosecond).UTC().Truncate(size)
+	}
+	if first.IsZero() || last.IsZero() {
+		return []TimeBucket{}
+	}
+
+	buckets := make([]TimeBucket, 0)
+	for start := first; !start.After(last); start = start.Add(size) {
+		if bucket, exists := counts[start]; exists {
+			buckets = append(buckets, *bucket)
+		} else {
+			buckets = append(buckets, TimeBucket{Start: start})
+		}
+	}
+	return buckets
+}
+
+// GetWindowReport generates an analytics report of the games that started
+// in the range, with games per hour for ranges up to a day and win rate per
+// day for longer ones
+func (ga *GameAnalytics) GetWindowReport(period TimeRange) string {
+	var report strings.Builder
+	writeReport(&report, period, ga.OverallStatsIn(period), ga.HardestNumbersIn(period, 5),
+		ga.CommonGuessesIn(period, 5), ga.TopPlayersIn(period, 5))
+
+	if !period.From.IsZero() && !period.To.IsZero() && period.To.Sub(period.From) <= 24*time.Hour {
+		report.WriteString("\nGAMES PER HOUR:\n")
+		for _, bucket := range ga.GamesPerHour(period) {
+			fmt.Fprintf(&report, "%s  %d\n", bucket.Start.Format("2006-01-02 15:00"), bucket.Games)
+		}
+	} else {
+		report.WriteString("\nWIN RATE PER DAY:\n")
+		buckets := ga.WinRatePerDay(period)
+		if len(buckets) == 0 {
+			report.WriteString("No data available yet\n")
+		}
+		for _, bucket := range buckets {
+			fmt.Fprintf(&report, "%s  %.1f%% of %d finished games\n", bucket.Start.Format(rangeDateFormat),
+				bucket.WinRate()*100, bucket.Finished)
+		}
+	}
+	return report.String()
+}
+
+// writeReport writes the sections every analytics report has, for the games
+// that started in the range
+func writeReport(report *strings.Builder, period TimeRange, overallStats OverallStats, hardestNumbers []NumberStat,
+	commonGuesses []GuessFrequency, topPlayers []PlayerRanking) {
+	fmt.Fprintf(report, "=== CODE BREAKER GAME ANALYTICS (%s) ===\n\n", period.Describe())
+
+	report.WriteString("OVERALL STATISTICS:\n")
+	fmt.Fprintf(report, "Games Played: %d\n", overallStats.GamesPlayed)
+	if overallStats.GamesPlayed > 0 {
+		fmt.Fprintf(report, "Games Won: %d (%.1f%%)\n", overallStats.GamesWon,
+			float64(overallStats.GamesWon)/float64(overallStats.GamesPlayed)*100)
+	} else {
+		fmt.Fprintf(report, "Games Won: %d\n", overallStats.GamesWon)
+	}
+	fmt.Fprintf(report, "Games Lost (out of guesses or time): %d\n", overallStats.GamesLost)
+	fmt.Fprintf(report, "Average Guesses Per Game: %.2f\n", overallStats.AvgGuessesPerGame)
+	fmt.Fprintf(report, "Average Guesses Per Win: %.2f\n", overallStats.AvgGuessesPerWin)
+	fmt.Fprintf(report, "Total Unique Players: %d\n", overallStats.TotalPlayers)
+	fmt.Fprintf(report, "Average Players Per Game: %.2f\n", overallStats.AvgPlayersPerGame)
+	fmt.Fprintf(report, "Average Game Duration: %s\n", overallStats.AvgGameDuration.Round(time.Second))
+
+	lines := make([]string, 0, len(hardestNumbers))
+	for _, num := range hardestNumbers {
+		lines = append(lines, fmt.Sprintf("Number %d - %.2f guesses on average (appeared %d times)",
+			num.Number, num.AvgGuesses, num.Frequency))
+	}
+	writeSection(report, "TOP 5 HARDEST NUMBERS TO GUESS", lines)
+
+	lines = make([]string, 0, len(commonGuesses))
+	for _, guess := range commonGuesses {
+		lines = append(lines, fmt.Sprintf("%d - guessed %d times", guess.Guess, guess.Frequency))
+	}
+	writeSection(report, "TOP 5 MOST COMMON GUESSES", lines)
+
+	lines = make([]string, 0, len(topPlayers))
+	for _, player := range topPlayers {
+		lines = append(lines, fmt.Sprintf("Player %d - %.1f%% win rate (%d wins, %d points)",
+			player.PlayerID, player.WinRate*100, player.GamesWon, player.TotalScore))
+	}
+	writeSection(report, "TOP 5 PLAYERS BY WIN RATE", lines)
+}
+
+// writeSection writes a numbered report section after a blank line, or a
+// note that there is no data yet
+func writeSection(report *strings.Builder, heading string, lines []string) {
+	fmt.Fprintf(report, "\n%s:\n", heading)
+	if len(lines) == 0 {
+		report.WriteString("No data available yet\n")
+	}
+	for i, line := range lines {
+		fmt.Fprintf(report, "%d. %s\n", i+1, line)
+	}
+}
+
+// handleStatsCommand answers the admin command "stats [hour|day|week |
+// <from> [to]]": the all-time report, or the report of a rolling window or
+// time range
+func handleStatsCommand(args []string, now time.Time) string {
+	if len(args) == 0 {
+		return globalAnalytics.GetAnalyticsReport()
+	}
+	if window, ok := rollingWindows[args[0]]; ok && len(args) == 1 {
+		return globalAnalytics.GetWindowReport(LastWindow(window, now))
+	}
+	period, err := ParseTimeRange(args)
+	if err != nil {
+		return fmt.Sprintf("Error: %v\nUsage: stats [hour|day|week] or stats <from> [to], "+
+			"where from and to are dates (2006-01-02) or times (2006-01-02T15:04:05Z) and - leaves one open", err)
+	}
+	return globalAnalytics.GetWindowReport(period)
+}
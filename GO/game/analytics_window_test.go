@@ -0,0 +1,144 @@
+package game
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// testWindowAnalytics returns analytics with games that started at the
+// given times: even ones won by player 1, odd ones lost by player 2
+func testWindowAnalytics(starts ...time.Time) *GameAnalytics {
+	analytics := NewGameAnalytics()
+	for i, start := range starts {
+		stats := analytics.StartGame(1000+i, 1)
+		stats.StartTime = start
+		if i%2 == 0 {
+			analytics.RecordGuess(stats, 1, 1000+i, 1000+i)
+			analytics.EndGame(stats, 1)
+		} else {
+			analytics.RecordGuess(stats, 2, 9999, 1000+i)
+			analytics.RecordGuess(stats, 2, 9999, 1000+i)
+			analytics.EndGameLost(stats)
+		}
+	}
+	return analytics
+}
+
+func TestGameAnalytics_OverallStatsIn(t *testing.T) {
+	now := time.Date(2026, 10, 18, 12, 30, 0, 0, time.UTC)
+	analytics := testWindowAnalytics(now.Add(-10*time.Minute), now.Add(-3*time.Hour), now.Add(-30*time.Hour))
+
+	stats := analytics.OverallStatsIn(LastWindow(time.Hour, now))
+	assert.Equal(t, 1, stats.GamesPlayed)
+	assert.Equal(t, 1, stats.GamesWon)
+	assert.Equal(t, 1.0, stats.AvgGuessesPerGame)
+
+	stats = analytics.OverallStatsIn(LastWindow(24*time.Hour, now))
+	assert.Equal(t, 2, stats.GamesPlayed)
+	assert.Equal(t, 1, stats.GamesLost)
+	assert.Equal(t, 2, stats.TotalPlayers)
+	assert.Equal(t, 1.5, stats.AvgGuessesPerGame)
+
+	// The zero range is all time, as in GetOverallStats
+	all := analytics.GetOverallStats()
+	stats = analytics.OverallStatsIn(TimeRange{})
+	assert.Equal(t, all, stats)
+}
+
+func TestGameAnalytics_RankingsIn(t *testing.T) {
+	now := time.Date(2026, 10, 18, 12, 30, 0, 0, time.UTC)
+	analytics := testWindowAnalytics(now.Add(-10*time.Minute), now.Add(-20*time.Minute), now.Add(-30*time.Hour))
+	lastHour := LastWindow(time.Hour, now)
+
+	assert.Equal(t, []NumberStat{{Number: 1000, AvgGuesses: 1, Frequency: 1}}, analytics.HardestNumbersIn(lastHour, 5))
+	assert.Len(t, analytics.HardestNumbersIn(TimeRange{}, 5), 2)
+	assert.Equal(t, []GuessFrequency{{Guess: 9999, Frequency: 2}}, analytics.CommonGuessesIn(lastHour, 1))
+
+	players := analytics.TopPlayersIn(lastHour, 5)
+	assert.Equal(t, []PlayerRanking{{PlayerID: 1, WinRate: 1, GamesWon: 1}, {PlayerID: 2}}, players)
+	players = analytics.TopPlayersIn(TimeRange{From: now.Add(-31 * time.Hour), To: now.Add(-29 * time.Hour)}, 5)
+	assert.Equal(t, []PlayerRanking{{PlayerID: 1, WinRate: 1, GamesWon: 1}}, players)
+}
+
+func TestGameAnalytics_TopPlayersInCreditsTeams(t *testing.T) {
+	analytics := NewGameAnalytics()
+	stats := analytics.StartGame(1234, 3)
+	analytics.RecordTeams(stats, []Team{{Name: "Red", Members: []int{1, 2}}, {Name: "Blue", Members: []int{3}}})
+	analytics.RecordGuess(stats, 1, 1234, 1234)
+	analytics.EndTeamGame(stats, 1, "Red")
+
+	players := analytics.TopPlayersIn(TimeRange{}, 5)
+	assert.Len(t, players, 3)
+	assert.Equal(t, 1.0, players[1].WinRate)
+	assert.Equal(t, 3, players[2].PlayerID)
+	assert.Equal(t, 0, players[2].GamesWon)
+}
+
+func TestGameAnalytics_GamesPerHourIncludesEmptyHours(t *testing.T) {
+	day := time.Date(2026, 10, 18, 0, 0, 0, 0, time.UTC)
+	analytics := testWindowAnalytics(day.Add(9*time.Hour+5*time.Minute), day.Add(9*time.Hour+50*time.Minute),
+		day.Add(11*time.Hour))
+
+	buckets := analytics.GamesPerHour(TimeRange{})
+	assert.Len(t, buckets, 3)
+	assert.Equal(t, TimeBucket{Start: day.Add(9 * time.Hour), Games: 2, Finished: 2, Won: 1}, buckets[0])
+	assert.Equal(t, 0, buckets[1].Games)
+	assert.Equal(t, 1, buckets[2].Games)
+
+	// A range's bounds set the first and last buckets
+	buckets = analytics.GamesPerHour(TimeRange{From: day.Add(8 * time.Hour), To: day.Add(12 * time.Hour)})
+	assert.Len(t, buckets, 4)
+	assert.Equal(t, day.Add(8*time.Hour), buckets[0].Start)
+	assert.Empty(t, NewGameAnalytics().GamesPerHour(TimeRange{}))
+}
+
+func TestGameAnalytics_WinRatePerDay(t *testing.T) {
+	day := time.Date(2026, 10, 16, 0, 0, 0, 0, time.UTC)
+	analytics := testWindowAnalytics(day.Add(time.Hour), day.Add(2*time.Hour), day.Add(50*time.Hour))
+
+	buckets := analytics.WinRatePerDay(TimeRange{})
+	assert.Len(t, buckets, 3)
+	assert.Equal(t, 0.5, buckets[0].WinRate())
+	assert.Equal(t, 0.0, buckets[1].WinRate())
+	assert.Equal(t, 1.0, buckets[2].WinRate())
+	assert.Equal(t, day.AddDate(0, 0, 2), buckets[2].Start)
+}
+
+func TestParseTimeRange(t *testing.T) {
+	period, err := ParseTimeRange([]string{"2026-10-01", "2026-10-02"})
+	assert.NoError(t, err)
+	assert.Equal(t, time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC), period.From)
+	// A date ends the range after that whole day
+	assert.Equal(t, time.Date(2026, 10, 3, 0, 0, 0, 0, time.UTC), period.To)
+
+	period, err = ParseTimeRange([]string{"-", "2026-10-02T12:00:00Z"})
+	assert.NoError(t, err)
+	assert.True(t, period.From.IsZero())
+	assert.Equal(t, time.Date(2026, 10, 2, 12, 0, 0, 0, time.UTC), period.To)
+
+	_, err = ParseTimeRange([]string{"yesterday"})
+	assert.Error(t, err)
+	_, err = ParseTimeRange([]string{"2026-10-02", "2026-10-01"})
+	assert.Error(t, err)
+}
+
+func TestHandleStatsCommand_RollingWindows(t *testing.T) {
+	saved := globalAnalytics
+	defer func() { globalAnalytics = saved }()
+	now := time.Now()
+	globalAnalytics = testWindowAnalytics(now.Add(-10*time.Minute), now.Add(-3*time.Hour))
+
+	report := handleStatsCommand([]string{"hour"}, now)
+	assert.Contains(t, report, "Games Played: 1\n")
+	assert.Contains(t, report, "GAMES PER HOUR:")
+	report = handleStatsCommand([]string{"week"}, now)
+	assert.Contains(t, report, "Games Played: 2\n")
+	assert.Contains(t, report, "WIN RATE PER DAY:")
+	report = handleStatsCommand(nil, now)
+	assert.Contains(t, report, "=== CODE BREAKER GAME ANALYTICS (all time) ===")
+	assert.Contains(t, report, "Games Played: 2\n")
+	assert.Contains(t, report, "TOP 5 DAILY CHALLENGE STREAKS:")
+	assert.Contains(t, handleStatsCommand([]string{"month"}, now), "Usage: stats")
+}
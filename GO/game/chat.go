@@ -0,0 +1,235 @@
+package game
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+const (
+	sayCommand      = "/say"  // Starts a message for everyone in the session
+	teamChatCommand = "/team" // Starts a message for the sender's teammates only
+
+	maxChatLength  = 200              // Longest chat message in characters
+	chatRateLimit  = 5                // Chat messages a player may send per chatRateWindow
+	chatRateWindow = 10 * time.Second // Window for chatRateLimit
+)
+
+// ChatFilter masks banned words in chat messages. It is safe for concurrent use.
+type ChatFilter struct {
+	mu    sync.RWMutex
+	words map[string]struct{} // Banned words, lower case
+}
+
+// NewChatFilter creates a filter for the given banned words
+func NewChatFilter(words ...string) *ChatFilter {
+	filter := &ChatFilter{words: make(map[string]struct{})}
+	for _, word := range words {
+		filter.Add(word)
+	}
+	return filter
+}
+
+// Add bans a word; it reports false if the word is empty or already banned
+func (f *ChatFilter) Add(word string) bool {
+	word = strings.ToLower(strings.TrimSpace(word))
+	if word == "" {
+		return false
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, exists := f.words[word]; exists {
+		return false
+	}
+	f.words[word] = struct{}{}
+	return true
+}
+
+// Remove lifts the ban on a word; it reports false if the word wasn't banned
+func (f *ChatFilter) Remove(word string) bool {
+	word = strings.ToLower(strings.TrimSpace(word))
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, exists := f.words[word]; !exists {
+		return false
+	}
+	delete(f.words, word)
+	return true
+}
+
+// Words returns the banned words in alphabetical order
+func (f *ChatFilter) Words() []string {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	words := make([]string, 0, len(f.words))
+	for word := range f.words {
+		words = append(words, word)
+	}
+	sort.Strings(words)
+	return words
+}
+
+// Clean replaces every banned word in a message with asterisks. Words are
+// matched whole and regardless of case.
+func (f *ChatFilter) Clean(message string) string {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	if len(f.words) == 0 {
+		return message
+	}
+
+	runes := []rune(message)
+	for start := 0; start < len(runes); {
+		if !isWordRune(runes[start]) {
+			start++
+			continue
+		}
+		end := start
+		for end < len(runes) && isWordRune(runes[end]) {
+			end++
+		}
+		if _, banned := f.words[strings.ToLower(string(runes[start:end]))]; banned {
+			for i := start; i < end; i++ {
+				runes[i] = '*'
+			}
+		}
+		start = end
+	}
+	return string(runes)
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// chatFilter is the profanity filter for all chat, configured by admins
+var chatFilter = NewChatFilter()
+
+// handleChatCommand delivers a chat message sent by a player. It reports
+// false if the text is not a chat command, so it can be treated as a guess or
+// answer instead.
+func handleChatCommand(session *GameSession, player *Player, text string) bool {
+	if message, ok := commandArgument(text, sayCommand); ok {
+		if message, ok = checkChat(session, player, sayCommand, message); ok {
+			session.mutex.Lock()
+			for _, p := range session.players {
+				writeToClient(p.conn, fmt.Sprintf("\n[Chat] %s: %s", player.name, message))
+				sendEvent(p, ProtocolEvent{Type: ProtocolChat, Player: player.name, Text: message})
+			}
+			session.mutex.Unlock()
+		}
+		return true
+	}
+	if message, ok := commandArgument(text, teamChatCommand); ok {
+		if message, ok = checkChat(session, player, teamChatCommand, message); ok {
+			sendTeamChat(session, player, message)
+		}
+		return true
+	}
+	return false
+}
+
+// commandArgument returns the text after a command such as "/say", and
+// whether the text is that command at all
+func commandArgument(text, command string) (string, bool) {
+	if text != command && !strings.HasPrefix(text, command+" ") {
+		return "", false
+	}
+	return strings.TrimSpace(text[len(command):]), true
+}
+
+// checkChat enforces the length and rate limits on a chat message and
+// returns it filtered, or tells the player why it can't be sent
+func checkChat(session *GameSession, player *Player, command, message string) (string, bool) {
+	if message == "" {
+		writeToClient(player.conn, fmt.Sprintf("\nUsage: %s <message>", command))
+		return "", false
+	}
+	if len([]rune(message)) > maxChatLength {
+		writeToClient(player.conn, fmt.Sprintf("\nChat messages can be at most %d characters long.", maxChatLength))
+		return "", false
+	}
+
+	session.mutex.Lock()
+	allowed := player.allowChat(time.Now())
+	session.mutex.Unlock()
+	if !allowed {
+		writeToClient(player.conn, fmt.Sprintf("\nYou are chatting too fast. You can send %d messages every %d seconds.",
+			chatRateLimit, int(chatRateWindow.Seconds())))
+		return "", false
+	}
+	return chatFilter.Clean(message), true
+}
+
+// allowChat reports whether a player may send a chat message at the given
+// time, and if so counts it against their rate limit; the caller must hold
+// session.mutex
+func (player *Player) allowChat(now time.Time) bool {
+	recent := player.chatTimes[:0]
+	for _, sent := range player.chatTimes {
+		if now.Sub(sent) < chatRateWindow {
+			recent = append(recent, sent)
+		}
+	}
+	player.chatTimes = recent
+
+	if len(recent) >= chatRateLimit {
+		return false
+	}
+	player.chatTimes = append(player.chatTimes, now)
+	return true
+}
+
+// handleFilterCommand lets admins view and change the chat filter with
+// "filter", "filter add <word>" and "filter remove <word>"
+func handleFilterCommand(args []string) string {
+	usage := "Usage: filter | filter add <word> | filter remove <word>"
+	switch {
+	case len(args) == 0:
+		words := chatFilter.Words()
+		if len(words) == 0 {
+			return "The chat filter has no banned words."
+		}
+		return "Banned words: " + strings.Join(words, ", ")
+	case len(args) == 2 && args[0] == "add":
+		if !chatFilter.Add(args[1]) {
+			return fmt.Sprintf("%q is already banned.", args[1])
+		}
+		return fmt.Sprintf("Added %q to the chat filter.", args[1])
+	case len(args) == 2 && args[0] == "remove":
+		if !chatFilter.Remove(args[1]) {
+			return fmt.Sprintf("%q is not banned.", args[1])
+		}
+		return fmt.Sprintf("Removed %q from the chat filter.", args[1])
+	default:
+		return usage
+	}
+}
+
+// sendTeamChat sends a message to the sender and their teammates
+func sendTeamChat(session *GameSession, player *Player, message string) {
+	session.mutex.Lock()
+	defer session.mutex.Unlock()
+
+	if session.game.Rules().Mode != ModeTeams {
+		writeToClient(player.conn, "\nTeam chat is only available in team mode.")
+		return
+	}
+	team := session.game.TeamOf(player.id)
+	if team == "" {
+		writeToClient(player.conn, "\nJoin a team before using team chat.")
+		return
+	}
+	for _, id := range session.game.Teammates(player.id) {
+		if teammate := session.playerByID(id); teammate != nil {
+			writeToClient(teammate.conn, fmt.Sprintf("\n[Team %s] %s: %s", team, player.name, message))
+			sendEvent(teammate, ProtocolEvent{Type: ProtocolChat, Player: player.name, Team: team, Text: message})
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package game
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChatFilter_Clean(t *testing.T) {
+	filter := NewChatFilter("darn", "Heck")
+
+	assert.Equal(t, "oh **** it, what the ****!", filter.Clean("oh darn it, what the HECK!"))
+
+	// Only whole words are masked
+	assert.Equal(t, "darned hecklers", filter.Clean("darned hecklers"))
+}
+
+func TestChatFilter_AddRemove(t *testing.T) {
+	filter := NewChatFilter()
+	assert.Equal(t, "darn", filter.Clean("darn"))
+
+	assert.True(t, filter.Add(" Darn "))
+	assert.False(t, filter.Add("darn"))
+	assert.False(t, filter.Add(""))
+	assert.Equal(t, []string{"darn"}, filter.Words())
+	assert.Equal(t, "****", filter.Clean("darn"))
+
+	assert.True(t, filter.Remove("DARN"))
+	assert.False(t, filter.Remove("darn"))
+	assert.Empty(t, filter.Words())
+}
+
+func TestPlayer_AllowChat(t *testing.T) {
+	player := &Player{}
+	start := time.Now()
+
+	for i := 0; i < chatRateLimit; i++ {
+		assert.True(t, player.allowChat(start))
+	}
+	assert.False(t, player.allowChat(start.Add(time.Second)))
+
+	// Older messages stop counting once they leave the window
+	assert.True(t, player.allowChat(start.Add(chatRateWindow)))
+}
+
+func TestCommandArgument(t *testing.T) {
+	message, ok := commandArgument("/say  hello there ", sayCommand)
+	assert.True(t, ok)
+	assert.Equal(t, "hello there", message)
+
+	message, ok = commandArgument("/say", sayCommand)
+	assert.True(t, ok)
+	assert.Equal(t, "", message)
+
+	_, ok = commandArgument("/sayhello", sayCommand)
+	assert.False(t, ok)
+	_, ok = commandArgument("1234", sayCommand)
+	assert.False(t, ok)
+}
@@ -3,20 +3,23 @@ package game
 import (
 	"bufio"
 	"fmt"
-	"net"
 	"os"
 	"strings"
-	"time"
 )
 
 func StartClient(address string) error {
 	// Connect to the server
-	conn, err := net.Dial("tcp", address)
+	conn, err := dialServer(address)
 	if err != nil {
 		return fmt.Errorf("error connecting to server: %v", err)
 	}
 	defer conn.Close()
 
+	// Ask for structured events too, to keep the board for /board and notes
+	if _, err := conn.Write([]byte(eventsCommand + "\n")); err != nil {
+		return fmt.Errorf("error sending message to server: %v", err)
+	}
+
 	fmt.Println("Welcome to the Code Breaker Game! Connecting to server...")
 
 	// Create a reader to capture input from stdin
@@ -24,12 +27,23 @@ func StartClient(address string) error {
 
 	// Use channels to handle incoming server messages in a separate goroutine
 	serverMessages := make(chan string)
+	serverEvents := make(chan []ProtocolEvent)
 	clientErrors := make(chan error)
 	gameOver := false
 	isMyTurn := false // Track if it's this player's turn
 
+	// Heartbeats tell a quiet server (e.g. while waiting for players) from a
+	// dead one
+	var beat heartbeat
+	stop := make(chan struct{})
+	defer close(stop)
+	startClientHeartbeat(conn, &beat, stop, func(err error) {
+		clientErrors <- fmt.Errorf("the server stopped responding: %v", err)
+	})
+
 	// Start goroutine to listen for server messages
 	go func() {
+		var protocol protocolReader
 		for {
 			buffer := make([]byte, 1024)
 			n, err := conn.Read(buffer)
@@ -37,8 +51,23 @@ func StartClient(address string) error {
 				clientErrors <- fmt.Errorf("disconnected from server: %v", err)
 				return
 			}
-
-			message := string(buffer[:n])
+			beat.seen()
+
+			// Events go to the board; the text is shown as before
+			texts, events := protocol.feed(string(buffer[:n]))
+			board := make([]ProtocolEvent, 0, len(events))
+			for _, event := range events {
+				if !answerPing(conn, event) {
+					board = append(board, event)
+				}
+			}
+			if len(board) > 0 {
+				serverEvents <- board
+			}
+			if len(texts) == 0 {
+				continue
+			}
+			message := strings.Join(texts, "\n")
 
 			// Check for game over condition
 			if message == "GAME_OVER" {
@@ -70,11 +99,30 @@ func StartClient(address string) error {
 		}
 	}()
 
+	// Read the player's input in the background so chat can be sent at any time
+	userInputs := make(chan string)
+	go func() {
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				clientErrors <- fmt.Errorf("error reading input: %v", err)
+				return
+			}
+			userInputs <- strings.TrimSpace(line)
+		}
+	}()
+	awaitingInput := false // Whether the server is waiting for a guess or answer
+	history := NewGuessHistory()
+
 	// Start the game loop
 	for {
 		select {
 		case err := <-clientErrors:
 			return err
+		case events := <-serverEvents:
+			for _, event := range events {
+				history.Apply(event)
+			}
 		case message := <-serverMessages:
 			fmt.Println(message)
 
@@ -82,8 +130,6 @@ func StartClient(address string) error {
 			if (isMyTurn && strings.Contains(message, "your turn")) ||
 				strings.Contains(message, "Try again:") ||
 				strings.Contains(message, "play again") {
-				var userInput string
-
 				// Check if this is a time-based prompt
 				if strings.Contains(message, "Time's up!") {
 					fmt.Println("⚠️ You ran out of time on your previous turn!")
@@ -94,35 +140,51 @@ func StartClient(address string) error {
 					fmt.Print("Enter 'yes' to play again or 'no' to quit: ")
 				} else {
 					// Regular guess prompt
-					fmt.Print("Enter your guess (4 digits) or 'exit' to quit: ")
+					fmt.Print("Enter your guess (4 digits), /say <message> to chat, /board for your notes, or 'exit' to quit: ")
 				}
+				awaitingInput = true
+			}
+		case userInput := <-userInputs:
+			// Handle exit command
+			if userInput == "exit" && !gameOver {
+				fmt.Println("Exiting the game.")
+				return nil
+			}
 
-				userInput, err = reader.ReadString('\n')
+			// The board and notes are kept here; the server never sees them
+			if userInput == boardCommand {
+				fmt.Println(history.Board())
+				continue
+			}
+			if isNote, err := history.Note(userInput); isNote {
 				if err != nil {
-					return fmt.Errorf("error reading input: %v", err)
+					fmt.Println(err)
+				} else {
+					fmt.Printf("Digits: %s\n", history.DescribeMarks())
 				}
-				userInput = strings.TrimSpace(userInput)
+				continue
+			}
 
-				// Handle exit command
-				if userInput == "exit" && !gameOver {
-					fmt.Println("Exiting the game.")
-					return nil
+			// Chat goes straight to the server; anything else waits for a prompt
+			isChat := strings.HasPrefix(userInput, "/")
+			if userInput == "" || (!isChat && !awaitingInput) {
+				if userInput != "" {
+					fmt.Println("Please wait for your turn. Use /say <message> to chat in the meantime.")
 				}
+				continue
+			}
 
-				// Send input to server
-				_, err = conn.Write([]byte(userInput))
-				if err != nil {
-					return fmt.Errorf("error sending message to server: %v", err)
-				}
+			// Send input to server
+			_, err = conn.Write([]byte(userInput + "\n"))
+			if err != nil {
+				return fmt.Errorf("error sending message to server: %v", err)
+			}
 
+			if !isChat {
 				// After sending input, it's no longer this player's turn
 				isMyTurn = false
+				awaitingInput = false
 			}
-		case <-time.After(90 * time.Second):
-			// Timeout for safety (in case of deadlock)
-			// This is longer than the server's turn timeout to account for network latency and processing
-			fmt.Println("No response from server in 90 seconds. Please check your connection.")
-			return fmt.Errorf("server response timeout")
 		}
 	}
 }
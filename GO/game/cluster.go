@@ -0,0 +1,558 @@
+package game
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Keys of the state the replicas of a cluster share
+const (
+	clusterPrefix  = "codebreaker:"
+	replicaPrefix  = clusterPrefix + "replica:"  // + replica ID: ReplicaRecord
+	sessionPrefix  = clusterPrefix + "session:"  // + replica ID:session ID: SessionRecord
+	presencePrefix = clusterPrefix + "presence:" // + player name: PresenceRecord
+	lobbyPrefix    = clusterPrefix + "lobby:"    // + lobby: LobbyHost
+)
+
+// Every replica republishes its state every clusterRefreshInterval. What a
+// replica published expires clusterTTL after it stops, so the others take
+// over its lobbies.
+const (
+	clusterRefreshInterval = 10 * time.Second
+	clusterTTL             = 30 * time.Second
+)
+
+// Lobbies of which a cluster has only one, hosted by one of its replicas
+const (
+	LobbyTournament  = "tournament"
+	LobbyMatchmaking = "matchmaking"
+	LobbyDaily       = "daily"
+)
+
+// ClusterOptions configures how a server shares state with the other
+// replicas of its cluster
+type ClusterOptions struct {
+	StateStore string // URL of the shared state, as for OpenStateStore; "memory" for a single server
+	ReplicaID  string // Names this replica; defaults to the host name
+	Advertise  string // Address the other replicas reach this one's game port at; defaults to the host name and port 8080
+}
+
+// ReplicaRecord is what a replica publishes about itself
+type ReplicaRecord struct {
+	ID        string           `json:"id"`
+	Address   string           `json:"address"`
+	Sessions  int              `json:"sessions"` // Games being played
+	Players   int              `json:"players"`  // Players in those games
+	Analytics AnalyticsSummary `json:"analytics"`
+	Updated   time.Time        `json:"updated"`
+}
+
+// SessionRecord is what a replica publishes about a game being played on it
+type SessionRecord struct {
+	ID      int64     `json:"id"`
+	Replica string    `json:"replica"`
+	Mode    string    `json:"mode"`
+	Players []string  `json:"players"`
+	Started time.Time `json:"started"`
+}
+
+// PresenceRecord tells which replica a named player is connected to
+type PresenceRecord struct {
+	Name    string    `json:"name"`
+	Replica string    `json:"replica"`
+	Lobby   string    `json:"lobby"`
+	Since   time.Time `json:"since"`
+}
+
+// LobbyHost tells which replica hosts a lobby
+type LobbyHost struct {
+	Replica string `json:"replica"`
+	Address string `json:"address"`
+}
+
+// Cluster shares this replica's games, players and analytics with the other
+// replicas through a StateStore, and routes the players of a lobby hosted
+// by another replica there
+type Cluster struct {
+	store     StateStore
+	storeName string // How the store was configured, for reports
+	id        string // This replica's ID
+	address   string // Where the other replicas reach this one
+	mutex     sync.Mutex
+	sessions  map[*GameSession]time.Time // Games being played here, and when they started
+	presence  map[string]PresenceRecord  // Named players connected here
+	lobbies   map[string]bool            // Lobbies this replica serves, hosting them or not
+}
+
+// NewCluster creates a replica's view of the cluster sharing store
+func NewCluster(store StateStore, id, address string) *Cluster {
+	return &Cluster{
+		store:     store,
+		storeName: "memory",
+		id:        id,
+		address:   address,
+		sessions:  make(map[*GameSession]time.Time),
+		presence:  make(map[string]PresenceRecord),
+		lobbies:   make(map[string]bool),
+	}
+}
+
+// cluster is this server's view of its cluster; a server on its own is a
+// cluster of one
+var cluster = NewCluster(NewMemoryStore(), "local", "localhost:8080")
+
+// ConfigureCluster opens the shared state store and starts publishing this
+// replica's state to it. It must be called before a server starts.
+func ConfigureCluster(options ClusterOptions) error {
+	store, err := OpenStateStore(options.StateStore)
+	if err != nil {
+		return err
+	}
+	host, _ := os.Hostname()
+	if options.ReplicaID == "" {
+		options.ReplicaID = host
+	}
+	if options.Advertise == "" {
+		options.Advertise = net.JoinHostPort(host, "8080")
+	}
+
+	cluster = NewCluster(store, options.ReplicaID, options.Advertise)
+	if u, err := url.Parse(options.StateStore); err == nil && u.Scheme == "redis" {
+		// Keep the password out of reports
+		cluster.storeName = u.Redacted()
+	}
+	AddHealthCheck("state store", store.Ping)
+	go cluster.run()
+	return nil
+}
+
+// run republishes the replica's state until the process ends
+func (c *Cluster) run() {
+	ticker := time.NewTicker(clusterRefreshInterval)
+	defer ticker.Stop()
+	for {
+		c.refresh()
+		<-ticker.C
+	}
+}
+
+// refresh republishes everything this replica shares, takes over lobbies
+// whose host has gone and learns the addresses of the other replicas
+func (c *Cluster) refresh() {
+	c.mutex.Lock()
+	sessions := make([]*GameSession, 0, len(c.sessions))
+	for session := range c.sessions {
+		sessions = append(sessions, session)
+	}
+	presence := make([]PresenceRecord, 0, len(c.presence))
+	for _, record := range c.presence {
+		presence = append(presence, record)
+	}
+	lobbies := make([]string, 0, len(c.lobbies))
+	for lobby := range c.lobbies {
+		lobbies = append(lobbies, lobby)
+	}
+	c.mutex.Unlock()
+
+	var failed error
+	for _, session := range sessions {
+		if err := c.publishSession(session); err != nil {
+			failed = err
+		}
+	}
+	for _, record := range presence {
+		if err := c.put(presencePrefix+record.Name, record); err != nil {
+			failed = err
+		}
+	}
+	for _, lobby := range lobbies {
+		if _, err := c.lobbyHost(lobby); err != nil {
+			failed = err
+		}
+	}
+	if err := c.publishReplica(); err != nil {
+		failed = err
+	}
+	if replicas, err := c.Replicas(); err == nil {
+		abuseGuard.Trust(peerIPs(replicas, c.id))
+	} else {
+		failed = err
+	}
+	if failed != nil {
+		slog.Warn("Error sharing state with the cluster", logEvent, "cluster_refresh", "error", failed)
+	}
+}
+
+// put stores a record as JSON for clusterTTL
+func (c *Cluster) put(key string, record any) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	return c.store.Set(key, string(data), clusterTTL)
+}
+
+// publishReplica shares the replica's totals
+func (c *Cluster) publishReplica() error {
+	record := ReplicaRecord{ID: c.id, Address: c.address, Updated: time.Now()}
+	c.mutex.Lock()
+	sessions := make([]*GameSession, 0, len(c.sessions))
+	for session := range c.sessions {
+		sessions = append(sessions, session)
+	}
+	c.mutex.Unlock()
+
+	for _, session := range sessions {
+		record.Sessions++
+		session.mutex.Lock()
+		record.Players += len(session.players)
+		session.mutex.Unlock()
+	}
+	if globalAnalytics != nil {
+		record.Analytics = globalAnalytics.Summary()
+	}
+	return c.put(replicaPrefix+c.id, record)
+}
+
+// sessionKey is where a game being played on this replica is registered
+func (c *Cluster) sessionKey(session *GameSession) string {
+	return sessionPrefix + c.id + ":" + strconv.FormatInt(session.id, 10)
+}
+
+// publishSession shares a game being played on this replica
+func (c *Cluster) publishSession(session *GameSession) error {
+	c.mutex.Lock()
+	started := c.sessions[session]
+	c.mutex.Unlock()
+
+	session.mutex.Lock()
+	record := SessionRecord{ID: session.id, Replica: c.id, Mode: session.game.Rules().Mode.String(),
+		Players: playerNames(session), Started: started}
+	if session.singlePlayerMode {
+		record.Mode = "single-player"
+	}
+	session.mutex.Unlock()
+	return c.put(c.sessionKey(session), record)
+}
+
+// sessionStarted registers a game being played on this replica
+func (c *Cluster) sessionStarted(session *GameSession) {
+	c.mutex.Lock()
+	c.sessions[session] = time.Now()
+	c.mutex.Unlock()
+	if err := c.publishSession(session); err != nil {
+		session.logger().Warn("Error registering the session with the cluster", "error", err)
+	}
+}
+
+// sessionFinished unregisters a game, and shares the analytics it added to
+func (c *Cluster) sessionFinished(session *GameSession) {
+	c.mutex.Lock()
+	delete(c.sessions, session)
+	c.mutex.Unlock()
+	if err := c.store.Delete(c.sessionKey(session)); err != nil {
+		session.logger().Warn("Error unregistering the session from the cluster", "error", err)
+	}
+	if err := c.publishReplica(); err != nil {
+		session.logger().Warn("Error sharing analytics with the cluster", "error", err)
+	}
+}
+
+// setPresence records that a named player is connected to this replica
+func (c *Cluster) setPresence(name, lobby string) {
+	record := PresenceRecord{Name: name, Replica: c.id, Lobby: lobby, Since: time.Now()}
+	c.mutex.Lock()
+	c.presence[name] = record
+	c.mutex.Unlock()
+	if err := c.put(presencePrefix+name, record); err != nil {
+		slog.Warn("Error sharing a player's presence with the cluster", "name", name, "error", err)
+	}
+}
+
+// clearPresence records that a named player has left this replica, unless
+// they have connected to another one since
+func (c *Cluster) clearPresence(name string) {
+	c.mutex.Lock()
+	delete(c.presence, name)
+	c.mutex.Unlock()
+
+	var record PresenceRecord
+	if found, err := c.get(presencePrefix+name, &record); err != nil || !found || record.Replica != c.id {
+		return
+	}
+	if err := c.store.Delete(presencePrefix + name); err != nil {
+		slog.Warn("Error clearing a player's presence in the cluster", "name", name, "error", err)
+	}
+}
+
+// get reads a record stored with put, reporting false if there is none
+func (c *Cluster) get(key string, record any) (bool, error) {
+	data, found, err := c.store.Get(key)
+	if err != nil || !found {
+		return false, err
+	}
+	return true, json.Unmarshal([]byte(data), record)
+}
+
+// serveLobby makes this replica serve a lobby: it hosts it unless another
+// replica already does, in which case it routes the lobby's players there
+// and takes over if that replica goes away
+func (c *Cluster) serveLobby(lobby string) {
+	c.mutex.Lock()
+	c.lobbies[lobby] = true
+	c.mutex.Unlock()
+
+	host, err := c.lobbyHost(lobby)
+	switch {
+	case err != nil:
+		slog.Warn("Error finding the host of the lobby; hosting it here", "lobby", lobby, "error", err)
+	case host.Replica == c.id:
+		slog.Info("Hosting the lobby", logEvent, "lobby_hosted", "lobby", lobby)
+	default:
+		slog.Info("The lobby is hosted by another replica; routing its players there", logEvent, "lobby_routed",
+			"lobby", lobby, "host", host.Replica, "address", host.Address)
+	}
+}
+
+// lobbyHost returns the replica hosting a lobby. If none does, this replica
+// becomes the host; if this one does, its claim is renewed.
+func (c *Cluster) lobbyHost(lobby string) (LobbyHost, error) {
+	key := lobbyPrefix + lobby
+	self := LobbyHost{Replica: c.id, Address: c.address}
+	data, err := json.Marshal(self)
+	if err != nil {
+		return LobbyHost{}, err
+	}
+	claimed, err := c.store.SetIfAbsent(key, string(data), clusterTTL)
+	if err != nil {
+		return LobbyHost{}, err
+	}
+	if claimed {
+		return self, nil
+	}
+
+	var host LobbyHost
+	if found, err := c.get(key, &host); err != nil {
+		return LobbyHost{}, err
+	} else if !found {
+		// The claim expired just now; try again next time
+		return self, nil
+	}
+	if host.Replica == c.id {
+		return self, c.store.Set(key, string(data), clusterTTL)
+	}
+	return host, nil
+}
+
+// routeLobby relays a lobby player's connection to the replica hosting the
+// lobby, reporting false if this replica hosts it (or the host can't be
+// found) and should serve the player itself
+func (c *Cluster) routeLobby(conn net.Conn, lobby string) bool {
+	host, err := c.lobbyHost(lobby)
+	if err != nil {
+		slog.Warn("Error finding the host of the lobby; serving the player here", "lobby", lobby, "error", err)
+		return false
+	}
+	if host.Replica == c.id {
+		return false
+	}
+	slog.Debug("Routing a player to the lobby's host", logEvent, "player_routed", "lobby", lobby,
+		"host", host.Replica, "remote", conn.RemoteAddr().String())
+	relay(conn, host.Address)
+	return true
+}
+
+// hostedElsewhere explains where to find a lobby hosted by another
+// replica, or returns "" if this replica hosts it
+func (c *Cluster) hostedElsewhere(lobby string) string {
+	host, err := c.lobbyHost(lobby)
+	if err != nil || host.Replica == c.id {
+		return ""
+	}
+	return fmt.Sprintf("The %s is hosted by replica %s (%s). Connect the admin client to that replica.",
+		lobby, host.Replica, host.Address)
+}
+
+// relay copies everything between a player's connection and another
+// replica's game port until either side closes
+func relay(conn net.Conn, address string) {
+	defer conn.Close()
+	peer, err := dialPeer(address)
+	if err != nil {
+		slog.Warn("Error reaching another replica", "address", address, "error", err)
+		writeToClient(conn, "The server hosting this game can't be reached. Please try again later.")
+		return
+	}
+	defer peer.Close()
+
+	done := make(chan struct{}, 2)
+	go func() {
+		io.Copy(peer, conn)
+		done <- struct{}{}
+	}()
+	go func() {
+		io.Copy(conn, peer)
+		done <- struct{}{}
+	}()
+	<-done
+}
+
+// peerIPs returns the IP addresses of the other replicas, which relay the
+// connections of many players
+func peerIPs(replicas []ReplicaRecord, self string) []string {
+	var ips []string
+	for _, replica := range replicas {
+		if replica.ID == self {
+			continue
+		}
+		host, _, err := net.SplitHostPort(replica.Address)
+		if err != nil {
+			continue
+		}
+		if ip := net.ParseIP(host); ip != nil {
+			ips = append(ips, ip.String())
+		} else if addresses, err := net.LookupHost(host); err == nil {
+			ips = append(ips, addresses...)
+		}
+	}
+	return ips
+}
+
+// scan passes every record stored under a prefix with put to decode
+func (c *Cluster) scan(prefix string, decode func(data []byte) error) error {
+	found, err := c.store.Scan(prefix)
+	if err != nil {
+		return err
+	}
+	for _, data := range found {
+		if err := decode([]byte(data)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Replicas returns the live replicas of the cluster, by ID
+func (c *Cluster) Replicas() ([]ReplicaRecord, error) {
+	var replicas []ReplicaRecord
+	err := c.scan(replicaPrefix, func(data []byte) error {
+		var record ReplicaRecord
+		err := json.Unmarshal(data, &record)
+		replicas = append(replicas, record)
+		return err
+	})
+	sort.Slice(replicas, func(i, j int) bool { return replicas[i].ID < replicas[j].ID })
+	return replicas, err
+}
+
+// Sessions returns the games being played across the cluster, by replica
+// and session ID
+func (c *Cluster) Sessions() ([]SessionRecord, error) {
+	var sessions []SessionRecord
+	err := c.scan(sessionPrefix, func(data []byte) error {
+		var record SessionRecord
+		err := json.Unmarshal(data, &record)
+		sessions = append(sessions, record)
+		return err
+	})
+	sort.Slice(sessions, func(i, j int) bool {
+		if sessions[i].Replica != sessions[j].Replica {
+			return sessions[i].Replica < sessions[j].Replica
+		}
+		return sessions[i].ID < sessions[j].ID
+	})
+	return sessions, err
+}
+
+// Presence returns the named players connected across the cluster, by name
+func (c *Cluster) Presence() ([]PresenceRecord, error) {
+	var presence []PresenceRecord
+	err := c.scan(presencePrefix, func(data []byte) error {
+		var record PresenceRecord
+		err := json.Unmarshal(data, &record)
+		presence = append(presence, record)
+		return err
+	})
+	sort.Slice(presence, func(i, j int) bool { return presence[i].Name < presence[j].Name })
+	return presence, err
+}
+
+// Analytics returns the totals of every replica's analytics
+func (c *Cluster) Analytics() (AnalyticsSummary, error) {
+	var total AnalyticsSummary
+	replicas, err := c.Replicas()
+	for _, replica := range replicas {
+		total.Add(replica.Analytics)
+	}
+	return total, err
+}
+
+// Report describes the replicas, their lobbies, games and players, and the
+// analytics of the whole cluster
+func (c *Cluster) Report(now time.Time) string {
+	replicas, err := c.Replicas()
+	if err != nil {
+		return fmt.Sprintf("Error reading the cluster's state from %s: %v", c.storeName, err)
+	}
+	sessions, _ := c.Sessions()
+	presence, _ := c.Presence()
+
+	var report strings.Builder
+	report.WriteString("=== CLUSTER ===\n\n")
+	fmt.Fprintf(&report, "This replica: %s (%s), sharing state through %s\n\n", c.id, c.address, c.storeName)
+
+	report.WriteString("REPLICAS:\n")
+	var total AnalyticsSummary
+	for _, replica := range replicas {
+		fmt.Fprintf(&report, "- %s (%s): %d games, %d players, updated %s ago\n", replica.ID, replica.Address,
+			replica.Sessions, replica.Players, now.Sub(replica.Updated).Round(time.Second))
+		total.Add(replica.Analytics)
+	}
+
+	report.WriteString("\nLOBBIES:\n")
+	lobbies, _ := c.store.Scan(lobbyPrefix)
+	if len(lobbies) == 0 {
+		report.WriteString("None\n")
+	}
+	names := make([]string, 0, len(lobbies))
+	for key := range lobbies {
+		names = append(names, key)
+	}
+	sort.Strings(names)
+	for _, key := range names {
+		var host LobbyHost
+		json.Unmarshal([]byte(lobbies[key]), &host)
+		fmt.Fprintf(&report, "- %s: hosted by %s\n", strings.TrimPrefix(key, lobbyPrefix), host.Replica)
+	}
+
+	report.WriteString("\nGAMES:\n")
+	if len(sessions) == 0 {
+		report.WriteString("None\n")
+	}
+	for _, session := range sessions {
+		fmt.Fprintf(&report, "- %s session %d (%s, %s): %s\n", session.Replica, session.ID, session.Mode,
+			now.Sub(session.Started).Round(time.Second), strings.Join(session.Players, ", "))
+	}
+
+	report.WriteString("\nPLAYERS ONLINE:\n")
+	if len(presence) == 0 {
+		report.WriteString("None\n")
+	}
+	for _, record := range presence {
+		fmt.Fprintf(&report, "- %s: %s on %s\n", record.Name, record.Lobby, record.Replica)
+	}
+
+	report.WriteString("\nCLUSTER ANALYTICS:\n")
+	report.WriteString(total.Describe())
+	return report.String()
+}
@@ -0,0 +1,133 @@
+package game
+
+import (
+	"bufio"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// testCluster returns two replicas sharing one store
+func testCluster() (*Cluster, *Cluster) {
+	store := NewMemoryStore()
+	return NewCluster(store, "a", "10.0.0.1:8080"), NewCluster(store, "b", "10.0.0.2:8080")
+}
+
+func TestCluster_SharesSessionsAndPresence(t *testing.T) {
+	a, b := testCluster()
+	session := &GameSession{id: 3, game: NewGame(1234, false), players: []*Player{{name: "ann"}, {name: "bob"}}}
+
+	a.sessionStarted(session)
+	sessions, err := b.Sessions()
+	assert.NoError(t, err)
+	assert.Len(t, sessions, 1)
+	assert.Equal(t, "a", sessions[0].Replica)
+	assert.Equal(t, []string{"ann", "bob"}, sessions[0].Players)
+
+	a.setPresence("ann", LobbyMatchmaking)
+	b.setPresence("bob", LobbyDaily)
+	presence, _ := a.Presence()
+	assert.Len(t, presence, 2)
+	assert.Equal(t, "b", presence[1].Replica)
+
+	// A player who moved to another replica stays present there
+	b.setPresence("ann", LobbyDaily)
+	a.clearPresence("ann")
+	presence, _ = a.Presence()
+	assert.Len(t, presence, 2)
+	b.clearPresence("ann")
+	presence, _ = a.Presence()
+	assert.Len(t, presence, 1)
+
+	a.sessionFinished(session)
+	sessions, _ = b.Sessions()
+	assert.Empty(t, sessions)
+	replicas, _ := b.Replicas()
+	assert.Equal(t, "a", replicas[0].ID)
+}
+
+func TestCluster_TotalsAnalyticsOfEveryReplica(t *testing.T) {
+	saved := globalAnalytics
+	defer func() { globalAnalytics = saved }()
+	globalAnalytics = NewGameAnalytics()
+	stats := globalAnalytics.StartGame(1234, 2)
+	globalAnalytics.RecordGuess(stats, 1, 5678, 1234)
+	globalAnalytics.RecordGuess(stats, 2, 1234, 1234)
+	globalAnalytics.EndGame(stats, 2)
+
+	a, b := testCluster()
+	assert.NoError(t, a.publishReplica())
+	assert.NoError(t, b.publishReplica())
+
+	total, err := a.Analytics()
+	assert.NoError(t, err)
+	assert.Equal(t, 2, total.GamesPlayed)
+	assert.Equal(t, 2, total.GamesWon)
+	assert.Equal(t, 4, total.TotalGuesses)
+	assert.Contains(t, b.Report(time.Now()), "Games Played: 2")
+}
+
+func TestCluster_OneReplicaHostsEachLobby(t *testing.T) {
+	a, b := testCluster()
+
+	host, err := a.lobbyHost(LobbyTournament)
+	assert.NoError(t, err)
+	assert.Equal(t, "a", host.Replica)
+	host, _ = b.lobbyHost(LobbyTournament)
+	assert.Equal(t, LobbyHost{Replica: "a", Address: "10.0.0.1:8080"}, host)
+	host, _ = b.lobbyHost(LobbyDaily)
+	assert.Equal(t, "b", host.Replica)
+
+	assert.Empty(t, a.hostedElsewhere(LobbyTournament))
+	assert.Contains(t, b.hostedElsewhere(LobbyTournament), "hosted by replica a")
+
+	// Another replica takes over a lobby whose host has gone
+	a.store.Delete(lobbyPrefix + LobbyTournament)
+	host, _ = b.lobbyHost(LobbyTournament)
+	assert.Equal(t, "b", host.Replica)
+}
+
+func TestCluster_RoutesLobbyPlayersToTheHost(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer listener.Close()
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		line, _ := bufio.NewReader(conn).ReadString('\n')
+		conn.Write([]byte("host got " + line))
+	}()
+
+	store := NewMemoryStore()
+	host := NewCluster(store, "host", listener.Addr().String())
+	other := NewCluster(store, "other", "127.0.0.1:1")
+	host.serveLobby(LobbyMatchmaking)
+
+	client, server := net.Pipe()
+	defer client.Close()
+	go other.routeLobby(server, LobbyMatchmaking)
+	client.Write([]byte("hello\n"))
+	reply, err := bufio.NewReader(client).ReadString('\n')
+	assert.NoError(t, err)
+	assert.Equal(t, "host got hello\n", reply)
+
+	assert.False(t, host.routeLobby(nil, LobbyMatchmaking))
+}
+
+func TestPeerIPs_TrustsOtherReplicas(t *testing.T) {
+	replicas := []ReplicaRecord{{ID: "a", Address: "10.0.0.1:8080"}, {ID: "b", Address: "10.0.0.2:8080"}}
+	assert.Equal(t, []string{"10.0.0.2"}, peerIPs(replicas, "a"))
+
+	guard := NewAbuseGuard(testAbuseLimits())
+	guard.Trust(peerIPs(replicas, "a"))
+	now := time.Now()
+	for i := 0; i < 5; i++ {
+		assert.NoError(t, guard.Admit("10.0.0.2", now))
+	}
+	assert.False(t, guard.Violation("10.0.0.2", now))
+}
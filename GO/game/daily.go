@@ -0,0 +1,147 @@
+package game
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"sort"
+	"strings"
+	"time"
+)
+
+// dailyDateFormat names a calendar day; days follow UTC so that every
+// player shares the same challenge wherever they are
+const dailyDateFormat = "2006-01-02"
+
+// ErrAlreadyAttempted is returned when a player tries today's challenge twice
+var ErrAlreadyAttempted = errors.New("you have already attempted today's challenge")
+
+// DailyResult is a player's attempt at a daily challenge
+type DailyResult struct {
+	Name     string
+	Solved   bool          // Whether the player cracked the code
+	Finished bool          // Whether the attempt is over
+	Guesses  int           // Guesses the player made
+	Duration time.Duration // Time from the first prompt to the end of the attempt
+}
+
+// DailySecret returns the secret code for a calendar day. It is derived from
+// the day and a server secret, so it is the same for every player and every
+// server sharing the secret, but can't be worked out without it.
+func DailySecret(day time.Time, serverSecret []byte) int {
+	mac := hmac.New(sha256.New, serverSecret)
+	mac.Write([]byte(day.UTC().Format(dailyDateFormat)))
+	seed := int64(binary.BigEndian.Uint64(mac.Sum(nil)) >> 1)
+	if seed == 0 {
+		seed = 1 // 0 would seed the generator from the clock
+	}
+
+	generator, _ := NewSecretGenerator(SecretRulesClassic, seed)
+	return generator.Next()
+}
+
+// DailyChallenge tracks the players' single attempts at each day's code and
+// ranks them. Results are kept for the current day only. Like Game it is
+// transport-free and not safe for concurrent use.
+type DailyChallenge struct {
+	serverSecret []byte
+	day          string                  // The day the results are for
+	results      map[string]*DailyResult // Today's attempts by player name
+}
+
+// NewDailyChallenge creates a daily challenge using the given server secret
+func NewDailyChallenge(serverSecret []byte) *DailyChallenge {
+	return &DailyChallenge{
+		serverSecret: serverSecret,
+		results:      make(map[string]*DailyResult),
+	}
+}
+
+// Secret returns the code for the day containing now
+func (d *DailyChallenge) Secret(now time.Time) int {
+	return DailySecret(now, d.serverSecret)
+}
+
+// Begin uses up a player's attempt for the day containing now. The attempt
+// counts even if the player never finishes it.
+func (d *DailyChallenge) Begin(name string, now time.Time) error {
+	d.rollOver(now)
+	name = strings.TrimSpace(name)
+	if name == "" || len(name) > maxTournamentName {
+		return ErrInvalidName
+	}
+	if _, exists := d.results[name]; exists {
+		return ErrAlreadyAttempted
+	}
+	d.results[name] = &DailyResult{Name: name}
+	return nil
+}
+
+// Finish records the outcome of an attempt begun on the day containing now.
+// It returns false if the day has changed since the attempt began.
+func (d *DailyChallenge) Finish(name string, now time.Time, solved bool, guesses int, duration time.Duration) bool {
+	d.rollOver(now)
+	result, exists := d.results[name]
+	if !exists {
+		return false
+	}
+	result.Finished = true
+	result.Solved = solved
+	result.Guesses = guesses
+	result.Duration = duration
+	return true
+}
+
+// Leaderboard returns the finished attempts for the day containing now:
+// solvers first by fewest guesses and then fastest time, followed by
+// everyone who didn't crack the code
+func (d *DailyChallenge) Leaderboard(now time.Time) []DailyResult {
+	d.rollOver(now)
+	board := make([]DailyResult, 0, len(d.results))
+	for _, result := range d.results {
+		if result.Finished {
+			board = append(board, *result)
+		}
+	}
+	sort.Slice(board, func(i, j int) bool {
+		a, b := board[i], board[j]
+		if a.Solved != b.Solved {
+			return a.Solved
+		}
+		if a.Guesses != b.Guesses {
+			return a.Guesses < b.Guesses
+		}
+		if a.Duration != b.Duration {
+			return a.Duration < b.Duration
+		}
+		return a.Name < b.Name
+	})
+	return board
+}
+
+// Rank returns a player's 1-based place on the day's leaderboard, or 0 if
+// they haven't finished an attempt
+func (d *DailyChallenge) Rank(name string, now time.Time) int {
+	for i, result := range d.Leaderboard(now) {
+		if result.Name == name {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+// Attempts returns how many players have begun today's challenge
+func (d *DailyChallenge) Attempts(now time.Time) int {
+	d.rollOver(now)
+	return len(d.results)
+}
+
+// rollOver starts a new day's results once the day containing now begins
+func (d *DailyChallenge) rollOver(now time.Time) {
+	day := now.UTC().Format(dailyDateFormat)
+	if day != d.day {
+		d.day = day
+		d.results = make(map[string]*DailyResult)
+	}
+}
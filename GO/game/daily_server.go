@@ -0,0 +1,222 @@
+package game
+
+import (
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+// DailyOptions configures a server hosting the daily challenge
+type DailyOptions struct {
+	Secret []byte    // Server secret the daily codes are derived from
+	Rules  GameRules // Optional guess and time limits for every attempt
+}
+
+// DailyServer runs the daily challenge over the network: players sign in by
+// name, get one attempt at the day's code and are ranked on the day's
+// leaderboard
+type DailyServer struct {
+	mutex     sync.Mutex
+	challenge *DailyChallenge
+	rules     GameRules
+	ids       map[string]int // Stable player IDs by name, used in analytics
+}
+
+// activeDaily is the daily challenge hosted by this server, if any
+var activeDaily *DailyServer
+
+// NewDailyServer creates a daily challenge server
+func NewDailyServer(options DailyOptions) *DailyServer {
+	// Attempts are always played alone, taking turns with the clock
+	options.Rules.Mode = ModeTurns
+
+	return &DailyServer{
+		challenge: NewDailyChallenge(options.Secret),
+		rules:     options.Rules,
+		ids:       make(map[string]int),
+	}
+}
+
+// StartDailyServer starts the server hosting the daily challenge. Players
+// connect on port 8080; admins follow the leaderboard through the command
+// listener.
+func StartDailyServer(options DailyOptions) {
+	// Initialize analytics if not already done
+	if globalAnalytics == nil {
+		InitAnalytics()
+	}
+
+	activeDaily = NewDailyServer(options)
+
+	slog.Info("Starting daily challenge server")
+	listener, err := listenGame()
+	if err != nil {
+		slog.Error("Error starting server", "error", err)
+		os.Exit(1)
+	}
+	defer listener.Close()
+
+	// Create command listener for admin commands
+	go startCommandListener()
+	cluster.serveLobby(LobbyDaily)
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			slog.Error("Error accepting connection", "error", err)
+			continue
+		}
+		go activeDaily.handleConnection(conn)
+	}
+}
+
+// handleConnection signs a new connection in under a player name and then
+// routes the player's messages to their attempt
+func (d *DailyServer) handleConnection(conn net.Conn) {
+	if cluster.routeLobby(conn, LobbyDaily) {
+		return
+	}
+	day := time.Now().UTC().Format(dailyDateFormat)
+	writeToClient(conn, fmt.Sprintf("Welcome to the Code Breaker daily challenge for %s!", day))
+	writeToClient(conn, "\nEveryone gets the same code today, and you have one attempt. Fewest guesses wins, then fastest time.")
+	writeToClient(conn, "\nIt's your turn to sign in. Enter your name:")
+	serveLobbyConnection(conn, LobbyDaily, d.join, d.route)
+}
+
+// join starts the player's attempt at today's challenge. It returns nil if
+// the name can't be used.
+func (d *DailyServer) join(player *Player, name string) *lobbyPlayer {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	now := time.Now()
+	if err := d.challenge.Begin(name, now); err == ErrAlreadyAttempted {
+		writeToClient(player.conn, fmt.Sprintf("\nYou have already attempted today's challenge.%s\nCome back tomorrow for a new code!",
+			d.describeResult(name, now)))
+		player.conn.Close()
+		return nil
+	} else if err != nil {
+		writeToClient(player.conn, err.Error()+"\nTry again:")
+		return nil
+	}
+
+	if _, exists := d.ids[name]; !exists {
+		d.ids[name] = len(d.ids) + 1
+	}
+	player.id, player.name = d.ids[name], name
+	entry := &lobbyPlayer{id: player.id, name: name, player: player}
+
+	session := newLobbySession([]*lobbyPlayer{entry}, d.challenge.Secret(now), d.rules)
+	session.playerLogger(player).Info("Player started the daily challenge", logEvent, "daily_started", "name", name)
+	writeToClient(player.conn, fmt.Sprintf("\nGood luck, %s!", name))
+	go d.play(session, entry, now)
+	return entry
+}
+
+// route hands a player's message to their attempt
+func (d *DailyServer) route(entry *lobbyPlayer, input playerInput) {
+	deliverToSession(&d.mutex, entry, input)
+	if input.err != nil {
+		slog.Info("Player left the daily challenge", logEvent, "player_left", logPlayer, entry.id, "name", entry.name,
+			"error", input.err)
+	}
+}
+
+// play runs a player's attempt, records it on the leaderboard and in the
+// player's streak, and shows them where they stand
+func (d *DailyServer) play(session *GameSession, entry *lobbyPlayer, started time.Time) {
+	runGameSession(session)
+	duration := time.Since(started)
+	solved := session.game.State() == StateWon
+	guesses := session.game.GuessCount()
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	entry.session = nil
+	streak := globalAnalytics.RecordDailyResult(entry.id, started, solved)
+	counted := d.challenge.Finish(entry.name, time.Now(), solved, guesses, duration)
+	session.logger().Info("Player finished the daily challenge", logEvent, "daily_finished", logPlayer, entry.id,
+		"name", entry.name, "solved", solved, "guesses", guesses, logDuration, duration.Round(time.Millisecond))
+
+	// Nobody is left to tell if the player disconnected
+	if session.game.State() == StateAbandoned {
+		return
+	}
+
+	conn := entry.player.conn
+	if !counted {
+		writeToClient(conn, "\nA new day started during your attempt, so it isn't on the leaderboard.")
+	} else {
+		writeToClient(conn, d.describeResult(entry.name, time.Now()))
+	}
+	best := streak
+	if stats := globalAnalytics.GetPlayerStats(entry.id); stats != nil {
+		best = stats.BestDailyStreak
+	}
+	writeToClient(conn, fmt.Sprintf("\nDaily streak: %d days (best %d)", streak, best))
+	writeToClient(conn, "\n"+d.leaderboard(time.Now(), 10))
+	writeToClient(conn, "\nCome back tomorrow for a new code!")
+	conn.Close()
+}
+
+// describeResult tells a player how their attempt went and where it ranks;
+// the caller must hold d.mutex
+func (d *DailyServer) describeResult(name string, now time.Time) string {
+	rank := d.challenge.Rank(name, now)
+	if rank == 0 {
+		return ""
+	}
+	result := d.challenge.Leaderboard(now)[rank-1]
+	return fmt.Sprintf("\nYour result: %s. You are #%d of %d today.", describeDailyResult(result), rank, len(d.challenge.Leaderboard(now)))
+}
+
+// leaderboard lists the n best attempts of the day; the caller must hold d.mutex
+func (d *DailyServer) leaderboard(now time.Time, n int) string {
+	board := d.challenge.Leaderboard(now)
+	report := fmt.Sprintf("DAILY LEADERBOARD (%s):\n", now.UTC().Format(dailyDateFormat))
+	if len(board) == 0 {
+		report += "No finished attempts yet\n"
+	}
+	for i, result := range board {
+		if i == n {
+			break
+		}
+		report += fmt.Sprintf("%d. %s - %s\n", i+1, result.Name, describeDailyResult(result))
+	}
+	return report
+}
+
+// describeDailyResult summarizes an attempt, e.g. "solved in 6 guesses (1m5s)"
+func describeDailyResult(result DailyResult) string {
+	if !result.Solved {
+		return fmt.Sprintf("not solved after %d guesses", result.Guesses)
+	}
+	return fmt.Sprintf("solved in %d guesses (%s)", result.Guesses, result.Duration.Round(time.Second))
+}
+
+// Report describes today's challenge and its full leaderboard
+func (d *DailyServer) Report() string {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	now := time.Now()
+	report := "=== CODE BREAKER DAILY CHALLENGE ===\n\n"
+	report += fmt.Sprintf("Attempts today: %d\n\n", d.challenge.Attempts(now))
+	report += d.leaderboard(now, len(d.ids))
+	return report
+}
+
+// handleDailyCommand lets admins follow the daily challenge with "daily"
+func handleDailyCommand() string {
+	if activeDaily == nil {
+		return "No daily challenge is running. Start the server in daily mode to host one."
+	}
+	if elsewhere := cluster.hostedElsewhere(LobbyDaily); elsewhere != "" {
+		return elsewhere
+	}
+	return activeDaily.Report()
+}
@@ -0,0 +1,83 @@
+package game
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDailySecret(t *testing.T) {
+	secret := []byte("server secret")
+	morning := time.Date(2024, 3, 1, 0, 30, 0, 0, time.UTC)
+	evening := time.Date(2024, 3, 1, 23, 30, 0, 0, time.UTC)
+
+	// The same all day and for everyone sharing the server secret
+	assert.Equal(t, DailySecret(morning, secret), DailySecret(evening, secret))
+	assert.Equal(t, DailySecret(morning, secret), NewDailyChallenge(secret).Secret(evening))
+
+	// Different from day to day and from server to server
+	differs := func(other func(day time.Time) int) bool {
+		for day := 0; day < 5; day++ {
+			date := morning.AddDate(0, 0, day)
+			if DailySecret(date, secret) != other(date) {
+				return true
+			}
+		}
+		return false
+	}
+	assert.True(t, differs(func(day time.Time) int { return DailySecret(day.AddDate(0, 0, 1), secret) }))
+	assert.True(t, differs(func(day time.Time) int { return DailySecret(day, []byte("another secret")) }))
+}
+
+func TestDailyChallenge_OneAttemptAndLeaderboard(t *testing.T) {
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	challenge := NewDailyChallenge([]byte("server secret"))
+
+	for _, name := range []string{"ann", "bob", "cat", "dan"} {
+		assert.NoError(t, challenge.Begin(name, now))
+	}
+	assert.ErrorIs(t, challenge.Begin("ann", now), ErrAlreadyAttempted)
+	assert.ErrorIs(t, challenge.Begin(" ", now), ErrInvalidName)
+
+	assert.True(t, challenge.Finish("ann", now, true, 6, 90*time.Second))
+	assert.True(t, challenge.Finish("bob", now, true, 6, 40*time.Second))
+	assert.True(t, challenge.Finish("cat", now, false, 3, 10*time.Second))
+	assert.True(t, challenge.Finish("dan", now, true, 4, 5*time.Minute))
+
+	// Fewest guesses first, then fastest, then those who didn't solve it
+	names := make([]string, 0)
+	for _, result := range challenge.Leaderboard(now) {
+		names = append(names, result.Name)
+	}
+	assert.Equal(t, []string{"dan", "bob", "ann", "cat"}, names)
+	assert.Equal(t, 2, challenge.Rank("bob", now))
+	assert.Equal(t, 4, challenge.Attempts(now))
+
+	// A new day brings a new attempt and an empty leaderboard
+	tomorrow := now.Add(24 * time.Hour)
+	assert.Empty(t, challenge.Leaderboard(tomorrow))
+	assert.False(t, challenge.Finish("ann", tomorrow, true, 5, time.Minute))
+	assert.NoError(t, challenge.Begin("ann", tomorrow))
+}
+
+func TestGameAnalytics_DailyStreak(t *testing.T) {
+	analytics := NewGameAnalytics()
+	day := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	assert.Equal(t, 1, analytics.RecordDailyResult(1, day, true))
+	assert.Equal(t, 2, analytics.RecordDailyResult(1, day.AddDate(0, 0, 1), true))
+	assert.Equal(t, 3, analytics.RecordDailyResult(1, day.AddDate(0, 0, 2), true))
+
+	// Skipping a day starts over, and so does failing
+	assert.Equal(t, 1, analytics.RecordDailyResult(1, day.AddDate(0, 0, 4), true))
+	assert.Equal(t, 0, analytics.RecordDailyResult(1, day.AddDate(0, 0, 5), false))
+
+	stats := analytics.GetPlayerStats(1)
+	assert.Equal(t, 0, stats.DailyStreak)
+	assert.Equal(t, 3, stats.BestDailyStreak)
+
+	streaks := analytics.GetTopDailyStreaks(5)
+	assert.Len(t, streaks, 1)
+	assert.Equal(t, 3, streaks[0].BestStreak)
+}
@@ -0,0 +1,161 @@
+package game
+
+// A duel is a two-player game where each player chooses the code their
+// opponent has to crack. Players take turns, and whoever cracks their code in
+// fewer guesses wins; cracking it in as many guesses is a draw.
+
+// SetSecret records the code a duel player chooses for their opponent. Play
+// begins once both players have chosen.
+func (g *Game) SetSecret(playerID int, input string) ([]Event, error) {
+	if g.state != StateSettingCodes {
+		return nil, ErrNotSettingCodes
+	}
+	if g.indexOf(playerID) < 0 {
+		return nil, ErrUnknownPlayer
+	}
+	opponent := g.opponentOf(playerID)
+	if _, set := g.codes[opponent]; set {
+		return nil, ErrCodeAlreadySet
+	}
+
+	// Chosen codes follow the same rules as guesses
+	code, err := ValidateGuess(input)
+	if err != nil {
+		return nil, err
+	}
+	g.codes[opponent] = code
+
+	events := []Event{{Type: EventCodeSet, PlayerID: playerID, SecretCode: code}}
+	return append(events, g.beginDuel()...), nil
+}
+
+// AssignCodes uses generated codes for the duel players who have not chosen
+// one yet, so that play can begin
+func (g *Game) AssignCodes(generate func() int) ([]Event, error) {
+	if g.state != StateSettingCodes {
+		return nil, ErrNotSettingCodes
+	}
+
+	events := make([]Event, 0, len(g.players)+2)
+	for _, id := range g.MissingCodes() {
+		code := generate()
+		g.codes[g.opponentOf(id)] = code
+		events = append(events, Event{Type: EventCodeAssigned, PlayerID: id, SecretCode: code})
+	}
+	return append(events, g.beginDuel()...), nil
+}
+
+// beginDuel starts play once every code has been set
+func (g *Game) beginDuel() []Event {
+	if len(g.codes) < len(g.players) {
+		return nil
+	}
+
+	g.state = StateInProgress
+	g.currentIndex = 0
+	g.startTime = g.now()
+	return []Event{{Type: EventGameStarted}, g.turnEvent()}
+}
+
+// MissingCodes returns the duel players who have not chosen a code yet
+func (g *Game) MissingCodes() []int {
+	missing := make([]int, 0, len(g.players))
+	if g.state != StateSettingCodes {
+		return missing
+	}
+	for _, id := range g.players {
+		if _, set := g.codes[g.opponentOf(id)]; !set {
+			missing = append(missing, id)
+		}
+	}
+	return missing
+}
+
+// TargetCode returns the code the given player is trying to crack
+func (g *Game) TargetCode(playerID int) int {
+	if g.rules.Mode == ModeDuel {
+		return g.codes[playerID]
+	}
+	return g.secretCode
+}
+
+// opponentOf returns the other player in a duel, or 0 if there is none
+func (g *Game) opponentOf(playerID int) int {
+	for _, id := range g.players {
+		if id != playerID {
+			return id
+		}
+	}
+	return 0
+}
+
+// applyDuelGuess turns a scored duel guess into events
+func (g *Game) applyDuelGuess(event Event) []Event {
+	if event.Guess == g.codes[event.PlayerID] {
+		g.cracked[event.PlayerID] = event.PlayerGuesses
+		event.Type = EventCodeCracked
+		event.SecretCode = event.Guess
+	} else {
+		event.Type = EventGuessIncorrect
+	}
+
+	events := []Event{event}
+	if settled := g.settleDuel(false); settled != nil {
+		return append(events, settled...)
+	}
+	if !g.advanceTurn() {
+		return append(events, g.settleDuel(true)...)
+	}
+	return append(events, g.turnEvent())
+}
+
+// settleDuel ends the duel once its result can no longer change and returns
+// the final event, or nil if play goes on. With final set nobody may guess any
+// more (for example because the game clock ran out).
+func (g *Game) settleDuel(final bool) []Event {
+	if len(g.players) != 2 {
+		return nil
+	}
+	a, b := g.players[0], g.players[1]
+	guessesA, crackedA := g.cracked[a]
+	guessesB, crackedB := g.cracked[b]
+	doneA := final || !g.canGuess(a)
+	doneB := final || !g.canGuess(b)
+
+	switch {
+	case crackedA && crackedB && guessesA == guessesB:
+		g.state = StateDraw
+		return []Event{{
+			Type:          EventGameDrawn,
+			GuessCount:    g.guessCount,
+			PlayerGuesses: guessesA,
+		}}
+	case crackedA && crackedB:
+		if guessesA < guessesB {
+			return []Event{g.winDuel(a)}
+		}
+		return []Event{g.winDuel(b)}
+	case crackedA && (doneB || g.playerGuesses[b] >= guessesA):
+		// The opponent can no longer crack their code in fewer guesses
+		return []Event{g.winDuel(a)}
+	case crackedB && (doneA || g.playerGuesses[a] >= guessesB):
+		return []Event{g.winDuel(b)}
+	case doneA && doneB:
+		return []Event{g.lose()}
+	}
+	return nil
+}
+
+// winDuel ends the duel with the given player as the winner
+func (g *Game) winDuel(playerID int) Event {
+	g.state = StateWon
+	g.winnerID = playerID
+	return Event{
+		Type:          EventDuelWon,
+		PlayerID:      playerID,
+		GuessCount:    g.guessCount,
+		PlayerGuesses: g.cracked[playerID],
+		SecretCode:    g.codes[playerID],
+		Score:         g.winningScore(playerID),
+	}
+}
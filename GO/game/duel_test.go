@@ -0,0 +1,190 @@
+package game
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// startedDuel returns a duel between players 1 and 2 where player 1 must
+// crack code1 and player 2 must crack code2
+func startedDuel(t *testing.T, rules GameRules, code1, code2 string) *Game {
+	g := NewGame(0, false)
+	rules.Mode = ModeDuel
+	g.SetRules(rules)
+	assert.NoError(t, g.AddPlayer(1))
+	assert.NoError(t, g.AddPlayer(2))
+
+	events, err := g.Start()
+	assert.NoError(t, err)
+	assert.Equal(t, []EventType{EventCodesRequested}, eventTypes(events))
+
+	_, err = g.SetSecret(2, code1)
+	assert.NoError(t, err)
+	_, err = g.SetSecret(1, code2)
+	assert.NoError(t, err)
+	return g
+}
+
+func TestGame_DuelSettingCodes(t *testing.T) {
+	g := NewGame(0, false)
+	g.SetRules(GameRules{Mode: ModeDuel})
+	assert.NoError(t, g.AddPlayer(1))
+	assert.NoError(t, g.AddPlayer(2))
+	assert.ErrorIs(t, g.AddPlayer(3), ErrGameFull)
+
+	_, err := g.Start()
+	assert.NoError(t, err)
+	assert.Equal(t, StateSettingCodes, g.State())
+	assert.Equal(t, []int{1, 2}, g.MissingCodes())
+
+	_, err = g.ApplyGuess(1, "1234")
+	assert.ErrorIs(t, err, ErrGameNotInProgress)
+
+	// Codes follow the same rules as guesses
+	_, err = g.SetSecret(1, "12a4")
+	assert.Error(t, err)
+
+	events, err := g.SetSecret(1, "5678")
+	assert.NoError(t, err)
+	assert.Equal(t, []EventType{EventCodeSet}, eventTypes(events))
+	assert.Equal(t, 5678, events[0].SecretCode)
+	assert.Equal(t, 5678, g.TargetCode(2))
+	assert.Equal(t, []int{2}, g.MissingCodes())
+
+	_, err = g.SetSecret(1, "1111")
+	assert.ErrorIs(t, err, ErrCodeAlreadySet)
+
+	events, err = g.SetSecret(2, "1234")
+	assert.NoError(t, err)
+	assert.Equal(t, []EventType{EventCodeSet, EventGameStarted, EventTurnChanged}, eventTypes(events))
+	assert.Equal(t, StateInProgress, g.State())
+	assert.Equal(t, 1234, g.TargetCode(1))
+	assert.Equal(t, 1, g.CurrentPlayer())
+
+	// Each player is scored against their own code
+	events, err = g.ApplyGuess(1, "1243")
+	assert.NoError(t, err)
+	assert.Equal(t, Feedback{Exact: 2, Partial: 2}, events[0].Feedback)
+}
+
+func TestGame_DuelAssignsMissingCodes(t *testing.T) {
+	g := NewGame(0, false)
+	g.SetRules(GameRules{Mode: ModeDuel})
+	assert.NoError(t, g.AddPlayer(1))
+	assert.NoError(t, g.AddPlayer(2))
+	_, err := g.Start()
+	assert.NoError(t, err)
+	_, err = g.SetSecret(1, "5678")
+	assert.NoError(t, err)
+
+	events, err := g.AssignCodes(func() int { return 4321 })
+	assert.NoError(t, err)
+	assert.Equal(t, []EventType{EventCodeAssigned, EventGameStarted, EventTurnChanged}, eventTypes(events))
+	assert.Equal(t, 2, events[0].PlayerID)
+	assert.Equal(t, 4321, g.TargetCode(1))
+	assert.Equal(t, 5678, g.TargetCode(2))
+}
+
+func TestGame_DuelFewerGuessesWins(t *testing.T) {
+	g := startedDuel(t, GameRules{}, "1234", "5678")
+
+	_, err := g.ApplyGuess(1, "1111")
+	assert.NoError(t, err)
+
+	// Player 2 cracks their code in one guess, player 1 has already used one
+	events, err := g.ApplyGuess(2, "5678")
+	assert.NoError(t, err)
+	assert.Equal(t, []EventType{EventCodeCracked, EventDuelWon}, eventTypes(events))
+	assert.Equal(t, 2, events[1].PlayerID)
+	assert.Equal(t, 1, events[1].PlayerGuesses)
+	assert.Equal(t, StateWon, g.State())
+	assert.Equal(t, 2, g.WinnerID())
+}
+
+func TestGame_DuelOpponentGetsLastChance(t *testing.T) {
+	g := startedDuel(t, GameRules{}, "1234", "5678")
+
+	// Player 1 cracks first, but player 2 may still match them
+	events, err := g.ApplyGuess(1, "1234")
+	assert.NoError(t, err)
+	assert.Equal(t, []EventType{EventCodeCracked, EventTurnChanged}, eventTypes(events))
+	assert.False(t, g.Over())
+
+	events, err = g.ApplyGuess(2, "5678")
+	assert.NoError(t, err)
+	assert.Equal(t, []EventType{EventCodeCracked, EventGameDrawn}, eventTypes(events))
+	assert.Equal(t, StateDraw, g.State())
+	assert.True(t, g.Over())
+}
+
+func TestGame_DuelCrackerKeepsTurnAway(t *testing.T) {
+	g := startedDuel(t, GameRules{}, "1234", "5678")
+
+	_, err := g.ApplyGuess(1, "1111")
+	assert.NoError(t, err)
+	_, err = g.ApplyGuess(2, "2222")
+	assert.NoError(t, err)
+	_, err = g.ApplyGuess(1, "1234")
+	assert.NoError(t, err)
+
+	// Player 2 now guesses alone and loses once they reach two guesses
+	assert.Equal(t, 2, g.CurrentPlayer())
+	events, err := g.ApplyGuess(2, "3333")
+	assert.NoError(t, err)
+	assert.Equal(t, []EventType{EventGuessIncorrect, EventDuelWon}, eventTypes(events))
+	assert.Equal(t, 1, g.WinnerID())
+}
+
+func TestGame_DuelLostWhenNobodyCracks(t *testing.T) {
+	g := startedDuel(t, GameRules{MaxGuessesPerPlayer: 1}, "1234", "5678")
+
+	_, err := g.ApplyGuess(1, "1111")
+	assert.NoError(t, err)
+	events, err := g.ApplyGuess(2, "2222")
+	assert.NoError(t, err)
+	assert.Equal(t, []EventType{EventGuessIncorrect, EventGameLost}, eventTypes(events))
+	assert.Equal(t, StateLost, g.State())
+}
+
+func TestGame_DuelRestartAsksForNewCodes(t *testing.T) {
+	g := startedDuel(t, GameRules{}, "1234", "5678")
+	_, err := g.ApplyGuess(1, "1234")
+	assert.NoError(t, err)
+
+	events, err := g.Restart(0, []int{1, 2})
+	assert.NoError(t, err)
+	assert.Equal(t, []EventType{EventCodesRequested}, eventTypes(events))
+	assert.Equal(t, []int{1, 2}, g.MissingCodes())
+}
+
+func TestGame_ConcurrentDuelsAssignCodes(t *testing.T) {
+	// Lobby servers play many duels at once, each assigning codes from its
+	// own goroutine while new matches draw their codes
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			g := NewGame(0, false)
+			g.SetRules(GameRules{Mode: ModeDuel})
+			assert.NoError(t, g.AddPlayer(1))
+			assert.NoError(t, g.AddPlayer(2))
+			_, err := g.Start()
+			assert.NoError(t, err)
+
+			_, err = g.AssignCodes(GenerateSecretCode)
+			assert.NoError(t, err)
+			assert.Equal(t, StateInProgress, g.State())
+		}()
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				code := GenerateSecretCode()
+				assert.True(t, code >= 0 && code < candidateLimit)
+			}
+		}()
+	}
+	wg.Wait()
+}
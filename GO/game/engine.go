@@ -0,0 +1,644 @@
+package game
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// GameState describes where a Game is in its lifecycle
+type GameState int
+
+const (
+	StateWaiting      GameState = iota // Players are still joining
+	StateInProgress                    // Guesses are being accepted
+	StateWon                           // A player broke the code
+	StateAbandoned                     // The game ended without a winner
+	StateLost                          // Everyone ran out of guesses or time
+	StateSettingCodes                  // Duel players are choosing codes for each other
+	StateDraw                          // Duel players cracked their codes in as many guesses
+)
+
+func (s GameState) String() string {
+	switch s {
+	case StateWaiting:
+		return "waiting"
+	case StateInProgress:
+		return "in progress"
+	case StateWon:
+		return "won"
+	case StateAbandoned:
+		return "abandoned"
+	case StateLost:
+		return "lost"
+	case StateSettingCodes:
+		return "setting codes"
+	case StateDraw:
+		return "draw"
+	default:
+		return fmt.Sprintf("GameState(%d)", int(s))
+	}
+}
+
+// EventType identifies what happened as the result of a Game transition
+type EventType int
+
+const (
+	EventGameStarted    EventType = iota // A game (or a restarted game) began
+	EventTurnChanged                     // PlayerID is now expected to guess
+	EventGuessIncorrect                  // PlayerID made a wrong guess
+	EventGuessCorrect                    // PlayerID broke the code and won
+	EventTurnTimedOut                    // PlayerID ran out of time
+	EventPlayerRemoved                   // PlayerID left the game
+	EventGameAbandoned                   // The game ended without a winner
+	EventGameLost                        // Everyone ran out of guesses or time
+	EventRaceProgress                    // PlayerID's standing changed in a race
+	EventCodesRequested                  // Duel players must choose codes for each other
+	EventCodeSet                         // PlayerID chose a code for their opponent
+	EventCodeAssigned                    // A code was generated for PlayerID, who did not choose in time
+	EventCodeCracked                     // PlayerID cracked their code in a duel
+	EventDuelWon                         // PlayerID won the duel
+	EventGameDrawn                       // The duel ended in a draw
+)
+
+// eventNames are the names of the event types, as they appear in logs
+var eventNames = map[EventType]string{
+	EventGameStarted:    "game_started",
+	EventTurnChanged:    "turn_changed",
+	EventGuessIncorrect: "guess_incorrect",
+	EventGuessCorrect:   "guess_correct",
+	EventTurnTimedOut:   "turn_timed_out",
+	EventPlayerRemoved:  "player_removed",
+	EventGameAbandoned:  "game_abandoned",
+	EventGameLost:       "game_lost",
+	EventRaceProgress:   "race_progress",
+	EventCodesRequested: "codes_requested",
+	EventCodeSet:        "code_set",
+	EventCodeAssigned:   "code_assigned",
+	EventCodeCracked:    "code_cracked",
+	EventDuelWon:        "duel_won",
+	EventGameDrawn:      "game_drawn",
+}
+
+func (t EventType) String() string {
+	if name, ok := eventNames[t]; ok {
+		return name
+	}
+	return fmt.Sprintf("EventType(%d)", int(t))
+}
+
+// GameMode selects how players take part in a game
+type GameMode int
+
+const (
+	ModeTurns GameMode = iota // Players take turns in order
+	ModeRace                  // Everyone guesses at once; first to crack the code wins
+	ModeDuel                  // Two players crack codes chosen by each other
+	ModeTeams                 // Teams take turns and share feedback and the win
+)
+
+func (m GameMode) String() string {
+	switch m {
+	case ModeTurns:
+		return "turns"
+	case ModeRace:
+		return "race"
+	case ModeDuel:
+		return "duel"
+	case ModeTeams:
+		return "teams"
+	default:
+		return fmt.Sprintf("GameMode(%d)", int(m))
+	}
+}
+
+// ParseGameMode converts a mode name such as "race" into a GameMode
+func ParseGameMode(name string) (GameMode, error) {
+	for _, mode := range []GameMode{ModeTurns, ModeRace, ModeDuel, ModeTeams} {
+		if mode.String() == name {
+			return mode, nil
+		}
+	}
+	return ModeTurns, fmt.Errorf("unknown game mode %q", name)
+}
+
+// Event is emitted by the Game engine for every state change so that a
+// front end (network server, terminal, tests) can present it
+type Event struct {
+	Type          EventType
+	PlayerID      int      // Player the event refers to (0 if none)
+	Guess         int      // The guess, for guess events
+	Feedback      Feedback // Feedback for the guess, for guess events
+	GuessCount    int      // Total guesses made in the game so far
+	SecretCode    int      // Revealed when the game ends
+	Score         int      // Points earned, for EventGuessCorrect
+	GuessesLeft   int      // Guesses PlayerID has left (-1 if unlimited)
+	PlayerGuesses int      // Guesses PlayerID has made, for guess and progress events
+	BestExact     int      // PlayerID's best exact-match count, for guess and progress events
+	Team          string   // PlayerID's team, in team mode
+}
+
+// GameRules configures the mode and optional limits of a game. The zero value
+// is the classic game: turns in order, unlimited guesses and no game clock.
+type GameRules struct {
+	Mode                GameMode      // How players take part
+	MaxGuesses          int           // Guesses allowed across all players (0 for unlimited)
+	MaxGuessesPerPlayer int           // Guesses allowed for each player (0 for unlimited)
+	TimeLimit           time.Duration // Time allowed for the whole game (0 for unlimited)
+	Teams               []string      // Team mode: names of the teams (DefaultTeamNames if empty)
+}
+
+// Limited reports whether the rules can end a game without a winner
+func (r GameRules) Limited() bool {
+	return r.MaxGuesses > 0 || r.MaxGuessesPerPlayer > 0 || r.TimeLimit > 0
+}
+
+// Feedback describes how close a guess was to the secret code
+type Feedback struct {
+	Exact   int `json:"exact"`   // Correct digits in the correct position
+	Partial int `json:"partial"` // Correct digits in the wrong position
+}
+
+// Errors returned by Game transitions
+var (
+	ErrGameNotInProgress = errors.New("game is not in progress")
+	ErrNotYourTurn       = errors.New("it is not your turn")
+	ErrUnknownPlayer     = errors.New("player is not part of this game")
+	ErrPlayerExists      = errors.New("player has already joined this game")
+	ErrNotEnoughPlayers  = errors.New("not enough players to start the game")
+	ErrNoGuessesLeft     = errors.New("you have no guesses left")
+	ErrNoTurns           = errors.New("there are no turns in this game mode")
+	ErrGameFull          = errors.New("game is full")
+	ErrNotSettingCodes   = errors.New("codes are not being chosen right now")
+	ErrCodeAlreadySet    = errors.New("you have already chosen a code")
+	ErrAlreadyCracked    = errors.New("you have already cracked your code")
+	ErrUnknownTeam       = errors.New("there is no team with that name")
+	ErrTeamsLocked       = errors.New("teams can only be chosen before the game starts")
+	ErrNotEnoughTeams    = errors.New("not enough teams to start the game")
+	ErrNoTeams           = errors.New("there are no teams in this game mode")
+)
+
+// Game is the transport-free Code Breaker rules engine. It holds the state of
+// a single game and turns player actions into events. It is not safe for
+// concurrent use; callers must serialize access.
+type Game struct {
+	secretCode    int
+	players       []int // Player IDs in turn order
+	currentIndex  int   // Index into players of whose turn it is
+	guessCount    int
+	playerGuesses map[int]int // Guesses made by each player
+	bestExact     map[int]int // Best exact-match count of each player
+	codes         map[int]int // Duel: code each player must crack
+	cracked       map[int]int // Duel: guesses each player took to crack their code
+	teams         []*Team     // Team mode: teams in turn order
+	teamIndex     int         // Team mode: index into teams of whose turn it is
+	winnerID      int
+	state         GameState
+	singlePlayer  bool
+	rules         GameRules
+	startTime     time.Time
+	now           func() time.Time // Clock, replaceable in tests
+}
+
+// NewGame creates a game in the waiting state for the given secret code
+func NewGame(secretCode int, singlePlayer bool) *Game {
+	return &Game{
+		secretCode:    secretCode,
+		players:       make([]int, 0),
+		playerGuesses: make(map[int]int),
+		bestExact:     make(map[int]int),
+		codes:         make(map[int]int),
+		cracked:       make(map[int]int),
+		state:         StateWaiting,
+		singlePlayer:  singlePlayer,
+		now:           time.Now,
+	}
+}
+
+// SetRules changes the limits used by this and any restarted game
+func (g *Game) SetRules(rules GameRules) {
+	g.rules = rules
+}
+
+// Rules returns the limits in effect
+func (g *Game) Rules() GameRules {
+	return g.rules
+}
+
+// State returns the current lifecycle state
+func (g *Game) State() GameState {
+	return g.state
+}
+
+// Over reports whether the game has finished
+func (g *Game) Over() bool {
+	return g.state == StateWon || g.state == StateAbandoned || g.state == StateLost || g.state == StateDraw
+}
+
+// SecretCode returns the code players are trying to break
+func (g *Game) SecretCode() int {
+	return g.secretCode
+}
+
+// GuessCount returns the number of valid guesses made so far
+func (g *Game) GuessCount() int {
+	return g.guessCount
+}
+
+// WinnerID returns the ID of the winning player, or 0 if nobody has won
+func (g *Game) WinnerID() int {
+	return g.winnerID
+}
+
+// GuessesLeft returns how many more guesses a player may make, or -1 if the
+// game has no guess limit
+func (g *Game) GuessesLeft(playerID int) int {
+	left := -1
+	if g.rules.MaxGuesses > 0 {
+		left = g.rules.MaxGuesses - g.guessCount
+	}
+	if g.rules.MaxGuessesPerPlayer > 0 {
+		playerLeft := g.rules.MaxGuessesPerPlayer - g.playerGuesses[playerID]
+		if left < 0 || playerLeft < left {
+			left = playerLeft
+		}
+	}
+	if left < -1 {
+		left = 0
+	}
+	return left
+}
+
+// TimeRemaining returns how long is left on the game clock. The second
+// result is false if the game has no time limit.
+func (g *Game) TimeRemaining() (time.Duration, bool) {
+	if g.rules.TimeLimit <= 0 {
+		return 0, false
+	}
+	if g.state == StateWaiting || g.state == StateSettingCodes {
+		return g.rules.TimeLimit, true
+	}
+	remaining := g.rules.TimeLimit - g.now().Sub(g.startTime)
+	if remaining < 0 {
+		remaining = 0
+	}
+	return remaining, true
+}
+
+// Players returns the IDs of the players in turn order
+func (g *Game) Players() []int {
+	players := make([]int, len(g.players))
+	copy(players, g.players)
+	return players
+}
+
+// CurrentPlayer returns the ID of the player whose turn it is, or 0 if the
+// game has no players or no turns
+func (g *Game) CurrentPlayer() int {
+	if len(g.players) == 0 || g.rules.Mode == ModeRace || g.state == StateSettingCodes {
+		return 0
+	}
+	return g.players[g.currentIndex]
+}
+
+// MinPlayers returns how many players are needed to start or continue
+func (g *Game) MinPlayers() int {
+	if g.singlePlayer {
+		return 1
+	}
+	return 2
+}
+
+// AddPlayer seats a player while the game is waiting to start
+func (g *Game) AddPlayer(playerID int) error {
+	if g.state != StateWaiting {
+		return ErrGameNotInProgress
+	}
+	if g.indexOf(playerID) >= 0 {
+		return ErrPlayerExists
+	}
+	if g.rules.Mode == ModeDuel && len(g.players) == 2 {
+		return ErrGameFull
+	}
+	g.players = append(g.players, playerID)
+	return nil
+}
+
+// Start begins the game with the seated players
+func (g *Game) Start() ([]Event, error) {
+	if g.state != StateWaiting {
+		return nil, ErrGameNotInProgress
+	}
+	if len(g.players) < g.MinPlayers() {
+		return nil, ErrNotEnoughPlayers
+	}
+
+	g.currentIndex = 0
+	if g.rules.Mode == ModeTeams {
+		if err := g.formTeams(); err != nil {
+			return nil, err
+		}
+	}
+	if g.rules.Mode == ModeDuel {
+		// Play begins once both players have chosen a code
+		g.state = StateSettingCodes
+		return []Event{{Type: EventCodesRequested}}, nil
+	}
+
+	g.state = StateInProgress
+	g.startTime = g.now()
+	if g.rules.Mode == ModeRace {
+		return []Event{{Type: EventGameStarted}}, nil
+	}
+	return []Event{
+		{Type: EventGameStarted},
+		g.turnEvent(),
+	}, nil
+}
+
+// ApplyGuess validates and applies a guess from the given player
+func (g *Game) ApplyGuess(playerID int, input string) ([]Event, error) {
+	if g.state != StateInProgress {
+		return nil, ErrGameNotInProgress
+	}
+	if g.indexOf(playerID) < 0 {
+		return nil, ErrUnknownPlayer
+	}
+	if g.rules.Mode != ModeRace && g.CurrentPlayer() != playerID {
+		return nil, ErrNotYourTurn
+	}
+	if _, done := g.cracked[playerID]; done {
+		return nil, ErrAlreadyCracked
+	}
+	if g.GuessesLeft(playerID) == 0 {
+		return nil, ErrNoGuessesLeft
+	}
+
+	guess, err := ValidateGuess(input)
+	if err != nil {
+		return nil, err
+	}
+
+	feedback := ScoreGuess(guess, g.TargetCode(playerID))
+	g.guessCount++
+	g.playerGuesses[playerID]++
+	if feedback.Exact > g.bestExact[playerID] {
+		g.bestExact[playerID] = feedback.Exact
+	}
+	event := Event{
+		PlayerID:      playerID,
+		Guess:         guess,
+		Feedback:      feedback,
+		GuessCount:    g.guessCount,
+		GuessesLeft:   g.GuessesLeft(playerID),
+		PlayerGuesses: g.playerGuesses[playerID],
+		BestExact:     g.bestExact[playerID],
+		Team:          g.TeamOf(playerID),
+	}
+
+	if g.rules.Mode == ModeDuel {
+		return g.applyDuelGuess(event), nil
+	}
+
+	if guess == g.secretCode {
+		g.state = StateWon
+		g.winnerID = playerID
+		event.Type = EventGuessCorrect
+		event.SecretCode = g.secretCode
+		event.Score = g.winningScore(playerID)
+		return []Event{event}, nil
+	}
+
+	event.Type = EventGuessIncorrect
+	if g.rules.Mode == ModeRace {
+		progress := Event{
+			Type:          EventRaceProgress,
+			PlayerID:      playerID,
+			GuessCount:    g.guessCount,
+			GuessesLeft:   event.GuessesLeft,
+			PlayerGuesses: event.PlayerGuesses,
+			BestExact:     event.BestExact,
+		}
+		if !g.anyGuessesLeft() {
+			return []Event{event, progress, g.lose()}, nil
+		}
+		return []Event{event, progress}, nil
+	}
+
+	if !g.advanceTurn() {
+		return append([]Event{event}, g.endWithoutGuesses()...), nil
+	}
+	return []Event{event, g.turnEvent()}, nil
+}
+
+// Expire ends the game because the game clock ran out
+func (g *Game) Expire() ([]Event, error) {
+	if g.state != StateInProgress {
+		return nil, ErrGameNotInProgress
+	}
+	return g.endWithoutGuesses(), nil
+}
+
+// Timeout records that the given player ran out of time on their turn. In
+// multiplayer games the turn passes to the next player; a single player
+// simply keeps the turn.
+func (g *Game) Timeout(playerID int) ([]Event, error) {
+	if g.state != StateInProgress {
+		return nil, ErrGameNotInProgress
+	}
+	if g.rules.Mode == ModeRace {
+		return nil, ErrNoTurns
+	}
+	if g.CurrentPlayer() != playerID {
+		return nil, ErrNotYourTurn
+	}
+
+	events := []Event{{Type: EventTurnTimedOut, PlayerID: playerID, GuessCount: g.guessCount}}
+	if !g.singlePlayer && !g.advanceTurn() {
+		return append(events, g.endWithoutGuesses()...), nil
+	}
+	return append(events, g.turnEvent()), nil
+}
+
+// RemovePlayer takes a player out of the game. The game is abandoned if too
+// few players remain to continue.
+func (g *Game) RemovePlayer(playerID int) ([]Event, error) {
+	index := g.indexOf(playerID)
+	if index < 0 {
+		return nil, ErrUnknownPlayer
+	}
+
+	current := g.CurrentPlayer()
+	team := g.TeamOf(playerID)
+	g.players = append(g.players[:index], g.players[index+1:]...)
+	g.leaveTeam(playerID)
+	events := []Event{{Type: EventPlayerRemoved, PlayerID: playerID, GuessCount: g.guessCount, Team: team}}
+
+	// Keep the turn on the same player, or hand it on if the leaver had it
+	if index < g.currentIndex {
+		g.currentIndex--
+	}
+	if g.currentIndex >= len(g.players) {
+		g.currentIndex = 0
+	}
+
+	if g.state != StateInProgress && g.state != StateSettingCodes {
+		return events, nil
+	}
+
+	if len(g.players) < g.MinPlayers() || (g.rules.Mode == ModeTeams && len(g.teams) < 2) {
+		g.state = StateAbandoned
+		return append(events, Event{
+			Type:       EventGameAbandoned,
+			GuessCount: g.guessCount,
+			SecretCode: g.secretCode,
+		}), nil
+	}
+
+	// The leaver may have been the last player with guesses left
+	if g.rules.Mode == ModeRace {
+		if !g.anyGuessesLeft() {
+			return append(events, g.lose()), nil
+		}
+		return events, nil
+	}
+	if g.rules.Mode == ModeTeams {
+		// Turns follow the teams rather than the join order
+		if current == playerID {
+			if !g.advanceTurn() {
+				return append(events, g.endWithoutGuesses()...), nil
+			}
+			return append(events, g.turnEvent()), nil
+		}
+		g.currentIndex = g.indexOf(current)
+	}
+	if !g.canGuess(g.CurrentPlayer()) && !g.advanceTurn() {
+		return append(events, g.endWithoutGuesses()...), nil
+	}
+	return append(events, g.turnEvent()), nil
+}
+
+// Restart begins a fresh game with a new secret code for the given players
+func (g *Game) Restart(secretCode int, playerIDs []int) ([]Event, error) {
+	if len(playerIDs) < g.MinPlayers() {
+		return nil, ErrNotEnoughPlayers
+	}
+
+	g.secretCode = secretCode
+	g.players = make([]int, len(playerIDs))
+	copy(g.players, playerIDs)
+	g.guessCount = 0
+	g.playerGuesses = make(map[int]int)
+	g.bestExact = make(map[int]int)
+	g.codes = make(map[int]int)
+	g.cracked = make(map[int]int)
+	g.keepTeamMembers(playerIDs)
+	g.winnerID = 0
+	g.state = StateWaiting
+	return g.Start()
+}
+
+// advanceTurn passes the turn to the next player who can still guess. It
+// returns false if nobody can.
+func (g *Game) advanceTurn() bool {
+	if g.rules.Mode == ModeTeams {
+		return g.advanceTeamTurn()
+	}
+	for i := 1; i <= len(g.players); i++ {
+		next := (g.currentIndex + i) % len(g.players)
+		if g.canGuess(g.players[next]) {
+			g.currentIndex = next
+			return true
+		}
+	}
+	return false
+}
+
+// canGuess reports whether a player may still make guesses
+func (g *Game) canGuess(playerID int) bool {
+	if _, done := g.cracked[playerID]; done {
+		return false
+	}
+	return g.GuessesLeft(playerID) != 0
+}
+
+// endWithoutGuesses ends a game in which nobody can guess any more
+func (g *Game) endWithoutGuesses() []Event {
+	if g.rules.Mode == ModeDuel {
+		return g.settleDuel(true)
+	}
+	return []Event{g.lose()}
+}
+
+// anyGuessesLeft reports whether any player may still guess
+func (g *Game) anyGuessesLeft() bool {
+	for _, id := range g.players {
+		if g.GuessesLeft(id) != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// lose ends the game with nobody breaking the code
+func (g *Game) lose() Event {
+	g.state = StateLost
+	return Event{Type: EventGameLost, GuessCount: g.guessCount, SecretCode: g.secretCode}
+}
+
+func (g *Game) turnEvent() Event {
+	return Event{
+		Type:        EventTurnChanged,
+		PlayerID:    g.CurrentPlayer(),
+		GuessCount:  g.guessCount,
+		GuessesLeft: g.GuessesLeft(g.CurrentPlayer()),
+		Team:        g.TeamOf(g.CurrentPlayer()),
+	}
+}
+
+func (g *Game) indexOf(playerID int) int {
+	for i, id := range g.players {
+		if id == playerID {
+			return i
+		}
+	}
+	return -1
+}
+
+// ScoreGuess compares a guess against the secret code
+func ScoreGuess(guess, secretCode int) Feedback {
+	guessStr := fmt.Sprintf("%04d", guess)
+	secretStr := fmt.Sprintf("%04d", secretCode)
+
+	var feedback Feedback
+
+	// Track which positions we've already matched
+	usedSecret := [4]bool{}
+	usedGuess := [4]bool{}
+
+	// First pass: find correct positions
+	for i := 0; i < 4; i++ {
+		if guessStr[i] == secretStr[i] {
+			feedback.Exact++
+			usedSecret[i] = true
+			usedGuess[i] = true
+		}
+	}
+
+	// Second pass: find correct digits in wrong positions
+	for i := 0; i < 4; i++ {
+		if usedGuess[i] {
+			continue
+		}
+
+		for j := 0; j < 4; j++ {
+			if !usedSecret[j] && guessStr[i] == secretStr[j] {
+				feedback.Partial++
+				usedSecret[j] = true
+				break
+			}
+		}
+	}
+
+	return feedback
+}
@@ -0,0 +1,368 @@
+package game
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// --- helpers ---
+
+func startedGame(t *testing.T, secretCode int, singlePlayer bool, playerIDs ...int) *Game {
+	g := NewGame(secretCode, singlePlayer)
+	for _, id := range playerIDs {
+		assert.NoError(t, g.AddPlayer(id))
+	}
+	_, err := g.Start()
+	assert.NoError(t, err)
+	return g
+}
+
+func eventTypes(events []Event) []EventType {
+	types := make([]EventType, len(events))
+	for i, e := range events {
+		types[i] = e.Type
+	}
+	return types
+}
+
+// --- Game engine tests ---
+
+func TestGame_StartRequiresEnoughPlayers(t *testing.T) {
+	g := NewGame(1234, false)
+	assert.NoError(t, g.AddPlayer(1))
+
+	_, err := g.Start()
+	assert.ErrorIs(t, err, ErrNotEnoughPlayers)
+	assert.Equal(t, StateWaiting, g.State())
+
+	assert.NoError(t, g.AddPlayer(2))
+	events, err := g.Start()
+	assert.NoError(t, err)
+	assert.Equal(t, []EventType{EventGameStarted, EventTurnChanged}, eventTypes(events))
+	assert.Equal(t, 1, events[1].PlayerID)
+	assert.Equal(t, StateInProgress, g.State())
+}
+
+func TestGame_AddPlayerRejectsDuplicates(t *testing.T) {
+	g := NewGame(1234, false)
+	assert.NoError(t, g.AddPlayer(1))
+	assert.ErrorIs(t, g.AddPlayer(1), ErrPlayerExists)
+}
+
+func TestGame_IncorrectGuessPassesTurn(t *testing.T) {
+	g := startedGame(t, 1234, false, 1, 2)
+
+	events, err := g.ApplyGuess(1, "1243")
+	assert.NoError(t, err)
+	assert.Equal(t, []EventType{EventGuessIncorrect, EventTurnChanged}, eventTypes(events))
+	assert.Equal(t, Feedback{Exact: 2, Partial: 2}, events[0].Feedback)
+	assert.Equal(t, 1, events[0].GuessCount)
+	assert.Equal(t, 2, events[1].PlayerID)
+	assert.Equal(t, 2, g.CurrentPlayer())
+}
+
+func TestGame_GuessOutOfTurnIsRejected(t *testing.T) {
+	g := startedGame(t, 1234, false, 1, 2)
+
+	_, err := g.ApplyGuess(2, "1111")
+	assert.ErrorIs(t, err, ErrNotYourTurn)
+	_, err = g.ApplyGuess(3, "1111")
+	assert.ErrorIs(t, err, ErrUnknownPlayer)
+	assert.Equal(t, 0, g.GuessCount())
+}
+
+func TestGame_InvalidGuessKeepsTurn(t *testing.T) {
+	g := startedGame(t, 1234, false, 1, 2)
+
+	_, err := g.ApplyGuess(1, "12a4")
+	assert.Error(t, err)
+	assert.Equal(t, 1, g.CurrentPlayer())
+	assert.Equal(t, 0, g.GuessCount())
+}
+
+func TestGame_CorrectGuessWins(t *testing.T) {
+	g := startedGame(t, 42, false, 1, 2)
+
+	_, err := g.ApplyGuess(1, "1111")
+	assert.NoError(t, err)
+	events, err := g.ApplyGuess(2, "0042")
+	assert.NoError(t, err)
+	assert.Equal(t, []EventType{EventGuessCorrect}, eventTypes(events))
+	assert.Equal(t, 42, events[0].SecretCode)
+	assert.Equal(t, 2, events[0].GuessCount)
+	assert.Equal(t, StateWon, g.State())
+	assert.Equal(t, 2, g.WinnerID())
+	assert.True(t, g.Over())
+
+	_, err = g.ApplyGuess(1, "0042")
+	assert.ErrorIs(t, err, ErrGameNotInProgress)
+}
+
+func TestGame_TimeoutForfeitsTurnInMultiplayer(t *testing.T) {
+	g := startedGame(t, 1234, false, 1, 2, 3)
+
+	events, err := g.Timeout(1)
+	assert.NoError(t, err)
+	assert.Equal(t, []EventType{EventTurnTimedOut, EventTurnChanged}, eventTypes(events))
+	assert.Equal(t, 2, g.CurrentPlayer())
+
+	_, err = g.Timeout(1)
+	assert.ErrorIs(t, err, ErrNotYourTurn)
+}
+
+func TestGame_TimeoutKeepsTurnInSinglePlayer(t *testing.T) {
+	g := startedGame(t, 1234, true, 1)
+
+	events, err := g.Timeout(1)
+	assert.NoError(t, err)
+	assert.Equal(t, []EventType{EventTurnTimedOut, EventTurnChanged}, eventTypes(events))
+	assert.Equal(t, 1, events[1].PlayerID)
+}
+
+func TestGame_RemovePlayerHandsOnTurn(t *testing.T) {
+	g := startedGame(t, 1234, false, 1, 2, 3)
+	_, err := g.ApplyGuess(1, "1111")
+	assert.NoError(t, err)
+
+	// Player 2 has the turn and leaves; player 3 is next
+	events, err := g.RemovePlayer(2)
+	assert.NoError(t, err)
+	assert.Equal(t, []EventType{EventPlayerRemoved, EventTurnChanged}, eventTypes(events))
+	assert.Equal(t, 3, g.CurrentPlayer())
+
+	// Player 1 leaves while it is player 3's turn; the turn stays put
+	events, err = g.RemovePlayer(1)
+	assert.NoError(t, err)
+	assert.Equal(t, []EventType{EventPlayerRemoved, EventGameAbandoned}, eventTypes(events))
+	assert.Equal(t, 1234, events[1].SecretCode)
+	assert.Equal(t, StateAbandoned, g.State())
+}
+
+func TestGame_RemoveEarlierPlayerKeepsCurrentTurn(t *testing.T) {
+	g := startedGame(t, 1234, false, 1, 2, 3)
+	_, err := g.ApplyGuess(1, "1111")
+	assert.NoError(t, err)
+
+	_, err = g.RemovePlayer(1)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, g.CurrentPlayer())
+	assert.Equal(t, []int{2, 3}, g.Players())
+}
+
+func TestGame_RestartResetsState(t *testing.T) {
+	g := startedGame(t, 1234, false, 1, 2)
+	_, err := g.ApplyGuess(1, "1234")
+	assert.NoError(t, err)
+
+	events, err := g.Restart(5678, []int{2, 1})
+	assert.NoError(t, err)
+	assert.Equal(t, []EventType{EventGameStarted, EventTurnChanged}, eventTypes(events))
+	assert.Equal(t, StateInProgress, g.State())
+	assert.Equal(t, 5678, g.SecretCode())
+	assert.Equal(t, 0, g.GuessCount())
+	assert.Equal(t, 0, g.WinnerID())
+	assert.Equal(t, 2, g.CurrentPlayer())
+
+	_, err = g.Restart(5678, []int{2})
+	assert.ErrorIs(t, err, ErrNotEnoughPlayers)
+}
+
+// --- ScoreGuess tests ---
+
+func TestScoreGuess(t *testing.T) {
+	tests := []struct {
+		guess, secret int
+		expected      Feedback
+	}{
+		{1234, 1234, Feedback{Exact: 4}},
+		{4321, 1234, Feedback{Partial: 4}},
+		{5678, 1234, Feedback{}},
+		{1122, 1212, Feedback{Exact: 2, Partial: 2}},
+		{1111, 1234, Feedback{Exact: 1}},
+		{12, 1200, Feedback{Partial: 4}}, // leading zeros count as digits
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.expected, ScoreGuess(tt.guess, tt.secret), "guess %04d vs %04d", tt.guess, tt.secret)
+	}
+}
+
+// --- Limited attempts and scoring tests ---
+
+func TestGame_GlobalGuessLimitLosesGame(t *testing.T) {
+	g := NewGame(1234, false)
+	g.SetRules(GameRules{MaxGuesses: 3})
+	g.AddPlayer(1)
+	g.AddPlayer(2)
+	g.Start()
+
+	events, err := g.ApplyGuess(1, "1111")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, events[0].GuessesLeft)
+	_, err = g.ApplyGuess(2, "2222")
+	assert.NoError(t, err)
+
+	events, err = g.ApplyGuess(1, "3333")
+	assert.NoError(t, err)
+	assert.Equal(t, []EventType{EventGuessIncorrect, EventGameLost}, eventTypes(events))
+	assert.Equal(t, 1234, events[1].SecretCode)
+	assert.Equal(t, StateLost, g.State())
+	assert.True(t, g.Over())
+}
+
+func TestGame_PerPlayerLimitSkipsExhaustedPlayers(t *testing.T) {
+	g := NewGame(1234, false)
+	g.SetRules(GameRules{MaxGuessesPerPlayer: 2})
+	g.AddPlayer(1)
+	g.AddPlayer(2)
+	g.Start()
+
+	g.ApplyGuess(1, "1111")
+	g.ApplyGuess(2, "2222")
+	g.ApplyGuess(1, "3333")
+
+	// Player 1 has used both guesses, so player 2 keeps the turn after timing out
+	events, err := g.Timeout(2)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, events[1].PlayerID)
+	assert.Equal(t, 0, g.GuessesLeft(1))
+
+	events, err = g.ApplyGuess(2, "4444")
+	assert.NoError(t, err)
+	assert.Equal(t, []EventType{EventGuessIncorrect, EventGameLost}, eventTypes(events))
+}
+
+func TestGame_RemovingLastPlayerWithGuessesLoses(t *testing.T) {
+	g := NewGame(1234, false)
+	g.SetRules(GameRules{MaxGuessesPerPlayer: 1})
+	g.AddPlayer(1)
+	g.AddPlayer(2)
+	g.AddPlayer(3)
+	g.Start()
+
+	g.ApplyGuess(1, "1111")
+	g.ApplyGuess(2, "2222")
+
+	events, err := g.RemovePlayer(3)
+	assert.NoError(t, err)
+	assert.Equal(t, []EventType{EventPlayerRemoved, EventGameLost}, eventTypes(events))
+}
+
+func TestGame_TimeLimitExpiresAndScores(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	g := NewGame(1234, true)
+	g.now = func() time.Time { return now }
+	g.SetRules(GameRules{MaxGuesses: 5, TimeLimit: time.Minute})
+	g.AddPlayer(1)
+	g.Start()
+
+	now = now.Add(20 * time.Second)
+	remaining, limited := g.TimeRemaining()
+	assert.True(t, limited)
+	assert.Equal(t, 40*time.Second, remaining)
+
+	g.ApplyGuess(1, "1111")
+	events, err := g.ApplyGuess(1, "1234")
+	assert.NoError(t, err)
+	assert.Equal(t, ScoreWin(2, 3, 40*time.Second), events[0].Score)
+
+	g.Restart(5678, []int{1})
+	now = now.Add(2 * time.Minute)
+	events, err = g.Expire()
+	assert.NoError(t, err)
+	assert.Equal(t, []EventType{EventGameLost}, eventTypes(events))
+	assert.Equal(t, 5678, events[0].SecretCode)
+}
+
+func TestScoreWin(t *testing.T) {
+	// Unlimited game: bonus for each guess under the free allowance
+	assert.Equal(t, BasePoints+(FreeGuessAllowance-5)*PointsPerFreeGuess, ScoreWin(5, -1, 0))
+	assert.Equal(t, BasePoints, ScoreWin(FreeGuessAllowance+3, -1, 0))
+
+	// Limited game: bonus for spare guesses and for time left on the clock
+	assert.Equal(t, BasePoints+4*PointsPerSpareGuess+30*PointsPerSecondLeft, ScoreWin(6, 4, 30*time.Second))
+	assert.Equal(t, BasePoints, ScoreWin(10, 0, 0))
+}
+
+// --- Race mode tests ---
+
+func startedRace(t *testing.T, rules GameRules, playerIDs ...int) *Game {
+	rules.Mode = ModeRace
+	g := NewGame(1234, false)
+	g.SetRules(rules)
+	for _, id := range playerIDs {
+		assert.NoError(t, g.AddPlayer(id))
+	}
+	events, err := g.Start()
+	assert.NoError(t, err)
+	assert.Equal(t, []EventType{EventGameStarted}, eventTypes(events))
+	return g
+}
+
+func TestGame_RaceLetsEveryoneGuess(t *testing.T) {
+	g := startedRace(t, GameRules{}, 1, 2)
+	assert.Equal(t, 0, g.CurrentPlayer())
+
+	events, err := g.ApplyGuess(2, "1200")
+	assert.NoError(t, err)
+	assert.Equal(t, []EventType{EventGuessIncorrect, EventRaceProgress}, eventTypes(events))
+	assert.Equal(t, 2, events[1].PlayerID)
+	assert.Equal(t, 1, events[1].PlayerGuesses)
+	assert.Equal(t, 2, events[1].BestExact)
+	assert.Equal(t, 0, events[1].Guess, "progress must not reveal the guess")
+
+	// A worse guess keeps the best exact-match count
+	events, err = g.ApplyGuess(2, "5678")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, events[1].PlayerGuesses)
+	assert.Equal(t, 2, events[1].BestExact)
+
+	events, err = g.ApplyGuess(1, "1234")
+	assert.NoError(t, err)
+	assert.Equal(t, []EventType{EventGuessCorrect}, eventTypes(events))
+	assert.Equal(t, 1, events[0].PlayerGuesses)
+	assert.Equal(t, 1, g.WinnerID())
+}
+
+func TestGame_RaceHasNoTurns(t *testing.T) {
+	g := startedRace(t, GameRules{}, 1, 2)
+
+	_, err := g.Timeout(1)
+	assert.ErrorIs(t, err, ErrNoTurns)
+}
+
+func TestGame_RaceLostWhenEveryoneIsOutOfGuesses(t *testing.T) {
+	g := startedRace(t, GameRules{MaxGuessesPerPlayer: 1}, 1, 2, 3)
+
+	g.ApplyGuess(1, "1111")
+	_, err := g.ApplyGuess(1, "2222")
+	assert.ErrorIs(t, err, ErrNoGuessesLeft)
+
+	events, err := g.ApplyGuess(2, "3333")
+	assert.NoError(t, err)
+	assert.Equal(t, []EventType{EventGuessIncorrect, EventRaceProgress}, eventTypes(events))
+
+	// The only player with guesses left leaves, so nobody can win
+	events, err = g.RemovePlayer(3)
+	assert.NoError(t, err)
+	assert.Equal(t, []EventType{EventPlayerRemoved, EventGameLost}, eventTypes(events))
+}
+
+func TestParseGameMode(t *testing.T) {
+	mode, err := ParseGameMode("race")
+	assert.NoError(t, err)
+	assert.Equal(t, ModeRace, mode)
+
+	mode, err = ParseGameMode("turns")
+	assert.NoError(t, err)
+	assert.Equal(t, ModeTurns, mode)
+
+	mode, err = ParseGameMode("duel")
+	assert.NoError(t, err)
+	assert.Equal(t, ModeDuel, mode)
+
+	_, err = ParseGameMode("chaos")
+	assert.Error(t, err)
+}
@@ -0,0 +1,244 @@
+package game
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Formats the game history can be exported in
+const (
+	ExportCSV   = "csv"   // Comma-separated values with a header row
+	ExportJSONL = "jsonl" // JSON Lines: one JSON object per row
+)
+
+// What the rows of an export describe
+const (
+	ExportGames   = "games"   // One row per game
+	ExportGuesses = "guesses" // One row per guess
+)
+
+// resultInProgress is the result of a game still being played, besides
+// the results of ProtocolGameOver
+const resultInProgress = "in_progress"
+
+// GameRow is an exported game. Every column is a flat value of a fixed
+// type, so the rows load straight into a data frame or a columnar format.
+type GameRow struct {
+	GameID      int        `json:"game_id"`
+	Started     time.Time  `json:"started"`
+	Ended       *time.Time `json:"ended"` // Nil while the game is being played
+	DurationSec float64    `json:"duration_seconds"`
+	Players     int        `json:"players"`
+	Duel        bool       `json:"duel"`
+	Secret      string     `json:"secret"` // Empty for duels, whose players each crack their own code
+	Guesses     int        `json:"guesses"`
+	Result      string     `json:"result"` // ResultWon, ResultLost, ResultDraw, ResultAbandoned or in_progress
+	Winner      int        `json:"winner"` // Player ID of the winner, or 0
+	WinningTeam string     `json:"winning_team"`
+	Score       int        `json:"score"`
+}
+
+// GuessRow is an exported guess
+type GuessRow struct {
+	GameID     int       `json:"game_id"`
+	Number     int       `json:"guess_number"` // Position of the guess in its game, from 1
+	Player     int       `json:"player"`
+	Time       time.Time `json:"time"`
+	Secret     string    `json:"secret"`
+	Guess      string    `json:"guess"`
+	Exact      int       `json:"exact"`
+	Partial    int       `json:"partial"`
+	Correct    bool      `json:"correct"`
+	GameResult string    `json:"game_result"`
+}
+
+// gameRowHeader and guessRowHeader name the CSV columns, matching the JSON
+// field names
+var (
+	gameRowHeader = []string{"game_id", "started", "ended", "duration_seconds", "players", "duel", "secret",
+		"guesses", "result", "winner", "winning_team", "score"}
+	guessRowHeader = []string{"game_id", "guess_number", "player", "time", "secret", "guess", "exact", "partial",
+		"correct", "game_result"}
+)
+
+// gameResult describes how a game ended
+func gameResult(game *GameStats) string {
+	switch {
+	case game.Won:
+		return ResultWon
+	case game.Lost:
+		return ResultLost
+	case game.Draw:
+		return ResultDraw
+	case game.EndTime.IsZero():
+		return resultInProgress
+	default:
+		return ResultAbandoned
+	}
+}
+
+// GameRows returns a row for every game that started in the range, oldest
+// first. Only the recent games analytics keeps whole can be exported.
+func (ga *GameAnalytics) GameRows(period TimeRange) []GameRow {
+	ga.mu.RLock()
+	defer ga.mu.RUnlock()
+
+	rows := make([]GameRow, 0)
+	for _, game := range ga.gameHistory {
+		if !period.includes(game.StartTime) {
+			continue
+		}
+		row := GameRow{
+			GameID:      game.ID,
+			Started:     game.StartTime,
+			Players:     game.PlayerCount,
+			Duel:        game.Duel,
+			Guesses:     game.GuessCount,
+			Result:      gameResult(game),
+			Winner:      game.WinnerID,
+			WinningTeam: game.WinningTeam,
+			Score:       game.Score,
+		}
+		if !game.EndTime.IsZero() {
+			ended := game.EndTime
+			row.Ended = &ended
+			row.DurationSec = game.EndTime.Sub(game.StartTime).Round(time.Millisecond).Seconds()
+		}
+		if !game.Duel {
+			row.Secret = formatCode(game.SecretCode)
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+// GuessRows returns a row for every guess made in the recent games that
+// started in the range, in the order they were made
+func (ga *GameAnalytics) GuessRows(period TimeRange) []GuessRow {
+	ga.mu.RLock()
+	defer ga.mu.RUnlock()
+
+	rows := make([]GuessRow, 0)
+	for _, game := range ga.gameHistory {
+		if !period.includes(game.StartTime) {
+			continue
+		}
+		result := gameResult(game)
+		for i, guess := range game.Guesses {
+			rows = append(rows, GuessRow{
+				GameID:     game.ID,
+				Number:     i + 1,
+				Player:     guess.PlayerID,
+				Time:       guess.Time,
+				Secret:     formatCode(guess.Secret),
+				Guess:      formatCode(guess.Guess),
+				Exact:      guess.Feedback.Exact,
+				Partial:    guess.Feedback.Partial,
+				Correct:    guess.Guess == guess.Secret,
+				GameResult: result,
+			})
+		}
+	}
+	return rows
+}
+
+// csvRecord returns the row's columns in the order of gameRowHeader
+func (r GameRow) csvRecord() []string {
+	ended := ""
+	if r.Ended != nil {
+		ended = formatExportTime(*r.Ended)
+	}
+	return []string{strconv.Itoa(r.GameID), formatExportTime(r.Started), ended,
+		strconv.FormatFloat(r.DurationSec, 'f', 3, 64), strconv.Itoa(r.Players), strconv.FormatBool(r.Duel),
+		r.Secret, strconv.Itoa(r.Guesses), r.Result, strconv.Itoa(r.Winner), r.WinningTeam, strconv.Itoa(r.Score)}
+}
+
+// csvRecord returns the row's columns in the order of guessRowHeader
+func (r GuessRow) csvRecord() []string {
+	return []string{strconv.Itoa(r.GameID), strconv.Itoa(r.Number), strconv.Itoa(r.Player),
+		formatExportTime(r.Time), r.Secret, r.Guess, strconv.Itoa(r.Exact), strconv.Itoa(r.Partial),
+		strconv.FormatBool(r.Correct), r.GameResult}
+}
+
+// formatExportTime formats a timestamp as JSON does, in UTC
+func formatExportTime(t time.Time) string {
+	return t.UTC().Format(time.RFC3339Nano)
+}
+
+// Export writes the games (ExportGames) or guesses (ExportGuesses) of the
+// games that started in the range to w, as ExportCSV or ExportJSONL
+func (ga *GameAnalytics) Export(w io.Writer, rows string, format string, period TimeRange) error {
+	var header []string
+	var records [][]string
+	var values []any
+	switch rows {
+	case ExportGames:
+		header = gameRowHeader
+		for _, row := range ga.GameRows(period) {
+			row.Started = row.Started.UTC()
+			if row.Ended != nil {
+				ended := row.Ended.UTC()
+				row.Ended = &ended
+			}
+			records = append(records, row.csvRecord())
+			values = append(values, row)
+		}
+	case ExportGuesses:
+		header = guessRowHeader
+		for _, row := range ga.GuessRows(period) {
+			row.Time = row.Time.UTC()
+			records = append(records, row.csvRecord())
+			values = append(values, row)
+		}
+	default:
+		return fmt.Errorf("unknown rows %q; use %s or %s", rows, ExportGames, ExportGuesses)
+	}
+
+	switch format {
+	case ExportCSV:
+		writer := csv.NewWriter(w)
+		writer.Write(header)
+		writer.WriteAll(records)
+		return writer.Error()
+	case ExportJSONL:
+		encoder := json.NewEncoder(w)
+		for _, value := range values {
+			if err := encoder.Encode(value); err != nil {
+				return err
+			}
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown format %q; use %s or %s", format, ExportCSV, ExportJSONL)
+	}
+}
+
+// handleExportCommand exports the game history for the admin command
+// "export <games|guesses> [csv|jsonl] [from] [to]"
+func handleExportCommand(args []string) string {
+	usage := "Usage: export <games|guesses> [csv|jsonl] [from] [to]\n" +
+		"from and to are dates (2006-01-02) or times (2006-01-02T15:04:05Z); use - to leave one open"
+	if len(args) == 0 {
+		return usage
+	}
+	rows, format := args[0], ExportCSV
+	args = args[1:]
+	if len(args) > 0 && (args[0] == ExportCSV || args[0] == ExportJSONL) {
+		format, args = args[0], args[1:]
+	}
+	period, err := ParseTimeRange(args)
+	if err != nil {
+		return fmt.Sprintf("Error: %v\n%s", err, usage)
+	}
+
+	var export strings.Builder
+	if err := globalAnalytics.Export(&export, rows, format, period); err != nil {
+		return fmt.Sprintf("Error: %v\n%s", err, usage)
+	}
+	return export.String()
+}
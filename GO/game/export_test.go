@@ -0,0 +1,121 @@
+package game
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// testExportAnalytics returns analytics with a won game, a lost game
+// started a day earlier and a duel still being played
+func testExportAnalytics() *GameAnalytics {
+	analytics := NewGameAnalytics()
+	won := analytics.StartGame(1234, 2)
+	analytics.RecordGuess(won, 1, 1243, 1234)
+	analytics.RecordGuess(won, 2, 1234, 1234)
+	analytics.RecordScore(won, 2, 50)
+	analytics.EndGame(won, 2)
+
+	lost := analytics.StartGame(5678, 1)
+	lost.StartTime = won.StartTime.Add(-24 * time.Hour)
+	analytics.RecordGuess(lost, 1, 9999, 5678)
+	analytics.EndGameLost(lost)
+
+	duel := analytics.StartDuel(2)
+	analytics.RecordGuess(duel, 1, 4321, 4312)
+	return analytics
+}
+
+func TestGameAnalytics_GameRows(t *testing.T) {
+	rows := testExportAnalytics().GameRows(TimeRange{})
+	assert.Len(t, rows, 3)
+
+	assert.Equal(t, 1, rows[0].GameID)
+	assert.Equal(t, "1234", rows[0].Secret)
+	assert.Equal(t, ResultWon, rows[0].Result)
+	assert.Equal(t, 2, rows[0].Winner)
+	assert.Equal(t, 2, rows[0].Guesses)
+	assert.Equal(t, 50, rows[0].Score)
+	assert.NotNil(t, rows[0].Ended)
+
+	assert.Equal(t, ResultLost, rows[1].Result)
+	assert.Equal(t, "in_progress", rows[2].Result)
+	assert.Nil(t, rows[2].Ended)
+	assert.Empty(t, rows[2].Secret)
+}
+
+func TestGameAnalytics_ExportsDraws(t *testing.T) {
+	analytics := NewGameAnalytics()
+	duel := analytics.StartDuel(2)
+	analytics.RecordGuess(duel, 1, 4321, 4321)
+	analytics.RecordGuess(duel, 2, 8765, 8765)
+	analytics.EndGameDrawn(duel)
+
+	rows := analytics.GameRows(TimeRange{})
+	assert.Len(t, rows, 1)
+	assert.Equal(t, ResultDraw, rows[0].Result)
+	assert.Zero(t, rows[0].Winner)
+	for _, guess := range analytics.GuessRows(TimeRange{}) {
+		assert.Equal(t, ResultDraw, guess.GameResult)
+	}
+}
+
+func TestGameAnalytics_GuessRowsCarryFeedback(t *testing.T) {
+	rows := testExportAnalytics().GuessRows(TimeRange{})
+	assert.Len(t, rows, 4)
+
+	assert.Equal(t, GuessRow{GameID: 1, Number: 1, Player: 1, Time: rows[0].Time, Secret: "1234", Guess: "1243",
+		Exact: 2, Partial: 2, GameResult: ResultWon}, rows[0])
+	assert.True(t, rows[1].Correct)
+	assert.Equal(t, 4, rows[1].Exact)
+	// A duel guess is scored against the code that player cracks
+	assert.Equal(t, "4312", rows[3].Secret)
+	assert.Equal(t, 2, rows[3].Exact)
+}
+
+func TestGameAnalytics_TimeRangesByStartTime(t *testing.T) {
+	analytics := testExportAnalytics()
+	first := analytics.GameRows(TimeRange{})[0].Started
+
+	rows := analytics.GameRows(TimeRange{From: first.Add(-time.Hour)})
+	assert.Len(t, rows, 2)
+	rows = analytics.GameRows(TimeRange{To: first.Add(-time.Hour)})
+	assert.Len(t, rows, 1)
+	assert.Equal(t, ResultLost, rows[0].Result)
+	assert.Len(t, analytics.GuessRows(TimeRange{To: first.Add(-time.Hour)}), 1)
+}
+
+func TestGameAnalytics_ExportCSV(t *testing.T) {
+	var out strings.Builder
+	assert.NoError(t, testExportAnalytics().Export(&out, ExportGuesses, ExportCSV, TimeRange{}))
+
+	records, err := csv.NewReader(strings.NewReader(out.String())).ReadAll()
+	assert.NoError(t, err)
+	assert.Len(t, records, 5)
+	assert.Equal(t, guessRowHeader, records[0])
+	assert.Equal(t, []string{"1", "1", "1", records[1][3], "1234", "1243", "2", "2", "false", "won"}, records[1])
+	_, err = time.Parse(time.RFC3339Nano, records[1][3])
+	assert.NoError(t, err)
+}
+
+func TestGameAnalytics_ExportJSONLines(t *testing.T) {
+	var out strings.Builder
+	assert.NoError(t, testExportAnalytics().Export(&out, ExportGames, ExportJSONL, TimeRange{}))
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	assert.Len(t, lines, 3)
+	var row map[string]any
+	assert.NoError(t, json.Unmarshal([]byte(lines[0]), &row))
+	assert.Equal(t, "1234", row["secret"])
+	assert.Equal(t, "won", row["result"])
+	for _, column := range gameRowHeader {
+		assert.Contains(t, row, column)
+	}
+
+	assert.Error(t, testExportAnalytics().Export(&out, "players", ExportCSV, TimeRange{}))
+	assert.Error(t, testExportAnalytics().Export(&out, ExportGames, "parquet", TimeRange{}))
+}
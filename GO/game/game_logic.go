@@ -6,11 +6,16 @@ import (
 	"math/rand"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
-// Global random generator
-var rng = rand.New(rand.NewSource(time.Now().UnixNano()))
+// Global random generator, shared by every game session; rngMutex guards it
+// as a rand.Rand isn't safe for concurrent use
+var (
+	rng      = rand.New(rand.NewSource(time.Now().UnixNano()))
+	rngMutex sync.Mutex
+)
 
 func ValidateGuess(input string) (int, error) {
 	// Trim any whitespace
@@ -41,8 +46,15 @@ func ValidateGuess(input string) (int, error) {
 
 func GenerateSecretCode() int {
 	// Generate a random 4-digit number (1000-9999)
+	rngMutex.Lock()
 	num := rng.Intn(9000) + 1000
+	rngMutex.Unlock()
+
+	return transformSecretCode(num)
+}
 
+// transformSecretCode applies the classic secret code rules to a raw number
+func transformSecretCode(num int) int {
 	// Calculate the sum of digits
 	sum := sumOfDigits(num)
 
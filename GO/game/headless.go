@@ -0,0 +1,350 @@
+package game
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+)
+
+// ClientText is the type of the events a Client makes of the server's text,
+// one per line, in Text. The server never sends it.
+const ClientText = "text"
+
+// ErrInvalidGuess is returned for a guess that isn't a 4-digit code
+var ErrInvalidGuess = errors.New("a guess must be a code from 0000 to 9999")
+
+// Client is a connection to a Code Breaker server for programs: everything
+// the server sends arrives as events, and input is sent with its methods.
+// Heartbeats are handled by the client and never delivered.
+type Client struct {
+	conn   net.Conn
+	events chan ProtocolEvent
+	closed chan struct{} // Closed by Close, so read stops waiting for a reader
+	once   sync.Once
+	beat   heartbeat
+
+	mutex sync.Mutex
+	err   error // Why the connection ended
+}
+
+// Dial connects to a server, over TLS if ConfigureClientTLS enabled it, and
+// asks it for protocol events
+func Dial(address string) (*Client, error) {
+	conn, err := dialServer(address)
+	if err != nil {
+		return nil, fmt.Errorf("error connecting to server: %v", err)
+	}
+	client, err := NewClient(conn)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return client, nil
+}
+
+// NewClient starts a client on an open connection
+func NewClient(conn net.Conn) (*Client, error) {
+	c := &Client{conn: conn, events: make(chan ProtocolEvent, 64), closed: make(chan struct{})}
+	if err := c.Send(eventsCommand); err != nil {
+		return nil, err
+	}
+	stop := make(chan struct{})
+	go c.read(stop)
+	startClientHeartbeat(conn, &c.beat, stop, func(err error) {
+		c.fail(err)
+		conn.Close()
+	})
+	return c, nil
+}
+
+// read turns what the server sends into events until the connection ends,
+// and then closes stop
+func (c *Client) read(stop chan struct{}) {
+	defer close(c.events)
+	defer close(stop)
+
+	var reader protocolReader
+	buffer := make([]byte, 4096)
+	for {
+		n, err := c.conn.Read(buffer)
+		if err != nil {
+			c.fail(err)
+			return
+		}
+		c.beat.seen()
+
+		// Within a chunk the text comes before the events
+		texts, events := reader.feed(string(buffer[:n]))
+		ordered := make([]ProtocolEvent, 0, len(texts)+len(events))
+		for _, text := range texts {
+			ordered = append(ordered, ProtocolEvent{Type: ClientText, Text: text})
+		}
+		for _, event := range append(ordered, events...) {
+			if answerPing(c.conn, event) {
+				continue
+			}
+			select {
+			case c.events <- event:
+			case <-c.closed:
+				return
+			}
+		}
+	}
+}
+
+// fail records why the connection ended, unless that is already known
+func (c *Client) fail(err error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.err == nil {
+		c.err = err
+	}
+}
+
+// Events returns the channel the server's events arrive on, in order. It is
+// closed when the connection ends.
+func (c *Client) Events() <-chan ProtocolEvent {
+	return c.events
+}
+
+// Err returns why the connection ended, once Events is closed; io.EOF
+// means the server closed it and ErrPeerSilent that it stopped answering
+func (c *Client) Err() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.err
+}
+
+// Send sends a line of input, such as a name, a chat message or a command
+func (c *Client) Send(line string) error {
+	if _, err := c.conn.Write([]byte(line + "\n")); err != nil {
+		return fmt.Errorf("error sending message to server: %v", err)
+	}
+	return nil
+}
+
+// SubmitGuess sends a guess, or a duel code when the server prompts for one
+func (c *Client) SubmitGuess(code int) error {
+	if code < 0 || code > 9999 {
+		return ErrInvalidGuess
+	}
+	return c.Send(formatCode(code))
+}
+
+// Respond answers the server's offer to play again
+func (c *Client) Respond(playAgain bool) error {
+	if playAgain {
+		return c.Send("yes")
+	}
+	return c.Send("no")
+}
+
+// Close ends the connection
+func (c *Client) Close() error {
+	c.once.Do(func() { close(c.closed) })
+	return c.conn.Close()
+}
+
+// HeadlessOptions configures a client played by a script or a program
+// instead of a person. One of Script and Command must be set.
+type HeadlessOptions struct {
+	Name    string    // Sent first, for the servers that ask for a name
+	Script  string    // File with one input per line, sent as the server asks for them
+	Command []string  // Program that reads the events on stdin and writes inputs on stdout
+	Output  io.Writer // Where the server's text is shown (nil to hide it)
+}
+
+// StartHeadlessClient connects to a server and plays with inputs from a
+// script file or from another program
+func StartHeadlessClient(address string, options HeadlessOptions) error {
+	if (options.Script == "") == (len(options.Command) == 0) {
+		return errors.New("a headless client needs either a script or a command")
+	}
+	if options.Output == nil {
+		options.Output = io.Discard
+	}
+
+	var script []string
+	if options.Script != "" {
+		var err error
+		if script, err = readScript(options.Script); err != nil {
+			return err
+		}
+	}
+
+	client, err := Dial(address)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	if options.Name != "" {
+		if err := client.Send(options.Name); err != nil {
+			return err
+		}
+	}
+
+	if options.Command != nil {
+		err = runCommand(client, options.Command, options.Output)
+	} else {
+		err = runScript(client, script, options.Output)
+	}
+	if errors.Is(err, io.EOF) {
+		// The server ends the connection when the game is over
+		return nil
+	}
+	return err
+}
+
+// readScript reads the inputs of a script, skipping blank lines and
+// comments starting with #
+func readScript(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("error opening script: %v", err)
+	}
+	defer file.Close()
+
+	var lines []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line != "" && !strings.HasPrefix(line, "#") {
+			lines = append(lines, line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading script: %v", err)
+	}
+	return lines, nil
+}
+
+// runScript sends the script's next line every time the server waits for
+// input from us, and leaves once the script is used up
+func runScript(client *Client, script []string, output io.Writer) error {
+	mode := ""
+	for event := range client.Events() {
+		if event.Type == ClientText {
+			fmt.Fprintln(output, event.Text)
+		}
+		if event.Type == ProtocolGameStarted {
+			mode = event.Mode
+		}
+		if !wantsInput(mode, event) {
+			continue
+		}
+
+		if len(script) == 0 {
+			fmt.Fprintln(output, "The script is finished. Leaving the game.")
+			return nil
+		}
+		fmt.Fprintf(output, "> %s\n", script[0])
+		if err := client.Send(script[0]); err != nil {
+			return err
+		}
+		script = script[1:]
+	}
+	return client.Err()
+}
+
+// wantsInput reports whether an event means the server now waits for input
+// from us: our turn, a prompt, or in a race the start of the game and each of
+// our wrong or rejected guesses
+func wantsInput(mode string, event ProtocolEvent) bool {
+	switch event.Type {
+	case ProtocolTurn:
+		return event.Player == event.You
+	case ProtocolPrompt:
+		return true
+	}
+
+	if mode != ModeRace.String() {
+		return false
+	}
+	switch event.Type {
+	case ProtocolGameStarted:
+		return true
+	case ProtocolGuess:
+		return event.Player == event.You && !event.Correct
+	case ClientText:
+		// Races have no turns, so a rejected guess is only told in text
+		return strings.Contains(event.Text, "Try again:")
+	}
+	return false
+}
+
+// runCommand runs a program that plays for us: it gets every event, as one
+// JSON object per line, on its stdin and its stdout lines are sent to the
+// server. It ends when the program exits; when the connection ends first,
+// the program's stdin is closed and it is expected to exit.
+func runCommand(client *Client, command []string, output io.Writer) error {
+	cmd := exec.Command(command[0], command[1:]...)
+	cmd.Stderr = os.Stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("error starting %s: %v", command[0], err)
+	}
+
+	// The program's answers go to the server as they come
+	finished := make(chan error, 1)
+	go func() {
+		scanner := bufio.NewScanner(stdout)
+		for scanner.Scan() {
+			if err := client.Send(strings.TrimSpace(scanner.Text())); err != nil {
+				finished <- err
+				return
+			}
+		}
+		finished <- nil
+	}()
+
+	encoder := json.NewEncoder(stdin)
+	events := client.Events()
+	for events != nil {
+		select {
+		case event, ok := <-events:
+			if !ok {
+				events = nil
+				break
+			}
+			if event.Type == ClientText {
+				fmt.Fprintln(output, event.Text)
+			}
+			if err := encoder.Encode(event); err != nil {
+				// The program stopped reading; wait for it to exit
+				events = nil
+			}
+		case err := <-finished:
+			// The program is done; leave the game
+			stdin.Close()
+			client.Close()
+			if waitErr := cmd.Wait(); err == nil && waitErr != nil {
+				err = fmt.Errorf("%s: %v", command[0], waitErr)
+			}
+			return err
+		}
+	}
+
+	// The connection ended; let the program finish. What it still sends
+	// can't be delivered, so only its exit status matters.
+	stdin.Close()
+	<-finished
+	if err := cmd.Wait(); err != nil {
+		return fmt.Errorf("%s: %v", command[0], err)
+	}
+	return client.Err()
+}
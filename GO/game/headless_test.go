@@ -0,0 +1,88 @@
+package game
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeServer is the server end of a client connection in tests
+type fakeServer struct {
+	conn  net.Conn
+	lines chan string // Lines the client sent
+}
+
+// newFakeServer connects a Client to a fake server
+func newFakeServer(t *testing.T) (*Client, *fakeServer) {
+	serverConn, clientConn := net.Pipe()
+	server := &fakeServer{conn: serverConn, lines: make(chan string, 16)}
+	go func() {
+		scanner := bufio.NewScanner(serverConn)
+		for scanner.Scan() {
+			server.lines <- scanner.Text()
+		}
+		close(server.lines)
+	}()
+
+	client, err := NewClient(clientConn)
+	assert.NoError(t, err)
+	assert.Equal(t, eventsCommand, <-server.lines)
+	return client, server
+}
+
+func TestClient_EventsAndInput(t *testing.T) {
+	client, server := newFakeServer(t)
+
+	go server.conn.Write([]byte("Welcome ann!\n@event {\"type\":\"turn\",\"you\":\"ann\",\"player\":\"ann\",\"seconds\":30}\n"))
+	assert.Equal(t, ProtocolEvent{Type: ClientText, Text: "Welcome ann!"}, <-client.Events())
+	assert.Equal(t, ProtocolEvent{Type: ProtocolTurn, You: "ann", Player: "ann", Seconds: 30}, <-client.Events())
+
+	assert.NoError(t, client.SubmitGuess(42))
+	assert.Equal(t, "0042", <-server.lines)
+	assert.ErrorIs(t, client.SubmitGuess(10000), ErrInvalidGuess)
+	assert.NoError(t, client.Respond(false))
+	assert.Equal(t, "no", <-server.lines)
+
+	// The events channel is closed when the server hangs up
+	server.conn.Close()
+	_, open := <-client.Events()
+	assert.False(t, open)
+	assert.ErrorIs(t, client.Err(), io.EOF)
+}
+
+func TestRunScript_AnswersWhenAsked(t *testing.T) {
+	client, server := newFakeServer(t)
+	defer server.conn.Close()
+
+	done := make(chan error)
+	go func() { done <- runScript(client, []string{"1234", "yes"}, io.Discard) }()
+
+	// Someone else's turn asks nothing of us
+	server.conn.Write([]byte("@event {\"type\":\"turn\",\"you\":\"ann\",\"player\":\"bob\"}\n"))
+	server.conn.Write([]byte("@event {\"type\":\"turn\",\"you\":\"ann\",\"player\":\"ann\"}\n"))
+	assert.Equal(t, "1234", <-server.lines)
+	server.conn.Write([]byte("@event {\"type\":\"prompt\",\"you\":\"ann\",\"prompt\":\"play_again\"}\n"))
+	assert.Equal(t, "yes", <-server.lines)
+
+	// The script is used up, so the client leaves at the next request
+	server.conn.Write([]byte("@event {\"type\":\"turn\",\"you\":\"ann\",\"player\":\"ann\"}\n"))
+	assert.NoError(t, <-done)
+}
+
+func TestWantsInput(t *testing.T) {
+	mine := ProtocolEvent{Type: ProtocolGuess, You: "ann", Player: "ann"}
+	assert.True(t, wantsInput("turns", ProtocolEvent{Type: ProtocolTurn, You: "ann", Player: "ann"}))
+	assert.False(t, wantsInput("turns", ProtocolEvent{Type: ProtocolTurn, You: "ann", Player: "bob"}))
+	assert.True(t, wantsInput("duel", ProtocolEvent{Type: ProtocolPrompt, Prompt: PromptCode}))
+	assert.False(t, wantsInput("turns", mine))
+
+	// Races have no turns: we guess again after each wrong guess
+	assert.True(t, wantsInput("race", ProtocolEvent{Type: ProtocolGameStarted, Mode: "race"}))
+	assert.True(t, wantsInput("race", mine))
+	mine.Correct = true
+	assert.False(t, wantsInput("race", mine))
+	assert.True(t, wantsInput("race", ProtocolEvent{Type: ClientText, Text: "Try again:"}))
+}
@@ -0,0 +1,346 @@
+package game
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"sort"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Health status reported by the health endpoints
+const (
+	HealthOK          = "ok"
+	HealthUnavailable = "unavailable"
+)
+
+// sessionProbeTimeout is how long a game session may keep its lock before
+// readiness considers it stuck
+const sessionProbeTimeout = 500 * time.Millisecond
+
+// errListenerClosed is recorded for a listener that was closed
+var errListenerClosed = errors.New("closed")
+
+// HealthReport is what the health endpoints answer with
+type HealthReport struct {
+	Status    string            `json:"status"`              // HealthOK or HealthUnavailable
+	Listeners map[string]string `json:"listeners,omitempty"` // State of each listener by name
+	Sessions  int               `json:"sessions"`            // Games being played
+	Checks    map[string]string `json:"checks,omitempty"`    // Result of each dependency check by name
+	Draining  bool              `json:"draining"`            // Whether the server is shutting down
+	Problems  []string          `json:"problems,omitempty"`  // Why the status is unavailable
+}
+
+// Health tracks what the health endpoints report: whether the listeners
+// accept connections, whether the game sessions respond, whether
+// dependencies such as storage are reachable, and whether the server is
+// draining its games to shut down
+type Health struct {
+	mutex     sync.Mutex
+	listeners map[string]error        // Listeners by name; nil while accepting
+	sessions  map[*GameSession]bool   // Game sessions being played
+	checks    map[string]func() error // Dependency checks by name
+	draining  bool                    // Whether new games are refused
+}
+
+// NewHealth creates a tracker with nothing to report yet
+func NewHealth() *Health {
+	return &Health{
+		listeners: make(map[string]error),
+		sessions:  make(map[*GameSession]bool),
+		checks:    make(map[string]func() error),
+	}
+}
+
+// serverHealth tracks the health of this process's server
+var serverHealth = NewHealth()
+
+// AddHealthCheck makes readiness depend on check, such as a ping of a storage
+// backend; check returns an error while the dependency is unavailable
+func AddHealthCheck(name string, check func() error) {
+	serverHealth.AddCheck(name, check)
+}
+
+// AddCheck makes readiness depend on check
+func (h *Health) AddCheck(name string, check func() error) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.checks[name] = check
+}
+
+// trackListener records the state of a listener under name. Once the server
+// is draining, a listener that drains refuses new connections.
+func (h *Health) trackListener(name string, listener net.Listener, drains bool) net.Listener {
+	h.mutex.Lock()
+	h.listeners[name] = nil
+	h.mutex.Unlock()
+	return &healthListener{Listener: listener, health: h, name: name, drains: drains}
+}
+
+// listenerFailed records why a listener stopped accepting connections
+func (h *Health) listenerFailed(name string, err error) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.listeners[name] = err
+}
+
+// sessionStarted records that a game session is being played
+func (h *Health) sessionStarted(session *GameSession) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.sessions[session] = true
+}
+
+// sessionFinished records that a game session has ended
+func (h *Health) sessionFinished(session *GameSession) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	delete(h.sessions, session)
+}
+
+// Sessions returns how many game sessions are being played
+func (h *Health) Sessions() int {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	return len(h.sessions)
+}
+
+// Draining reports whether the server is shutting down
+func (h *Health) Draining() bool {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	return h.draining
+}
+
+// Liveness reports whether the server works: its listeners accept
+// connections. A busy game session is left to readiness, as restarting the
+// server would end every other game too.
+func (h *Health) Liveness() HealthReport {
+	report, _ := h.snapshot()
+	report.checkListeners()
+	return report.finish()
+}
+
+// Readiness reports whether the server should be sent new players: it is
+// live, its game listener is up, none of its game sessions are stuck, its
+// dependencies are reachable and it is not draining
+func (h *Health) Readiness() HealthReport {
+	report, sessions := h.snapshot()
+	report.checkListeners()
+	if _, ok := report.Listeners["game"]; !ok {
+		report.Problems = append(report.Problems, "game listener: not started")
+	}
+	for _, session := range sessions {
+		if !session.responsive(sessionProbeTimeout) {
+			session.logger().Warn("Session is not responding to the health check", logEvent, "session_stuck",
+				logDuration, sessionProbeTimeout)
+			report.Problems = append(report.Problems, fmt.Sprintf("session %d is not responding", session.id))
+		}
+	}
+
+	h.mutex.Lock()
+	checks := make(map[string]func() error, len(h.checks))
+	for name, check := range h.checks {
+		checks[name] = check
+	}
+	h.mutex.Unlock()
+
+	for name, check := range checks {
+		if report.Checks == nil {
+			report.Checks = make(map[string]string)
+		}
+		if err := check(); err != nil {
+			report.Checks[name] = err.Error()
+			report.Problems = append(report.Problems, fmt.Sprintf("%s: %v", name, err))
+		} else {
+			report.Checks[name] = HealthOK
+		}
+	}
+	if report.Draining {
+		report.Problems = append(report.Problems, "draining for shutdown")
+	}
+	return report.finish()
+}
+
+// checkListeners adds a problem for each listener that stopped accepting
+// connections
+func (r *HealthReport) checkListeners() {
+	for name, state := range r.Listeners {
+		if state != "listening" {
+			r.Problems = append(r.Problems, fmt.Sprintf("%s listener: %s", name, state))
+		}
+	}
+}
+
+// snapshot returns the state of the listeners and the sessions being played
+func (h *Health) snapshot() (HealthReport, []*GameSession) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	report := HealthReport{Listeners: make(map[string]string), Sessions: len(h.sessions), Draining: h.draining}
+	for name, err := range h.listeners {
+		report.Listeners[name] = "listening"
+		if err != nil {
+			report.Listeners[name] = err.Error()
+		}
+	}
+	sessions := make([]*GameSession, 0, len(h.sessions))
+	for session := range h.sessions {
+		sessions = append(sessions, session)
+	}
+	return report, sessions
+}
+
+// finish sets the report's status from its problems
+func (r HealthReport) finish() HealthReport {
+	sort.Strings(r.Problems)
+	r.Status = HealthOK
+	if len(r.Problems) > 0 {
+		r.Status = HealthUnavailable
+	}
+	return r
+}
+
+// responsive reports whether the session's lock can be taken within wait. A
+// session that holds it longer is stuck, for example writing to a client
+// that stopped reading until the write times out.
+func (session *GameSession) responsive(wait time.Duration) bool {
+	deadline := time.Now().Add(wait)
+	for {
+		if session.mutex.TryLock() {
+			session.mutex.Unlock()
+			return true
+		}
+		if time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// Drain stops new games from starting, tells the players of the games being
+// played that they are the last, and waits up to timeout for them to finish.
+// It reports whether they all did.
+func (h *Health) Drain(timeout time.Duration) bool {
+	h.mutex.Lock()
+	h.draining = true
+	sessions := make([]*GameSession, 0, len(h.sessions))
+	for session := range h.sessions {
+		sessions = append(sessions, session)
+	}
+	h.mutex.Unlock()
+
+	for _, session := range sessions {
+		broadcastMessage(session, "\nThe server is shutting down. This is the last game.")
+	}
+
+	deadline := time.Now().Add(timeout)
+	for h.Sessions() > 0 {
+		if time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	return true
+}
+
+// healthListener records in a Health tracker when its listener stops
+// accepting connections, and refuses connections while the server drains
+type healthListener struct {
+	net.Listener
+	health *Health
+	name   string
+	drains bool // Whether to refuse connections while draining
+}
+
+// Accept returns the next connection, refusing those made while draining
+func (l *healthListener) Accept() (net.Conn, error) {
+	for {
+		conn, err := l.Listener.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				l.health.listenerFailed(l.name, errListenerClosed)
+			}
+			return nil, err
+		}
+		if !l.drains || !l.health.Draining() {
+			return conn, nil
+		}
+		conn.SetWriteDeadline(time.Now().Add(time.Second))
+		conn.Write([]byte("The server is shutting down. Please try again later.\n"))
+		conn.Close()
+	}
+}
+
+// Close stops the listener
+func (l *healthListener) Close() error {
+	l.health.listenerFailed(l.name, errListenerClosed)
+	return l.Listener.Close()
+}
+
+// listenGame opens the game port, tracked by the health endpoints
+func listenGame() (net.Listener, error) {
+	listener, err := listen("0.0.0.0:8080", gameTLS, abuseGuard)
+	if err != nil {
+		return nil, err
+	}
+	return serverHealth.trackListener("game", listener, true), nil
+}
+
+// StartHealthServer serves the health endpoints over HTTP on address:
+// /healthz (liveness) and /readyz (readiness) answer with a HealthReport,
+// with status 503 if there is a problem
+func StartHealthServer(address string) error {
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return fmt.Errorf("error starting health endpoints: %v", err)
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", healthHandler(serverHealth.Liveness))
+	mux.HandleFunc("/readyz", healthHandler(serverHealth.Readiness))
+	go http.Serve(listener, mux)
+	slog.Info("Health endpoints started", "address", listener.Addr().String())
+	return nil
+}
+
+// healthHandler answers with the report of check
+func healthHandler(check func() HealthReport) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		report := check()
+		w.Header().Set("Content-Type", "application/json")
+		if report.Status != HealthOK {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		json.NewEncoder(w).Encode(report)
+	}
+}
+
+// HandleShutdown drains the server when it is asked to stop (SIGTERM or
+// Ctrl-C), waiting up to timeout for the games being played before exiting.
+// A second signal stops it straight away.
+func HandleShutdown(timeout time.Duration) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, os.Interrupt)
+	go func() {
+		<-signals
+		signal.Stop(signals)
+		slog.Info("Draining for shutdown", logEvent, "drain_started", "sessions", serverHealth.Sessions(),
+			"timeout", timeout)
+		started := time.Now()
+		if serverHealth.Drain(timeout) {
+			slog.Info("All games finished; shutting down", logEvent, "drain_finished",
+				logDuration, time.Since(started).Round(time.Millisecond))
+		} else {
+			slog.Warn("Shutting down with games still being played", logEvent, "drain_timed_out",
+				"sessions", serverHealth.Sessions())
+		}
+		os.Exit(0)
+	}()
+}
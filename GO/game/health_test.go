@@ -0,0 +1,113 @@
+package game
+
+import (
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHealth_ReadyOnceListeningAndChecksPass(t *testing.T) {
+	health := NewHealth()
+	assert.Equal(t, HealthOK, health.Liveness().Status)
+	assert.Contains(t, health.Readiness().Problems, "game listener: not started")
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	tracked := health.trackListener("game", listener, true)
+	assert.Equal(t, HealthOK, health.Readiness().Status)
+
+	storageErr := errors.New("connection refused")
+	health.AddCheck("storage", func() error { return storageErr })
+	report := health.Readiness()
+	assert.Equal(t, HealthUnavailable, report.Status)
+	assert.Equal(t, "connection refused", report.Checks["storage"])
+	assert.Equal(t, HealthOK, health.Liveness().Status)
+
+	storageErr = nil
+	assert.Equal(t, HealthOK, health.Readiness().Status)
+
+	// A listener that stops is a liveness problem
+	tracked.Close()
+	assert.Equal(t, []string{"game listener: closed"}, health.Liveness().Problems)
+}
+
+func TestHealth_ReportsStuckSessionsWhenNotReady(t *testing.T) {
+	health := NewHealth()
+	session := &GameSession{id: 4}
+	health.sessionStarted(session)
+	assert.NotContains(t, health.Readiness().Problems, "session 4 is not responding")
+
+	// A stuck session keeps new players away, but restarting the server
+	// wouldn't help the other games
+	session.mutex.Lock()
+	assert.Contains(t, health.Readiness().Problems, "session 4 is not responding")
+	assert.Equal(t, HealthOK, health.Liveness().Status)
+	session.mutex.Unlock()
+
+	health.sessionFinished(session)
+	assert.Equal(t, 0, health.Sessions())
+}
+
+func TestWriteToClient_DropsClientsThatStopReading(t *testing.T) {
+	saved := clientWriteTimeout
+	defer func() { clientWriteTimeout = saved }()
+	clientWriteTimeout = 20 * time.Millisecond
+
+	serverConn, clientConn := net.Pipe()
+	defer clientConn.Close()
+	started := time.Now()
+	writeToClient(serverConn, "Your turn!")
+	assert.Less(t, time.Since(started), time.Second)
+
+	// The connection is closed, which disconnects the player
+	_, err := clientConn.Read(make([]byte, 16))
+	assert.ErrorIs(t, err, io.EOF)
+}
+
+func TestHealth_DrainRefusesNewPlayersAndWaitsForGames(t *testing.T) {
+	health := NewHealth()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	tracked := health.trackListener("game", listener, true)
+	defer tracked.Close()
+
+	session := &GameSession{id: 1}
+	health.sessionStarted(session)
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		health.sessionFinished(session)
+	}()
+	assert.True(t, health.Drain(time.Second))
+	assert.Contains(t, health.Readiness().Problems, "draining for shutdown")
+	assert.Equal(t, HealthOK, health.Liveness().Status)
+
+	go tracked.Accept()
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	assert.NoError(t, err)
+	defer conn.Close()
+	reply := make([]byte, 128)
+	n, _ := conn.Read(reply)
+	assert.Contains(t, string(reply[:n]), "shutting down")
+
+	health.sessionStarted(&GameSession{})
+	assert.False(t, health.Drain(10*time.Millisecond))
+}
+
+func TestHealthHandler_AnswersUnavailableWith503(t *testing.T) {
+	health := NewHealth()
+
+	recorder := httptest.NewRecorder()
+	healthHandler(health.Readiness)(recorder, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, recorder.Code)
+	assert.Contains(t, recorder.Body.String(), `"status":"unavailable"`)
+
+	recorder = httptest.NewRecorder()
+	healthHandler(health.Liveness)(recorder, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	assert.Equal(t, http.StatusOK, recorder.Code)
+}
@@ -0,0 +1,84 @@
+package game
+
+import (
+	"errors"
+	"net"
+	"sync/atomic"
+	"time"
+)
+
+// Both sides of a connection that uses protocol events check that the other
+// is still there: each sends a ping every heartbeatInterval and gives up on
+// the other after hearing nothing from it for heartbeatTimeout. Clients ping
+// with pingCommand and answer the server's ping events with pongCommand; the
+// server answers pingCommand with a pong event.
+const (
+	pingCommand       = "/ping"
+	pongCommand       = "/pong"
+	heartbeatInterval = 15 * time.Second
+	heartbeatTimeout  = 45 * time.Second
+)
+
+// ErrPeerSilent is returned when the other side of a connection stopped
+// answering pings
+var ErrPeerSilent = errors.New("no heartbeat received in time")
+
+// heartbeat records when a connection last heard from the other side
+type heartbeat struct {
+	lastSeen atomic.Int64 // Unix nanoseconds
+}
+
+// seen records that the other side was just heard from
+func (h *heartbeat) seen() {
+	h.lastSeen.Store(time.Now().UnixNano())
+}
+
+// silence returns how long it has been since the other side was heard from
+func (h *heartbeat) silence() time.Duration {
+	return time.Since(time.Unix(0, h.lastSeen.Load()))
+}
+
+// keepAlive calls ping every interval until stop is closed, and returns
+// ErrPeerSilent once nothing was heard from the other side for timeout
+func keepAlive(beat *heartbeat, interval, timeout time.Duration, ping func(), stop <-chan struct{}) error {
+	beat.seen()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return nil
+		case <-ticker.C:
+			if beat.silence() > timeout {
+				return ErrPeerSilent
+			}
+			ping()
+		}
+	}
+}
+
+// startClientHeartbeat pings the server over conn until stop is closed, and
+// calls silent if the server stops answering. Whatever the client reads from
+// the server must be recorded in beat.
+func startClientHeartbeat(conn net.Conn, beat *heartbeat, stop <-chan struct{}, silent func(error)) {
+	ping := func() { conn.Write([]byte(pingCommand + "\n")) }
+	go func() {
+		if err := keepAlive(beat, heartbeatInterval, heartbeatTimeout, ping, stop); err != nil {
+			silent(err)
+		}
+	}()
+}
+
+// answerPing answers the server's ping events, reporting whether the event
+// was a heartbeat that needs no further handling
+func answerPing(conn net.Conn, event ProtocolEvent) bool {
+	switch event.Type {
+	case ProtocolPing:
+		conn.Write([]byte(pongCommand + "\n"))
+		return true
+	case ProtocolPong:
+		return true
+	}
+	return false
+}
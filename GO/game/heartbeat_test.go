@@ -0,0 +1,110 @@
+package game
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKeepAlive_GivesUpOnSilentPeer(t *testing.T) {
+	var beat heartbeat
+	pings := 0
+	err := keepAlive(&beat, 5*time.Millisecond, 20*time.Millisecond, func() { pings++ }, make(chan struct{}))
+	assert.ErrorIs(t, err, ErrPeerSilent)
+	assert.Greater(t, pings, 0)
+}
+
+func TestKeepAlive_KeepsAnsweringPeer(t *testing.T) {
+	var beat heartbeat
+	stop := make(chan struct{})
+	done := make(chan error)
+	go func() { done <- keepAlive(&beat, 5*time.Millisecond, 20*time.Millisecond, beat.seen, stop) }()
+
+	// A peer that answers every ping is kept however long it is quiet otherwise
+	time.Sleep(100 * time.Millisecond)
+	close(stop)
+	assert.NoError(t, <-done)
+}
+
+func TestReadInput_AnswersPings(t *testing.T) {
+	serverConn, clientConn := net.Pipe()
+	defer clientConn.Close()
+	player := &Player{conn: serverConn, name: "ann"}
+	player.pingable.Store(true)
+
+	inputs := make(chan playerInput, 4)
+	go readInput(player, func(input playerInput) bool {
+		inputs <- input
+		return true
+	})
+
+	// Heartbeats are answered by the reader and never reach the game
+	clientConn.Write([]byte(pingCommand + "\n" + pongCommand + "\n1234\n"))
+	reader := bufio.NewReader(clientConn)
+	for {
+		line, err := reader.ReadString('\n')
+		assert.NoError(t, err)
+		if strings.HasPrefix(line, eventPrefix) {
+			assert.Contains(t, line, `"type":"pong"`)
+			break
+		}
+	}
+	assert.Equal(t, "1234", (<-inputs).text)
+}
+
+func TestReadInput_BuffersPartialLines(t *testing.T) {
+	serverConn, clientConn := net.Pipe()
+	defer clientConn.Close()
+	player := &Player{conn: serverConn, name: "ann"}
+
+	inputs := make(chan playerInput, 4)
+	go readInput(player, func(input playerInput) bool {
+		inputs <- input
+		return true
+	})
+
+	// A guess and the heartbeat's answer arriving in one read stay apart
+	clientConn.Write([]byte("1234\n" + pongCommand + "\n"))
+	assert.Equal(t, "1234", (<-inputs).text)
+
+	// So do a guess and an answer split across reads
+	for _, part := range []string{"56", "78\n/po", "ng\n9", "012\n"} {
+		clientConn.Write([]byte(part))
+	}
+	assert.Equal(t, "5678", (<-inputs).text)
+	assert.Equal(t, "9012", (<-inputs).text)
+}
+
+func TestReadInput_DropsOversizedLinesWhole(t *testing.T) {
+	saved := abuseGuard.Limits()
+	defer abuseGuard.SetLimits(saved)
+	limits := saved
+	limits.MaxMessageSize = 0
+	abuseGuard.SetLimits(limits)
+
+	serverConn, clientConn := net.Pipe()
+	defer clientConn.Close()
+	player := &Player{conn: serverConn, name: "ann"}
+	inputs := make(chan playerInput, 4)
+	go readInput(player, func(input playerInput) bool {
+		inputs <- input
+		return true
+	})
+	replies := make(chan string, 1)
+	go func() {
+		line, _ := bufio.NewReader(clientConn).ReadString('.')
+		replies <- line
+	}()
+
+	// Even with no size limit, a line longer than the buffer is not read as
+	// several guesses
+	clientConn.Write([]byte(strings.Repeat("1234", maxLineSize) + "\n5678\n"))
+	assert.Contains(t, <-replies, fmt.Sprintf("Messages can be at most %d bytes long.", maxLineSize))
+	assert.Equal(t, "5678", (<-inputs).text)
+	assert.Empty(t, inputs)
+}
@@ -0,0 +1,179 @@
+package game
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// historyCommand asks the server for the guesses made so far in the game
+const historyCommand = "/history"
+
+// pastGuess is a guess made in a session's current game
+type pastGuess struct {
+	event  Event         // The engine's guess event
+	player string        // Name of the guesser
+	took   time.Duration // How long the guesser took over it
+}
+
+// handlePlayerCommand handles the commands a player may send at any time:
+// chat, history and event requests. It reports whether the text was a
+// command.
+func handlePlayerCommand(session *GameSession, player *Player, text string) bool {
+	if handleChatCommand(session, player, text) {
+		return true
+	}
+	switch strings.TrimSpace(text) {
+	case historyCommand:
+		sendHistory(session, player)
+		return true
+	case eventsCommand:
+		enableEvents(session, player)
+		return true
+	}
+	return false
+}
+
+// enableEvents starts sending protocol events to a player. A game may have
+// started before the request arrived, so the player is first caught up on
+// the game in progress.
+func enableEvents(session *GameSession, player *Player) {
+	if player.structured.Swap(true) {
+		return
+	}
+
+	session.mutex.Lock()
+	defer session.mutex.Unlock()
+
+	sendEvent(player, ProtocolEvent{Type: ProtocolPlayers, Players: playerNames(session)})
+	switch {
+	case session.game.State() == StateSettingCodes && containsID(session.game.MissingCodes(), player.id):
+		sendEvent(player, ProtocolEvent{Type: ProtocolPrompt, Prompt: PromptCode})
+		return
+	case session.game.State() == StateWaiting && session.game.Rules().Mode == ModeTeams && session.game.TeamOf(player.id) == "":
+		// Teams are chosen before the game starts
+		sendEvent(player, ProtocolEvent{Type: ProtocolPrompt, Prompt: PromptTeam})
+		return
+	case session.game.State() != StateInProgress:
+		return
+	}
+
+	started := ProtocolEvent{Type: ProtocolGameStarted, Players: playerNames(session), Mode: session.game.Rules().Mode.String()}
+	if session.game.Rules().Mode != ModeRace {
+		started.Seconds = int(session.turnTimeLimit.Seconds())
+	}
+	sendEvent(player, started)
+	sendEvent(player, ProtocolEvent{Type: ProtocolHistory, History: historyEntries(session, player.id)})
+
+	if current := session.playerByID(session.game.CurrentPlayer()); current != nil {
+		left := session.turnTimeLimit - time.Since(session.turnStarted)
+		if left < 0 {
+			left = 0
+		}
+		sendEvent(player, ProtocolEvent{Type: ProtocolTurn, Player: current.name,
+			Team: session.game.TeamOf(current.id), Seconds: int(left.Seconds())})
+	}
+}
+
+// recordGuess adds a guess to the history of the session's current game
+func (session *GameSession) recordGuess(event Event, guesser *Player) {
+	session.mutex.Lock()
+	defer session.mutex.Unlock()
+	session.history = append(session.history, pastGuess{event: event, player: guesser.name, took: guesser.guessTook})
+}
+
+// visibleGuess decides what a player may see of a guess, matching the text
+// messages: whether they see it at all and, if so, the feedback they see
+// (nil if it's hidden from them). The caller must hold session.mutex.
+func visibleGuess(session *GameSession, event Event, viewerID int) (bool, *Feedback) {
+	feedback := &event.Feedback
+	if event.Type != EventGuessIncorrect {
+		// A cracked code gives nothing away
+		return true, feedback
+	}
+
+	switch session.game.Rules().Mode {
+	case ModeRace:
+		// The others only hear how a racer is doing, not what they guessed
+		if viewerID != event.PlayerID {
+			return false, nil
+		}
+		return true, feedback
+	case ModeDuel:
+		if viewerID != event.PlayerID {
+			return true, nil
+		}
+		return true, feedback
+	case ModeTeams:
+		if !containsID(session.game.Teammates(event.PlayerID), viewerID) {
+			return true, nil
+		}
+		return true, feedback
+	default:
+		return true, nil
+	}
+}
+
+// historyEntries returns the guess events of the current game that a player
+// may see; the caller must hold session.mutex
+func historyEntries(session *GameSession, viewerID int) []ProtocolEvent {
+	entries := make([]ProtocolEvent, 0, len(session.history))
+	for _, past := range session.history {
+		visible, feedback := visibleGuess(session, past.event, viewerID)
+		if !visible {
+			continue
+		}
+		entries = append(entries, ProtocolEvent{Type: ProtocolGuess, Player: past.player, Team: past.event.Team,
+			Guess: formatCode(past.event.Guess), Feedback: feedback, Correct: past.event.Type != EventGuessIncorrect})
+	}
+	return entries
+}
+
+// guesserView returns the earlier guesses at the code a player is cracking,
+// and the player's new guess, as that player saw them, for the solver to
+// judge the guess by; the caller must hold session.mutex
+func guesserView(session *GameSession, event Event) ([]GuessRecord, GuessRecord) {
+	known := make([]GuessRecord, 0, len(session.history))
+	for _, past := range session.history {
+		// In a duel only our own guesses are about our code
+		if session.game.Rules().Mode == ModeDuel && past.event.PlayerID != event.PlayerID {
+			continue
+		}
+		visible, feedback := visibleGuess(session, past.event, event.PlayerID)
+		if !visible {
+			continue
+		}
+		known = append(known, GuessRecord{Player: past.player, Guess: formatCode(past.event.Guess),
+			Feedback: feedback, Correct: past.event.Type != EventGuessIncorrect})
+	}
+
+	_, feedback := visibleGuess(session, event, event.PlayerID)
+	return known, GuessRecord{Guess: formatCode(event.Guess), Feedback: feedback,
+		Correct: event.Type != EventGuessIncorrect}
+}
+
+// sendHistory lists the guesses of the current game that a player may see
+func sendHistory(session *GameSession, player *Player) {
+	session.mutex.Lock()
+	defer session.mutex.Unlock()
+
+	entries := historyEntries(session, player.id)
+	lines := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		result := "incorrect"
+		switch {
+		case entry.Correct:
+			result = "cracked it"
+		case entry.Feedback != nil:
+			result = describeFeedback(*entry.Feedback)
+		}
+		lines = append(lines, fmt.Sprintf("%d. %s guessed %s - %s", len(lines)+1, entry.Player, entry.Guess, result))
+	}
+
+	if len(lines) == 0 {
+		writeToClient(player.conn, "\nNo guesses yet in this game.")
+	} else {
+		writeToClient(player.conn, "\nGuesses so far:\n"+strings.Join(lines, "\n"))
+	}
+	sendEvent(player, ProtocolEvent{Type: ProtocolHistory, History: entries})
+}
@@ -0,0 +1,121 @@
+package game
+
+import (
+	"bufio"
+	"log/slog"
+	"strings"
+	"time"
+)
+
+// maxLineSize is the longest message read from a player, whatever the
+// abuse limits; longer ones are dropped whole
+const maxLineSize = 4096
+
+// playerInput is a message, or a read error, received from a player
+type playerInput struct {
+	player *Player
+	text   string
+	err    error
+}
+
+// readPlayerInput forwards everything a player sends to the session until the
+// connection fails or the session is finished. Reading continuously (rather
+// than only on the player's turn) lets every player act at any time.
+func readPlayerInput(session *GameSession, player *Player) {
+	readInput(player, session.deliver)
+}
+
+// readInput passes each message a player sends, or the read error that ends
+// the connection, to deliver until the connection fails or deliver returns
+// false. Meanwhile it checks that clients using protocol events are still
+// there, and closes the connection of those that stop answering. Messages
+// beyond the abuse limits are dropped.
+func readInput(player *Player, deliver func(playerInput) bool) {
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		if err := keepAlive(&player.heartbeat, heartbeatInterval, heartbeatTimeout, func() { pingPlayer(player) }, stop); err != nil {
+			slog.Info("Closing a silent connection", logEvent, "heartbeat_timeout",
+				"remote", player.conn.RemoteAddr().String(), "error", err)
+			player.conn.Close()
+		}
+	}()
+
+	limiter := newInputLimiter(abuseGuard, player.conn)
+	// Messages end with a newline; one may arrive over several reads, or
+	// several in one read
+	reader := bufio.NewReaderSize(player.conn, maxLineSize)
+	for {
+		data, err := reader.ReadSlice('\n')
+		oversized := err == bufio.ErrBufferFull
+		for err == bufio.ErrBufferFull {
+			// The rest of a line too long for the buffer is dropped with it
+			_, err = reader.ReadSlice('\n')
+		}
+		if err != nil {
+			deliver(playerInput{player: player, err: err})
+			player.conn.Close()
+			return
+		}
+		player.heartbeat.seen()
+
+		var line, reason string
+		var banned bool
+		if oversized {
+			reason, banned = limiter.tooLong(maxLineSize, time.Now())
+		} else {
+			line = strings.TrimSpace(string(data))
+			if line == "" {
+				continue
+			}
+			reason, banned = limiter.check(line, time.Now())
+		}
+		if reason != "" {
+			writeToClient(player.conn, "\n"+reason)
+			slog.Debug("Message dropped", logEvent, "message_dropped", "ip", limiter.ip, "reason", reason)
+			if banned {
+				slog.Warn("Banning an address after repeated violations", logEvent, "ban", "ip", limiter.ip,
+					logDuration, abuseGuard.Limits().BanDuration)
+				writeToClient(player.conn, "\nYou have been temporarily banned for repeated violations.")
+				player.conn.Close()
+			}
+			continue
+		}
+
+		switch line {
+		case pongCommand:
+			continue
+		case pingCommand:
+			writeEvent(player, ProtocolEvent{Type: ProtocolPong})
+			continue
+		case eventsCommand:
+			// The game decides when to start sending events, but the
+			// heartbeats start now
+			player.pingable.Store(true)
+		}
+		if !deliver(playerInput{player: player, text: line}) {
+			return
+		}
+	}
+}
+
+// pingPlayer checks that a client is still there. Clients without protocol
+// events can't answer, so they are taken to be there as long as they are
+// connected.
+func pingPlayer(player *Player) {
+	if !player.pingable.Load() {
+		player.heartbeat.seen()
+		return
+	}
+	writeEvent(player, ProtocolEvent{Type: ProtocolPing})
+}
+
+// deliver hands input to the session, reporting false once the session is finished
+func (session *GameSession) deliver(input playerInput) bool {
+	select {
+	case session.inputs <- input:
+		return true
+	case <-session.done:
+		return false
+	}
+}
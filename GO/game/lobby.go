@@ -0,0 +1,85 @@
+package game
+
+import (
+	"net"
+	"sync"
+	"time"
+)
+
+// lobbyPlayer is a named player whose connection outlives the games they
+// play, as in tournaments and matchmaking
+type lobbyPlayer struct {
+	id      int          // Stable player ID, used in analytics
+	name    string       // Name the player joined with
+	player  *Player      // Current connection (nil while disconnected)
+	session *GameSession // Game the player is in, if any
+}
+
+// serveLobbyConnection hands a new connection's messages to join until it
+// returns the player they joined as, and everything after that (including
+// the read error that ends the connection) to route. The cluster knows the
+// player is in the lobby while they are connected.
+func serveLobbyConnection(conn net.Conn, lobby string, join func(player *Player, text string) *lobbyPlayer,
+	route func(entry *lobbyPlayer, input playerInput)) {
+	player := &Player{conn: conn}
+	var entry *lobbyPlayer
+	readInput(player, func(input playerInput) bool {
+		// Lobby games start after joining, so there is nothing to catch up on
+		if input.text == eventsCommand {
+			player.structured.Store(true)
+			return true
+		}
+		if entry != nil {
+			route(entry, input)
+			if input.err != nil {
+				cluster.clearPresence(entry.name)
+			}
+			return true
+		}
+		if input.err != nil {
+			conn.Close()
+			return false
+		}
+		if entry = join(player, input.text); entry != nil {
+			cluster.setPresence(entry.name, lobby)
+		}
+		return true
+	})
+}
+
+// deliverToSession hands a lobby player's message to the game they are in,
+// reporting false if they aren't in a game that is still running. The mutex
+// guards entry.session.
+func deliverToSession(mutex *sync.Mutex, entry *lobbyPlayer, input playerInput) bool {
+	mutex.Lock()
+	session := entry.session
+	mutex.Unlock()
+	return session != nil && session.deliver(input)
+}
+
+// newLobbySession creates a session for a single game of connected lobby
+// players, played alone in single-player mode if there is only one; the
+// caller must hold the lock guarding them
+func newLobbySession(entries []*lobbyPlayer, secretCode int, rules GameRules) *GameSession {
+	singlePlayerMode := len(entries) == 1
+	session := &GameSession{
+		id:               nextSessionID(),
+		players:          make([]*Player, 0, len(entries)),
+		game:             NewGame(secretCode, singlePlayerMode),
+		maxPlayers:       len(entries),
+		singlePlayerMode: singlePlayerMode,
+		singleGame:       true,
+		stableIDs:        true,
+		turnTimeLimit:    30 * time.Second, // 30-second time limit for each turn
+		inputs:           make(chan playerInput, 16),
+		done:             make(chan struct{}),
+	}
+	session.game.SetRules(rules)
+	for _, entry := range entries {
+		session.players = append(session.players, entry.player)
+		session.game.AddPlayer(entry.id)
+		entry.session = session
+	}
+	session.startAnalytics(secretCode, len(entries))
+	return session
+}
@@ -0,0 +1,104 @@
+package game
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"sync/atomic"
+	"time"
+)
+
+// Keys of the fields the servers attach to log records, so the records of
+// one match or one player can be picked out of a busy log
+const (
+	logSession  = "session"  // ID of the game session
+	logPlayer   = "player"   // ID of the player
+	logEvent    = "event"    // What happened, such as game_started or guess
+	logDuration = "duration" // How long it took
+)
+
+// Log formats accepted by ConfigureLogging
+const (
+	LogText = "text"
+	LogJSON = "json"
+)
+
+// LogOptions configures the server's log
+type LogOptions struct {
+	Level  string // Least severe level written: debug, info, warn or error
+	Format string // LogText or LogJSON
+}
+
+// ConfigureLogging makes the default logger write records to w in the given
+// format and level. Messages written with the log package go through it too.
+// Guesses are only logged at debug level.
+func ConfigureLogging(options LogOptions, w io.Writer) error {
+	var level slog.Level
+	if options.Level != "" {
+		if err := level.UnmarshalText([]byte(options.Level)); err != nil {
+			return fmt.Errorf("unknown log level %q; use debug, info, warn or error", options.Level)
+		}
+	}
+
+	handlerOptions := &slog.HandlerOptions{Level: level}
+	var handler slog.Handler
+	switch options.Format {
+	case LogText, "":
+		handler = slog.NewTextHandler(w, handlerOptions)
+	case LogJSON:
+		handler = slog.NewJSONHandler(w, handlerOptions)
+	default:
+		return fmt.Errorf("unknown log format %q; use %s or %s", options.Format, LogText, LogJSON)
+	}
+	slog.SetDefault(slog.New(handler))
+	return nil
+}
+
+// lastSessionID numbers the game sessions of every server in this process
+var lastSessionID atomic.Int64
+
+// nextSessionID returns the ID of a new game session
+func nextSessionID() int64 {
+	return lastSessionID.Add(1)
+}
+
+// logger returns the logger for records about the session
+func (session *GameSession) logger() *slog.Logger {
+	return slog.Default().With(logSession, session.id)
+}
+
+// playerLogger returns the logger for records about a player in the session
+func (session *GameSession) playerLogger(player *Player) *slog.Logger {
+	return session.logger().With(logPlayer, player.id)
+}
+
+// logGameEvent records an engine event. Turns and race progress are only
+// logged when debugging, as are the guesses themselves; codes never are.
+func (session *GameSession) logGameEvent(event Event) {
+	logger := session.logger().With(logEvent, event.Type.String())
+	if event.PlayerID != 0 {
+		logger = logger.With(logPlayer, event.PlayerID)
+	}
+
+	switch event.Type {
+	case EventTurnChanged, EventRaceProgress:
+		logger.Debug("Game event")
+	case EventGuessIncorrect, EventCodeCracked:
+		logger.Debug("Guess applied", "guess", formatCode(event.Guess))
+	case EventGuessCorrect, EventGameLost, EventGameAbandoned, EventDuelWon, EventGameDrawn:
+		if event.Type == EventGuessCorrect {
+			logger.Debug("Guess applied", "guess", formatCode(event.Guess))
+		}
+		logger.Info("Game over", logDuration, session.gameDuration())
+	default:
+		logger.Info("Game event")
+	}
+}
+
+// gameDuration returns how long the session's current game has been going
+func (session *GameSession) gameDuration() time.Duration {
+	if session.analytics == nil {
+		return 0
+	}
+	return time.Since(session.analytics.StartTime).Round(time.Millisecond)
+}
@@ -0,0 +1,80 @@
+package game
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// captureLog sends the default logger's records to a buffer as JSON for the
+// rest of the test
+func captureLog(t *testing.T, level string) *bytes.Buffer {
+	saved := slog.Default()
+	t.Cleanup(func() { slog.SetDefault(saved) })
+
+	var buffer bytes.Buffer
+	assert.NoError(t, ConfigureLogging(LogOptions{Level: level, Format: LogJSON}, &buffer))
+	return &buffer
+}
+
+// logRecords decodes the JSON records written to a buffer
+func logRecords(buffer *bytes.Buffer) []map[string]any {
+	var records []map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(buffer.String()), "\n") {
+		record := map[string]any{}
+		if json.Unmarshal([]byte(line), &record) == nil {
+			records = append(records, record)
+		}
+	}
+	return records
+}
+
+func TestConfigureLogging_RejectsUnknownOptions(t *testing.T) {
+	saved := slog.Default()
+	defer slog.SetDefault(saved)
+
+	var buffer bytes.Buffer
+	assert.Error(t, ConfigureLogging(LogOptions{Level: "loud"}, &buffer))
+	assert.Error(t, ConfigureLogging(LogOptions{Format: "xml"}, &buffer))
+	assert.NoError(t, ConfigureLogging(LogOptions{Level: "WARN", Format: LogText}, &buffer))
+
+	slog.Info("hidden")
+	slog.Warn("shown")
+	assert.NotContains(t, buffer.String(), "hidden")
+	assert.Contains(t, buffer.String(), "level=WARN msg=shown")
+}
+
+func TestLogGuess_KeepsGuessesOutOfInfoLogs(t *testing.T) {
+	buffer := captureLog(t, "info")
+	session := &GameSession{id: 7}
+
+	logGuess(session, &Player{id: 2}, "1234", 1500*time.Millisecond, nil)
+
+	records := logRecords(buffer)
+	assert.Len(t, records, 1)
+	assert.Equal(t, "Guess received", records[0]["msg"])
+	assert.Equal(t, float64(7), records[0][logSession])
+	assert.Equal(t, float64(2), records[0][logPlayer])
+	assert.Equal(t, "guess", records[0][logEvent])
+	assert.Equal(t, float64(1500*time.Millisecond), records[0][logDuration])
+	assert.NotContains(t, buffer.String(), "1234")
+}
+
+func TestLogGameEvent_AddsGuessesWhenDebugging(t *testing.T) {
+	buffer := captureLog(t, "debug")
+	session := &GameSession{id: 3, analytics: &GameStats{StartTime: time.Now().Add(-time.Minute)}}
+
+	session.logGameEvent(Event{Type: EventGuessCorrect, PlayerID: 1, Guess: 42, SecretCode: 42})
+
+	records := logRecords(buffer)
+	assert.Len(t, records, 2)
+	assert.Equal(t, "0042", records[0]["guess"])
+	assert.Equal(t, "guess_correct", records[1][logEvent])
+	assert.Equal(t, "Game over", records[1]["msg"])
+	assert.GreaterOrEqual(t, records[1][logDuration], float64(time.Minute))
+}
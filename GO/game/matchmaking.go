@@ -0,0 +1,226 @@
+package game
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"time"
+)
+
+// MatchPreference is the kind of game a player wants to be matched into
+type MatchPreference struct {
+	Mode    GameMode // How players take part in the game
+	Limited bool     // Whether the server's guess and time limits apply
+}
+
+// QueueTicket is a player waiting in a MatchmakingQueue
+type QueueTicket struct {
+	Name       string
+	Rating     int
+	Preference MatchPreference
+	Joined     time.Time // When the player started waiting
+}
+
+// MatchmakingOptions configures how a MatchmakingQueue groups players
+type MatchmakingOptions struct {
+	GroupSize   int           // Players per game in turns and race mode (duels are always 2)
+	InitialBand int           // Widest rating difference accepted right away
+	WidenBy     int           // How much the band grows every WidenEvery
+	WidenEvery  time.Duration // How often a waiting player's band grows
+}
+
+// DefaultMatchmakingOptions returns the options used when none are given
+func DefaultMatchmakingOptions() MatchmakingOptions {
+	return MatchmakingOptions{
+		GroupSize:   2,
+		InitialBand: 100,
+		WidenBy:     50,
+		WidenEvery:  10 * time.Second,
+	}
+}
+
+// Errors returned by MatchmakingQueue
+var (
+	ErrAlreadyQueued   = errors.New("player is already in the queue")
+	ErrUnsupportedMode = errors.New("that mode can't be matched")
+)
+
+// MatchmakingQueue groups waiting players into games by preference and
+// rating. A player accepts opponents within a rating band that widens the
+// longer they wait, and two players are only grouped if each is within the
+// other's band. Like Game it is transport-free and not safe for concurrent
+// use.
+type MatchmakingQueue struct {
+	options MatchmakingOptions
+	tickets []QueueTicket // Waiting players, longest waiting first
+}
+
+// NewMatchmakingQueue creates an empty queue
+func NewMatchmakingQueue(options MatchmakingOptions) *MatchmakingQueue {
+	if options.GroupSize < 2 {
+		options.GroupSize = 2
+	}
+	if options.WidenEvery <= 0 {
+		options.WidenEvery = DefaultMatchmakingOptions().WidenEvery
+	}
+	return &MatchmakingQueue{
+		options: options,
+		tickets: make([]QueueTicket, 0),
+	}
+}
+
+// Join adds a player to the back of the queue
+func (q *MatchmakingQueue) Join(ticket QueueTicket) error {
+	if ticket.Preference.Mode == ModeTeams {
+		return ErrUnsupportedMode
+	}
+	if q.indexOf(ticket.Name) >= 0 {
+		return ErrAlreadyQueued
+	}
+	q.tickets = append(q.tickets, ticket)
+	return nil
+}
+
+// Leave removes a player from the queue, reporting whether they were in it
+func (q *MatchmakingQueue) Leave(name string) bool {
+	i := q.indexOf(name)
+	if i < 0 {
+		return false
+	}
+	q.tickets = append(q.tickets[:i], q.tickets[i+1:]...)
+	return true
+}
+
+// Tickets returns the waiting players, longest waiting first
+func (q *MatchmakingQueue) Tickets() []QueueTicket {
+	return append([]QueueTicket(nil), q.tickets...)
+}
+
+// Band returns the widest rating difference a player accepts at the given time
+func (q *MatchmakingQueue) Band(ticket QueueTicket, now time.Time) int {
+	waited := now.Sub(ticket.Joined)
+	if waited < 0 {
+		waited = 0
+	}
+	return q.options.InitialBand + q.options.WidenBy*int(waited/q.options.WidenEvery)
+}
+
+// GroupSize returns the number of players in a game of the given preference
+func (q *MatchmakingQueue) GroupSize(preference MatchPreference) int {
+	if preference.Mode == ModeDuel {
+		return 2
+	}
+	return q.options.GroupSize
+}
+
+// FormGroups removes and returns every group of compatible players that can
+// start a game. The longest waiting players are matched first, each with the
+// closest rated compatible players.
+func (q *MatchmakingQueue) FormGroups(now time.Time) [][]QueueTicket {
+	groups := make([][]QueueTicket, 0)
+	matched := make(map[string]bool)
+
+	for _, anchor := range q.tickets {
+		if matched[anchor.Name] {
+			continue
+		}
+
+		candidates := make([]QueueTicket, 0)
+		for _, ticket := range q.tickets {
+			if ticket.Name != anchor.Name && !matched[ticket.Name] && ticket.Preference == anchor.Preference {
+				candidates = append(candidates, ticket)
+			}
+		}
+		sort.SliceStable(candidates, func(i, j int) bool {
+			return ratingGap(anchor, candidates[i]) < ratingGap(anchor, candidates[j])
+		})
+
+		group := []QueueTicket{anchor}
+		size := q.GroupSize(anchor.Preference)
+		for _, candidate := range candidates {
+			if len(group) == size {
+				break
+			}
+			if q.fits(group, candidate, now) {
+				group = append(group, candidate)
+			}
+		}
+		if len(group) < size {
+			continue
+		}
+
+		for _, ticket := range group {
+			matched[ticket.Name] = true
+		}
+		groups = append(groups, group)
+	}
+
+	for name := range matched {
+		q.Leave(name)
+	}
+	return groups
+}
+
+// fits reports whether a player and every member of a group are within each
+// other's bands
+func (q *MatchmakingQueue) fits(group []QueueTicket, candidate QueueTicket, now time.Time) bool {
+	for _, member := range group {
+		gap := ratingGap(member, candidate)
+		if gap > q.Band(member, now) || gap > q.Band(candidate, now) {
+			return false
+		}
+	}
+	return true
+}
+
+// indexOf returns a player's position in the queue, or -1 if not queued
+func (q *MatchmakingQueue) indexOf(name string) int {
+	for i, ticket := range q.tickets {
+		if ticket.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// ratingGap returns the rating difference between two players
+func ratingGap(a, b QueueTicket) int {
+	if a.Rating > b.Rating {
+		return a.Rating - b.Rating
+	}
+	return b.Rating - a.Rating
+}
+
+// ParseMatchRequest reads a player's name and preferences from a line such
+// as "alice race limited". The mode defaults to taking turns.
+func ParseMatchRequest(text string) (string, MatchPreference, error) {
+	fields := strings.Fields(text)
+	if len(fields) == 0 || len(fields[0]) > maxTournamentName {
+		return "", MatchPreference{}, ErrInvalidName
+	}
+
+	preference := MatchPreference{Mode: ModeTurns}
+	for _, option := range fields[1:] {
+		if strings.EqualFold(option, "limited") {
+			preference.Limited = true
+			continue
+		}
+		mode, err := ParseGameMode(strings.ToLower(option))
+		if err != nil {
+			return "", MatchPreference{}, err
+		}
+		if mode == ModeTeams {
+			return "", MatchPreference{}, ErrUnsupportedMode
+		}
+		preference.Mode = mode
+	}
+	return fields[0], preference, nil
+}
+
+// String describes the preference, e.g. "race (limited)"
+func (p MatchPreference) String() string {
+	if p.Limited {
+		return p.Mode.String() + " (limited)"
+	}
+	return p.Mode.String()
+}
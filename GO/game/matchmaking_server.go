@@ -0,0 +1,320 @@
+package game
+
+import (
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MatchmakingServerOptions configures a server that matches players by rating
+type MatchmakingServerOptions struct {
+	Matchmaking MatchmakingOptions // How waiting players are grouped
+	Rules       GameRules          // Guess and time limits for players who ask for limited games
+}
+
+// Matchmaker runs a matchmaking queue over the network: players join the
+// queue as they connect, a GameSession starts whenever a compatible group
+// forms, and players go back into the queue after each game
+type Matchmaker struct {
+	mutex   sync.Mutex
+	queue   *MatchmakingQueue
+	rules   GameRules
+	ratings *RatingBook
+	players map[string]*lobbyPlayer    // Connected players by name
+	wants   map[string]MatchPreference // The kind of game each player asked for
+	games   int                        // Games being played
+	ids     map[string]int             // Stable player IDs by name, used in analytics
+}
+
+// activeMatchmaker is the matchmaker hosted by this server, if any
+var activeMatchmaker *Matchmaker
+
+// NewMatchmaker creates a matchmaker with an empty queue
+func NewMatchmaker(options MatchmakingServerOptions) *Matchmaker {
+	return &Matchmaker{
+		queue:   NewMatchmakingQueue(options.Matchmaking),
+		rules:   options.Rules,
+		ratings: playerRatings,
+		players: make(map[string]*lobbyPlayer),
+		wants:   make(map[string]MatchPreference),
+		ids:     make(map[string]int),
+	}
+}
+
+// StartMatchmakingServer starts the server matching players by rating.
+// Players join the queue by connecting on port 8080; admins follow the
+// queue through the command listener.
+func StartMatchmakingServer(options MatchmakingServerOptions) {
+	// Initialize analytics if not already done
+	if globalAnalytics == nil {
+		InitAnalytics()
+	}
+
+	activeMatchmaker = NewMatchmaker(options)
+
+	slog.Info("Starting matchmaking server")
+	listener, err := listenGame()
+	if err != nil {
+		slog.Error("Error starting server", "error", err)
+		os.Exit(1)
+	}
+	defer listener.Close()
+
+	// Create command listener for admin commands
+	go startCommandListener()
+	cluster.serveLobby(LobbyMatchmaking)
+
+	go activeMatchmaker.run()
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			slog.Error("Error accepting connection", "error", err)
+			continue
+		}
+		go activeMatchmaker.handleConnection(conn)
+	}
+}
+
+// run checks the queue for compatible groups every second
+func (m *Matchmaker) run() {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for now := range ticker.C {
+		m.matchPlayers(now)
+	}
+}
+
+// handleConnection queues a new connection under a player name and then
+// routes the player's messages to their games
+func (m *Matchmaker) handleConnection(conn net.Conn) {
+	if cluster.routeLobby(conn, LobbyMatchmaking) {
+		return
+	}
+	writeToClient(conn, "Welcome to Code Breaker matchmaking! You will be matched with players of similar skill.")
+	writeToClient(conn, "\nIt's your turn to join. Enter your name and preferred mode, e.g. 'alice race' "+
+		"(modes: turns, race, duel; add 'limited' for guess and time limits):")
+	serveLobbyConnection(conn, LobbyMatchmaking, m.join, m.route)
+}
+
+// join queues a player under the name and preferences they sent. It returns
+// nil if the request can't be used.
+func (m *Matchmaker) join(player *Player, text string) *lobbyPlayer {
+	name, preference, err := ParseMatchRequest(text)
+	if err != nil {
+		writeToClient(player.conn, err.Error()+"\nTry again:")
+		return nil
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if _, exists := m.players[name]; exists {
+		writeToClient(player.conn, "That name is already taken.\nTry again:")
+		return nil
+	}
+
+	// A player keeps their ID when they come back, as they keep their rating
+	if _, exists := m.ids[name]; !exists {
+		m.ids[name] = len(m.ids) + 1
+	}
+	player.id, player.name = m.ids[name], name
+	entry := &lobbyPlayer{id: player.id, name: name, player: player}
+	m.players[name] = entry
+	m.wants[name] = preference
+
+	slog.Info("Player joined the matchmaking queue", logEvent, "queue_joined", logPlayer, entry.id, "name", name,
+		"preference", preference.String())
+	m.enqueue(entry)
+	return entry
+}
+
+// enqueue puts a connected player at the back of the queue; the caller must
+// hold m.mutex
+func (m *Matchmaker) enqueue(entry *lobbyPlayer) {
+	preference := m.wants[entry.name]
+	rating := m.ratings.Rating(entry.name)
+	ticket := QueueTicket{Name: entry.name, Rating: rating, Preference: preference, Joined: time.Now()}
+	if err := m.queue.Join(ticket); err != nil {
+		slog.Warn("Could not queue player", logPlayer, entry.id, "name", entry.name, "error", err)
+		return
+	}
+	writeToClient(entry.player.conn, fmt.Sprintf("\nYou are in the queue as %s (rating %d) for %s games. Looking for opponents...",
+		entry.name, rating, preference))
+}
+
+// route hands a player's message to their game, or answers it from the
+// queue between games
+func (m *Matchmaker) route(entry *lobbyPlayer, input playerInput) {
+	delivered := deliverToSession(&m.mutex, entry, input)
+	if input.err != nil {
+		m.mutex.Lock()
+		entry.player = nil
+		m.queue.Leave(entry.name)
+		if entry.session == nil {
+			m.remove(entry)
+		}
+		m.mutex.Unlock()
+		slog.Info("Player left matchmaking", logEvent, "player_left", logPlayer, entry.id, "name", entry.name,
+			"error", input.err)
+		return
+	}
+	if !delivered {
+		writeToClient(input.player.conn, "\nStill looking for opponents. Please wait.")
+	}
+}
+
+// remove forgets a player who has left; the caller must hold m.mutex
+func (m *Matchmaker) remove(entry *lobbyPlayer) {
+	delete(m.players, entry.name)
+	delete(m.wants, entry.name)
+}
+
+// matchPlayers starts a game for every compatible group in the queue
+func (m *Matchmaker) matchPlayers(now time.Time) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	// No new games start once the server is shutting down
+	if serverHealth.Draining() {
+		return
+	}
+	for _, group := range m.queue.FormGroups(now) {
+		entries := make([]*lobbyPlayer, 0, len(group))
+		names := make([]string, 0, len(group))
+		for _, ticket := range group {
+			entries = append(entries, m.players[ticket.Name])
+			names = append(names, fmt.Sprintf("%s (%d)", ticket.Name, ticket.Rating))
+		}
+
+		preference := group[0].Preference
+		rules := GameRules{Mode: preference.Mode}
+		if preference.Limited {
+			rules.MaxGuesses = m.rules.MaxGuesses
+			rules.MaxGuessesPerPlayer = m.rules.MaxGuessesPerPlayer
+			rules.TimeLimit = m.rules.TimeLimit
+		}
+		session := newLobbySession(entries, GenerateSecretCode(), rules)
+		session.rate = func() map[string]int { return m.rate(session, entries) }
+		m.games++
+
+		description := fmt.Sprintf("%s game: %s", preference, strings.Join(names, " vs "))
+		session.logger().Info("Match found", logEvent, "match_found", "match", description)
+		for _, entry := range entries {
+			writeToClient(entry.player.conn, fmt.Sprintf("\nMatch found! Starting a %s!", description))
+			writeToClient(entry.player.conn, fmt.Sprintf("\nUse %s <message> to chat with the other players at any time.", sayCommand))
+		}
+
+		go m.play(session, entries)
+	}
+}
+
+// play runs a matched game, updates the ratings from its result if the game
+// summary didn't, and puts the players who are still connected back in the
+// queue
+func (m *Matchmaker) play(session *GameSession, entries []*lobbyPlayer) {
+	runGameSession(session)
+	changes := session.rateGame()
+	abandoned := session.game.State() == StateAbandoned
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.games--
+	for _, entry := range entries {
+		entry.session = nil
+		if entry.player == nil {
+			m.remove(entry)
+			continue
+		}
+		if change, rated := changes[entry.name]; rated && abandoned {
+			// A win by forfeit has no summary to show the change
+			writeToClient(entry.player.conn, fmt.Sprintf("\nYour rating is now %d (%+d).", m.ratings.Rating(entry.name), change))
+		}
+		m.enqueue(entry)
+	}
+}
+
+// rate records a finished game in the rating book. A player left alone in
+// an abandoned game wins by forfeit; games nobody won leave the ratings as
+// they were, except duels ending in a draw.
+func (m *Matchmaker) rate(session *GameSession, entries []*lobbyPlayer) map[string]int {
+	winnerID := 0
+	switch session.game.State() {
+	case StateWon:
+		winnerID = session.game.WinnerID()
+	case StateAbandoned:
+		if len(session.players) == 1 {
+			winnerID = session.players[0].id
+		}
+	case StateDraw:
+		names := make([]string, 0, len(entries))
+		for _, entry := range entries {
+			names = append(names, entry.name)
+		}
+		return m.ratings.RecordDraw(names)
+	}
+	if winnerID == 0 {
+		return nil
+	}
+
+	winner, losers := "", make([]string, 0, len(entries)-1)
+	for _, entry := range entries {
+		if entry.id == winnerID {
+			winner = entry.name
+		} else {
+			losers = append(losers, entry.name)
+		}
+	}
+	changes := m.ratings.RecordResult(winner, losers)
+	session.logger().Info("Rated game finished", logEvent, "game_rated", logPlayer, winnerID, "winner", winner,
+		"losers", strings.Join(losers, ", "))
+	return changes
+}
+
+// Report describes the waiting players, the games being played and the
+// best rated players
+func (m *Matchmaker) Report() string {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	now := time.Now()
+	report := "=== CODE BREAKER MATCHMAKING ===\n\n"
+	report += fmt.Sprintf("Players connected: %d\n", len(m.players))
+	report += fmt.Sprintf("Games in progress: %d\n\n", m.games)
+
+	report += "QUEUE:\n"
+	tickets := m.queue.Tickets()
+	if len(tickets) == 0 {
+		report += "Nobody is waiting\n"
+	}
+	for i, ticket := range tickets {
+		report += fmt.Sprintf("%d. %s - rating %d, %s, waiting %ds, band ±%d\n", i+1, ticket.Name, ticket.Rating,
+			ticket.Preference, int(now.Sub(ticket.Joined).Seconds()), m.queue.Band(ticket, now))
+	}
+
+	report += "\nTOP 10 RATINGS:\n"
+	top := m.ratings.Top(10)
+	if len(top) == 0 {
+		report += "No rated games played yet\n"
+	}
+	for i, player := range top {
+		report += fmt.Sprintf("%d. %s - %d (%d games)\n", i+1, player.Name, player.Rating, player.GamesPlayed)
+	}
+	return report
+}
+
+// handleQueueCommand lets admins follow matchmaking with "queue"
+func handleQueueCommand() string {
+	if activeMatchmaker == nil {
+		return "No matchmaking queue is running. Start the server in matchmaking mode to host one."
+	}
+	if elsewhere := cluster.hostedElsewhere(LobbyMatchmaking); elsewhere != "" {
+		return elsewhere
+	}
+	return activeMatchmaker.Report()
+}
@@ -0,0 +1,142 @@
+package game
+
+import (
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// groupNames returns the names in each group formed by the queue
+func groupNames(groups [][]QueueTicket) [][]string {
+	names := make([][]string, len(groups))
+	for i, group := range groups {
+		for _, ticket := range group {
+			names[i] = append(names[i], ticket.Name)
+		}
+	}
+	return names
+}
+
+func TestMatchmakingQueue_GroupsClosestRatings(t *testing.T) {
+	start := time.Now()
+	queue := NewMatchmakingQueue(DefaultMatchmakingOptions())
+	turns := MatchPreference{Mode: ModeTurns}
+	assert.NoError(t, queue.Join(QueueTicket{Name: "ann", Rating: 1200, Preference: turns, Joined: start}))
+	assert.NoError(t, queue.Join(QueueTicket{Name: "bob", Rating: 1500, Preference: turns, Joined: start}))
+	assert.NoError(t, queue.Join(QueueTicket{Name: "cat", Rating: 1250, Preference: turns, Joined: start}))
+	assert.ErrorIs(t, queue.Join(QueueTicket{Name: "ann", Preference: turns}), ErrAlreadyQueued)
+
+	groups := queue.FormGroups(start)
+	assert.Equal(t, [][]string{{"ann", "cat"}}, groupNames(groups))
+	assert.Len(t, queue.Tickets(), 1)
+	assert.Equal(t, "bob", queue.Tickets()[0].Name)
+}
+
+func TestMatchmakingQueue_WidensBandWhileWaiting(t *testing.T) {
+	start := time.Now()
+	queue := NewMatchmakingQueue(MatchmakingOptions{GroupSize: 2, InitialBand: 100, WidenBy: 50, WidenEvery: 10 * time.Second})
+	turns := MatchPreference{Mode: ModeTurns}
+	ann := QueueTicket{Name: "ann", Rating: 1200, Preference: turns, Joined: start}
+	bob := QueueTicket{Name: "bob", Rating: 1400, Preference: turns, Joined: start}
+	assert.NoError(t, queue.Join(ann))
+	assert.NoError(t, queue.Join(bob))
+
+	assert.Equal(t, 100, queue.Band(ann, start))
+	assert.Empty(t, queue.FormGroups(start))
+
+	// Both have to accept the gap, so waiting longer on one side isn't enough
+	assert.Equal(t, 150, queue.Band(ann, start.Add(15*time.Second)))
+	assert.Empty(t, queue.FormGroups(start.Add(15*time.Second)))
+
+	groups := queue.FormGroups(start.Add(20 * time.Second))
+	assert.Equal(t, [][]string{{"ann", "bob"}}, groupNames(groups))
+	assert.Empty(t, queue.Tickets())
+}
+
+func TestMatchmakingQueue_MatchesPreferences(t *testing.T) {
+	start := time.Now()
+	queue := NewMatchmakingQueue(MatchmakingOptions{GroupSize: 3, InitialBand: 100, WidenBy: 50, WidenEvery: time.Second})
+	race := MatchPreference{Mode: ModeRace}
+	duel := MatchPreference{Mode: ModeDuel}
+	limitedRace := MatchPreference{Mode: ModeRace, Limited: true}
+	assert.NoError(t, queue.Join(QueueTicket{Name: "ann", Rating: 1200, Preference: race, Joined: start}))
+	assert.NoError(t, queue.Join(QueueTicket{Name: "bob", Rating: 1200, Preference: duel, Joined: start}))
+	assert.NoError(t, queue.Join(QueueTicket{Name: "cat", Rating: 1200, Preference: limitedRace, Joined: start}))
+	assert.NoError(t, queue.Join(QueueTicket{Name: "dan", Rating: 1200, Preference: race, Joined: start}))
+	assert.NoError(t, queue.Join(QueueTicket{Name: "eve", Rating: 1200, Preference: duel, Joined: start}))
+	assert.ErrorIs(t, queue.Join(QueueTicket{Name: "fay", Preference: MatchPreference{Mode: ModeTeams}}), ErrUnsupportedMode)
+
+	// Duels are always two players; races wait for a group of three
+	groups := queue.FormGroups(start)
+	assert.Equal(t, [][]string{{"bob", "eve"}}, groupNames(groups))
+
+	assert.NoError(t, queue.Join(QueueTicket{Name: "gus", Rating: 1250, Preference: race, Joined: start}))
+	groups = queue.FormGroups(start)
+	assert.Equal(t, [][]string{{"ann", "dan", "gus"}}, groupNames(groups))
+
+	assert.True(t, queue.Leave("cat"))
+	assert.False(t, queue.Leave("cat"))
+	assert.Empty(t, queue.Tickets())
+}
+
+func TestParseMatchRequest(t *testing.T) {
+	name, preference, err := ParseMatchRequest("alice race limited")
+	assert.NoError(t, err)
+	assert.Equal(t, "alice", name)
+	assert.Equal(t, MatchPreference{Mode: ModeRace, Limited: true}, preference)
+	assert.Equal(t, "race (limited)", preference.String())
+
+	_, preference, err = ParseMatchRequest("bob")
+	assert.NoError(t, err)
+	assert.Equal(t, MatchPreference{Mode: ModeTurns}, preference)
+
+	_, _, err = ParseMatchRequest("  ")
+	assert.ErrorIs(t, err, ErrInvalidName)
+	_, _, err = ParseMatchRequest("bob teams")
+	assert.ErrorIs(t, err, ErrUnsupportedMode)
+	_, _, err = ParseMatchRequest("bob chess")
+	assert.Error(t, err)
+}
+
+func TestMatchmaker_KeepsPlayerIDsByName(t *testing.T) {
+	m := NewMatchmaker(MatchmakingServerOptions{Matchmaking: DefaultMatchmakingOptions()})
+	connect := func(text string) *lobbyPlayer {
+		serverConn, clientConn := net.Pipe()
+		go io.Copy(io.Discard, clientConn)
+		return m.join(&Player{conn: serverConn}, text)
+	}
+
+	ann, bob := connect("ann race"), connect("bob duel")
+	assert.NotEqual(t, ann.id, bob.id)
+
+	// Ann comes back under the same ID, so her stats stay hers
+	m.route(ann, playerInput{player: ann.player, err: io.EOF})
+	again := connect("ann turns")
+	assert.Equal(t, ann.id, again.id)
+	assert.Equal(t, ann.id, again.player.id)
+}
+
+func TestRatingBook(t *testing.T) {
+	book := NewRatingBook()
+	assert.Equal(t, DefaultRating, book.Rating("ann"))
+
+	changes := book.RecordResult("ann", []string{"bob"})
+	assert.Equal(t, map[string]int{"ann": 16, "bob": -16}, changes)
+	assert.Equal(t, 1216, book.Rating("ann"))
+	assert.Equal(t, 1184, book.Rating("bob"))
+
+	// The favourite gains less for beating a weaker player
+	changes = book.RecordResult("ann", []string{"bob"})
+	assert.Less(t, changes["ann"], 16)
+
+	// In a draw the weaker player gains
+	changes = book.RecordDraw([]string{"ann", "bob"})
+	assert.Greater(t, changes["bob"], 0)
+	assert.Less(t, changes["ann"], 0)
+
+	top := book.Top(1)
+	assert.Equal(t, []RatedPlayer{{Name: "ann", Rating: book.Rating("ann"), GamesPlayed: 3}}, top)
+}
@@ -0,0 +1,237 @@
+package game
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Commands a client answers itself from its guess history and notes
+const (
+	boardCommand   = "/board"  // Show the guesses and notes
+	outCommand     = "/out"    // Mark digits as not in the code
+	inCommand      = "/in"     // Mark digits as in the code
+	unmarkCommand  = "/unmark" // Forget the marks on digits (all without digits)
+	candidateLimit = 10000     // Codes from 0000 to 9999
+)
+
+// DigitMark is a player's note about a digit
+type DigitMark int
+
+const (
+	DigitUnknown    DigitMark = iota // Not marked
+	DigitEliminated                  // Marked as not in the code
+	DigitConfirmed                   // Marked as in the code
+)
+
+// GuessRecord is a guess in a client's history
+type GuessRecord struct {
+	Player   string
+	Guess    string    // Always four digits
+	Feedback *Feedback // nil if the feedback wasn't shared with us
+	Correct  bool
+}
+
+// GuessHistory is a client's record of the guesses of the current game and
+// of the player's deduction notes. It is kept up to date from protocol
+// events and does no I/O.
+type GuessHistory struct {
+	You     string
+	Mode    string
+	Guesses []GuessRecord
+	Marks   [10]DigitMark
+
+	candidates        [2]int // Codes that fit, without and with the notes, cached
+	candidatesCounted bool
+}
+
+// ErrBadNote is returned for a note command without valid digits
+var ErrBadNote = errors.New("name the digits to mark, e.g. /out 1 5 or /in 7")
+
+// NewGuessHistory creates an empty history
+func NewGuessHistory() *GuessHistory {
+	return &GuessHistory{}
+}
+
+// Apply updates the history with a protocol event. A new game has a new code,
+// so it clears both the guesses and the notes.
+func (h *GuessHistory) Apply(event ProtocolEvent) {
+	if event.You != "" {
+		h.You = event.You
+	}
+
+	switch event.Type {
+	case ProtocolGameStarted:
+		h.Mode = event.Mode
+		h.Guesses = nil
+		h.Marks = [10]DigitMark{}
+	case ProtocolGuess:
+		h.Guesses = append(h.Guesses, GuessRecord{Player: event.Player, Guess: event.Guess,
+			Feedback: event.Feedback, Correct: event.Correct})
+	case ProtocolHistory:
+		// The server's history replaces ours, e.g. after joining late
+		h.Guesses = nil
+		for _, guess := range event.History {
+			h.Apply(guess)
+		}
+	default:
+		return
+	}
+	h.candidatesCounted = false
+}
+
+// Note applies a note command such as "/out 1 2" or "/in 7". It reports
+// whether the text was a note command.
+func (h *GuessHistory) Note(text string) (bool, error) {
+	fields := strings.Fields(text)
+	if len(fields) == 0 {
+		return false, nil
+	}
+
+	var mark DigitMark
+	switch fields[0] {
+	case outCommand:
+		mark = DigitEliminated
+	case inCommand:
+		mark = DigitConfirmed
+	case unmarkCommand:
+		mark = DigitUnknown
+		if len(fields) == 1 {
+			h.Marks = [10]DigitMark{}
+			h.candidatesCounted = false
+			return true, nil
+		}
+	default:
+		return false, nil
+	}
+
+	// Digits may be separated or written together, e.g. "/out 125"
+	digits := strings.Join(fields[1:], "")
+	if digits == "" {
+		return true, ErrBadNote
+	}
+	for _, char := range digits {
+		if char < '0' || char > '9' {
+			return true, ErrBadNote
+		}
+	}
+	for _, char := range digits {
+		h.Marks[char-'0'] = mark
+	}
+	h.candidatesCounted = false
+	return true, nil
+}
+
+// Candidates returns how many codes from 0000 to 9999 fit the guesses on the
+// board, and how many of those also fit the notes
+func (h *GuessHistory) Candidates() (int, int) {
+	if h.candidatesCounted {
+		return h.candidates[0], h.candidates[1]
+	}
+
+	// In a duel only our own guesses are about our code
+	known := make([]GuessRecord, 0, len(h.Guesses))
+	for _, guess := range h.Guesses {
+		if h.Mode == ModeDuel.String() && guess.Player != h.You {
+			continue
+		}
+		known = append(known, guess)
+	}
+
+	fit, fitNotes := 0, 0
+	for code := 0; code < candidateLimit; code++ {
+		if !fitsGuesses(code, known) {
+			continue
+		}
+		fit++
+		if h.fitsNotes(code) {
+			fitNotes++
+		}
+	}
+	h.candidates = [2]int{fit, fitNotes}
+	h.candidatesCounted = true
+	return fit, fitNotes
+}
+
+// fitsGuesses reports whether a code could be the secret given the guesses.
+// Guesses with feedback rule out the codes that would score differently,
+// and wrong guesses without it rule out themselves.
+func fitsGuesses(code int, guesses []GuessRecord) bool {
+	for _, guess := range guesses {
+		value, err := strconv.Atoi(guess.Guess)
+		if err != nil {
+			continue
+		}
+		switch {
+		case guess.Correct:
+			if code != value {
+				return false
+			}
+		case guess.Feedback != nil:
+			if ScoreGuess(value, code) != *guess.Feedback {
+				return false
+			}
+		case code == value:
+			return false
+		}
+	}
+	return true
+}
+
+// fitsNotes reports whether a code has none of the eliminated digits and
+// all of the confirmed ones
+func (h *GuessHistory) fitsNotes(code int) bool {
+	digits := formatCode(code)
+	for digit, mark := range h.Marks {
+		contains := strings.ContainsRune(digits, rune('0'+digit))
+		if (mark == DigitEliminated && contains) || (mark == DigitConfirmed && !contains) {
+			return false
+		}
+	}
+	return true
+}
+
+// DescribeFeedback summarizes the feedback of a guess for the board
+func (r GuessRecord) DescribeFeedback() string {
+	switch {
+	case r.Correct:
+		return "CRACKED"
+	case r.Feedback != nil:
+		return fmt.Sprintf("%d exact, %d misplaced", r.Feedback.Exact, r.Feedback.Partial)
+	default:
+		return "-"
+	}
+}
+
+// DescribeMarks shows the notes on every digit, e.g. "0 1x 2 3+ ..." where
+// x means eliminated and + confirmed
+func (h *GuessHistory) DescribeMarks() string {
+	marks := make([]string, len(h.Marks))
+	for digit, mark := range h.Marks {
+		marks[digit] = strconv.Itoa(digit)
+		switch mark {
+		case DigitEliminated:
+			marks[digit] += "x"
+		case DigitConfirmed:
+			marks[digit] += "+"
+		}
+	}
+	return strings.Join(marks, " ")
+}
+
+// Board lists the guesses and notes for the plain client
+func (h *GuessHistory) Board() string {
+	board := "\n=== Your board ===\n"
+	if len(h.Guesses) == 0 {
+		board += "No guesses yet in this game.\n"
+	}
+	for i, guess := range h.Guesses {
+		board += fmt.Sprintf("%2d. %-12s %s  %s\n", i+1, guess.Player, guess.Guess, guess.DescribeFeedback())
+	}
+	fit, fitNotes := h.Candidates()
+	board += fmt.Sprintf("Digits: %s  (x = out, + = in)\n", h.DescribeMarks())
+	board += fmt.Sprintf("Codes that fit: %d (%d with your notes)\n", fit, fitNotes)
+	board += fmt.Sprintf("Mark digits with %s <digits>, %s <digits> or %s [digits].", outCommand, inCommand, unmarkCommand)
+	return board
+}
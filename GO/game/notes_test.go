@@ -0,0 +1,73 @@
+package game
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGuessHistory_CountsCandidates(t *testing.T) {
+	history := NewGuessHistory()
+	history.Apply(ProtocolEvent{Type: ProtocolGameStarted, You: "ann", Mode: "race"})
+	fit, _ := history.Candidates()
+	assert.Equal(t, 10000, fit)
+
+	// A wrong guess without feedback only rules itself out
+	history.Apply(ProtocolEvent{Type: ProtocolGuess, Player: "bob", Guess: "5555"})
+	fit, _ = history.Candidates()
+	assert.Equal(t, 9999, fit)
+
+	// Feedback keeps only the codes that would score the same
+	feedback := ScoreGuess(1234, 4321)
+	history.Apply(ProtocolEvent{Type: ProtocolGuess, Player: "ann", Guess: "1234", Feedback: &feedback})
+	fit, _ = history.Candidates()
+	assert.Less(t, fit, 9999)
+	assert.True(t, fitsGuesses(4321, history.Guesses))
+
+	history.Apply(ProtocolEvent{Type: ProtocolGuess, Player: "ann", Guess: "4321", Correct: true})
+	fit, _ = history.Candidates()
+	assert.Equal(t, 1, fit)
+}
+
+func TestGuessHistory_Notes(t *testing.T) {
+	history := NewGuessHistory()
+
+	isNote, err := history.Note("/out 1 23")
+	assert.True(t, isNote)
+	assert.NoError(t, err)
+	isNote, err = history.Note("/in 7")
+	assert.True(t, isNote)
+	assert.NoError(t, err)
+	assert.Equal(t, "0 1x 2x 3x 4 5 6 7+ 8 9", history.DescribeMarks())
+
+	// Codes with 1, 2 or 3, or without 7, don't fit the notes
+	fit, fitNotes := history.Candidates()
+	assert.Equal(t, 10000, fit)
+	assert.Less(t, fitNotes, fit)
+	assert.True(t, history.fitsNotes(7000))
+	assert.False(t, history.fitsNotes(7100))
+	assert.False(t, history.fitsNotes(4000))
+
+	_, err = history.Note("/out x")
+	assert.ErrorIs(t, err, ErrBadNote)
+	isNote, _ = history.Note("1234")
+	assert.False(t, isNote)
+
+	history.Note("/unmark 7")
+	assert.Equal(t, "0 1x 2x 3x 4 5 6 7 8 9", history.DescribeMarks())
+	history.Note("/unmark")
+	assert.Equal(t, "0 1 2 3 4 5 6 7 8 9", history.DescribeMarks())
+}
+
+func TestGuessHistory_ReplacedByServerHistory(t *testing.T) {
+	history := NewGuessHistory()
+	history.Apply(ProtocolEvent{Type: ProtocolGuess, Player: "bob", Guess: "1111"})
+
+	history.Apply(ProtocolEvent{Type: ProtocolHistory, History: []ProtocolEvent{
+		{Type: ProtocolGuess, Player: "ann", Guess: "1234"},
+		{Type: ProtocolGuess, Player: "bob", Guess: "5678"},
+	}})
+	assert.Len(t, history.Guesses, 2)
+	assert.Equal(t, "1234", history.Guesses[0].Guess)
+	assert.Contains(t, history.Board(), "5678")
+}
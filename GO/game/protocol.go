@@ -0,0 +1,157 @@
+package game
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strings"
+)
+
+// Clients that want structured events send eventsCommand after connecting.
+// From then on the server sends them, alongside the usual text, one JSON
+// object per line prefixed with eventPrefix.
+const (
+	eventsCommand = "/events"
+	eventPrefix   = "@event "
+)
+
+// Types of protocol events
+const (
+	ProtocolGameStarted = "game_started" // Players, Mode and Seconds (turn time limit)
+	ProtocolPlayers     = "players"      // Players in the game changed
+	ProtocolTurn        = "turn"         // Player's turn started, with Seconds to guess
+	ProtocolGuess       = "guess"        // Player guessed; Feedback if the receiver may see it
+	ProtocolProgress    = "progress"     // Race: Player made Guesses, best BestExact in place
+	ProtocolTimeout     = "timeout"      // Player ran out of time
+	ProtocolChat        = "chat"         // Player said Text (to their Team, if set)
+	ProtocolGameOver    = "game_over"    // Result, Winner and Secret of a finished game
+	ProtocolPrompt      = "prompt"       // The server waits for the Prompt input from the receiver
+	ProtocolHistory     = "history"      // History lists the guess events of the game so far
+	ProtocolPing        = "ping"         // The server checks the client is there; answer with /pong
+	ProtocolPong        = "pong"         // The server's answer to /ping
+	ProtocolSummary     = "summary"      // Summary of the game that just ended
+)
+
+// Game results reported by ProtocolGameOver
+const (
+	ResultWon       = "won"
+	ResultLost      = "lost"
+	ResultDraw      = "draw"
+	ResultAbandoned = "abandoned"
+)
+
+// Inputs the server can prompt for with ProtocolPrompt
+const (
+	PromptPlayAgain = "play_again" // "yes" or "no"
+	PromptCode      = "code"       // A code for the duel opponent
+	PromptTeam      = "team"       // A team name or number
+)
+
+// ProtocolEvent is a structured game event sent to clients that asked for
+// them. Fields that don't apply to the event type are left empty.
+type ProtocolEvent struct {
+	Type      string    `json:"type"`
+	You       string    `json:"you,omitempty"`    // Name of the player receiving the event
+	Player    string    `json:"player,omitempty"` // Player the event is about
+	Players   []string  `json:"players,omitempty"`
+	Mode      string    `json:"mode,omitempty"`
+	Team      string    `json:"team,omitempty"`
+	Guess     string    `json:"guess,omitempty"` // Always four digits
+	Feedback  *Feedback `json:"feedback,omitempty"`
+	Correct   bool      `json:"correct,omitempty"`
+	Seconds   int       `json:"seconds,omitempty"`
+	Guesses   int       `json:"guesses,omitempty"`
+	BestExact int       `json:"best_exact,omitempty"`
+	Result    string    `json:"result,omitempty"`
+	Winner    string    `json:"winner,omitempty"`
+	Secret    string    `json:"secret,omitempty"` // Always four digits
+	Text      string    `json:"text,omitempty"`
+	Prompt    string    `json:"prompt,omitempty"`
+
+	History []ProtocolEvent `json:"history,omitempty"`
+	Summary *GameSummary    `json:"summary,omitempty"`
+}
+
+// sendEvent sends a protocol event to a player who asked for them
+func sendEvent(player *Player, event ProtocolEvent) {
+	if !player.structured.Load() {
+		return
+	}
+	writeEvent(player, event)
+}
+
+// writeEvent sends a protocol event to a player
+func writeEvent(player *Player, event ProtocolEvent) {
+	event.You = player.name
+	data, err := json.Marshal(event)
+	if err != nil {
+		slog.Error("Error encoding protocol event", logEvent, event.Type, "error", err)
+		return
+	}
+	writeToClient(player.conn, "\n"+eventPrefix+string(data)+"\n")
+}
+
+// broadcastEvent sends a protocol event to every player in the session who
+// asked for them
+func broadcastEvent(session *GameSession, event ProtocolEvent) {
+	session.mutex.Lock()
+	defer session.mutex.Unlock()
+	for _, player := range session.players {
+		sendEvent(player, event)
+	}
+}
+
+// playerNames lists the names of the session's players; the caller must hold
+// session.mutex
+func playerNames(session *GameSession) []string {
+	names := make([]string, len(session.players))
+	for i, player := range session.players {
+		names[i] = player.name
+	}
+	return names
+}
+
+// formatCode writes a code or guess as four digits
+func formatCode(code int) string {
+	return fmt.Sprintf("%04d", code)
+}
+
+// protocolReader splits what a server sends into text and protocol events.
+// Text isn't newline-terminated, so an unterminated line is passed on as text
+// straight away unless it may be the start of an event.
+type protocolReader struct {
+	pending string // Start of an event line still being received
+}
+
+// feed takes the next chunk read from the server and returns the complete
+// text lines and events in it
+func (r *protocolReader) feed(chunk string) ([]string, []ProtocolEvent) {
+	lines := strings.Split(r.pending+chunk, "\n")
+	r.pending = ""
+
+	// The last line is unterminated; hold it back if it could be an event
+	last := lines[len(lines)-1]
+	lines = lines[:len(lines)-1]
+	if strings.HasPrefix(last, eventPrefix) || strings.HasPrefix(eventPrefix, last) {
+		r.pending = last
+	} else {
+		lines = append(lines, last)
+	}
+
+	texts := make([]string, 0, len(lines))
+	events := make([]ProtocolEvent, 0)
+	for _, line := range lines {
+		line = strings.TrimRight(line, "\r")
+		if strings.HasPrefix(line, eventPrefix) {
+			var event ProtocolEvent
+			if err := json.Unmarshal([]byte(line[len(eventPrefix):]), &event); err == nil {
+				events = append(events, event)
+				continue
+			}
+		}
+		if strings.TrimSpace(line) != "" {
+			texts = append(texts, line)
+		}
+	}
+	return texts, events
+}
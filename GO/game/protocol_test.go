@@ -0,0 +1,29 @@
+package game
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProtocolReader_SplitsTextAndEvents(t *testing.T) {
+	var reader protocolReader
+
+	texts, events := reader.feed("Welcome alice!\nIt's your turn. Enter your guess:")
+	assert.Equal(t, []string{"Welcome alice!", "It's your turn. Enter your guess:"}, texts)
+	assert.Empty(t, events)
+
+	// An event split across reads is held back until its line is complete
+	texts, events = reader.feed("\n@event {\"type\":\"guess\",\"player\":\"bob\",\"gue")
+	assert.Empty(t, texts)
+	assert.Empty(t, events)
+
+	texts, events = reader.feed("ss\":\"0042\",\"feedback\":{\"exact\":1,\"partial\":2}}\nTry again!")
+	assert.Equal(t, []string{"Try again!"}, texts)
+	assert.Equal(t, []ProtocolEvent{{Type: ProtocolGuess, Player: "bob", Guess: "0042", Feedback: &Feedback{Exact: 1, Partial: 2}}}, events)
+
+	// Lines that only look like events are text
+	texts, events = reader.feed("@event not json\n")
+	assert.Equal(t, []string{"@event not json"}, texts)
+	assert.Empty(t, events)
+}
@@ -0,0 +1,130 @@
+package game
+
+import (
+	"math"
+	"sort"
+	"sync"
+)
+
+// Elo rating parameters
+const (
+	DefaultRating = 1200 // Rating of a player who hasn't played a rated game
+	ratingK       = 32   // Most a rating can move in one pairing
+)
+
+// RatedPlayer is a player's entry in a RatingBook
+type RatedPlayer struct {
+	Name        string
+	Rating      int
+	GamesPlayed int
+}
+
+// RatingBook keeps an Elo rating for every named player. It is safe for
+// concurrent use.
+type RatingBook struct {
+	mutex   sync.Mutex
+	ratings map[string]float64
+	games   map[string]int
+}
+
+// playerRatings holds the ratings of the players matched by this server
+var playerRatings = NewRatingBook()
+
+// NewRatingBook creates an empty rating book
+func NewRatingBook() *RatingBook {
+	return &RatingBook{
+		ratings: make(map[string]float64),
+		games:   make(map[string]int),
+	}
+}
+
+// Rating returns a player's current rating
+func (b *RatingBook) Rating(name string) int {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return int(math.Round(b.rating(name)))
+}
+
+// RecordResult updates the ratings after a game in which the winner beat
+// every loser. Each loser counts as a separate pairing against the winner.
+// It returns every player's rating change.
+func (b *RatingBook) RecordResult(winner string, losers []string) map[string]int {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	deltas := make(map[string]float64, len(losers)+1)
+	for _, loser := range losers {
+		change := ratingK * (1 - expectedScore(b.rating(winner), b.rating(loser)))
+		deltas[winner] += change
+		deltas[loser] -= change
+	}
+	return b.apply(deltas)
+}
+
+// RecordDraw updates the ratings after a game between the given players
+// ended without a winner, pairing every player with every other
+func (b *RatingBook) RecordDraw(names []string) map[string]int {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	deltas := make(map[string]float64, len(names))
+	for i, a := range names {
+		for _, other := range names[i+1:] {
+			change := ratingK * (0.5 - expectedScore(b.rating(a), b.rating(other)))
+			deltas[a] += change
+			deltas[other] -= change
+		}
+	}
+	return b.apply(deltas)
+}
+
+// Top returns the n highest rated players, best first
+func (b *RatingBook) Top(n int) []RatedPlayer {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	players := make([]RatedPlayer, 0, len(b.ratings))
+	for name, rating := range b.ratings {
+		players = append(players, RatedPlayer{
+			Name:        name,
+			Rating:      int(math.Round(rating)),
+			GamesPlayed: b.games[name],
+		})
+	}
+	sort.Slice(players, func(i, j int) bool {
+		if players[i].Rating != players[j].Rating {
+			return players[i].Rating > players[j].Rating
+		}
+		return players[i].Name < players[j].Name
+	})
+	if len(players) > n {
+		players = players[:n]
+	}
+	return players
+}
+
+// rating returns a player's unrounded rating; the caller must hold b.mutex
+func (b *RatingBook) rating(name string) float64 {
+	if rating, exists := b.ratings[name]; exists {
+		return rating
+	}
+	return DefaultRating
+}
+
+// apply adds the rating changes of one game, computed from the ratings
+// before it, and returns them rounded; the caller must hold b.mutex
+func (b *RatingBook) apply(deltas map[string]float64) map[string]int {
+	changes := make(map[string]int, len(deltas))
+	for name, delta := range deltas {
+		before := math.Round(b.rating(name))
+		b.ratings[name] = b.rating(name) + delta
+		b.games[name]++
+		changes[name] = int(math.Round(b.ratings[name]) - before)
+	}
+	return changes
+}
+
+// expectedScore is the Elo probability that a player rated a beats one rated b
+func expectedScore(a, b float64) float64 {
+	return 1 / (1 + math.Pow(10, (b-a)/400))
+}
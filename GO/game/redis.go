@@ -0,0 +1,482 @@
+package game
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// redisTimeout bounds connecting to the state store and every command sent to it
+const redisTimeout = 2 * time.Second
+
+// RedisOptions configures a RedisStore
+type RedisOptions struct {
+	Address  string // host:port of the server
+	Password string // Sent with AUTH if set
+	DB       int    // Database selected after connecting
+}
+
+// RedisStore is a StateStore kept by a server that speaks the Redis
+// protocol (RESP), such as Redis, Valkey or ServeStateStore
+type RedisStore struct {
+	options RedisOptions
+	mutex   sync.Mutex
+	conn    net.Conn // Nil until connected, and after the connection fails
+	reader  *bufio.Reader
+}
+
+// NewRedisStore creates a store that connects to the server when first used
+func NewRedisStore(options RedisOptions) *RedisStore {
+	return &RedisStore{options: options}
+}
+
+// redisError is an error reply from the server
+type redisError string
+
+func (e redisError) Error() string {
+	return string(e)
+}
+
+// redisStatus is a simple string reply, such as OK
+type redisStatus string
+
+// Get returns the value of a key, reporting false if there is none
+func (r *RedisStore) Get(key string) (string, bool, error) {
+	reply, err := r.do("GET", key)
+	if err != nil || reply == nil {
+		return "", false, err
+	}
+	value, ok := reply.(string)
+	if !ok {
+		return "", false, fmt.Errorf("unexpected reply to GET: %v", reply)
+	}
+	return value, true, nil
+}
+
+// Set stores a value under a key
+func (r *RedisStore) Set(key, value string, ttl time.Duration) error {
+	_, err := r.do(setCommand(key, value, ttl)...)
+	return err
+}
+
+// SetIfAbsent stores a value only if the key has none, reporting whether it did
+func (r *RedisStore) SetIfAbsent(key, value string, ttl time.Duration) (bool, error) {
+	reply, err := r.do(append(setCommand(key, value, ttl), "NX")...)
+	return err == nil && reply != nil, err
+}
+
+// Delete removes a key
+func (r *RedisStore) Delete(key string) error {
+	_, err := r.do("DEL", key)
+	return err
+}
+
+// Scan returns every key starting with prefix and its value
+func (r *RedisStore) Scan(prefix string) (map[string]string, error) {
+	var keys []string
+	cursor := "0"
+	for {
+		reply, err := r.do("SCAN", cursor, "MATCH", escapeGlob(prefix)+"*", "COUNT", "100")
+		if err != nil {
+			return nil, err
+		}
+		parts, ok := reply.([]any)
+		if !ok || len(parts) != 2 {
+			return nil, fmt.Errorf("unexpected reply to SCAN: %v", reply)
+		}
+		cursor, _ = parts[0].(string)
+		batch, _ := parts[1].([]any)
+		for _, key := range batch {
+			if key, ok := key.(string); ok {
+				keys = append(keys, key)
+			}
+		}
+		if cursor == "0" || cursor == "" {
+			break
+		}
+	}
+
+	found := make(map[string]string, len(keys))
+	if len(keys) == 0 {
+		return found, nil
+	}
+	reply, err := r.do(append([]string{"MGET"}, keys...)...)
+	if err != nil {
+		return nil, err
+	}
+	values, _ := reply.([]any)
+	for i, value := range values {
+		// Keys may expire between the scan and the read
+		if value, ok := value.(string); ok && i < len(keys) {
+			found[keys[i]] = value
+		}
+	}
+	return found, nil
+}
+
+// Ping checks that the store can be reached
+func (r *RedisStore) Ping() error {
+	_, err := r.do("PING")
+	return err
+}
+
+// setCommand builds a SET command that expires after ttl, if it is set
+func setCommand(key, value string, ttl time.Duration) []string {
+	command := []string{"SET", key, value}
+	if ttl > 0 {
+		command = append(command, "PX", strconv.FormatInt(ttl.Milliseconds(), 10))
+	}
+	return command
+}
+
+// do sends a command and returns its reply, connecting first if needed. A
+// connection that fails is dropped, so the next command reconnects.
+func (r *RedisStore) do(args ...string) (any, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.conn == nil {
+		if err := r.connectLocked(); err != nil {
+			return nil, err
+		}
+	}
+	reply, err := r.roundTripLocked(args)
+	var replyErr redisError
+	if err != nil && !errors.As(err, &replyErr) {
+		r.conn.Close()
+		r.conn = nil
+	}
+	return reply, err
+}
+
+// connectLocked connects to the server, authenticates and selects the
+// database; the caller must hold r.mutex
+func (r *RedisStore) connectLocked() error {
+	conn, err := net.DialTimeout("tcp", r.options.Address, redisTimeout)
+	if err != nil {
+		return err
+	}
+	r.conn, r.reader = conn, bufio.NewReader(conn)
+
+	var setup [][]string
+	if r.options.Password != "" {
+		setup = append(setup, []string{"AUTH", r.options.Password})
+	}
+	if r.options.DB != 0 {
+		setup = append(setup, []string{"SELECT", strconv.Itoa(r.options.DB)})
+	}
+	for _, command := range setup {
+		if _, err := r.roundTripLocked(command); err != nil {
+			conn.Close()
+			r.conn = nil
+			return err
+		}
+	}
+	return nil
+}
+
+// roundTripLocked sends a command and reads its reply; the caller must hold
+// r.mutex
+func (r *RedisStore) roundTripLocked(args []string) (any, error) {
+	r.conn.SetDeadline(time.Now().Add(redisTimeout))
+	if _, err := r.conn.Write(encodeCommand(args)); err != nil {
+		return nil, err
+	}
+	reply, err := readReply(r.reader)
+	if err != nil {
+		return nil, err
+	}
+	if replyErr, ok := reply.(redisError); ok {
+		return nil, replyErr
+	}
+	if status, ok := reply.(redisStatus); ok {
+		return string(status), nil
+	}
+	return reply, nil
+}
+
+// encodeCommand encodes a command as an array of bulk strings
+func encodeCommand(args []string) []byte {
+	parts := make([]any, len(args))
+	for i, arg := range args {
+		parts[i] = arg
+	}
+	return encodeReply(parts)
+}
+
+// encodeReply encodes a value in the Redis protocol: redisStatus and
+// redisError as simple strings and errors, strings as bulk strings, nil as a
+// null bulk string, int64 as an integer and []any as an array
+func encodeReply(value any) []byte {
+	switch value := value.(type) {
+	case redisStatus:
+		return []byte("+" + string(value) + "\r\n")
+	case redisError:
+		return []byte("-" + string(value) + "\r\n")
+	case string:
+		return []byte(fmt.Sprintf("$%d\r\n%s\r\n", len(value), value))
+	case int64:
+		return []byte(fmt.Sprintf(":%d\r\n", value))
+	case []any:
+		encoded := []byte(fmt.Sprintf("*%d\r\n", len(value)))
+		for _, item := range value {
+			encoded = append(encoded, encodeReply(item)...)
+		}
+		return encoded
+	default:
+		return []byte("$-1\r\n")
+	}
+}
+
+// readReply reads a value in the Redis protocol, decoded as by encodeReply
+func readReply(reader *bufio.Reader) (any, error) {
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	line = strings.TrimRight(line, "\r\n")
+	if line == "" {
+		return nil, errors.New("empty reply")
+	}
+
+	switch line[0] {
+	case '+':
+		return redisStatus(line[1:]), nil
+	case '-':
+		return redisError(line[1:]), nil
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+	case '$':
+		size, err := strconv.Atoi(line[1:])
+		if err != nil || size < 0 {
+			return nil, err
+		}
+		data := make([]byte, size+2)
+		if _, err := io.ReadFull(reader, data); err != nil {
+			return nil, err
+		}
+		return string(data[:size]), nil
+	case '*':
+		count, err := strconv.Atoi(line[1:])
+		if err != nil || count < 0 {
+			return nil, err
+		}
+		items := make([]any, count)
+		for i := range items {
+			if items[i], err = readReply(reader); err != nil {
+				return nil, err
+			}
+		}
+		return items, nil
+	default:
+		return nil, fmt.Errorf("unexpected reply %q", line)
+	}
+}
+
+// escapeGlob escapes the characters Redis treats specially in patterns
+func escapeGlob(s string) string {
+	var escaped strings.Builder
+	for _, c := range s {
+		if strings.ContainsRune(`*?[]\`, c) {
+			escaped.WriteByte('\\')
+		}
+		escaped.WriteRune(c)
+	}
+	return escaped.String()
+}
+
+// matchGlob reports whether key matches a Redis pattern
+func matchGlob(pattern, key string) bool {
+	var literal strings.Builder
+	for i := 0; i < len(pattern); i++ {
+		switch c := pattern[i]; {
+		case c == '\\' && i+1 < len(pattern):
+			i++
+			literal.WriteByte(pattern[i])
+		case c == '*' && i == len(pattern)-1:
+			return strings.HasPrefix(key, literal.String())
+		case c == '*' || c == '?' || c == '[':
+			matched, _ := path.Match(pattern, key)
+			return matched
+		default:
+			literal.WriteByte(c)
+		}
+	}
+	return key == literal.String()
+}
+
+// StartStateServer serves a MemoryStore over the Redis protocol on address,
+// so several local server replicas can share state without a Redis server
+func StartStateServer(address string) error {
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return err
+	}
+	slog.Info("State server started", "address", listener.Addr().String())
+	return ServeStateStore(listener, NewMemoryStore())
+}
+
+// ServeStateStore answers the Redis protocol commands a RedisStore sends
+// from a MemoryStore, standing in for a Redis server in tests and local
+// setups. It returns when the listener fails.
+func ServeStateStore(listener net.Listener, store *MemoryStore) error {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return err
+		}
+		go serveStateConnection(conn, store)
+	}
+}
+
+// serveStateConnection answers the commands of one connection
+func serveStateConnection(conn net.Conn, store *MemoryStore) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	for {
+		args, err := readCommand(reader)
+		if err != nil {
+			return
+		}
+		if len(args) == 0 {
+			continue
+		}
+		if _, err := conn.Write(encodeReply(runStateCommand(store, args))); err != nil {
+			return
+		}
+	}
+}
+
+// readCommand reads a command sent as an array of bulk strings or, as by
+// hand, as a line of words
+func readCommand(reader *bufio.Reader) ([]string, error) {
+	first, err := reader.Peek(1)
+	if err != nil {
+		return nil, err
+	}
+	if first[0] != '*' {
+		line, err := reader.ReadString('\n')
+		return strings.Fields(line), err
+	}
+
+	reply, err := readReply(reader)
+	if err != nil {
+		return nil, err
+	}
+	parts, _ := reply.([]any)
+	args := make([]string, 0, len(parts))
+	for _, part := range parts {
+		arg, _ := part.(string)
+		args = append(args, arg)
+	}
+	return args, nil
+}
+
+// runStateCommand carries out a command on the store and returns its reply
+func runStateCommand(store *MemoryStore, args []string) any {
+	wrongArgs := redisError(fmt.Sprintf("ERR wrong number of arguments for '%s' command", strings.ToLower(args[0])))
+	switch strings.ToUpper(args[0]) {
+	case "PING":
+		return redisStatus("PONG")
+	case "AUTH", "SELECT":
+		// The stand-in has neither passwords nor databases
+		return redisStatus("OK")
+	case "GET":
+		if len(args) != 2 {
+			return wrongArgs
+		}
+		if value, ok, _ := store.Get(args[1]); ok {
+			return value
+		}
+		return nil
+	case "MGET":
+		values := make([]any, 0, len(args)-1)
+		for _, key := range args[1:] {
+			if value, ok, _ := store.Get(key); ok {
+				values = append(values, value)
+			} else {
+				values = append(values, nil)
+			}
+		}
+		return values
+	case "SET":
+		return runSetCommand(store, args, wrongArgs)
+	case "DEL":
+		var deleted int64
+		for _, key := range args[1:] {
+			if _, ok, _ := store.Get(key); ok {
+				store.Delete(key)
+				deleted++
+			}
+		}
+		return deleted
+	case "SCAN":
+		if len(args) < 2 {
+			return wrongArgs
+		}
+		pattern := "*"
+		for i := 2; i+1 < len(args); i += 2 {
+			if strings.EqualFold(args[i], "MATCH") {
+				pattern = args[i+1]
+			}
+		}
+		all, _ := store.Scan("")
+		keys := make([]any, 0)
+		for key := range all {
+			if matchGlob(pattern, key) {
+				keys = append(keys, key)
+			}
+		}
+		// Everything is returned at once, so the scan is over
+		return []any{"0", keys}
+	default:
+		return redisError(fmt.Sprintf("ERR unknown command '%s'", args[0]))
+	}
+}
+
+// runSetCommand carries out SET key value [NX] [PX ms | EX s]
+func runSetCommand(store *MemoryStore, args []string, wrongArgs redisError) any {
+	if len(args) < 3 {
+		return wrongArgs
+	}
+	var ttl time.Duration
+	onlyIfAbsent := false
+	for i := 3; i < len(args); i++ {
+		switch option := strings.ToUpper(args[i]); option {
+		case "NX":
+			onlyIfAbsent = true
+		case "PX", "EX":
+			if i+1 >= len(args) {
+				return redisError("ERR syntax error")
+			}
+			n, err := strconv.ParseInt(args[i+1], 10, 64)
+			if err != nil || n <= 0 {
+				return redisError("ERR invalid expire time in 'set' command")
+			}
+			ttl = time.Duration(n) * time.Millisecond
+			if option == "EX" {
+				ttl = time.Duration(n) * time.Second
+			}
+			i++
+		default:
+			return redisError("ERR syntax error")
+		}
+	}
+
+	if onlyIfAbsent {
+		if stored, _ := store.SetIfAbsent(args[1], args[2], ttl); !stored {
+			return nil
+		}
+		return redisStatus("OK")
+	}
+	store.Set(args[1], args[2], ttl)
+	return redisStatus("OK")
+}
@@ -0,0 +1,37 @@
+package game
+
+import "time"
+
+// Points awarded for breaking the code
+const (
+	BasePoints          = 100 // Awarded for every win
+	PointsPerSpareGuess = 50  // Per guess left unused when guesses are limited
+	PointsPerSecondLeft = 2   // Per second left on the game clock
+	FreeGuessAllowance  = 20  // Guesses a win may take in an unlimited game before the guess bonus runs out
+	PointsPerFreeGuess  = 10  // Per guess under FreeGuessAllowance in an unlimited game
+)
+
+// ScoreWin returns the points for a win that took guessesUsed guesses, with
+// guessesLeft guesses to spare (-1 when guesses are unlimited) and
+// timeLeft on the game clock (0 when the game is untimed).
+func ScoreWin(guessesUsed, guessesLeft int, timeLeft time.Duration) int {
+	points := BasePoints
+
+	if guessesLeft >= 0 {
+		points += guessesLeft * PointsPerSpareGuess
+	} else if guessesUsed < FreeGuessAllowance {
+		points += (FreeGuessAllowance - guessesUsed) * PointsPerFreeGuess
+	}
+
+	if timeLeft > 0 {
+		points += int(timeLeft.Seconds()) * PointsPerSecondLeft
+	}
+
+	return points
+}
+
+// winningScore scores a win for the given player in this game
+func (g *Game) winningScore(playerID int) int {
+	timeLeft, _ := g.TimeRemaining()
+	return ScoreWin(g.playerGuesses[playerID], g.GuessesLeft(playerID), timeLeft)
+}
@@ -0,0 +1,53 @@
+package game
+
+import (
+	"fmt"
+	"math/rand"
+	"time"
+)
+
+// Secret code rule sets understood by NewSecretGenerator
+const (
+	SecretRulesClassic = "classic" // Random 1000-9999 put through the classic transforms
+	SecretRulesUniform = "uniform" // Any code from 0000 to 9999 with equal probability
+)
+
+// SecretGenerator produces secret codes by drawing a raw number from
+// [Min, Max] and passing it through Transform
+type SecretGenerator struct {
+	Rules     string        // Name of the rule set
+	Min       int           // Smallest raw number drawn
+	Max       int           // Largest raw number drawn
+	Transform func(int) int // Turns a raw number into a secret code
+	rng       *rand.Rand
+}
+
+// NewSecretGenerator creates a generator for the named rule set. A seed of 0
+// seeds the generator from the current time.
+func NewSecretGenerator(rules string, seed int64) (*SecretGenerator, error) {
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	generator := &SecretGenerator{
+		Rules: rules,
+		rng:   rand.New(rand.NewSource(seed)),
+	}
+
+	switch rules {
+	case SecretRulesClassic:
+		generator.Min, generator.Max = 1000, 9999
+		generator.Transform = transformSecretCode
+	case SecretRulesUniform:
+		generator.Min, generator.Max = 0, 9999
+		generator.Transform = func(num int) int { return num }
+	default:
+		return nil, fmt.Errorf("unknown secret rules %q (use %q or %q)", rules, SecretRulesClassic, SecretRulesUniform)
+	}
+
+	return generator, nil
+}
+
+// Next returns a new secret code
+func (sg *SecretGenerator) Next() int {
+	return sg.Transform(sg.rng.Intn(sg.Max-sg.Min+1) + sg.Min)
+}
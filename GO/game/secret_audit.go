@@ -0,0 +1,310 @@
+package game
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// auditListLimit is how many codes the audit report lists in each section,
+// and maxAuditSamples the most codes the admin command may sample
+const (
+	auditListLimit  = 10
+	maxAuditSamples = 10000000
+)
+
+// SecretAudit is the distribution of the codes a secret generator produces,
+// found by putting every raw number through its transform or by sampling it
+type SecretAudit struct {
+	Rules   string              // Name of the generator's rule set
+	Draws   int                 // Raw numbers enumerated or sampled
+	Sampled bool                // Whether the draws were sampled rather than enumerated
+	Counts  [candidateLimit]int // Draws that gave each code
+}
+
+// AuditSecretGenerator finds the distribution of a generator's codes. With
+// no samples it enumerates every raw number from Min to Max, which gives the
+// exact probabilities; otherwise it draws that many codes from the generator.
+func AuditSecretGenerator(generator *SecretGenerator, samples int) *SecretAudit {
+	audit := &SecretAudit{Rules: generator.Rules, Sampled: samples > 0}
+	if samples > 0 {
+		for i := 0; i < samples; i++ {
+			audit.add(generator.Next())
+		}
+		return audit
+	}
+	for num := generator.Min; num <= generator.Max; num++ {
+		audit.add(generator.Transform(num))
+	}
+	return audit
+}
+
+// add counts a drawn code
+func (a *SecretAudit) add(code int) {
+	a.Draws++
+	a.Counts[code]++
+}
+
+// Probability is how likely the generator is to produce a code
+func (a *SecretAudit) Probability(code int) float64 {
+	if a.Draws == 0 || code < 0 || code >= candidateLimit {
+		return 0
+	}
+	return float64(a.Counts[code]) / float64(a.Draws)
+}
+
+// Entropy is the information, in bits, in a code from the generator; a
+// uniform generator gives codeInformation
+func (a *SecretAudit) Entropy() float64 {
+	entropy := 0.0
+	for code := range a.Counts {
+		if p := a.Probability(code); p > 0 {
+			entropy -= p * math.Log2(p)
+		}
+	}
+	return entropy
+}
+
+// Unreachable returns the codes the generator never produced, in order
+func (a *SecretAudit) Unreachable() []int {
+	codes := make([]int, 0)
+	for code, count := range a.Counts {
+		if count == 0 {
+			codes = append(codes, code)
+		}
+	}
+	return codes
+}
+
+// MostLikely returns the N codes the generator produces most often
+func (a *SecretAudit) MostLikely(n int) []int {
+	codes := make([]int, 0, candidateLimit)
+	for code, count := range a.Counts {
+		if count > 0 {
+			codes = append(codes, code)
+		}
+	}
+	sort.SliceStable(codes, func(i, j int) bool {
+		return a.Counts[codes[i]] > a.Counts[codes[j]]
+	})
+	if n > len(codes) {
+		n = len(codes)
+	}
+	return codes[:n]
+}
+
+// ChiSquareUniform tests the draws against every code being equally likely,
+// returning the statistic, its degrees of freedom and the p-value: the
+// chance of a result at least this far from uniform if it were uniform
+func (a *SecretAudit) ChiSquareUniform() ChiSquareResult {
+	expected := float64(a.Draws) / candidateLimit
+	result := ChiSquareResult{DegreesOfFreedom: candidateLimit - 1}
+	for _, count := range a.Counts {
+		diff := float64(count) - expected
+		result.Statistic += diff * diff / expected
+	}
+	result.PValue = chiSquarePValue(result.Statistic, result.DegreesOfFreedom)
+	return result
+}
+
+// Divergence is the chi-square divergence of the distribution from uniform:
+// how much each draw adds, on average, to the chi-square statistic of a
+// sample beyond what chance adds. It is 0 for a uniform generator.
+func (a *SecretAudit) Divergence() float64 {
+	divergence := 0.0
+	for code := range a.Counts {
+		diff := a.Probability(code)*candidateLimit - 1
+		divergence += diff * diff
+	}
+	return divergence / candidateLimit
+}
+
+// DrawsToDetect estimates how many codes must be drawn before a chi-square
+// test would be expected to find, at the 5% level, that they aren't
+// uniform; 0 if the generator is uniform
+func (a *SecretAudit) DrawsToDetect() int {
+	divergence := a.Divergence()
+	if divergence < 1e-12 {
+		return 0
+	}
+	k := float64(candidateLimit - 1)
+	v := 2 / (9 * k)
+	critical := k * math.Pow(1-v+1.645*math.Sqrt(v), 3)
+	return int(math.Ceil((critical - k) / divergence))
+}
+
+// ChiSquareResult is the outcome of a chi-square goodness-of-fit test
+type ChiSquareResult struct {
+	Statistic        float64
+	DegreesOfFreedom int
+	PValue           float64 // Chance of a statistic this large if the counts fit
+}
+
+// chiSquarePValue is the chance of a chi-square statistic of at least x with
+// k degrees of freedom. It uses the Wilson-Hilferty approximation, which is
+// close for the thousands of degrees of freedom of a code distribution.
+func chiSquarePValue(x float64, k int) float64 {
+	if k <= 0 {
+		return 1
+	}
+	v := 2 / (9 * float64(k))
+	z := (math.Cbrt(x/float64(k)) - (1 - v)) / math.Sqrt(v)
+	return 0.5 * math.Erfc(z/math.Sqrt2)
+}
+
+// SecretComparison sets the secret codes games were played with against the
+// distribution of the generator that should have produced them
+type SecretComparison struct {
+	Games      int             // Secret codes observed
+	Distinct   int             // Different codes among them
+	Impossible []int           // Observed codes the generator never produces
+	Fit        ChiSquareResult // Test of the observed counts against the generator
+	Sparse     bool            // Whether too few games were seen for the test to be reliable
+}
+
+// Compare tests the secret codes observed in games, as counted by
+// GameAnalytics, against the generator's distribution
+func (a *SecretAudit) Compare(observed map[int]int) SecretComparison {
+	comparison := SecretComparison{}
+	for code, count := range observed {
+		comparison.Games += count
+		comparison.Distinct++
+		if a.Probability(code) == 0 {
+			comparison.Impossible = append(comparison.Impossible, code)
+		}
+	}
+	sort.Ints(comparison.Impossible)
+
+	reachable := 0
+	for code := range a.Counts {
+		p := a.Probability(code)
+		if p == 0 {
+			continue
+		}
+		reachable++
+		expected := p * float64(comparison.Games)
+		if expected < 5 {
+			// The test needs about five expected games per code
+			comparison.Sparse = true
+		}
+		if expected > 0 {
+			diff := float64(observed[code]) - expected
+			comparison.Fit.Statistic += diff * diff / expected
+		}
+	}
+	comparison.Fit.DegreesOfFreedom = reachable - 1
+	comparison.Fit.PValue = chiSquarePValue(comparison.Fit.Statistic, comparison.Fit.DegreesOfFreedom)
+	return comparison
+}
+
+// Report presents the audit, and its comparison with the codes observed in
+// games if any were
+func (a *SecretAudit) Report(observed map[int]int) string {
+	var report strings.Builder
+	fmt.Fprintf(&report, "=== SECRET CODE AUDIT (%s) ===\n\n", a.Rules)
+	if a.Sampled {
+		fmt.Fprintf(&report, "Sampled %d codes from the generator\n", a.Draws)
+	} else {
+		fmt.Fprintf(&report, "Enumerated all %d raw numbers the generator draws from\n", a.Draws)
+	}
+	unreachable := a.Unreachable()
+	fmt.Fprintf(&report, "Reachable Codes: %d of %d\n", candidateLimit-len(unreachable), candidateLimit)
+	fmt.Fprintf(&report, "Entropy: %.3f bits (%.3f if uniform)\n", a.Entropy(), codeInformation)
+	if a.Sampled {
+		// A sample is tested directly; exact probabilities tell how soon the games would show any bias
+		uniform := a.ChiSquareUniform()
+		fmt.Fprintf(&report, "Chi-Square vs Uniform: %.1f with %d degrees of freedom (p = %.3g)\n",
+			uniform.Statistic, uniform.DegreesOfFreedom, uniform.PValue)
+	} else if draws := a.DrawsToDetect(); draws > 0 {
+		fmt.Fprintf(&report, "Chi-Square Divergence from Uniform: %.4f per code drawn\n", a.Divergence())
+		fmt.Fprintf(&report, "About %d games are enough for a chi-square test to tell the codes aren't uniform (p < 0.05)\n", draws)
+	} else {
+		report.WriteString("Chi-Square Divergence from Uniform: 0 (every code is equally likely)\n")
+	}
+	report.WriteString("\n")
+
+	fmt.Fprintf(&report, "TOP %d MOST LIKELY CODES:\n", auditListLimit)
+	for i, code := range a.MostLikely(auditListLimit) {
+		fmt.Fprintf(&report, "%d. %04d - %.3f%% (%.1fx uniform)\n",
+			i+1, code, a.Probability(code)*100, a.Probability(code)*candidateLimit)
+	}
+
+	heading := "UNREACHABLE CODES"
+	if a.Sampled {
+		heading = "CODES NEVER DRAWN"
+	}
+	fmt.Fprintf(&report, "\n%s: %d\n", heading, len(unreachable))
+	if len(unreachable) > 0 {
+		report.WriteString(listCodes(unreachable) + "\n")
+	}
+
+	report.WriteString("\nOBSERVED SECRET CODES:\n")
+	if len(observed) == 0 {
+		report.WriteString("No data available yet\n")
+		return report.String()
+	}
+	comparison := a.Compare(observed)
+	fmt.Fprintf(&report, "Games: %d, with %d different codes\n", comparison.Games, comparison.Distinct)
+	fmt.Fprintf(&report, "Chi-Square vs Generator: %.1f with %d degrees of freedom (p = %.3g)\n",
+		comparison.Fit.Statistic, comparison.Fit.DegreesOfFreedom, comparison.Fit.PValue)
+	if comparison.Sparse {
+		report.WriteString("Too few games for every code to be expected five times, so the test is only a rough guide\n")
+	}
+	fmt.Fprintf(&report, "Codes the generator can't produce: %d\n", len(comparison.Impossible))
+	if len(comparison.Impossible) > 0 {
+		report.WriteString(listCodes(comparison.Impossible) + "\n")
+	}
+	return report.String()
+}
+
+// listCodes lists the first auditListLimit codes and how many more there are
+func listCodes(codes []int) string {
+	shown := make([]string, 0, auditListLimit)
+	for _, code := range codes[:min(len(codes), auditListLimit)] {
+		shown = append(shown, formatCode(code))
+	}
+	list := strings.Join(shown, ", ")
+	if len(codes) > auditListLimit {
+		list += fmt.Sprintf(" and %d more", len(codes)-auditListLimit)
+	}
+	return list
+}
+
+// GetSecretCounts returns how many times each code was generated as a secret
+func (ga *GameAnalytics) GetSecretCounts() map[int]int {
+	ga.mu.RLock()
+	defer ga.mu.RUnlock()
+
+	counts := make(map[int]int, len(ga.secretCounts))
+	for code, count := range ga.secretCounts {
+		counts[code] = count
+	}
+	return counts
+}
+
+// handleSecretsCommand answers the admin command "secrets [classic|uniform]
+// [samples]": the audit of a secret generator, enumerated or sampled, set
+// against the secret codes of the games played
+func handleSecretsCommand(args []string) string {
+	usage := fmt.Sprintf("Usage: secrets [classic|uniform] [samples], with up to %d samples; "+
+		"without samples every raw number is enumerated", maxAuditSamples)
+	rules := SecretRulesClassic
+	if len(args) > 0 {
+		rules, args = args[0], args[1:]
+	}
+	samples := 0
+	if len(args) > 0 {
+		var err error
+		samples, err = strconv.Atoi(args[0])
+		if err != nil || samples < 0 || samples > maxAuditSamples {
+			return fmt.Sprintf("Error: invalid sample count %q\n%s", args[0], usage)
+		}
+	}
+	generator, err := NewSecretGenerator(rules, 0)
+	if err != nil {
+		return fmt.Sprintf("Error: %v\n%s", err, usage)
+	}
+	return AuditSecretGenerator(generator, samples).Report(globalAnalytics.GetSecretCounts())
+}
@@ -0,0 +1,99 @@
+package game
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// --- SecretGenerator tests ---
+
+func TestSecretGenerator_SeedIsDeterministic(t *testing.T) {
+	for _, rules := range []string{SecretRulesClassic, SecretRulesUniform} {
+		first, err := NewSecretGenerator(rules, 42)
+		assert.NoError(t, err)
+		second, err := NewSecretGenerator(rules, 42)
+		assert.NoError(t, err)
+
+		for i := 0; i < 20; i++ {
+			code := first.Next()
+			assert.Equal(t, code, second.Next())
+			assert.True(t, code >= 0 && code <= 9999, "code %d out of range", code)
+		}
+	}
+}
+
+func TestSecretGenerator_ClassicMatchesTransforms(t *testing.T) {
+	generator, err := NewSecretGenerator(SecretRulesClassic, 1)
+	assert.NoError(t, err)
+
+	assert.Equal(t, 4321, generator.Transform(1234))
+	assert.Equal(t, 7777, generator.Transform(2442))
+	assert.Equal(t, 9000, generator.Transform(8999))
+}
+
+func TestSecretGenerator_UnknownRules(t *testing.T) {
+	_, err := NewSecretGenerator("random", 1)
+	assert.Error(t, err)
+}
+
+func TestAuditSecretGenerator_Classic(t *testing.T) {
+	generator, err := NewSecretGenerator(SecretRulesClassic, 1)
+	assert.NoError(t, err)
+	audit := AuditSecretGenerator(generator, 0)
+
+	// Every raw number is put through the transforms once
+	assert.False(t, audit.Sampled)
+	assert.Equal(t, 9000, audit.Draws)
+	assert.Equal(t, 7777, audit.MostLikely(1)[0])
+	assert.Greater(t, audit.Probability(7777), 50*audit.Probability(4321))
+	assert.Contains(t, audit.Unreachable(), 0)
+	assert.Less(t, audit.Entropy(), codeInformation)
+	assert.Greater(t, audit.DrawsToDetect(), 0)
+
+	// Observed codes the generator can't produce are picked out
+	comparison := audit.Compare(map[int]int{7777: 3, 4321: 1, 0: 1})
+	assert.Equal(t, 5, comparison.Games)
+	assert.Equal(t, []int{0}, comparison.Impossible)
+	assert.True(t, comparison.Sparse)
+
+	report := audit.Report(map[int]int{7777: 3})
+	assert.Contains(t, report, "1. 7777 - 1.000% (100.0x uniform)")
+	assert.Contains(t, report, "UNREACHABLE CODES: 1089")
+	assert.Contains(t, report, "Games: 3, with 1 different codes")
+}
+
+func TestAuditSecretGenerator_Uniform(t *testing.T) {
+	generator, err := NewSecretGenerator(SecretRulesUniform, 1)
+	assert.NoError(t, err)
+
+	audit := AuditSecretGenerator(generator, 0)
+	assert.Empty(t, audit.Unreachable())
+	assert.InDelta(t, codeInformation, audit.Entropy(), 1e-9)
+	assert.Equal(t, 0, audit.DrawsToDetect())
+
+	// A large enough sample passes the test of uniformity
+	audit = AuditSecretGenerator(generator, 200000)
+	assert.True(t, audit.Sampled)
+	assert.Greater(t, audit.ChiSquareUniform().PValue, 0.001)
+	assert.Contains(t, audit.Report(nil), "No data available yet")
+}
+
+func TestChiSquarePValue(t *testing.T) {
+	// The statistic's mean has a p-value near one half, and the 5% critical
+	// value of 10 degrees of freedom is 18.31
+	assert.InDelta(t, 0.5, chiSquarePValue(9999, 10000), 0.01)
+	assert.InDelta(t, 0.05, chiSquarePValue(18.31, 10), 0.005)
+}
+
+// --- Offline hint tests ---
+
+func TestFormatHint_Difficulty(t *testing.T) {
+	feedback := ScoreGuess(1243, 1234)
+
+	assert.Equal(t, "", formatHint(DifficultyHard, 1243, 1234, feedback))
+	assert.Equal(t, "2 correct position, 2 correct digit but wrong position",
+		formatHint(DifficultyNormal, 1243, 1234, feedback))
+	assert.Equal(t, "2 correct position, 2 correct digit but wrong position (1 2 _ _)",
+		formatHint(DifficultyEasy, 1243, 1234, feedback))
+}
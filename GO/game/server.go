@@ -1,37 +1,56 @@
 package game
 
 import (
-	"context"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"net"
 	"os"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
 type Player struct {
-	conn      net.Conn
-	id        int
-	name      string
-	readyNext bool
+	conn       net.Conn
+	id         int
+	name       string
+	readyNext  bool
+	chatTimes  []time.Time   // When recent chat messages were sent, for rate limiting
+	structured atomic.Bool   // Whether the client gets protocol events
+	heartbeat  heartbeat     // When the client was last heard from
+	pingable   atomic.Bool   // Whether the client asked for events, and so answers pings
+	lastGuess  time.Time     // When the player last guessed, for logging how long guesses take
+	guessTook  time.Duration // How long the player took over their last guess
 }
 
 type GameSession struct {
+	id               int64 // Identifies the session in logs
 	players          []*Player
-	currentPlayer    int
-	secretCode       int
-	gameOver         bool
-	guessCount       int
+	game             *Game // Rules engine for the current game
 	mutex            sync.Mutex
 	gameStarted      bool
 	maxPlayers       int
 	acceptingPlayers bool
 	singlePlayerMode bool
-	turnTimeLimit    time.Duration // Time limit for each player's turn
-	analytics        *GameStats    // Analytics for this game session
+	turnTimeLimit    time.Duration         // Time limit for each player's turn
+	turnStarted      time.Time             // When the current turn began
+	singleGame       bool                  // Play one game and keep the connections open (tournament matches)
+	analytics        *GameStats            // Analytics for this game session
+	inputs           chan playerInput      // Messages read from all players
+	done             chan struct{}         // Closed when the session is finished
+	history          []pastGuess           // Guesses made in the current game
+	rate             func() map[string]int // Matched games: updates the ratings, returning each player's change by name
+	rateOnce         sync.Once             // Rates the game only once
+	ratingChanges    map[string]int        // Rating changes of the finished game, once rated
+	stableIDs        bool                  // Player IDs stay with the players' names from game to game (lobby servers)
+}
+
+// ServerOptions configures the games hosted by the server
+type ServerOptions struct {
+	Rules GameRules // Optional guess and time limits for every game
 }
 
 // Global analytics tracker
@@ -40,48 +59,54 @@ var globalAnalytics *GameAnalytics
 // InitAnalytics initializes the global analytics tracker
 func InitAnalytics() {
 	globalAnalytics = NewGameAnalytics()
+	globalAnalytics.SetRecentLimit(analyticsRecentGames)
 }
 
 // StartMultiplayerServer starts the server in multiplayer mode
-func StartMultiplayerServer() {
+func StartMultiplayerServer(maxPlayers int, options ServerOptions) {
 	// Initialize analytics if not already done
 	if globalAnalytics == nil {
 		InitAnalytics()
 	}
 
-	// Get the maximum number of players from environment variable or argument
-	// Default to 2 if not specified
-	maxPlayers := 2
-	if len(os.Args) > 2 {
-		if val, err := strconv.Atoi(os.Args[2]); err == nil && val > 1 {
-			maxPlayers = val
-		}
+	// Default to 2 players if the requested number is not usable
+	if maxPlayers < 2 {
+		maxPlayers = 2
 	}
 
-	startServer(maxPlayers, false)
+	// A duel is always one against one
+	if options.Rules.Mode == ModeDuel {
+		maxPlayers = 2
+	}
+
+	startServer(maxPlayers, false, options)
 }
 
 // StartSinglePlayerServer starts the server in single-player mode
-func StartSinglePlayerServer() {
+func StartSinglePlayerServer(options ServerOptions) {
 	// Initialize analytics if not already done
 	if globalAnalytics == nil {
 		InitAnalytics()
 	}
 
-	startServer(1, true)
+	// A lone player has nobody to race against
+	options.Rules.Mode = ModeTurns
+
+	startServer(1, true, options)
 }
 
 // Common server starting function with mode parameter
-func startServer(maxPlayers int, singlePlayerMode bool) {
+func startServer(maxPlayers int, singlePlayerMode bool, options ServerOptions) {
 	modeStr := "multiplayer"
 	if singlePlayerMode {
 		modeStr = "single-player"
 	}
 
-	log.Printf("Starting server in %s mode with support for %d players...", modeStr, maxPlayers)
-	listener, err := net.Listen("tcp", "0.0.0.0:8080")
+	slog.Info("Starting server", "mode", modeStr, "max_players", maxPlayers, "game_mode", options.Rules.Mode.String())
+	listener, err := listenGame()
 	if err != nil {
-		log.Fatalf("Error starting server: %v", err)
+		slog.Error("Error starting server", "error", err)
+		os.Exit(1)
 	}
 	defer listener.Close()
 
@@ -94,26 +119,25 @@ func startServer(maxPlayers int, singlePlayerMode bool) {
 		
 		// Create a new game session
 		session := &GameSession{
+			id:               nextSessionID(),
 			players:          make([]*Player, 0, maxPlayers),
-			currentPlayer:    0,
-			secretCode:       secretCode,
-			gameOver:         false,
-			guessCount:       0,
+			game:             NewGame(secretCode, singlePlayerMode),
 			gameStarted:      false,
 			maxPlayers:       maxPlayers,
 			acceptingPlayers: true,
 			singlePlayerMode: singlePlayerMode,
 			turnTimeLimit:    30 * time.Second, // 30-second time limit for each turn
+			inputs:           make(chan playerInput, 16),
+			done:             make(chan struct{}),
 		}
 
+		session.game.SetRules(options.Rules)
+
 		// Initialize analytics for this game
-		session.analytics = globalAnalytics.StartGame(secretCode, maxPlayers)
+		session.startAnalytics(secretCode, maxPlayers)
 
-		if singlePlayerMode {
-			log.Printf("New game session created. Waiting for a player to connect...")
-		} else {
-			log.Printf("New game session created. Waiting for up to %d players to connect...", maxPlayers)
-		}
+		session.logger().Info("New game session created. Waiting for players to connect...",
+			logEvent, "session_created", "max_players", maxPlayers)
 
 		// Start accepting players in a separate goroutine
 		playersConnected := make(chan struct{})
@@ -130,19 +154,21 @@ func startServer(maxPlayers int, singlePlayerMode bool) {
 // startCommandListener starts a goroutine to listen for admin commands
 func startCommandListener() {
 	commandPort := 8081 // Different port for admin commands
-	commandListener, err := net.Listen("tcp", fmt.Sprintf("0.0.0.0:%d", commandPort))
+	commandListener, err := listen(fmt.Sprintf("0.0.0.0:%d", commandPort), adminTLS, nil)
 	if err != nil {
-		log.Printf("Error starting command listener: %v", err)
+		slog.Error("Error starting command listener", "error", err)
+		serverHealth.listenerFailed("admin", err)
 		return
 	}
+	commandListener = serverHealth.trackListener("admin", commandListener, false)
 	defer commandListener.Close()
 
-	log.Printf("Command listener started on port %d", commandPort)
+	slog.Info("Command listener started", "port", commandPort)
 
 	for {
 		conn, err := commandListener.Accept()
 		if err != nil {
-			log.Printf("Error accepting command connection: %v", err)
+			slog.Error("Error accepting command connection", "error", err)
 			continue
 		}
 
@@ -157,19 +183,50 @@ func handleCommandConnection(conn net.Conn) {
 	buffer := make([]byte, 1024)
 	n, err := conn.Read(buffer)
 	if err != nil {
-		log.Printf("Error reading command: %v", err)
+		slog.Warn("Error reading command", "error", err)
 		return
 	}
 
 	command := strings.TrimSpace(string(buffer[:n]))
+	fields := strings.Fields(command)
+	if len(fields) == 0 {
+		fields = []string{""}
+	}
+	slog.Info("Admin command", logEvent, "admin_command", "command", fields[0], "remote", conn.RemoteAddr().String())
 	
-	switch command {
+	switch fields[0] {
+	case "tournament":
+		// View or start the tournament
+		conn.Write([]byte(handleTournamentCommand(fields[1:])))
 	case "stats":
-		// Generate and send analytics report
-		report := globalAnalytics.GetAnalyticsReport()
-		conn.Write([]byte(report))
+		// Generate and send analytics report, for all time or a time range
+		conn.Write([]byte(handleStatsCommand(fields[1:], time.Now())))
+	case "filter":
+		// View or change the chat profanity filter
+		conn.Write([]byte(handleFilterCommand(fields[1:])))
+	case "queue":
+		// View the matchmaking queue and ratings
+		conn.Write([]byte(handleQueueCommand()))
+	case "daily":
+		// View today's daily challenge leaderboard
+		conn.Write([]byte(handleDailyCommand()))
+	case "abuse":
+		// View the abuse protection, ban and unban addresses and change the limits
+		conn.Write([]byte(handleAbuseCommand(fields[1:])))
+	case "export":
+		// Export the game history for analysis
+		conn.Write([]byte(handleExportCommand(fields[1:])))
+	case "cluster":
+		// View the replicas, their games and players, and the cluster's analytics
+		conn.Write([]byte(cluster.Report(time.Now())))
+	case "efficiency":
+		// View how efficiently the players guess
+		conn.Write([]byte(handleEfficiencyCommand(fields[1:])))
+	case "secrets":
+		// Audit the distribution of the secret codes
+		conn.Write([]byte(handleSecretsCommand(fields[1:])))
 	default:
-		conn.Write([]byte("Unknown command. Available commands: stats"))
+		conn.Write([]byte("Unknown command. Available commands: stats, export, efficiency, secrets, filter, tournament, queue, daily, abuse, cluster"))
 	}
 }
 
@@ -186,7 +243,7 @@ func acceptPlayers(listener net.Listener, session *GameSession, playersConnected
 		for session.acceptingPlayers {
 			conn, err := listener.Accept()
 			if err != nil {
-				log.Printf("Error accepting connection: %v", err)
+				slog.Error("Error accepting connection", "error", err)
 				continue
 			}
 			connChan <- conn
@@ -208,7 +265,10 @@ func acceptPlayers(listener net.Listener, session *GameSession, playersConnected
 			}
 
 			session.players = append(session.players, player)
-			log.Printf("%s has connected. Total players: %d/%d", player.name, len(session.players), session.maxPlayers)
+			session.game.AddPlayer(playerID)
+			go readPlayerInput(session, player)
+			session.playerLogger(player).Info("Player connected", logEvent, "player_connected",
+				"remote", conn.RemoteAddr().String(), "players", len(session.players), "max_players", session.maxPlayers)
 
 			// Send welcome message to the new player
 			if session.singlePlayerMode {
@@ -218,13 +278,25 @@ func acceptPlayers(listener net.Listener, session *GameSession, playersConnected
 			} else {
 				writeToClient(conn, fmt.Sprintf("Welcome %s! Waiting for other players... (%d/%d connected)",
 					player.name, len(session.players), session.maxPlayers))
-				writeToClient(conn, fmt.Sprintf("You will have %d seconds to make each guess!", int(session.turnTimeLimit.Seconds())))
+				switch session.game.Rules().Mode {
+				case ModeRace:
+					writeToClient(conn, "This is a race: everyone guesses at the same time!")
+				case ModeDuel:
+					writeToClient(conn, "This is a duel: you will choose the code your opponent has to crack!")
+				case ModeTeams:
+					writeToClient(conn, "This is a team game: you will choose a team before play starts!")
+				default:
+					writeToClient(conn, fmt.Sprintf("You will have %d seconds to make each guess!", int(session.turnTimeLimit.Seconds())))
+				}
+
+				writeToClient(conn, fmt.Sprintf("\nUse %s <message> to chat with the other players at any time.", sayCommand))
 
 				// Broadcast to other players that someone new joined
 				for _, p := range session.players {
 					if p.id != playerID {
 						writeToClient(p.conn, fmt.Sprintf("\n%s has joined the game. (%d/%d players connected)",
 							player.name, len(session.players), session.maxPlayers))
+						sendEvent(p, ProtocolEvent{Type: ProtocolPlayers, Players: playerNames(session)})
 					}
 				}
 			}
@@ -247,19 +319,26 @@ func acceptPlayers(listener net.Listener, session *GameSession, playersConnected
 }
 
 func runGameSession(session *GameSession) {
-	session.mutex.Lock()
-	
-	// Single-player mode only needs 1 player
-	minPlayers := 2
-	if session.singlePlayerMode {
-		minPlayers = 1
+	// Stop the player readers once the session is finished
+	defer close(session.done)
+	serverHealth.sessionStarted(session)
+	defer serverHealth.sessionFinished(session)
+	cluster.sessionStarted(session)
+	defer cluster.sessionFinished(session)
+
+	if session.game.Rules().Mode == ModeTeams {
+		chooseTeams(session)
 	}
-	
-	if len(session.players) < minPlayers {
-		log.Println("Not enough players to start the game.")
+
+	session.mutex.Lock()
+	events, err := session.game.Start()
+	if err != nil {
+		session.logger().Info("Not enough players to start the game", logEvent, "start_failed")
 		for _, player := range session.players {
 			writeToClient(player.conn, "Not enough players to start the game. Please try again later.")
-			player.conn.Close()
+			if !session.singleGame {
+				player.conn.Close()
+			}
 		}
 		session.mutex.Unlock()
 		
@@ -273,439 +352,919 @@ func runGameSession(session *GameSession) {
 	session.mutex.Unlock()
 
 	if session.singlePlayerMode {
-		// Single-player mode
-		player := session.players[0]
-		writeToClient(player.conn, "\nGame is starting in single-player mode!")
-		writeToClient(player.conn, "Try to guess the 4-digit code.")
-		writeToClient(player.conn, fmt.Sprintf("\nYou have %d seconds for each guess!", int(session.turnTimeLimit.Seconds())))
-		writeToClient(player.conn, "\nIt's your turn. Enter your guess:")
-		
-		// Run the single-player game loop
-		for !session.gameOver {
-			handlePlayerGuess(session, player)
+		writeToClient(session.players[0].conn, "\nGame is starting in single-player mode!")
+	}
+
+	// Play games until the players no longer want to continue
+	for {
+		handleEvents(session, events)
+		runGameLoop(session)
+		if session.singleGame {
+			return
 		}
-		
-		// When game is over, ask if player wants to restart
-		handleSinglePlayerRestart(session, player)
-	} else {
-		// Multiplayer mode
-		// Notify players that the game is starting
-		broadcastMessage(session, "\nGame is starting with "+strconv.Itoa(len(session.players))+" players!")
-		broadcastMessage(session, "Try to guess the 4-digit code. Players will take turns in order.")
-		broadcastMessage(session, fmt.Sprintf("\nEach player has %d seconds to make their guess!", int(session.turnTimeLimit.Seconds())))
-
-		// Show player list
-		playerList := "\nPlayers in this game:"
-		for _, player := range session.players {
-			playerList += "\n- " + player.name
+		if serverHealth.Draining() {
+			// No new games start once the server is shutting down
+			session.mutex.Lock()
+			for _, player := range session.players {
+				writeToClient(player.conn, "\nThe server is shutting down. Thank you for playing!")
+				player.conn.Close()
+			}
+			session.mutex.Unlock()
+			return
 		}
-		broadcastMessage(session, playerList)
 
-		// Notify the first player that it's their turn
-		writeToClient(session.players[0].conn, "\nIt's your turn. Enter your guess:")
+		var restarted bool
+		if session.singlePlayerMode {
+			events, restarted = handleSinglePlayerRestart(session, session.players[0])
+		} else {
+			events, restarted = handleGameRestart(session)
+		}
+		if !restarted {
+			return
+		}
+	}
+}
 
-		// Notify other players they're waiting
-		for i, player := range session.players {
-			if i != 0 {
-				writeToClient(player.conn, "\nWaiting for Player 1 to make a guess...")
-			}
+// startAnalytics begins tracking the session's current game
+func (session *GameSession) startAnalytics(secretCode int, playerCount int) {
+	if session.game.Rules().Mode == ModeDuel {
+		// Duel codes are recorded as the players set them
+		session.analytics = globalAnalytics.StartDuel(playerCount)
+		return
+	}
+	session.analytics = globalAnalytics.StartGame(secretCode, playerCount)
+}
+
+// isOver reports whether the session's current game has finished
+func (session *GameSession) isOver() bool {
+	session.mutex.Lock()
+	defer session.mutex.Unlock()
+	return session.game.Over()
+}
+
+// playerByID finds a connected player; the caller must hold session.mutex
+func (session *GameSession) playerByID(playerID int) *Player {
+	for _, p := range session.players {
+		if p.id == playerID {
+			return p
 		}
+	}
+	return nil
+}
+
+// handleEvents records engine events in analytics and presents them to the players
+func handleEvents(session *GameSession, events []Event) {
+	timeLimit := int(session.turnTimeLimit.Seconds())
+
+	for i, event := range events {
+		session.logGameEvent(event)
+		session.mutex.Lock()
+		player := session.playerByID(event.PlayerID)
+		session.mutex.Unlock()
+
+		switch event.Type {
+		case EventGameStarted:
+			session.mutex.Lock()
+			session.history = nil
+			started := ProtocolEvent{Type: ProtocolGameStarted, Players: playerNames(session), Mode: session.game.Rules().Mode.String()}
+			session.mutex.Unlock()
+			if session.game.Rules().Mode != ModeRace {
+				started.Seconds = timeLimit
+			}
+			broadcastEvent(session, started)
+
+			if session.singlePlayerMode {
+				writeToClient(session.players[0].conn, "Try to guess the 4-digit code.")
+				writeToClient(session.players[0].conn, fmt.Sprintf("\nYou have %d seconds for each guess!", timeLimit))
+				if limits := describeRules(session.game.Rules()); limits != "" {
+					writeToClient(session.players[0].conn, limits)
+				}
+				continue
+			}
+
+			// Notify players that the game is starting
+			race := session.game.Rules().Mode == ModeRace
+			if session.game.Rules().Mode == ModeDuel {
+				broadcastMessage(session, "\nBoth codes are set. The duel begins!")
+				broadcastMessage(session, fmt.Sprintf("Players take turns guessing their own code, with %d seconds for each guess.", timeLimit))
+				continue
+			}
+			broadcastMessage(session, "\nGame is starting with "+strconv.Itoa(len(session.players))+" players!")
+			if race {
+				broadcastMessage(session, "Race mode: everyone guesses at the same time. The first to crack the 4-digit code wins!")
+			} else {
+				broadcastMessage(session, "Try to guess the 4-digit code. Players will take turns in order.")
+				broadcastMessage(session, fmt.Sprintf("\nEach player has %d seconds to make their guess!", timeLimit))
+			}
+			if limits := describeRules(session.game.Rules()); limits != "" {
+				broadcastMessage(session, limits)
+			}
 
-		// Main game loop
-		for !session.gameOver {
+			// Show player list
+			if session.game.Rules().Mode == ModeTeams {
+				session.mutex.Lock()
+				teams := session.game.Teams()
+				session.mutex.Unlock()
+				globalAnalytics.RecordTeams(session.analytics, teams)
+				broadcastMessage(session, describeTeams(session, teams))
+				broadcastMessage(session, fmt.Sprintf("Teams share feedback. Use %s <message> to talk to your team.", teamChatCommand))
+			} else {
+				playerList := "\nPlayers in this game:"
+				for _, p := range session.players {
+					playerList += "\n- " + p.name
+				}
+				broadcastMessage(session, playerList)
+			}
+
+			// In a race there are no turns, so everyone may guess right away
+			if race {
+				broadcastMessage(session, "\nIt's your turn. Enter your guess:")
+			}
+
+		case EventTurnChanged:
 			session.mutex.Lock()
-			currentPlayerIndex := session.currentPlayer
-			currentPlayer := session.players[currentPlayerIndex]
+			session.turnStarted = time.Now()
 			session.mutex.Unlock()
+			broadcastEvent(session, ProtocolEvent{Type: ProtocolTurn, Player: player.name, Team: event.Team, Seconds: timeLimit})
 
-			handlePlayerGuess(session, currentPlayer)
+			// A single player keeps the turn after a timeout and is already prompted to try again
+			if session.singlePlayerMode && i > 0 && events[i-1].Type == EventTurnTimedOut {
+				continue
+			}
+			announceTurn(session, player)
+
+		case EventGuessIncorrect:
+			// Record this guess in analytics
+			recordGuessAnalytics(session, event)
+			sendGuessEvents(session, event, player)
+
+			writeToClient(player.conn, "Try again!")
+			if session.game.Rules().Mode == ModeRace && !session.singlePlayerMode {
+				// In a race each player only sees feedback on their own guesses
+				writeToClient(player.conn, fmt.Sprintf("\nYou guessed %d (incorrect): %s. Your guesses: %d",
+					event.Guess, describeFeedback(event.Feedback), event.PlayerGuesses))
+			} else if session.game.Rules().Mode == ModeTeams {
+				// Teammates share feedback; the other teams only see the guess
+				session.mutex.Lock()
+				teammates := session.game.Teammates(event.PlayerID)
+				for _, p := range session.players {
+					if containsID(teammates, p.id) {
+						writeToClient(p.conn, fmt.Sprintf("\n%s guessed %d (incorrect): %s. Total guesses: %d",
+							player.name, event.Guess, describeFeedback(event.Feedback), event.GuessCount))
+					} else {
+						writeToClient(p.conn, fmt.Sprintf("\n%s (Team %s) guessed %d (incorrect). Total guesses: %d",
+							player.name, event.Team, event.Guess, event.GuessCount))
+					}
+				}
+				session.mutex.Unlock()
+			} else if session.game.Rules().Mode == ModeDuel {
+				// Each duel player is cracking a different code, so feedback stays private
+				writeToClient(player.conn, fmt.Sprintf("\nYou guessed %d (incorrect): %s. Your guesses: %d",
+					event.Guess, describeFeedback(event.Feedback), event.PlayerGuesses))
+				session.mutex.Lock()
+				for _, p := range session.players {
+					if p.id != event.PlayerID {
+						writeToClient(p.conn, fmt.Sprintf("\n%s guessed %d (incorrect). Their guesses: %d",
+							player.name, event.Guess, event.PlayerGuesses))
+					}
+				}
+				session.mutex.Unlock()
+			} else if session.singlePlayerMode {
+				writeToClient(player.conn, fmt.Sprintf("\nYou guessed %d (incorrect). Total guesses: %d", event.Guess, event.GuessCount))
+			} else {
+				broadcastMessage(session, fmt.Sprintf("\n%s guessed %d (incorrect). Total guesses: %d", player.name, event.Guess, event.GuessCount))
+			}
+			if event.GuessesLeft >= 0 {
+				writeToClient(player.conn, fmt.Sprintf("\nYou have %d guesses left.", event.GuessesLeft))
+			}
+
+		case EventRaceProgress:
+			// Tell the others how the guesser is doing without revealing the guess
+			session.mutex.Lock()
+			for _, p := range session.players {
+				if p.id != event.PlayerID {
+					writeToClient(p.conn, fmt.Sprintf("\nRace update: %s has made %d guesses, best so far %d/4 digits in place.",
+						player.name, event.PlayerGuesses, event.BestExact))
+					sendEvent(p, ProtocolEvent{Type: ProtocolProgress, Player: player.name, Guesses: event.PlayerGuesses, BestExact: event.BestExact})
+				}
+			}
+			session.mutex.Unlock()
+
+			// The guesser may go again straight away
+			session.mutex.Lock()
+			over := session.game.Over()
+			session.mutex.Unlock()
+			if !over {
+				writeToClient(player.conn, "\nIt's your turn. Enter your guess:")
+			}
+
+		case EventGuessCorrect:
+			// Record this guess and update analytics for game end with winner
+			recordGuessAnalytics(session, event)
+			if event.Team != "" {
+				// The whole team shares the win and the points
+				session.mutex.Lock()
+				teammates := session.game.Teammates(event.PlayerID)
+				session.mutex.Unlock()
+				for _, id := range teammates {
+					globalAnalytics.RecordScore(session.analytics, id, event.Score)
+				}
+				globalAnalytics.EndTeamGame(session.analytics, event.PlayerID, event.Team)
+				broadcastMessage(session, fmt.Sprintf("\nTeam %s wins! Every member scores %d points.", event.Team, event.Score))
+			} else {
+				globalAnalytics.RecordScore(session.analytics, event.PlayerID, event.Score)
+				globalAnalytics.EndGame(session.analytics, event.PlayerID)
+			}
+			sendGuessEvents(session, event, player)
+			broadcastEvent(session, ProtocolEvent{Type: ProtocolGameOver, Result: ResultWon, Winner: player.name,
+				Team: event.Team, Secret: formatCode(event.SecretCode)})
+
+			prefix := GenerateTimestampPrefix()
+			writeToClient(player.conn, prefix+"Congratulations! You guessed the correct number!")
+			writeToClient(player.conn, fmt.Sprintf("\nYou scored %d points.", event.Score))
+
+			if session.singlePlayerMode {
+				// Single-player mode - notify only current player
+				writeToClient(player.conn, fmt.Sprintf("\nYou guessed the correct code (%d)!", event.Guess))
+				writeToClient(player.conn, fmt.Sprintf("\nSecret code was: %d", event.SecretCode))
+				writeToClient(player.conn, fmt.Sprintf("\nTotal guesses: %d", event.GuessCount))
+
+				sendSummary(session, ResultWon)
+
+				// Ask if they want to play again
+				askPlayAgain(session)
+			} else {
+				// Multiplayer mode - notify all players
+				if session.game.Rules().Mode == ModeRace {
+					broadcastMessage(session, fmt.Sprintf("\n%s cracked the code in %d of their own guesses and won the race!", player.name, event.PlayerGuesses))
+				}
+				broadcastMessage(session, fmt.Sprintf("\n%s guessed the correct code (%d) and won the game!", player.name, event.Guess))
+				broadcastMessage(session, fmt.Sprintf("\nSecret code was: %d", event.SecretCode))
+				broadcastMessage(session, fmt.Sprintf("\nTotal guesses: %d", event.GuessCount))
+
+				sendSummary(session, ResultWon)
+				askPlayAgain(session)
+			}
+
+		case EventCodesRequested:
+			session.mutex.Lock()
+			session.turnStarted = time.Now()
+			session.mutex.Unlock()
+
+			broadcastMessage(session, "\nDuel mode: each player chooses a 4-digit code for their opponent to crack.")
+			broadcastMessage(session, "Whoever cracks their own code in fewer guesses wins!")
+			if limits := describeRules(session.game.Rules()); limits != "" {
+				broadcastMessage(session, limits)
+			}
+			broadcastMessage(session, fmt.Sprintf("\nIt's your turn to choose a secret code for your opponent (%d seconds). Enter a 4-digit code:",
+				timeLimit))
+			broadcastEvent(session, ProtocolEvent{Type: ProtocolPrompt, Prompt: PromptCode, Seconds: timeLimit})
+
+		case EventCodeSet:
+			globalAnalytics.RecordChosenSecret(session.analytics, event.PlayerID, event.SecretCode)
+
+			writeToClient(player.conn, fmt.Sprintf("\nYour code %04d is locked in.", event.SecretCode))
+			session.mutex.Lock()
+			for _, p := range session.players {
+				if p.id != event.PlayerID {
+					writeToClient(p.conn, fmt.Sprintf("\n%s has chosen your code.", player.name))
+				}
+			}
+			session.mutex.Unlock()
+
+		case EventCodeAssigned:
+			globalAnalytics.RecordGeneratedSecret(session.analytics, event.SecretCode)
+
+			writeToClient(player.conn, "\nYou took too long, so a random code was chosen for your opponent.")
+
+		case EventCodeCracked:
+			recordGuessAnalytics(session, event)
+			sendGuessEvents(session, event, player)
+
+			broadcastMessage(session, fmt.Sprintf("\n%s cracked their code (%04d) in %d guesses!",
+				player.name, event.SecretCode, event.PlayerGuesses))
+
+		case EventDuelWon:
+			globalAnalytics.RecordScore(session.analytics, event.PlayerID, event.Score)
+			globalAnalytics.EndGame(session.analytics, event.PlayerID)
+
+			broadcastMessage(session, fmt.Sprintf("\n%s won the duel, cracking their code in %d guesses!",
+				player.name, event.PlayerGuesses))
+			broadcastEvent(session, ProtocolEvent{Type: ProtocolGameOver, Result: ResultWon, Winner: player.name})
+			writeToClient(player.conn, fmt.Sprintf("\nYou scored %d points.", event.Score))
+			revealDuelCodes(session)
+
+			sendSummary(session, ResultWon)
+			askPlayAgain(session)
+
+		case EventGameDrawn:
+			// A draw has no winner
+			globalAnalytics.EndGameDrawn(session.analytics)
+			broadcastEvent(session, ProtocolEvent{Type: ProtocolGameOver, Result: ResultDraw})
+
+			broadcastMessage(session, fmt.Sprintf("\nThe duel is a draw! Both players cracked their code in %d guesses.",
+				event.PlayerGuesses))
+			revealDuelCodes(session)
+
+			sendSummary(session, ResultDraw)
+			askPlayAgain(session)
+
+		case EventTurnTimedOut:
+			globalAnalytics.RecordTimeout(session.analytics, event.PlayerID)
+			broadcastEvent(session, ProtocolEvent{Type: ProtocolTimeout, Player: player.name})
+
+			if session.singlePlayerMode {
+				// In single-player, just tell them they timed out and give another chance
+				writeToClient(player.conn, fmt.Sprintf("\nTime's up! You took longer than %d seconds. Try again:", timeLimit))
+			} else {
+				// In multiplayer, their turn is forfeited
+				writeToClient(player.conn, fmt.Sprintf("\nTime's up! You took longer than %d seconds. Your turn is forfeited.", timeLimit))
+				broadcastMessage(session, fmt.Sprintf("\n%s ran out of time and forfeited their turn!", player.name))
+			}
+
+		case EventPlayerRemoved:
+			// Drop the disconnected player's connection from the session
+			session.mutex.Lock()
+			if !session.singlePlayerMode {
+				for j, p := range session.players {
+					if p.id == event.PlayerID {
+						session.players = append(session.players[:j], session.players[j+1:]...)
+						break
+					}
+				}
+			}
+			remaining := len(session.players)
+			names := playerNames(session)
+			session.mutex.Unlock()
+
+			if session.singlePlayerMode {
+				continue
+			}
+			broadcastEvent(session, ProtocolEvent{Type: ProtocolPlayers, Players: names})
+			if i+1 < len(events) && events[i+1].Type == EventGameAbandoned {
+				broadcastMessage(session, fmt.Sprintf("\n%s has disconnected. Not enough players to continue.", player.name))
+				continue
+			}
+			broadcastMessage(session, fmt.Sprintf("\n%s has disconnected. Continuing with %d players.",
+				player.name, remaining))
+
+		case EventGameLost:
+			// Update analytics for a game nobody won
+			globalAnalytics.EndGameLost(session.analytics)
+			lost := ProtocolEvent{Type: ProtocolGameOver, Result: ResultLost}
+			if session.game.Rules().Mode != ModeDuel {
+				lost.Secret = formatCode(event.SecretCode)
+			}
+			broadcastEvent(session, lost)
+
+			session.mutex.Lock()
+			remaining, limited := session.game.TimeRemaining()
+			session.mutex.Unlock()
+
+			message := "\nEveryone is out of guesses! Nobody broke the code."
+			if limited && remaining == 0 {
+				message = "\nTime is up for this game! Nobody broke the code."
+			}
+			if session.singlePlayerMode {
+				message = strings.Replace(message, "Everyone is", "You are", 1)
+			}
+			broadcastMessage(session, message)
+			if session.game.Rules().Mode == ModeDuel {
+				revealDuelCodes(session)
+			} else {
+				broadcastMessage(session, fmt.Sprintf("\nSecret code was: %d", event.SecretCode))
+			}
+			broadcastMessage(session, fmt.Sprintf("\nTotal guesses: %d", event.GuessCount))
+
+			sendSummary(session, ResultLost)
+			askPlayAgain(session)
+
+		case EventGameAbandoned:
+			// Update analytics for game end with no winner
+			globalAnalytics.EndGame(session.analytics, 0)
+			broadcastEvent(session, ProtocolEvent{Type: ProtocolGameOver, Result: ResultAbandoned})
+
+			if session.singlePlayerMode {
+				continue
+			}
+			session.mutex.Lock()
+			for _, p := range session.players {
+				if session.singleGame {
+					writeToClient(p.conn, "\nGame over.")
+					continue
+				}
+				writeToClient(p.conn, "\nGame over. Thank you for playing!")
+				p.conn.Close()
+			}
+			session.mutex.Unlock()
 		}
+	}
+}
 
-		// When game is over, wait for player responses about restarting
-		handleGameRestart(session)
-	}
-}
-
-func handlePlayerGuess(session *GameSession, player *Player) {
-    // Create a context with cancel function to abort the read operation if needed
-    ctx, cancel := context.WithTimeout(context.Background(), session.turnTimeLimit)
-    defer cancel() // Ensure we always cancel the context
-    
-    // Create channels for the guess and timeout
-    guessChan := make(chan string)
-    errChan := make(chan error)
-    
-    // Start a goroutine to read the player's guess
-    go func() {
-        // Set read deadline based on our timeout
-        player.conn.SetReadDeadline(time.Now().Add(session.turnTimeLimit))
-        buffer := make([]byte, 1024)
-        n, err := player.conn.Read(buffer)
-
-        // Check if the context was canceled before we check the error
-        select {
-        case <-ctx.Done():
-            // The context was canceled, so we just return without sending
-            // to the channels, effectively abandoning this read attempt
-            return
-        default:
-            // Context wasn't canceled, so proceed normally
-            if err != nil {
-                errChan <- err
-                return
-            }
-            guessChan <- string(buffer[:n])
-        }
-    }()
-    
-    // Wait for either a guess, an error, or a timeout
-    select {
-    case guess := <-guessChan:
-        // Reset read deadline
-        player.conn.SetReadDeadline(time.Time{})
-        
-        // Process the guess
-        log.Printf("Received guess from %s: %s", player.name, guess)
-        
-        // Validate the guess
-        numGuess, err := ValidateGuess(guess)
-        if err != nil {
-            writeToClient(player.conn, err.Error())
-            writeToClient(player.conn, "\nTry again:")
-            return
-        }
-        
-        // Record this guess in analytics
-        globalAnalytics.RecordGuess(session.analytics, player.id, numGuess)
-        
-        // Increment guess count
-        session.mutex.Lock()
-        session.guessCount++
-        totalGuesses := session.guessCount
-        session.mutex.Unlock()
-        
-        // Check if the guess is correct
-        if numGuess == session.secretCode {
-            // Game over - player wins
-            prefix := GenerateTimestampPrefix()
-            response := prefix + "Congratulations! You guessed the correct number!"
-            writeToClient(player.conn, response)
-            
-            session.mutex.Lock()
-            session.gameOver = true
-            session.mutex.Unlock()
-            
-            // Update analytics for game end with winner
-            globalAnalytics.EndGame(session.analytics, player.id)
-            
-            if session.singlePlayerMode {
-                // Single-player mode - notify only current player
-                writeToClient(player.conn, fmt.Sprintf("\nYou guessed the correct code (%d)!", numGuess))
-                writeToClient(player.conn, fmt.Sprintf("\nSecret code was: %d", session.secretCode))
-                writeToClient(player.conn, fmt.Sprintf("\nTotal guesses: %d", totalGuesses))
-                
-                // Ask if they want to play again
-                writeToClient(player.conn, "\nWould you like to play again? (yes/no)")
-            } else {
-                // Multiplayer mode - notify all players
-                broadcastMessage(session, fmt.Sprintf("\n%s guessed the correct code (%d) and won the game!", player.name, numGuess))
-                broadcastMessage(session, fmt.Sprintf("\nSecret code was: %d", session.secretCode))
-                broadcastMessage(session, fmt.Sprintf("\nTotal guesses: %d", totalGuesses))
-                
-                // Ask if they want to play again
-                broadcastMessage(session, "\nWould you like to play again? (yes/no)")
-            }
-        } else {
-            response := "Try again!"
-            
-            if session.singlePlayerMode {
-                // Single-player mode - just notify the player
-                writeToClient(player.conn, response)
-                writeToClient(player.conn, fmt.Sprintf("\nYou guessed %d (incorrect). Total guesses: %d", numGuess, totalGuesses))
-                writeToClient(player.conn, "\nIt's your turn. Enter your guess:")
-            } else {
-                // Multiplayer mode - switch turns to next player
-                session.mutex.Lock()
-                playerCount := len(session.players)
-                session.currentPlayer = (session.currentPlayer + 1) % playerCount
-                nextPlayer := session.players[session.currentPlayer]
-                session.mutex.Unlock()
-                
-                // Send response to current player
-                writeToClient(player.conn, response)
-                broadcastMessage(session, fmt.Sprintf("\n%s guessed %d (incorrect). Total guesses: %d", player.name, numGuess, totalGuesses))
-                
-                // Update players about whose turn it is
-                writeToClient(nextPlayer.conn, "\nIt's your turn. Enter your guess:")
-                
-                // Tell other players to wait
-                for _, p := range session.players {
-                    if p.id != nextPlayer.id {
-                        writeToClient(p.conn, fmt.Sprintf("\nWaiting for %s to make a guess...", nextPlayer.name))
-                    }
-                }
-            }
-        }
-    
-    case err := <-errChan:
-        // Handle error (could be a disconnection or timeout)
-        if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
-            // This is a timeout error
-            log.Printf("%s timed out on their turn", player.name)
-            
-            // Cancel the context to abort the read operation
-            cancel()
-            
-            if session.singlePlayerMode {
-                // In single-player, just tell them they timed out and give another chance
-                writeToClient(player.conn, fmt.Sprintf("\nTime's up! You took longer than %d seconds. Try again:", int(session.turnTimeLimit.Seconds())))
-                // Reset read deadline
-                player.conn.SetReadDeadline(time.Time{})
-            } else {
-                // In multiplayer, forfeit their turn
-                writeToClient(player.conn, fmt.Sprintf("\nTime's up! You took longer than %d seconds. Your turn is forfeited.", int(session.turnTimeLimit.Seconds())))
-                
-                // Move to next player
-                session.mutex.Lock()
-                playerCount := len(session.players)
-                session.currentPlayer = (session.currentPlayer + 1) % playerCount
-                nextPlayer := session.players[session.currentPlayer]
-                session.mutex.Unlock()
-                
-                // Broadcast timeout message
-                broadcastMessage(session, fmt.Sprintf("\n%s ran out of time and forfeited their turn!", player.name))
-                
-                // Update players about whose turn it is
-                writeToClient(nextPlayer.conn, "\nIt's your turn. Enter your guess:")
-                
-                // Tell other players to wait
-                for _, p := range session.players {
-                    if p.id != nextPlayer.id {
-                        writeToClient(p.conn, fmt.Sprintf("\nWaiting for %s to make a guess...", nextPlayer.name))
-                    }
-                }
-                
-                // Reset read deadline for the player who timed out
-                player.conn.SetReadDeadline(time.Time{})
-            }
-        } else {
-            // Some other error (like disconnection)
-            log.Printf("Error reading from %s: %v", player.name, err)
-            handlePlayerDisconnect(session, player)
-        }
-    
-    case <-ctx.Done():
-        // Context timeout - the turn has expired
-        log.Printf("%s timed out on their turn (context timeout)", player.name)
-        
-        if session.singlePlayerMode {
-            writeToClient(player.conn, fmt.Sprintf("\nTime's up! You took longer than %d seconds. Try again:", int(session.turnTimeLimit.Seconds())))
-            // Reset read deadline
-            player.conn.SetReadDeadline(time.Time{})
-        } else {
-            writeToClient(player.conn, fmt.Sprintf("\nTime's up! You took longer than %d seconds. Your turn is forfeited.", int(session.turnTimeLimit.Seconds())))
-            
-            // Move to next player
-            session.mutex.Lock()
-            playerCount := len(session.players)
-            session.currentPlayer = (session.currentPlayer + 1) % playerCount
-            nextPlayer := session.players[session.currentPlayer]
-            session.mutex.Unlock()
-            
-            broadcastMessage(session, fmt.Sprintf("\n%s ran out of time and forfeited their turn!", player.name))
-            writeToClient(nextPlayer.conn, "\nIt's your turn. Enter your guess:")
-            
-            for _, p := range session.players {
-                if p.id != nextPlayer.id {
-                    writeToClient(p.conn, fmt.Sprintf("\nWaiting for %s to make a guess...", nextPlayer.name))
-                }
-            }
-            
-            // Reset read deadline
-            player.conn.SetReadDeadline(time.Time{})
-        }
-    }
-}
-
-func handleSinglePlayerRestart(session *GameSession, player *Player) {
-	log.Println("Single-player game over, waiting for player to decide if they want to restart...")
-	
-	// Read the player's response with a timeout
-	player.conn.SetReadDeadline(time.Now().Add(30 * time.Second))
-	buffer := make([]byte, 1024)
-	n, err := player.conn.Read(buffer)
-	player.conn.SetReadDeadline(time.Time{}) // Reset deadline
-	
-	if err != nil {
-		log.Printf("Error reading restart response from %s: %v", player.name, err)
-		writeToClient(player.conn, "\nNo response received. Ending game. Thank you for playing!")
-		player.conn.Close()
+// revealDuelCodes shows every player the code each duel player had to crack
+func revealDuelCodes(session *GameSession) {
+	session.mutex.Lock()
+	reveal := "\nThe codes were:"
+	for _, p := range session.players {
+		reveal += fmt.Sprintf("\n- %s had to crack %04d", p.name, session.game.TargetCode(p.id))
+	}
+	session.mutex.Unlock()
+
+	broadcastMessage(session, reveal)
+}
+
+// sendGuessEvents records a guess in the game's history and tells every
+// player about it, with the feedback only for those who would see it in the
+// text messages
+func sendGuessEvents(session *GameSession, event Event, guesser *Player) {
+	session.recordGuess(event, guesser)
+
+	session.mutex.Lock()
+	defer session.mutex.Unlock()
+
+	for _, p := range session.players {
+		visible, feedback := visibleGuess(session, event, p.id)
+		if !visible {
+			continue
+		}
+		sendEvent(p, ProtocolEvent{Type: ProtocolGuess, Player: guesser.name, Team: event.Team,
+			Guess: formatCode(event.Guess), Feedback: feedback, Correct: event.Type != EventGuessIncorrect})
+	}
+}
+
+// recordGuessAnalytics records a guess, and the code it was made against,
+// in the session's analytics, with the solver's judgement of the guess
+func recordGuessAnalytics(session *GameSession, event Event) {
+	session.mutex.Lock()
+	secret := session.game.TargetCode(event.PlayerID)
+	known, guess := guesserView(session, event)
+	session.mutex.Unlock()
+	globalAnalytics.RecordGuess(session.analytics, event.PlayerID, event.Guess, secret)
+	globalAnalytics.RecordEfficiency(session.analytics, event.PlayerID, analyzeGuess(known, guess))
+}
+
+// askPlayAgain asks the players whether they want another game, unless the
+// session only plays one
+func askPlayAgain(session *GameSession) {
+	if session.singleGame || serverHealth.Draining() {
 		return
 	}
-	
-	response := strings.TrimSpace(string(buffer[:n]))
-	log.Printf("%s responded with: %s", player.name, response)
-	
-	if response == "yes" {
-		// Player wants to continue
-		session.mutex.Lock()
-		
-		// Reset for new game
-		newSecretCode := GenerateSecretCode()
-		session.gameOver = false
-		session.guessCount = 0
-		session.secretCode = newSecretCode
-		
-		// Create new analytics for this game
-		session.analytics = globalAnalytics.StartGame(newSecretCode, 1)
-		
-		session.mutex.Unlock()
-		
-		// Start a new game
-		writeToClient(player.conn, "\nStarting a new game!")
-		writeToClient(player.conn, "\nTry to guess the 4-digit code.")
-		writeToClient(player.conn, fmt.Sprintf("\nYou have %d seconds for each guess!", int(session.turnTimeLimit.Seconds())))
-		writeToClient(player.conn, "\nIt's your turn. Enter your guess:")
-		
-		// Run the single-player game session again
-		for !session.gameOver {
-			handlePlayerGuess(session, player)
+	broadcastMessage(session, "\nWould you like to play again? (yes/no)")
+	broadcastEvent(session, ProtocolEvent{Type: ProtocolPrompt, Prompt: PromptPlayAgain})
+}
+
+// describeTeams lists the teams of a team game and their members
+func describeTeams(session *GameSession, teams []Team) string {
+	session.mutex.Lock()
+	defer session.mutex.Unlock()
+
+	description := "\nTeams in this game:"
+	for _, team := range teams {
+		names := make([]string, 0, len(team.Members))
+		for _, id := range team.Members {
+			if p := session.playerByID(id); p != nil {
+				names = append(names, p.name)
+			}
 		}
-		
-		// When game is over, ask if player wants to restart again
-		handleSinglePlayerRestart(session, player)
-	} else {
-		// Player doesn't want to continue
-		writeToClient(player.conn, "\nThank you for playing! Goodbye.")
-		player.conn.Close()
+		description += fmt.Sprintf("\n- Team %s: %s", team.Name, strings.Join(names, ", "))
 	}
+	return description
 }
 
-func handlePlayerDisconnect(session *GameSession, player *Player) {
-	log.Printf("%s has disconnected.", player.name)
+// containsID reports whether a list of player IDs contains the given one
+func containsID(ids []int, playerID int) bool {
+	for _, id := range ids {
+		if id == playerID {
+			return true
+		}
+	}
+	return false
+}
 
-	// In single-player mode, just end the game
+// describeRules explains the guess and time limits of a game, or returns an
+// empty string for the classic unlimited game
+func describeRules(rules GameRules) string {
+	if !rules.Limited() {
+		return ""
+	}
+
+	limits := make([]string, 0, 3)
+	if rules.MaxGuesses > 0 {
+		limits = append(limits, fmt.Sprintf("%d guesses in total", rules.MaxGuesses))
+	}
+	if rules.MaxGuessesPerPlayer > 0 {
+		limits = append(limits, fmt.Sprintf("%d guesses per player", rules.MaxGuessesPerPlayer))
+	}
+	if rules.TimeLimit > 0 {
+		limits = append(limits, fmt.Sprintf("%s on the game clock", rules.TimeLimit))
+	}
+	return fmt.Sprintf("\nLimits: %s. Win sooner for more points!", strings.Join(limits, ", "))
+}
+
+// announceTurn tells a player it is their turn and the others to wait
+func announceTurn(session *GameSession, current *Player) {
+	writeToClient(current.conn, "\nIt's your turn. Enter your guess:")
 	if session.singlePlayerMode {
-		session.mutex.Lock()
-		session.gameOver = true
-		session.mutex.Unlock()
-		
-		// Update analytics for game end with no winner
-		globalAnalytics.EndGame(session.analytics, 0)
 		return
 	}
 
-	// Remove the player from the session
 	session.mutex.Lock()
-	for i, p := range session.players {
-		if p.id == player.id {
-			// Remove this player
-			session.players = append(session.players[:i], session.players[i+1:]...)
-			break
+	defer session.mutex.Unlock()
+	name := current.name
+	if team := session.game.TeamOf(current.id); team != "" {
+		name = fmt.Sprintf("%s (Team %s)", current.name, team)
+	}
+	for _, p := range session.players {
+		if p.id != current.id {
+			writeToClient(p.conn, fmt.Sprintf("\nWaiting for %s to make a guess...", name))
 		}
 	}
+}
 
-	// Check if we still have enough players to continue
-	if len(session.players) < 2 {
-		session.gameOver = true
-		session.mutex.Unlock()
-		
-		// Update analytics for game end with no winner
-		globalAnalytics.EndGame(session.analytics, 0)
+// nextDeadline returns how long until the game needs attention without player
+// input: the end of the current turn (cut short when the game clock is about
+// to run out) or, in race mode, the end of the game clock
+func (session *GameSession) nextDeadline() (time.Duration, bool) {
+	session.mutex.Lock()
+	defer session.mutex.Unlock()
 
-		// Notify remaining players
-		for _, p := range session.players {
-			writeToClient(p.conn, fmt.Sprintf("\n%s has disconnected. Not enough players to continue.", player.name))
-			writeToClient(p.conn, "\nGame over. Thank you for playing!")
-			p.conn.Close()
+	remaining, limited := session.game.TimeRemaining()
+	if session.game.Rules().Mode == ModeRace {
+		return remaining, limited
+	}
+
+	wait := session.turnTimeLimit - time.Since(session.turnStarted)
+	if limited && remaining < wait {
+		wait = remaining
+	}
+	if wait < 0 {
+		wait = 0
+	}
+	return wait, true
+}
+
+// runGameLoop processes player input and deadlines until the game is over
+func runGameLoop(session *GameSession) {
+	for !session.isOver() {
+		var deadline <-chan time.Time
+		var timer *time.Timer
+		if wait, ok := session.nextDeadline(); ok {
+			timer = time.NewTimer(wait)
+			deadline = timer.C
 		}
-	} else {
-		// Adjust current player index if needed
-		if session.currentPlayer >= len(session.players) {
-			session.currentPlayer = 0
+
+		select {
+		case input := <-session.inputs:
+			handlePlayerInput(session, input)
+		case <-deadline:
+			handleDeadline(session)
 		}
 
-		nextPlayer := session.players[session.currentPlayer]
+		if timer != nil {
+			timer.Stop()
+		}
+	}
+}
+
+// handlePlayerInput applies a message (or read error) from a player to the game
+func handlePlayerInput(session *GameSession, input playerInput) {
+	player := input.player
+
+	session.mutex.Lock()
+	connected := session.playerByID(player.id) == player
+	session.mutex.Unlock()
+	if !connected {
+		return
+	}
+
+	if input.err != nil {
+		// The connection failed (like a disconnection)
+		session.playerLogger(player).Info("Connection lost", logEvent, "read_error", "error", input.err)
+		handlePlayerDisconnect(session, player)
+		return
+	}
+
+	// Chat and history requests may be sent at any time, not only on the player's turn
+	if handlePlayerCommand(session, player, input.text) {
+		return
+	}
+
+	session.mutex.Lock()
+	if session.game.State() == StateSettingCodes {
+		// The player is choosing a code for their opponent
+		events, err := session.game.SetSecret(player.id, input.text)
 		session.mutex.Unlock()
+		handleCodeChoice(session, player, events, err)
+		return
+	}
+	session.mutex.Unlock()
+
+	// Let the engine validate and apply the guess
+	session.mutex.Lock()
+	took := time.Since(session.guessStarted(player)).Round(time.Millisecond)
+	player.lastGuess = time.Now()
+	player.guessTook = took
+	events, err := session.game.ApplyGuess(player.id, input.text)
+	freshTurn := err != nil && session.game.CurrentPlayer() == player.id
+	if freshTurn {
+		// A rejected guess gives the player a fresh turn to try again
+		session.turnStarted = time.Now()
+	}
+	team := session.game.TeamOf(player.id)
+	session.mutex.Unlock()
+	logGuess(session, player, input.text, took, err)
+
+	switch {
+	case err == nil:
+		handleEvents(session, events)
+	case errors.Is(err, ErrNotYourTurn):
+		writeToClient(player.conn, "\nIt's not your turn yet. Please wait.")
+	case errors.Is(err, ErrAlreadyCracked):
+		writeToClient(player.conn, "\nYou have already cracked your code. Waiting for your opponent...")
+	case errors.Is(err, ErrGameNotInProgress):
+		// The game ended while this guess was on its way
+	default:
+		writeToClient(player.conn, err.Error())
+		writeToClient(player.conn, "\nTry again:")
+		if freshTurn {
+			broadcastEvent(session, ProtocolEvent{Type: ProtocolTurn, Player: player.name, Team: team,
+				Seconds: int(session.turnTimeLimit.Seconds())})
+		}
+	}
+}
 
-		// Notify remaining players
-		broadcastMessage(session, fmt.Sprintf("\n%s has disconnected. Continuing with %d players.",
-			player.name, len(session.players)))
+// guessStarted returns when the player could start working on their next
+// guess: the start of their turn, or in a race or duel, of the game or their
+// last guess. The caller must hold session.mutex.
+func (session *GameSession) guessStarted(player *Player) time.Time {
+	started := session.turnStarted
+	if session.analytics != nil && session.analytics.StartTime.After(started) {
+		started = session.analytics.StartTime
+	}
+	if player.lastGuess.After(started) {
+		started = player.lastGuess
+	}
+	return started
+}
 
-		// Update turn if it was the disconnected player's turn
-		writeToClient(nextPlayer.conn, "\nIt's your turn. Enter your guess:")
+// logGuess records a guess and how long the player took over it. The guess
+// itself is only logged when debugging.
+func logGuess(session *GameSession, player *Player, guess string, took time.Duration, err error) {
+	logger := session.playerLogger(player).With(logEvent, "guess")
+	if err != nil {
+		logger.Info("Guess rejected", logDuration, took, "error", err)
+	} else {
+		logger.Info("Guess received", logDuration, took)
+	}
+	logger.Debug("Guess text", "guess", guess)
+}
 
-		for _, p := range session.players {
-			if p.id != nextPlayer.id {
-				writeToClient(p.conn, fmt.Sprintf("\nWaiting for %s to make a guess...", nextPlayer.name))
-			}
+// handleCodeChoice presents the result of a duel player choosing a code
+func handleCodeChoice(session *GameSession, player *Player, events []Event, err error) {
+	switch {
+	case err == nil:
+		handleEvents(session, events)
+		session.mutex.Lock()
+		waiting := session.game.State() == StateSettingCodes
+		session.mutex.Unlock()
+		if waiting {
+			writeToClient(player.conn, "\nWaiting for your opponent to choose your code...")
 		}
+	case errors.Is(err, ErrCodeAlreadySet):
+		writeToClient(player.conn, "\nYou have already chosen a code. Waiting for your opponent...")
+	case errors.Is(err, ErrNotSettingCodes):
+		// Play began while this code was on its way
+	default:
+		writeToClient(player.conn, err.Error())
+		writeToClient(player.conn, "\nTry again:")
 	}
 }
 
-func handleGameRestart(session *GameSession) {
-	log.Println("Game over, waiting for players to decide if they want to restart...")
+// handleDeadline forfeits (or, in single-player, restarts) the current turn,
+// ends the game if the game clock has run out, or chooses random codes for
+// duel players who took too long
+func handleDeadline(session *GameSession) {
+	session.mutex.Lock()
+	var events []Event
+	var err error
+	if session.game.State() == StateSettingCodes {
+		events, err = session.game.AssignCodes(GenerateSecretCode)
+	} else if remaining, limited := session.game.TimeRemaining(); limited && remaining == 0 {
+		events, err = session.game.Expire()
+	} else {
+		events, err = session.game.Timeout(session.game.CurrentPlayer())
+	}
+	session.mutex.Unlock()
 
-	// Reset player ready flags
-	for _, player := range session.players {
-		player.readyNext = false
+	if err != nil {
+		session.logger().Debug("Ignoring deadline", "error", err)
+		return
 	}
+	handleEvents(session, events)
+}
 
-	// Track player responses
-	responses := make(map[int]bool)
-	var responseMutex sync.Mutex
-	var wg sync.WaitGroup
+// teamChoiceTimeout is how long players have to choose a team
+const teamChoiceTimeout = 30 * time.Second
 
-	// Process each player's restart decision in separate goroutines
+// chooseTeams asks every player to choose a team before a team game starts.
+// Players who don't choose in time are put on a team when the game starts.
+func chooseTeams(session *GameSession) {
 	session.mutex.Lock()
-	playerCount := len(session.players)
-	playersArray := make([]*Player, playerCount)
-	copy(playersArray, session.players)
+	teams := session.game.Teams()
+	pending := make(map[int]*Player, len(session.players))
+	for _, player := range session.players {
+		pending[player.id] = player
+	}
 	session.mutex.Unlock()
 
-	wg.Add(playerCount)
+	choices := make([]string, len(teams))
+	for i, team := range teams {
+		choices[i] = fmt.Sprintf("%d. %s", i+1, team.Name)
+	}
+	broadcastMessage(session, "\nTeams: "+strings.Join(choices, ", "))
+	broadcastMessage(session, fmt.Sprintf("\nIt's your turn to choose a team (%d seconds). Enter a team name or number:",
+		int(teamChoiceTimeout.Seconds())))
+	broadcastEvent(session, ProtocolEvent{Type: ProtocolPrompt, Prompt: PromptTeam, Seconds: int(teamChoiceTimeout.Seconds())})
 
-	// Set restart decision timeout
-	decisionTimeout := 30 * time.Second
+	timer := time.NewTimer(teamChoiceTimeout)
+	defer timer.Stop()
+
+	for len(pending) > 0 {
+		select {
+		case input := <-session.inputs:
+			// Chat and history requests are not a choice
+			if input.err == nil && handlePlayerCommand(session, input.player, input.text) {
+				continue
+			}
+
+			player, waiting := pending[input.player.id]
+			if !waiting || player != input.player {
+				continue
+			}
 
-	for i := range playersArray {
-		go func(playerIndex int) {
-			defer wg.Done()
-			player := playersArray[playerIndex]
+			if input.err != nil {
+				session.playerLogger(player).Info("Connection lost while choosing a team", logEvent, "read_error", "error", input.err)
+				delete(pending, player.id)
+				handlePlayerDisconnect(session, player)
+				continue
+			}
 
-			// Read the player's response with a timeout
-			player.conn.SetReadDeadline(time.Now().Add(decisionTimeout))
-			buffer := make([]byte, 1024)
-			n, err := player.conn.Read(buffer)
-			player.conn.SetReadDeadline(time.Time{}) // Reset deadline
-			
+			session.mutex.Lock()
+			team, err := session.game.JoinTeam(player.id, input.text)
+			session.mutex.Unlock()
 			if err != nil {
-				log.Printf("Error or timeout reading restart response from %s: %v", player.name, err)
-				responseMutex.Lock()
-				responses[player.id] = false
-				responseMutex.Unlock()
-				writeToClient(player.conn, "\nNo response received in time. You'll be disconnected when the game restarts.")
-				return
+				writeToClient(player.conn, err.Error())
+				writeToClient(player.conn, "\nTry again:")
+				continue
+			}
+
+			session.playerLogger(player).Info("Player joined a team", logEvent, "team_joined", "team", team)
+			delete(pending, player.id)
+			writeToClient(player.conn, fmt.Sprintf("\nYou joined Team %s. Waiting for the other players...", team))
+			session.mutex.Lock()
+			for _, p := range session.players {
+				if p.id != player.id {
+					writeToClient(p.conn, fmt.Sprintf("\n%s joined Team %s.", player.name, team))
+				}
+			}
+			session.mutex.Unlock()
+
+		case <-timer.C:
+			for _, player := range pending {
+				writeToClient(player.conn, "\nNo team chosen in time. You will be put on a team.")
+			}
+			return
+		}
+	}
+}
+
+// restartDecisionTimeout is how long players have to decide whether to play again
+const restartDecisionTimeout = 30 * time.Second
+
+// collectRestartAnswers asks each player whether they want to play again and
+// sets their readyNext flag. A disconnect or no answer in time counts as no.
+func collectRestartAnswers(session *GameSession, players []*Player) {
+	pending := make(map[int]*Player, len(players))
+	for _, player := range players {
+		player.readyNext = false
+		pending[player.id] = player
+	}
+
+	timer := time.NewTimer(restartDecisionTimeout)
+	defer timer.Stop()
+
+	for len(pending) > 0 {
+		select {
+		case input := <-session.inputs:
+			// Chat and history requests are not an answer
+			if input.err == nil && handlePlayerCommand(session, input.player, input.text) {
+				continue
 			}
 
-			response := strings.TrimSpace(string(buffer[:n]))
-			log.Printf("%s responded with: %s", player.name, response)
+			player, waiting := pending[input.player.id]
+			if !waiting || player != input.player {
+				continue
+			}
+
+			if input.err != nil {
+				session.playerLogger(player).Info("Connection lost while choosing to play again", logEvent, "read_error", "error", input.err)
+				delete(pending, player.id)
+				continue
+			}
 
-			responseMutex.Lock()
-			if response == "yes" {
-				responses[player.id] = true
+			// A guess that arrived after the game ended is not an answer
+			if _, err := ValidateGuess(input.text); err == nil {
+				continue
+			}
+
+			delete(pending, player.id)
+			again := strings.EqualFold(input.text, "yes") || strings.EqualFold(input.text, "y")
+			session.playerLogger(player).Info("Player answered whether to play again", logEvent, "restart_answer", "again", again)
+			if again {
 				player.readyNext = true
-				writeToClient(player.conn, "\nYou chose to continue. Waiting for other players' responses...")
-			} else {
-				responses[player.id] = false
+				if !session.singlePlayerMode {
+					writeToClient(player.conn, "\nYou chose to continue. Waiting for other players' responses...")
+				}
+			} else if !session.singlePlayerMode {
 				writeToClient(player.conn, "\nYou chose not to continue. Waiting for other players...")
 			}
-			responseMutex.Unlock()
-		}(i)
+
+		case <-timer.C:
+			for _, player := range pending {
+				session.playerLogger(player).Info("No answer whether to play again", logEvent, "restart_timeout")
+				if session.singlePlayerMode {
+					writeToClient(player.conn, "\nNo response received. Ending game. Thank you for playing!")
+				} else {
+					writeToClient(player.conn, "\nNo response received in time. You'll be disconnected when the game restarts.")
+				}
+			}
+			return
+		}
+	}
+}
+
+// handleSinglePlayerRestart asks the player whether to play again and, if so,
+// restarts the game and returns its start events
+func handleSinglePlayerRestart(session *GameSession, player *Player) ([]Event, bool) {
+	session.logger().Info("Waiting for the player to decide whether to play again", logEvent, "restart_requested")
+
+	collectRestartAnswers(session, []*Player{player})
+	if !player.readyNext {
+		// Player doesn't want to continue
+		writeToClient(player.conn, "\nThank you for playing! Goodbye.")
+		player.conn.Close()
+		return nil, false
+	}
+
+	// Player wants to continue
+	session.mutex.Lock()
+
+	// Reset for new game
+	newSecretCode := GenerateSecretCode()
+	events, err := session.game.Restart(newSecretCode, []int{player.id})
+
+	// Create new analytics for this game
+	session.startAnalytics(newSecretCode, 1)
+
+	session.mutex.Unlock()
+
+	if err != nil {
+		session.playerLogger(player).Error("Error restarting game", "error", err)
+		player.conn.Close()
+		return nil, false
 	}
 
+	writeToClient(player.conn, "\nStarting a new game!")
+	return events, true
+}
+
+func handlePlayerDisconnect(session *GameSession, player *Player) {
+	session.playerLogger(player).Info("Player disconnected", logEvent, "player_disconnected")
+
+	// Remove the player from the game
+	session.mutex.Lock()
+	events, err := session.game.RemovePlayer(player.id)
+	session.mutex.Unlock()
+
+	if err != nil {
+		session.playerLogger(player).Warn("Error removing player from the game", "error", err)
+		return
+	}
+	handleEvents(session, events)
+}
+
+// handleGameRestart asks every player whether to play again and, if enough
+// want to, restarts the game with them and returns its start events
+func handleGameRestart(session *GameSession) ([]Event, bool) {
+	session.logger().Info("Waiting for the players to decide whether to play again", logEvent, "restart_requested")
+
+	session.mutex.Lock()
+	playersArray := make([]*Player, len(session.players))
+	copy(playersArray, session.players)
+	session.mutex.Unlock()
+
 	// Wait for all players to respond (or timeout)
-	wg.Wait()
+	collectRestartAnswers(session, playersArray)
 
 	// Count yes responses
 	session.mutex.Lock()
@@ -716,42 +1275,8 @@ func handleGameRestart(session *GameSession) {
 		}
 	}
 
-	// Check if we have enough players to restart (at least 2)
-	if yesCount >= 2 {
-		// Create a new array with only players who want to continue
-		continuingPlayers := make([]*Player, 0, yesCount)
-		for _, player := range session.players {
-			if player.readyNext {
-				continuingPlayers = append(continuingPlayers, player)
-			} else {
-				// Close connection for players who don't want to continue
-				writeToClient(player.conn, "\nThank you for playing! Goodbye.")
-				player.conn.Close()
-			}
-		}
-
-		// Generate a new secret code for the next game
-		newSecretCode := GenerateSecretCode()
-		
-		// Update the session with only continuing players
-		session.players = continuingPlayers
-		session.gameOver = false
-		session.guessCount = 0
-		session.secretCode = newSecretCode
-		session.currentPlayer = 0
-		
-		// Initialize analytics for this new game
-		session.analytics = globalAnalytics.StartGame(newSecretCode, len(continuingPlayers))
-		
-		session.mutex.Unlock()
-
-		// Start a new game
-		broadcastMessage(session, fmt.Sprintf("\n%d players want to continue. Starting a new game!", yesCount))
-		broadcastMessage(session, fmt.Sprintf("\nEach player has %d seconds to make their guess!", int(session.turnTimeLimit.Seconds())))
-
-		// Run the game session again
-		runGameSession(session)
-	} else {
+	// Check if we have enough players to restart (as many as the mode needs)
+	if yesCount < session.game.MinPlayers() {
 		// Not enough players to restart
 		session.mutex.Unlock()
 		broadcastMessage(session, "\nNot enough players want to continue. Game ended.")
@@ -761,7 +1286,42 @@ func handleGameRestart(session *GameSession) {
 			writeToClient(player.conn, "Thank you for playing! Goodbye.")
 			player.conn.Close()
 		}
+		return nil, false
+	}
+
+	// Create a new array with only players who want to continue
+	continuingPlayers := make([]*Player, 0, yesCount)
+	continuingIDs := make([]int, 0, yesCount)
+	for _, player := range session.players {
+		if player.readyNext {
+			continuingPlayers = append(continuingPlayers, player)
+			continuingIDs = append(continuingIDs, player.id)
+		} else {
+			// Close connection for players who don't want to continue
+			writeToClient(player.conn, "\nThank you for playing! Goodbye.")
+			player.conn.Close()
+		}
 	}
+
+	// Generate a new secret code for the next game
+	newSecretCode := GenerateSecretCode()
+
+	// Update the session with only continuing players
+	session.players = continuingPlayers
+	events, err := session.game.Restart(newSecretCode, continuingIDs)
+
+	// Initialize analytics for this new game
+	session.startAnalytics(newSecretCode, len(continuingPlayers))
+
+	session.mutex.Unlock()
+
+	if err != nil {
+		session.logger().Error("Error restarting game", "error", err)
+		return nil, false
+	}
+
+	broadcastMessage(session, fmt.Sprintf("\n%d players want to continue. Starting a new game!", yesCount))
+	return events, true
 }
 
 func broadcastMessage(session *GameSession, message string) {
@@ -772,10 +1332,23 @@ func broadcastMessage(session *GameSession, message string) {
 	session.mutex.Unlock()
 }
 
+// clientWriteTimeout is how long a write to a client may take. Writes are
+// made holding the session's lock, so a client that stops reading is
+// dropped rather than left to hold up the game.
+var clientWriteTimeout = 5 * time.Second
+
 func writeToClient(conn net.Conn, s string) {
+	conn.SetWriteDeadline(time.Now().Add(clientWriteTimeout))
 	_, err := conn.Write([]byte(s))
+	if errors.Is(err, os.ErrDeadlineExceeded) {
+		// Closing the connection ends its reader, which disconnects the player
+		slog.Warn("Dropping a client that stopped reading", logEvent, "slow_client",
+			"remote", conn.RemoteAddr().String())
+		conn.Close()
+		return
+	}
 	if err != nil {
-		log.Printf("Error writing to client: %v", err)
+		slog.Debug("Error writing to client", "remote", conn.RemoteAddr().String(), "error", err)
 		return
 	}
 }
\ No newline at end of file
@@ -7,27 +7,69 @@ import (
 	"strings"
 )
 
+// singlePlayerID is the player ID used for the local single-player game
+const singlePlayerID = 1
+
+// Difficulty controls how much help the local single-player game gives
+type Difficulty string
+
+const (
+	DifficultyEasy   Difficulty = "easy"   // Hints show which digits are in the right place
+	DifficultyNormal Difficulty = "normal" // Hints count correct positions and digits
+	DifficultyHard   Difficulty = "hard"   // No hints, only right or wrong
+)
+
+// OfflineOptions configures the local single-player game
+type OfflineOptions struct {
+	SecretRules string     // Secret code rules (SecretRulesClassic or SecretRulesUniform)
+	Difficulty  Difficulty // How much feedback to give on wrong guesses
+	Seed        int64      // Seed for the secret codes (0 for a random seed)
+	Rules       GameRules  // Optional guess and time limits
+}
+
+// DefaultOfflineOptions returns the options matching the classic game
+func DefaultOfflineOptions() OfflineOptions {
+	return OfflineOptions{
+		SecretRules: SecretRulesClassic,
+		Difficulty:  DifficultyNormal,
+	}
+}
+
 // StartSinglePlayerGame starts a single-player version of the Code Breaker Game
-func StartSinglePlayerGame() {
+func StartSinglePlayerGame(options OfflineOptions) error {
+	generator, err := NewSecretGenerator(options.SecretRules, options.Seed)
+	if err != nil {
+		return err
+	}
+	switch options.Difficulty {
+	case DifficultyEasy, DifficultyNormal, DifficultyHard:
+	default:
+		return fmt.Errorf("unknown difficulty %q (use easy, normal or hard)", options.Difficulty)
+	}
+
 	fmt.Println("Welcome to the Code Breaker Game (Single Player Mode)!")
+	fmt.Printf("Rules: %s, difficulty: %s\n", options.SecretRules, options.Difficulty)
+	if limits := describeRules(options.Rules); limits != "" {
+		fmt.Println(strings.TrimSpace(limits))
+	}
 	fmt.Println("Try to guess the 4-digit code.")
 	
 	reader := bufio.NewReader(os.Stdin)
 	playAgain := true
 	
 	for playAgain {
-		// Generate a secret code for this game
-		secretCode := GenerateSecretCode()
-		guessCount := 0
-		gameWon := false
+		// Start a new game against a fresh secret code
+		engine := NewGame(generator.Next(), true)
+		engine.SetRules(options.Rules)
+		engine.AddPlayer(singlePlayerID)
+		engine.Start()
 		
 		// Game loop for one round
-		for !gameWon {
+		for !engine.Over() {
 			fmt.Print("\nEnter your guess (4 digits) or 'exit' to quit: ")
 			input, err := reader.ReadString('\n')
 			if err != nil {
-				fmt.Printf("Error reading input: %v\n", err)
-				return
+				return fmt.Errorf("error reading input: %v", err)
 			}
 			
 			input = strings.TrimSpace(input)
@@ -35,31 +77,39 @@ func StartSinglePlayerGame() {
 			// Check for exit command
 			if input == "exit" {
 				fmt.Println("Exiting the game.")
-				return
+				return nil
 			}
 			
-			// Validate the guess
-			numGuess, err := ValidateGuess(input)
+			// Let the engine validate and score the guess, unless the game clock ran out
+			var events []Event
+			if remaining, limited := engine.TimeRemaining(); limited && remaining == 0 {
+				events, err = engine.Expire()
+			} else {
+				events, err = engine.ApplyGuess(singlePlayerID, input)
+			}
 			if err != nil {
 				fmt.Printf("Invalid input: %s\n", err.Error())
 				continue
 			}
 			
-			// Increment guess count
-			guessCount++
-			
-			// Check if the guess is correct
-			if numGuess == secretCode {
-				prefix := GenerateTimestampPrefix()
-				fmt.Printf("%sCorrect! You guessed it in %d attempts.\n", prefix, guessCount)
-				gameWon = true
-			} else {
-				// Provide feedback on the guess
-				fmt.Printf("Incorrect. Try again! (Attempts: %d)\n", guessCount)
-				
-				// Optional: Add hint functionality for single player mode
-				hint := generateHint(numGuess, secretCode)
-				fmt.Printf("Hint: %s\n", hint)
+			for _, event := range events {
+				switch event.Type {
+				case EventGuessCorrect:
+					prefix := GenerateTimestampPrefix()
+					fmt.Printf("%sCorrect! You guessed it in %d attempts.\n", prefix, event.GuessCount)
+					fmt.Printf("You scored %d points.\n", event.Score)
+				case EventGameLost:
+					fmt.Printf("Out of guesses or time! The code was %04d.\n", event.SecretCode)
+				case EventGuessIncorrect:
+					// Provide feedback on the guess
+					fmt.Printf("Incorrect. Try again! (Attempts: %d)\n", event.GuessCount)
+					if hint := formatHint(options.Difficulty, event.Guess, engine.SecretCode(), event.Feedback); hint != "" {
+						fmt.Printf("Hint: %s\n", hint)
+					}
+					if event.GuessesLeft >= 0 {
+						fmt.Printf("Guesses left: %d\n", event.GuessesLeft)
+					}
+				}
 			}
 		}
 		
@@ -67,8 +117,7 @@ func StartSinglePlayerGame() {
 		fmt.Print("\nWould you like to play again? (yes/no): ")
 		response, err := reader.ReadString('\n')
 		if err != nil {
-			fmt.Printf("Error reading input: %v\n", err)
-			return
+			return fmt.Errorf("error reading input: %v", err)
 		}
 		
 		response = strings.TrimSpace(strings.ToLower(response))
@@ -76,45 +125,39 @@ func StartSinglePlayerGame() {
 	}
 	
 	fmt.Println("Thanks for playing! Goodbye.")
+	return nil
 }
 
-// Helper function to generate hints for single player mode
-func generateHint(guess, secretCode int) string {
+// formatHint describes guess feedback for single player mode at the given difficulty
+func formatHint(difficulty Difficulty, guess, secretCode int, feedback Feedback) string {
+	switch difficulty {
+	case DifficultyHard:
+		return ""
+	case DifficultyEasy:
+		return fmt.Sprintf("%s (%s)", describeFeedback(feedback), positionHint(guess, secretCode))
+	default:
+		return describeFeedback(feedback)
+	}
+}
+
+// describeFeedback spells out the feedback for a guess
+func describeFeedback(feedback Feedback) string {
+	return fmt.Sprintf("%d correct position, %d correct digit but wrong position",
+		feedback.Exact, feedback.Partial)
+}
+
+// positionHint shows the digits of a guess that are in the right place, e.g. "1 _ _ 4"
+func positionHint(guess, secretCode int) string {
 	guessStr := fmt.Sprintf("%04d", guess)
 	secretStr := fmt.Sprintf("%04d", secretCode)
-	
-	// Count correct digits in correct positions and correct digits in wrong positions
-	correctPosition := 0
-	correctDigit := 0
-	
-	// Track which positions we've already matched
-	usedSecret := [4]bool{}
-	usedGuess := [4]bool{}
-	
-	// First pass: find correct positions
+
+	marks := make([]string, 4)
 	for i := 0; i < 4; i++ {
 		if guessStr[i] == secretStr[i] {
-			correctPosition++
-			usedSecret[i] = true
-			usedGuess[i] = true
+			marks[i] = string(guessStr[i])
+		} else {
+			marks[i] = "_"
 		}
 	}
-	
-	// Second pass: find correct digits in wrong positions
-	for i := 0; i < 4; i++ {
-		if usedGuess[i] {
-			continue
-		}
-		
-		for j := 0; j < 4; j++ {
-			if !usedSecret[j] && guessStr[i] == secretStr[j] {
-				correctDigit++
-				usedSecret[j] = true
-				break
-			}
-		}
-	}
-	
-	return fmt.Sprintf("%d correct position, %d correct digit but wrong position", 
-		correctPosition, correctDigit)
-}
\ No newline at end of file
+	return strings.Join(marks, " ")
+}
@@ -0,0 +1,311 @@
+package game
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+// The solver weighs every code as its next guess once at most
+// solverSearchLimit codes could still be the secret, and otherwise only the
+// first solverGuessLimit of those, which keeps a solve within tens of
+// milliseconds
+const (
+	solverSearchLimit = 200
+	solverGuessLimit  = 500
+)
+
+// solverOpenings are the first guesses the solver weighs: one code of each
+// pattern of repeated digits, as every other code plays like one of them
+var solverOpenings = []int{0, 1, 11, 12, 123}
+
+// solvedCodes caches how many guesses the solver takes for each code
+var solvedCodes = struct {
+	sync.Mutex
+	guesses map[int]int
+}{guesses: make(map[int]int)}
+
+// codeInformation is the information, in bits, it takes to pin down one
+// code out of the candidateLimit codes
+var codeInformation = math.Log2(candidateLimit)
+
+// GuessEfficiency is what the solver makes of a guess, judged by what its
+// guesser knew when they made it
+type GuessEfficiency struct {
+	Consistent bool // Whether the guess could still have been the secret
+	Before     int  // Codes that fit what the guesser knew before the guess
+	After      int  // Codes that still fit once they saw how the guess did
+}
+
+// Bits is the information the guess gained: how many times over it halved
+// the codes that could be the secret
+func (e GuessEfficiency) Bits() float64 {
+	if e.Before == 0 || e.After == 0 {
+		return 0
+	}
+	return math.Log2(float64(e.Before) / float64(e.After))
+}
+
+// analyzeGuess works out how a guess narrowed down the secret. known are the
+// earlier guesses at the same secret as the guesser saw them, and guess is
+// the new one as they saw it, with the feedback only if it was shown to them.
+func analyzeGuess(known []GuessRecord, guess GuessRecord) GuessEfficiency {
+	value, _ := strconv.Atoi(guess.Guess)
+	result := GuessEfficiency{Consistent: fitsGuesses(value, known)}
+	latest := []GuessRecord{guess}
+	for code := 0; code < candidateLimit; code++ {
+		if !fitsGuesses(code, known) {
+			continue
+		}
+		result.Before++
+		if fitsGuesses(code, latest) {
+			result.After++
+		}
+	}
+	return result
+}
+
+// SolveCode returns how many guesses a solver that sees the feedback of
+// every guess takes to crack a code. Each guess leaves the fewest codes that
+// could still be the secret in the worst case (Knuth's minimax).
+func SolveCode(secret int) int {
+	solvedCodes.Lock()
+	guesses, solved := solvedCodes.guesses[secret]
+	solvedCodes.Unlock()
+	if solved {
+		return guesses
+	}
+
+	every := make([]int, candidateLimit)
+	for code := range every {
+		every[code] = code
+	}
+	candidates := append([]int(nil), every...)
+	pool := solverOpenings
+	for {
+		guess := minimaxGuess(pool, candidates)
+		guesses++
+		feedback := scoreCodes(guess, secret)
+		if feedback.Exact == 4 {
+			break
+		}
+		remaining := candidates[:0]
+		for _, code := range candidates {
+			if scoreCodes(guess, code) == feedback {
+				remaining = append(remaining, code)
+			}
+		}
+		candidates = remaining
+		pool = every
+		if len(candidates) > solverSearchLimit {
+			pool = candidates[:min(len(candidates), solverGuessLimit)]
+		}
+	}
+
+	solvedCodes.Lock()
+	solvedCodes.guesses[secret] = guesses
+	solvedCodes.Unlock()
+	return guesses
+}
+
+// minimaxGuess returns the guess from the pool whose worst feedback leaves
+// the fewest candidates, preferring a candidate on a tie as it may be right
+func minimaxGuess(pool []int, candidates []int) int {
+	if len(candidates) == 1 {
+		return candidates[0]
+	}
+	var fits [candidateLimit]bool
+	for _, code := range candidates {
+		fits[code] = true
+	}
+
+	best, bestWorst := pool[0], candidateLimit+1
+	for _, guess := range pool {
+		// Feedback is counted by 5*Exact+Partial
+		var counts [25]int
+		worst := 0
+		for _, code := range candidates {
+			feedback := scoreCodes(guess, code)
+			counts[5*feedback.Exact+feedback.Partial]++
+			worst = max(worst, counts[5*feedback.Exact+feedback.Partial])
+		}
+		if worst < bestWorst || (worst == bestWorst && fits[guess] && !fits[best]) {
+			best, bestWorst = guess, worst
+		}
+	}
+	return best
+}
+
+// scoreCodes scores a guess like ScoreGuess, without formatting the codes,
+// for the solver's many comparisons
+func scoreCodes(guess, secret int) Feedback {
+	var feedback Feedback
+	var guessDigits, secretDigits [10]int
+	for i := 0; i < 4; i++ {
+		g, s := guess%10, secret%10
+		guess, secret = guess/10, secret/10
+		if g == s {
+			feedback.Exact++
+			continue
+		}
+		guessDigits[g]++
+		secretDigits[s]++
+	}
+	for digit := range guessDigits {
+		feedback.Partial += min(guessDigits[digit], secretDigits[digit])
+	}
+	return feedback
+}
+
+// Efficiency sums up the guesses of a player the solver has analyzed
+type Efficiency struct {
+	Guesses    int     `json:"guesses"`    // Guesses analyzed
+	Consistent int     `json:"consistent"` // Of those, guesses that could still have been the secret
+	Bits       float64 `json:"bits"`       // Information gained, in bits
+}
+
+// Add counts an analyzed guess
+func (e *Efficiency) Add(guess GuessEfficiency) {
+	e.Guesses++
+	if guess.Consistent {
+		e.Consistent++
+	}
+	e.Bits += guess.Bits()
+}
+
+// ConsistentRate is the share of the guesses that could still have been
+// the secret
+func (e Efficiency) ConsistentRate() float64 {
+	if e.Guesses == 0 {
+		return 0
+	}
+	return float64(e.Consistent) / float64(e.Guesses)
+}
+
+// BitsPerGuess is the information gained by a guess on average
+func (e Efficiency) BitsPerGuess() float64 {
+	if e.Guesses == 0 {
+		return 0
+	}
+	return e.Bits / float64(e.Guesses)
+}
+
+// Describe presents the efficiency in a sentence
+func (e Efficiency) Describe() string {
+	return fmt.Sprintf("%d guesses, %d (%.0f%%) consistent with the feedback seen, %.2f bits of information gained "+
+		"(%.2f per guess; a code takes %.1f)", e.Guesses, e.Consistent, e.ConsistentRate()*100, e.Bits,
+		e.BitsPerGuess(), codeInformation)
+}
+
+// PlayerEfficiency is a player's efficiency over all their games
+type PlayerEfficiency struct {
+	PlayerID int
+	Efficiency
+}
+
+// RecordEfficiency adds the solver's analysis of a player's guess to the
+// game's and the player's efficiency
+func (ga *GameAnalytics) RecordEfficiency(stats *GameStats, playerID int, guess GuessEfficiency) {
+	ga.mu.Lock()
+	defer ga.mu.Unlock()
+
+	if stats.Efficiency == nil {
+		stats.Efficiency = make(map[int]*Efficiency)
+	}
+	if _, exists := stats.Efficiency[playerID]; !exists {
+		stats.Efficiency[playerID] = &Efficiency{}
+	}
+	stats.Efficiency[playerID].Add(guess)
+
+	if _, exists := ga.playerStats[playerID]; !exists {
+		ga.playerStats[playerID] = &PlayerStats{}
+	}
+	ga.playerStats[playerID].Efficiency.Add(guess)
+}
+
+// GameEfficiency returns a player's efficiency in a game, and false if none
+// of their guesses were analyzed
+func (ga *GameAnalytics) GameEfficiency(stats *GameStats, playerID int) (Efficiency, bool) {
+	ga.mu.RLock()
+	defer ga.mu.RUnlock()
+
+	efficiency, exists := stats.Efficiency[playerID]
+	if !exists {
+		return Efficiency{}, false
+	}
+	return *efficiency, true
+}
+
+// GetPlayerEfficiency returns a player's efficiency over all their games,
+// and false if none of their guesses were analyzed. Like the other player
+// stats it is kept by player ID, which on the plain server is a seat.
+func (ga *GameAnalytics) GetPlayerEfficiency(playerID int) (Efficiency, bool) {
+	ga.mu.RLock()
+	defer ga.mu.RUnlock()
+
+	stats, exists := ga.playerStats[playerID]
+	if !exists || stats.Efficiency.Guesses == 0 {
+		return Efficiency{}, false
+	}
+	return stats.Efficiency, true
+}
+
+// GetTopEfficientPlayers returns the N players who gained the most
+// information per guess
+func (ga *GameAnalytics) GetTopEfficientPlayers(n int) []PlayerEfficiency {
+	ga.mu.RLock()
+	defer ga.mu.RUnlock()
+
+	players := make([]PlayerEfficiency, 0)
+	for id, stats := range ga.playerStats {
+		if stats.Efficiency.Guesses > 0 {
+			players = append(players, PlayerEfficiency{PlayerID: id, Efficiency: stats.Efficiency})
+		}
+	}
+
+	// Sort by information per guess (descending), then by consistency and ID
+	sort.Slice(players, func(i, j int) bool {
+		if players[i].BitsPerGuess() != players[j].BitsPerGuess() {
+			return players[i].BitsPerGuess() > players[j].BitsPerGuess()
+		}
+		if players[i].ConsistentRate() != players[j].ConsistentRate() {
+			return players[i].ConsistentRate() > players[j].ConsistentRate()
+		}
+		return players[i].PlayerID < players[j].PlayerID
+	})
+
+	// Take top N
+	if n > len(players) {
+		n = len(players)
+	}
+	return players[:n]
+}
+
+// handleEfficiencyCommand answers the admin command "efficiency [player ID]":
+// the most efficient players, or one player's efficiency
+func handleEfficiencyCommand(args []string) string {
+	if len(args) > 0 {
+		playerID, err := strconv.Atoi(args[0])
+		if err != nil {
+			return fmt.Sprintf("Error: invalid player ID %q\nUsage: efficiency [player ID]", args[0])
+		}
+		efficiency, exists := globalAnalytics.GetPlayerEfficiency(playerID)
+		if !exists {
+			return fmt.Sprintf("No guesses analyzed for player %d yet", playerID)
+		}
+		return fmt.Sprintf("Player %d: %s", playerID, efficiency.Describe())
+	}
+
+	report := "TOP 10 PLAYERS BY INFORMATION PER GUESS:\n"
+	players := globalAnalytics.GetTopEfficientPlayers(10)
+	if len(players) == 0 {
+		report += "No data available yet\n"
+	}
+	for i, player := range players {
+		report += fmt.Sprintf("%d. Player %d - %.2f bits per guess, %.1f%% consistent (%d guesses)\n",
+			i+1, player.PlayerID, player.BitsPerGuess(), player.ConsistentRate()*100, player.Guesses)
+	}
+	return report
+}
@@ -0,0 +1,83 @@
+package game
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAnalyzeGuess(t *testing.T) {
+	// The first guess can't go against anything and narrows down the codes
+	// to those that score the same
+	feedback := ScoreGuess(1234, 5678)
+	first := GuessRecord{Guess: "1234", Feedback: &feedback}
+	result := analyzeGuess(nil, first)
+	assert.True(t, result.Consistent)
+	assert.Equal(t, 10000, result.Before)
+	assert.Equal(t, 6*6*6*6, result.After)
+	assert.InDelta(t, math.Log2(10000.0/1296.0), result.Bits(), 1e-9)
+
+	// Guessing a digit already ruled out can't be right
+	known := []GuessRecord{first}
+	second := ScoreGuess(1567, 5678)
+	result = analyzeGuess(known, GuessRecord{Guess: "1567", Feedback: &second})
+	assert.False(t, result.Consistent)
+	assert.Equal(t, 1296, result.Before)
+	assert.Less(t, result.After, result.Before)
+
+	// Without feedback a wrong guess only rules itself out
+	result = analyzeGuess(known, GuessRecord{Guess: "5566"})
+	assert.True(t, result.Consistent)
+	assert.Equal(t, 1295, result.After)
+
+	// Cracking the code leaves only the code
+	result = analyzeGuess(known, GuessRecord{Guess: "5678", Correct: true})
+	assert.True(t, result.Consistent)
+	assert.Equal(t, 1, result.After)
+	assert.InDelta(t, math.Log2(1296), result.Bits(), 1e-9)
+}
+
+func TestGameAnalytics_RecordsEfficiency(t *testing.T) {
+	analytics := NewGameAnalytics()
+	stats := analytics.StartGame(5678, 2)
+	analytics.RecordEfficiency(stats, 1, GuessEfficiency{Consistent: true, Before: 16, After: 4})
+	analytics.RecordEfficiency(stats, 1, GuessEfficiency{Consistent: false, Before: 4, After: 4})
+	analytics.RecordEfficiency(stats, 2, GuessEfficiency{Consistent: true, Before: 4, After: 1})
+	analytics.EndGame(stats, 2)
+
+	game, exists := analytics.GameEfficiency(stats, 1)
+	assert.True(t, exists)
+	assert.Equal(t, Efficiency{Guesses: 2, Consistent: 1, Bits: 2}, game)
+	assert.Equal(t, 0.5, game.ConsistentRate())
+	assert.Equal(t, 1.0, game.BitsPerGuess())
+	_, exists = analytics.GameEfficiency(stats, 3)
+	assert.False(t, exists)
+
+	// A player's efficiency adds up over their games
+	stats = analytics.StartGame(1111, 1)
+	analytics.RecordEfficiency(stats, 1, GuessEfficiency{Consistent: true, Before: 8, After: 1})
+	overall, exists := analytics.GetPlayerEfficiency(1)
+	assert.True(t, exists)
+	assert.Equal(t, Efficiency{Guesses: 3, Consistent: 2, Bits: 5}, overall)
+
+	top := analytics.GetTopEfficientPlayers(5)
+	assert.Len(t, top, 2)
+	assert.Equal(t, 2, top[0].PlayerID)
+	assert.Equal(t, 1, top[1].PlayerID)
+}
+
+func TestHandleEfficiencyCommand(t *testing.T) {
+	saved := globalAnalytics
+	defer func() { globalAnalytics = saved }()
+	globalAnalytics = NewGameAnalytics()
+
+	assert.Contains(t, handleEfficiencyCommand(nil), "No data available yet")
+
+	stats := globalAnalytics.StartGame(5678, 1)
+	globalAnalytics.RecordEfficiency(stats, 4, GuessEfficiency{Consistent: true, Before: 10000, After: 1296})
+	assert.Contains(t, handleEfficiencyCommand(nil), "1. Player 4 - 2.95 bits per guess, 100.0% consistent (1 guesses)")
+	assert.Contains(t, handleEfficiencyCommand([]string{"4"}), "Player 4: 1 guesses, 1 (100%) consistent")
+	assert.Contains(t, handleEfficiencyCommand([]string{"5"}), "No guesses analyzed for player 5")
+	assert.Contains(t, handleEfficiencyCommand([]string{"x"}), "Usage: efficiency [player ID]")
+}
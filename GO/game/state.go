@@ -0,0 +1,151 @@
+package game
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// StateStore holds the state the server replicas share. Keys expire after
+// their ttl, so what a replica published disappears by itself if the replica
+// dies; a ttl of 0 keeps a key until it is deleted. Implementations are safe
+// for concurrent use.
+type StateStore interface {
+	// Get returns the value of a key, reporting false if there is none
+	Get(key string) (string, bool, error)
+	// Set stores a value under a key
+	Set(key, value string, ttl time.Duration) error
+	// SetIfAbsent stores a value only if the key has none, reporting whether it did
+	SetIfAbsent(key, value string, ttl time.Duration) (bool, error)
+	// Delete removes a key
+	Delete(key string) error
+	// Scan returns every key starting with prefix and its value
+	Scan(prefix string) (map[string]string, error)
+	// Ping checks that the store can be reached
+	Ping() error
+}
+
+// OpenStateStore opens the store named by a URL: "memory" (or "") for a
+// store inside this process, which suits a single server, or
+// "redis://[:password@]host:port[/db]" for one shared by several
+func OpenStateStore(address string) (StateStore, error) {
+	if address == "" || address == "memory" {
+		return NewMemoryStore(), nil
+	}
+	u, err := url.Parse(address)
+	if err != nil || u.Scheme != "redis" || u.Host == "" {
+		return nil, fmt.Errorf("unknown state store %q; use memory or redis://host:port", address)
+	}
+
+	options := RedisOptions{Address: u.Host}
+	if u.User != nil {
+		options.Password, _ = u.User.Password()
+	}
+	if db := strings.Trim(u.Path, "/"); db != "" {
+		if _, err := fmt.Sscan(db, &options.DB); err != nil {
+			return nil, fmt.Errorf("invalid database number %q in %s", db, address)
+		}
+	}
+	store := NewRedisStore(options)
+	if err := store.Ping(); err != nil {
+		return nil, fmt.Errorf("error connecting to the state store: %v", err)
+	}
+	return store, nil
+}
+
+// memoryEntry is a value kept by a MemoryStore
+type memoryEntry struct {
+	value   string
+	expires time.Time // Zero if the entry does not expire
+}
+
+// MemoryStore is a StateStore inside this process
+type MemoryStore struct {
+	mutex   sync.Mutex
+	entries map[string]memoryEntry
+}
+
+// NewMemoryStore creates an empty store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{entries: make(map[string]memoryEntry)}
+}
+
+// Get returns the value of a key, reporting false if there is none
+func (m *MemoryStore) Get(key string) (string, bool, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	entry, ok := m.liveLocked(key, time.Now())
+	return entry.value, ok, nil
+}
+
+// Set stores a value under a key
+func (m *MemoryStore) Set(key, value string, ttl time.Duration) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.entries[key] = newMemoryEntry(value, ttl)
+	return nil
+}
+
+// SetIfAbsent stores a value only if the key has none, reporting whether it did
+func (m *MemoryStore) SetIfAbsent(key, value string, ttl time.Duration) (bool, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if _, ok := m.liveLocked(key, time.Now()); ok {
+		return false, nil
+	}
+	m.entries[key] = newMemoryEntry(value, ttl)
+	return true, nil
+}
+
+// Delete removes a key
+func (m *MemoryStore) Delete(key string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	delete(m.entries, key)
+	return nil
+}
+
+// Scan returns every key starting with prefix and its value
+func (m *MemoryStore) Scan(prefix string) (map[string]string, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	now := time.Now()
+	found := make(map[string]string)
+	for key := range m.entries {
+		if !strings.HasPrefix(key, prefix) {
+			continue
+		}
+		if entry, ok := m.liveLocked(key, now); ok {
+			found[key] = entry.value
+		}
+	}
+	return found, nil
+}
+
+// Ping checks that the store can be reached, which it always can
+func (m *MemoryStore) Ping() error {
+	return nil
+}
+
+// liveLocked returns a key's entry unless it has expired, which removes it;
+// the caller must hold m.mutex
+func (m *MemoryStore) liveLocked(key string, now time.Time) (memoryEntry, bool) {
+	entry, ok := m.entries[key]
+	if ok && !entry.expires.IsZero() && !now.Before(entry.expires) {
+		delete(m.entries, key)
+		return memoryEntry{}, false
+	}
+	return entry, ok
+}
+
+// newMemoryEntry creates an entry that expires after ttl, if it is set
+func newMemoryEntry(value string, ttl time.Duration) memoryEntry {
+	entry := memoryEntry{value: value}
+	if ttl > 0 {
+		entry.expires = time.Now().Add(ttl)
+	}
+	return entry
+}
@@ -0,0 +1,118 @@
+package game
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// testStateStores returns a MemoryStore and a RedisStore talking to
+// ServeStateStore, to run the same checks against both
+func testStateStores(t *testing.T) map[string]StateStore {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	t.Cleanup(func() { listener.Close() })
+	go ServeStateStore(listener, NewMemoryStore())
+
+	return map[string]StateStore{
+		"memory": NewMemoryStore(),
+		"redis":  NewRedisStore(RedisOptions{Address: listener.Addr().String(), Password: "secret", DB: 2}),
+	}
+}
+
+func TestStateStore_SetGetAndDelete(t *testing.T) {
+	for name, store := range testStateStores(t) {
+		t.Run(name, func(t *testing.T) {
+			assert.NoError(t, store.Ping())
+			_, found, err := store.Get("missing")
+			assert.NoError(t, err)
+			assert.False(t, found)
+
+			assert.NoError(t, store.Set("codebreaker:a", "line one\r\nline two", 0))
+			value, found, err := store.Get("codebreaker:a")
+			assert.NoError(t, err)
+			assert.True(t, found)
+			assert.Equal(t, "line one\r\nline two", value)
+
+			assert.NoError(t, store.Delete("codebreaker:a"))
+			_, found, _ = store.Get("codebreaker:a")
+			assert.False(t, found)
+		})
+	}
+}
+
+func TestStateStore_KeysExpire(t *testing.T) {
+	for name, store := range testStateStores(t) {
+		t.Run(name, func(t *testing.T) {
+			assert.NoError(t, store.Set("short", "1", 50*time.Millisecond))
+			assert.NoError(t, store.Set("long", "2", time.Minute))
+			time.Sleep(100 * time.Millisecond)
+
+			_, found, _ := store.Get("short")
+			assert.False(t, found)
+			_, found, _ = store.Get("long")
+			assert.True(t, found)
+		})
+	}
+}
+
+func TestStateStore_SetIfAbsentClaimsOnce(t *testing.T) {
+	for name, store := range testStateStores(t) {
+		t.Run(name, func(t *testing.T) {
+			claimed, err := store.SetIfAbsent("lobby", "first", 50*time.Millisecond)
+			assert.NoError(t, err)
+			assert.True(t, claimed)
+
+			claimed, err = store.SetIfAbsent("lobby", "second", time.Minute)
+			assert.NoError(t, err)
+			assert.False(t, claimed)
+			value, _, _ := store.Get("lobby")
+			assert.Equal(t, "first", value)
+
+			// An expired claim can be taken over
+			time.Sleep(100 * time.Millisecond)
+			claimed, _ = store.SetIfAbsent("lobby", "second", time.Minute)
+			assert.True(t, claimed)
+		})
+	}
+}
+
+func TestStateStore_ScanMatchesPrefix(t *testing.T) {
+	for name, store := range testStateStores(t) {
+		t.Run(name, func(t *testing.T) {
+			store.Set("codebreaker:replica:a", "1", 0)
+			store.Set("codebreaker:replica:b", "2", 0)
+			store.Set("codebreaker:session:a:1", "3", 0)
+			store.Set("codebreaker:replica*", "4", 0)
+
+			found, err := store.Scan("codebreaker:replica:")
+			assert.NoError(t, err)
+			assert.Equal(t, map[string]string{"codebreaker:replica:a": "1", "codebreaker:replica:b": "2"}, found)
+
+			// Glob characters in the prefix match only themselves
+			found, _ = store.Scan("codebreaker:replica*")
+			assert.Equal(t, map[string]string{"codebreaker:replica*": "4"}, found)
+		})
+	}
+}
+
+func TestOpenStateStore(t *testing.T) {
+	store, err := OpenStateStore("memory")
+	assert.NoError(t, err)
+	assert.IsType(t, &MemoryStore{}, store)
+
+	_, err = OpenStateStore("etcd://localhost:2379")
+	assert.Error(t, err)
+	_, err = OpenStateStore("redis://localhost:6379/db")
+	assert.Error(t, err)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer listener.Close()
+	go ServeStateStore(listener, NewMemoryStore())
+	store, err = OpenStateStore("redis://:pw@" + listener.Addr().String() + "/1")
+	assert.NoError(t, err)
+	assert.Equal(t, RedisOptions{Address: listener.Addr().String(), Password: "pw", DB: 1}, store.(*RedisStore).options)
+}
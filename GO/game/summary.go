@@ -0,0 +1,152 @@
+package game
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// GameSummary sums up a finished game for its players, in a ProtocolSummary
+// event and as text
+type GameSummary struct {
+	Result  string          `json:"result"` // ResultWon, ResultLost or ResultDraw
+	Players []PlayerSummary `json:"players"`
+}
+
+// PlayerSummary is a player's part in a game summary
+type PlayerSummary struct {
+	Player        string         `json:"player"`
+	Secret        string         `json:"secret"`         // The code the player had to crack
+	SolverGuesses int            `json:"solver_guesses"` // Guesses SolveCode takes to crack it
+	Guesses       []GuessSummary `json:"guesses"`
+	Timeouts      int            `json:"timeouts"`                // Turns the player ran out of time for
+	Efficiency    Efficiency     `json:"efficiency"`              // The solver's analysis of their guesses
+	Stats         *PlayerStats   `json:"stats,omitempty"`         // Their lifetime stats, counting this game; lobby servers only
+	RatingChange  *int           `json:"rating_change,omitempty"` // Matched games only
+}
+
+// GuessSummary is a guess in a game summary
+type GuessSummary struct {
+	Guess    string   `json:"guess"` // Always four digits
+	Feedback Feedback `json:"feedback"`
+	Correct  bool     `json:"correct"`
+	Seconds  float64  `json:"seconds"` // Time the player took over the guess
+}
+
+// rateGame updates the ratings of a matched game once it's over, only the
+// first time it's called, and returns each player's rating change by name;
+// unrated games return nil
+func (session *GameSession) rateGame() map[string]int {
+	if session.rate == nil {
+		return nil
+	}
+	session.rateOnce.Do(func() { session.ratingChanges = session.rate() })
+	return session.ratingChanges
+}
+
+// gameRecord returns a player's efficiency and timeouts in a game, and a
+// copy of their personal stats
+func (ga *GameAnalytics) gameRecord(stats *GameStats, playerID int) (Efficiency, int, PlayerStats) {
+	ga.mu.RLock()
+	defer ga.mu.RUnlock()
+
+	var efficiency Efficiency
+	if game, exists := stats.Efficiency[playerID]; exists {
+		efficiency = *game
+	}
+	var personal PlayerStats
+	if player, exists := ga.playerStats[playerID]; exists {
+		personal = *player
+	}
+	return efficiency, stats.Timeouts[playerID], personal
+}
+
+// buildSummary sums up the game that just ended for the players still in
+// the session. Once the game is over every guess and its feedback can be
+// shown to everyone.
+func buildSummary(session *GameSession, result string) GameSummary {
+	changes := session.rateGame()
+
+	session.mutex.Lock()
+	summary := GameSummary{Result: result, Players: make([]PlayerSummary, 0, len(session.players))}
+	secrets := make([]int, 0, len(session.players))
+	for _, p := range session.players {
+		secret := session.game.TargetCode(p.id)
+		player := PlayerSummary{Player: p.name, Secret: formatCode(secret), Guesses: make([]GuessSummary, 0)}
+		for _, past := range session.history {
+			if past.event.PlayerID != p.id {
+				continue
+			}
+			player.Guesses = append(player.Guesses, GuessSummary{Guess: formatCode(past.event.Guess),
+				Feedback: past.event.Feedback, Correct: past.event.Type != EventGuessIncorrect,
+				Seconds: past.took.Seconds()})
+		}
+		var stats PlayerStats
+		player.Efficiency, player.Timeouts, stats = globalAnalytics.gameRecord(session.analytics, p.id)
+		if session.stableIDs {
+			// Elsewhere a player ID is a seat, whose lifetime stats are those of whoever sat in it
+			player.Stats = &stats
+		}
+		if change, rated := changes[p.name]; rated {
+			player.RatingChange = &change
+		}
+		summary.Players = append(summary.Players, player)
+		secrets = append(secrets, secret)
+	}
+	session.mutex.Unlock()
+
+	// Solving takes a while, so it's done without holding up the session
+	for i, secret := range secrets {
+		summary.Players[i].SolverGuesses = SolveCode(secret)
+	}
+	return summary
+}
+
+// Describe presents the summary as text
+func (s GameSummary) Describe() string {
+	var text strings.Builder
+	text.WriteString("\n=== GAME SUMMARY ===")
+	for _, player := range s.Players {
+		fmt.Fprintf(&text, "\n%s - code %s, which the solver cracks in %d guesses", player.Player, player.Secret,
+			player.SolverGuesses)
+		if len(player.Guesses) == 0 {
+			text.WriteString("\n  No guesses")
+		}
+		for i, guess := range player.Guesses {
+			result := describeFeedback(guess.Feedback)
+			if guess.Correct {
+				result = "cracked it"
+			}
+			took := time.Duration(guess.Seconds * float64(time.Second)).Round(100 * time.Millisecond)
+			fmt.Fprintf(&text, "\n  %d. %s - %s (%s)", i+1, guess.Guess, result, took)
+		}
+		fmt.Fprintf(&text, "\n  Timeouts: %d", player.Timeouts)
+		if player.Efficiency.Guesses > 0 {
+			fmt.Fprintf(&text, "\n  Guessing: %s", player.Efficiency.Describe())
+		}
+		if stats := player.Stats; stats != nil {
+			fmt.Fprintf(&text, "\n  Stats: %d games played, %d won", stats.GamesPlayed, stats.GamesWon)
+			if stats.BestGame > 0 {
+				fmt.Fprintf(&text, ", best win in %d guesses", stats.BestGame)
+			}
+			fmt.Fprintf(&text, ", %d points", stats.TotalScore)
+		}
+		if player.RatingChange != nil {
+			fmt.Fprintf(&text, "\n  Rating change: %+d", *player.RatingChange)
+		}
+	}
+	return text.String()
+}
+
+// sendSummary sends every player the summary of the game that just ended
+func sendSummary(session *GameSession, result string) {
+	summary := buildSummary(session, result)
+	text := summary.Describe()
+
+	session.mutex.Lock()
+	defer session.mutex.Unlock()
+	for _, p := range session.players {
+		writeToClient(p.conn, text)
+		sendEvent(p, ProtocolEvent{Type: ProtocolSummary, Summary: &summary})
+	}
+}
@@ -0,0 +1,108 @@
+package game
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuildSummary(t *testing.T) {
+	saved := globalAnalytics
+	defer func() { globalAnalytics = saved }()
+	globalAnalytics = NewGameAnalytics()
+
+	ann, bob := &Player{id: 1, name: "ann"}, &Player{id: 2, name: "bob"}
+	session := &GameSession{players: []*Player{ann, bob}, game: startedGame(t, 5678, false, 1, 2), stableIDs: true}
+	session.analytics = globalAnalytics.StartGame(5678, 2)
+	rated := 0
+	session.rate = func() map[string]int {
+		rated++
+		return map[string]int{"ann": 16, "bob": -16}
+	}
+
+	// Ann misses, Bob runs out of time and Ann cracks the code
+	for _, guess := range []struct {
+		player *Player
+		text   string
+	}{{ann, "1234"}, {bob, ""}, {ann, "5678"}} {
+		if guess.text == "" {
+			_, err := session.game.Timeout(guess.player.id)
+			assert.NoError(t, err)
+			globalAnalytics.RecordTimeout(session.analytics, guess.player.id)
+			continue
+		}
+		guess.player.guessTook = 2 * time.Second
+		events, err := session.game.ApplyGuess(guess.player.id, guess.text)
+		assert.NoError(t, err)
+		recordGuessAnalytics(session, events[0])
+		session.recordGuess(events[0], guess.player)
+	}
+	globalAnalytics.EndGame(session.analytics, 1)
+
+	summary := buildSummary(session, ResultWon)
+	buildSummary(session, ResultWon)
+	assert.Equal(t, 1, rated)
+	assert.Len(t, summary.Players, 2)
+
+	first := summary.Players[0]
+	assert.Equal(t, "ann", first.Player)
+	assert.Equal(t, "5678", first.Secret)
+	assert.Equal(t, SolveCode(5678), first.SolverGuesses)
+	assert.Equal(t, []GuessSummary{
+		{Guess: "1234", Feedback: Feedback{}, Seconds: 2},
+		{Guess: "5678", Feedback: Feedback{Exact: 4}, Correct: true, Seconds: 2},
+	}, first.Guesses)
+	assert.Equal(t, 2, first.Efficiency.Guesses)
+	assert.Equal(t, 1, first.Stats.GamesWon)
+	assert.Equal(t, 16, *first.RatingChange)
+
+	second := summary.Players[1]
+	assert.Empty(t, second.Guesses)
+	assert.Equal(t, 1, second.Timeouts)
+	assert.Equal(t, 1, second.Stats.Timeouts)
+
+	text := summary.Describe()
+	assert.Contains(t, text, "ann - code 5678, which the solver cracks in")
+	assert.Contains(t, text, "  1. 1234 - 0 correct position, 0 correct digit but wrong position (2s)")
+	assert.Contains(t, text, "  2. 5678 - cracked it (2s)")
+	assert.Contains(t, text, "  Stats: 1 games played, 1 won, best win in 2 guesses, 0 points")
+	assert.Contains(t, text, "  No guesses\n  Timeouts: 1")
+	assert.Contains(t, text, "  Rating change: -16")
+
+	data, err := json.Marshal(ProtocolEvent{Type: ProtocolSummary, Summary: &summary})
+	assert.NoError(t, err)
+	assert.Contains(t, string(data), `"rating_change":16`)
+	assert.Contains(t, string(data), `"solver_guesses":`)
+
+	// Where player IDs are seats, lifetime stats would mix up whoever sat there
+	session.stableIDs = false
+	summary = buildSummary(session, ResultWon)
+	assert.Nil(t, summary.Players[0].Stats)
+	assert.NotContains(t, summary.Describe(), "Stats:")
+	data, err = json.Marshal(summary)
+	assert.NoError(t, err)
+	assert.NotContains(t, string(data), `"stats"`)
+}
+
+func TestSolveCode(t *testing.T) {
+	// The solver's scoring matches the game's
+	for guess := 0; guess < candidateLimit; guess += 97 {
+		for secret := 0; secret < candidateLimit; secret += 89 {
+			assert.Equal(t, ScoreGuess(guess, secret), scoreCodes(guess, secret))
+		}
+	}
+
+	for _, secret := range []int{0, 1122, 7777, 9081} {
+		guesses := SolveCode(secret)
+		assert.True(t, guesses >= 1 && guesses <= 7, "%04d took %d guesses", secret, guesses)
+	}
+
+	// The solver's opening guess cracks itself straight away
+	codes := make([]int, candidateLimit)
+	for code := range codes {
+		codes[code] = code
+	}
+	assert.Equal(t, 1, SolveCode(minimaxGuess(solverOpenings, codes)))
+}
@@ -0,0 +1,223 @@
+package game
+
+import (
+	"strconv"
+	"strings"
+)
+
+// DefaultTeamNames are the teams used in team mode when none are configured
+var DefaultTeamNames = []string{"Red", "Blue"}
+
+// Team is a named group of players who take turns in rotation and share
+// feedback and the win
+type Team struct {
+	Name    string
+	Members []int // Player IDs in turn order within the team
+	turn    int   // Index into Members of the member who had the last turn
+}
+
+// Teams returns the teams and their members in turn order
+func (g *Game) Teams() []Team {
+	if g.rules.Mode != ModeTeams {
+		return nil
+	}
+	g.ensureTeams()
+	teams := make([]Team, len(g.teams))
+	for i, team := range g.teams {
+		teams[i] = Team{Name: team.Name, Members: append([]int(nil), team.Members...)}
+	}
+	return teams
+}
+
+// TeamOf returns the name of a player's team, or "" if they have none
+func (g *Game) TeamOf(playerID int) string {
+	if team, _ := g.teamOf(playerID); team != nil {
+		return team.Name
+	}
+	return ""
+}
+
+// Teammates returns the members of a player's team, including the player
+func (g *Game) Teammates(playerID int) []int {
+	if team, _ := g.teamOf(playerID); team != nil {
+		return append([]int(nil), team.Members...)
+	}
+	return nil
+}
+
+// JoinTeam puts a player on the team with the given name (any case) or
+// number, leaving their previous team. It returns the team's name.
+func (g *Game) JoinTeam(playerID int, choice string) (string, error) {
+	if g.rules.Mode != ModeTeams {
+		return "", ErrNoTeams
+	}
+	if g.state != StateWaiting {
+		return "", ErrTeamsLocked
+	}
+	if g.indexOf(playerID) < 0 {
+		return "", ErrUnknownPlayer
+	}
+	g.ensureTeams()
+
+	choice = strings.TrimSpace(choice)
+	var chosen *Team
+	for i, team := range g.teams {
+		if strings.EqualFold(team.Name, choice) || choice == strconv.Itoa(i+1) {
+			chosen = team
+			break
+		}
+	}
+	if chosen == nil {
+		return "", ErrUnknownTeam
+	}
+
+	g.leaveTeam(playerID)
+	chosen.Members = append(chosen.Members, playerID)
+	return chosen.Name, nil
+}
+
+// ensureTeams creates the configured teams if they don't exist yet
+func (g *Game) ensureTeams() {
+	if g.teams != nil {
+		return
+	}
+	names := g.rules.Teams
+	if len(names) == 0 {
+		names = DefaultTeamNames
+	}
+	g.teams = make([]*Team, 0, len(names))
+	for _, name := range names {
+		g.teams = append(g.teams, &Team{Name: name, turn: -1})
+	}
+}
+
+// formTeams puts players who didn't choose a team on the smallest one, evens
+// out empty teams, drops teams nobody is on and gives the first turn to the
+// first team
+func (g *Game) formTeams() error {
+	g.ensureTeams()
+	for _, id := range g.players {
+		if team, _ := g.teamOf(id); team == nil {
+			smallest := g.teams[0]
+			for _, team := range g.teams[1:] {
+				if len(team.Members) < len(smallest.Members) {
+					smallest = team
+				}
+			}
+			smallest.Members = append(smallest.Members, id)
+		}
+	}
+
+	// A team nobody chose takes a player from the largest team
+	for _, team := range g.teams {
+		if len(team.Members) > 0 {
+			continue
+		}
+		largest := g.teams[0]
+		for _, other := range g.teams[1:] {
+			if len(other.Members) > len(largest.Members) {
+				largest = other
+			}
+		}
+		if len(largest.Members) < 2 {
+			break
+		}
+		last := len(largest.Members) - 1
+		team.Members = append(team.Members, largest.Members[last])
+		largest.Members = largest.Members[:last]
+	}
+
+	teams := make([]*Team, 0, len(g.teams))
+	for _, team := range g.teams {
+		if len(team.Members) > 0 {
+			team.turn = -1
+			teams = append(teams, team)
+		}
+	}
+	if len(teams) < 2 {
+		return ErrNotEnoughTeams
+	}
+	g.teams = teams
+
+	// Hand the first turn to the first member of the first team
+	g.teamIndex = len(g.teams) - 1
+	g.advanceTeamTurn()
+	return nil
+}
+
+// keepTeamMembers drops everyone but the given players from their teams,
+// ready for a new game with the same teams
+func (g *Game) keepTeamMembers(playerIDs []int) {
+	keep := make(map[int]bool, len(playerIDs))
+	for _, id := range playerIDs {
+		keep[id] = true
+	}
+	for _, team := range g.teams {
+		members := make([]int, 0, len(team.Members))
+		for _, id := range team.Members {
+			if keep[id] {
+				members = append(members, id)
+			}
+		}
+		team.Members = members
+	}
+}
+
+// leaveTeam takes a player off their team, keeping the turn order of the
+// teams and of the team's remaining members
+func (g *Game) leaveTeam(playerID int) {
+	team, index := g.teamOf(playerID)
+	if team == nil {
+		return
+	}
+
+	team.Members = append(team.Members[:index], team.Members[index+1:]...)
+	if index <= team.turn {
+		team.turn--
+	}
+	if len(team.Members) > 0 || g.state == StateWaiting {
+		return
+	}
+
+	// An empty team drops out of the rotation once the game is under way
+	for i, t := range g.teams {
+		if t == team {
+			g.teams = append(g.teams[:i], g.teams[i+1:]...)
+			if i <= g.teamIndex {
+				g.teamIndex--
+			}
+			return
+		}
+	}
+}
+
+// advanceTeamTurn passes the turn to the next team, and within it to the
+// next member who can still guess. It returns false if nobody can.
+func (g *Game) advanceTeamTurn() bool {
+	for i := 1; i <= len(g.teams); i++ {
+		teamIndex := (g.teamIndex + i) % len(g.teams)
+		team := g.teams[teamIndex]
+		for j := 1; j <= len(team.Members); j++ {
+			turn := (team.turn + j) % len(team.Members)
+			if g.canGuess(team.Members[turn]) {
+				g.teamIndex = teamIndex
+				team.turn = turn
+				g.currentIndex = g.indexOf(team.Members[turn])
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// teamOf finds a player's team and their index in it
+func (g *Game) teamOf(playerID int) (*Team, int) {
+	for _, team := range g.teams {
+		for i, id := range team.Members {
+			if id == playerID {
+				return team, i
+			}
+		}
+	}
+	return nil, -1
+}
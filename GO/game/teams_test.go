@@ -0,0 +1,135 @@
+package game
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// newTeamGame returns a team game with the given players, not yet started
+func newTeamGame(t *testing.T, playerIDs ...int) *Game {
+	g := NewGame(1234, false)
+	g.SetRules(GameRules{Mode: ModeTeams})
+	for _, id := range playerIDs {
+		assert.NoError(t, g.AddPlayer(id))
+	}
+	return g
+}
+
+func TestGame_JoinTeam(t *testing.T) {
+	g := newTeamGame(t, 1, 2)
+
+	name, err := g.JoinTeam(1, "blue")
+	assert.NoError(t, err)
+	assert.Equal(t, "Blue", name)
+	assert.Equal(t, "Blue", g.TeamOf(1))
+
+	// Teams can also be chosen by number, and a new choice replaces the old one
+	name, err = g.JoinTeam(1, "1")
+	assert.NoError(t, err)
+	assert.Equal(t, "Red", name)
+	assert.Equal(t, []int{1}, g.Teammates(1))
+
+	_, err = g.JoinTeam(2, "green")
+	assert.ErrorIs(t, err, ErrUnknownTeam)
+
+	_, err = g.Start()
+	assert.NoError(t, err)
+	_, err = g.JoinTeam(2, "red")
+	assert.ErrorIs(t, err, ErrTeamsLocked)
+	assert.Equal(t, "Blue", g.TeamOf(2))
+}
+
+func TestGame_JoinTeamNeedsTeamMode(t *testing.T) {
+	g := NewGame(1234, false)
+	assert.NoError(t, g.AddPlayer(1))
+
+	_, err := g.JoinTeam(1, "red")
+	assert.ErrorIs(t, err, ErrNoTeams)
+	assert.Nil(t, g.Teams())
+}
+
+func TestGame_TeamsAreBalancedAtStart(t *testing.T) {
+	g := newTeamGame(t, 1, 2, 3)
+
+	// Everyone chose the same team, so one of them moves over
+	for _, id := range []int{1, 2, 3} {
+		_, err := g.JoinTeam(id, "red")
+		assert.NoError(t, err)
+	}
+	_, err := g.Start()
+	assert.NoError(t, err)
+
+	teams := g.Teams()
+	assert.Equal(t, []int{1, 2}, teams[0].Members)
+	assert.Equal(t, []int{3}, teams[1].Members)
+}
+
+func TestGame_TurnsRotateAcrossAndWithinTeams(t *testing.T) {
+	g := newTeamGame(t, 1, 2, 3)
+	_, err := g.JoinTeam(1, "red")
+	assert.NoError(t, err)
+	_, err = g.JoinTeam(2, "red")
+	assert.NoError(t, err)
+	_, err = g.JoinTeam(3, "blue")
+	assert.NoError(t, err)
+
+	events, err := g.Start()
+	assert.NoError(t, err)
+	assert.Equal(t, "Red", events[1].Team)
+
+	// Red and Blue alternate, and Red's members take turns
+	order := []int{g.CurrentPlayer()}
+	for i := 0; i < 4; i++ {
+		_, err := g.ApplyGuess(g.CurrentPlayer(), "1111")
+		assert.NoError(t, err)
+		order = append(order, g.CurrentPlayer())
+	}
+	assert.Equal(t, []int{1, 3, 2, 3, 1}, order)
+}
+
+func TestGame_TeamWin(t *testing.T) {
+	g := newTeamGame(t, 1, 2)
+	_, err := g.Start()
+	assert.NoError(t, err)
+
+	events, err := g.ApplyGuess(1, "1234")
+	assert.NoError(t, err)
+	assert.Equal(t, EventGuessCorrect, events[0].Type)
+	assert.Equal(t, "Red", events[0].Team)
+}
+
+func TestGame_RemovingTeamPassesTurnAndAbandons(t *testing.T) {
+	g := newTeamGame(t, 1, 2, 3, 4)
+	_, err := g.Start()
+	assert.NoError(t, err)
+	assert.Equal(t, 1, g.CurrentPlayer())
+
+	// The player on turn leaves, so the turn goes to the other team
+	events, err := g.RemovePlayer(1)
+	assert.NoError(t, err)
+	assert.Equal(t, []EventType{EventPlayerRemoved, EventTurnChanged}, eventTypes(events))
+	assert.Equal(t, "Red", events[0].Team)
+	assert.Equal(t, 2, g.CurrentPlayer())
+
+	// Once Blue has nobody left there is nobody to play against
+	_, err = g.RemovePlayer(4)
+	assert.NoError(t, err)
+	events, err = g.RemovePlayer(2)
+	assert.NoError(t, err)
+	assert.Equal(t, []EventType{EventPlayerRemoved, EventGameAbandoned}, eventTypes(events))
+}
+
+func TestGame_RestartKeepsTeams(t *testing.T) {
+	g := newTeamGame(t, 1, 2, 3)
+	_, err := g.Start()
+	assert.NoError(t, err)
+	_, err = g.ApplyGuess(1, "1234")
+	assert.NoError(t, err)
+
+	_, err = g.Restart(5678, []int{1, 2})
+	assert.NoError(t, err)
+	assert.Equal(t, "Red", g.TeamOf(1))
+	assert.Equal(t, "Blue", g.TeamOf(2))
+	assert.Equal(t, "", g.TeamOf(3))
+}
@@ -0,0 +1,314 @@
+package game
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+// TLSOptions configures TLS for the game and admin listeners. Both listen in
+// plaintext unless a certificate is given.
+type TLSOptions struct {
+	CertFile      string // Server certificate (PEM)
+	KeyFile       string // Private key of the certificate (PEM)
+	AdminClientCA string // CA the admin listener requires client certificates from (mutual TLS); empty for none
+}
+
+// ClientTLSOptions configures TLS for connecting to a server
+type ClientTLSOptions struct {
+	Enabled  bool   // Connect with TLS, trusting the system's CAs unless CAFile is set
+	CAFile   string // Only trust certificates signed by this CA (PEM); implies Enabled
+	CertFile string // Client certificate for servers that require one (PEM)
+	KeyFile  string // Private key of the client certificate (PEM)
+}
+
+// TLS configurations of the listeners and of outgoing connections (nil for
+// plaintext)
+var (
+	gameTLS   *tls.Config
+	adminTLS  *tls.Config
+	clientTLS *tls.Config
+	peerTLS   *tls.Config // Connections relayed to other replicas, which share the server certificate
+)
+
+// ConfigureTLS loads the certificates for the game and admin listeners. It
+// must be called before a server starts.
+func ConfigureTLS(options TLSOptions) error {
+	if options.CertFile == "" && options.KeyFile == "" {
+		if options.AdminClientCA != "" {
+			return errors.New("mutual TLS for admins needs a server certificate and key")
+		}
+		gameTLS, adminTLS, peerTLS = nil, nil, nil
+		return nil
+	}
+	if options.CertFile == "" || options.KeyFile == "" {
+		return errors.New("TLS needs both a certificate and a key")
+	}
+
+	cert, err := tls.LoadX509KeyPair(options.CertFile, options.KeyFile)
+	if err != nil {
+		return fmt.Errorf("error loading TLS certificate: %v", err)
+	}
+	gameTLS = &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}
+	adminTLS = gameTLS.Clone()
+	if peerTLS, err = newPeerTLSConfig(cert); err != nil {
+		return err
+	}
+
+	if options.AdminClientCA != "" {
+		pool, err := loadCertPool(options.AdminClientCA)
+		if err != nil {
+			return err
+		}
+		adminTLS.ClientCAs = pool
+		adminTLS.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return nil
+}
+
+// ConfigureClientTLS sets up TLS for the clients' connections. It must be
+// called before a client connects.
+func ConfigureClientTLS(options ClientTLSOptions) error {
+	if !options.Enabled && options.CAFile == "" {
+		if options.CertFile != "" || options.KeyFile != "" {
+			return errors.New("a client certificate needs TLS; add -tls or -ca")
+		}
+		clientTLS = nil
+		return nil
+	}
+
+	config := &tls.Config{MinVersion: tls.VersionTLS12}
+	if options.CAFile != "" {
+		pool, err := loadCertPool(options.CAFile)
+		if err != nil {
+			return err
+		}
+		config.RootCAs = pool
+	}
+	if options.CertFile != "" || options.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(options.CertFile, options.KeyFile)
+		if err != nil {
+			return fmt.Errorf("error loading client certificate: %v", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	clientTLS = config
+	return nil
+}
+
+// newPeerTLSConfig configures connections to other replicas, which serve the
+// same certificate: it is trusted, as are the CAs of the system, and its
+// name is expected whatever address the replica is reached at
+func newPeerTLSConfig(cert tls.Certificate) (*tls.Config, error) {
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		return nil, fmt.Errorf("error reading TLS certificate: %v", err)
+	}
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		pool = x509.NewCertPool()
+	}
+	pool.AddCert(leaf)
+
+	name := leaf.Subject.CommonName
+	if len(leaf.DNSNames) > 0 {
+		name = leaf.DNSNames[0]
+	} else if len(leaf.IPAddresses) > 0 {
+		name = leaf.IPAddresses[0].String()
+	}
+	return &tls.Config{RootCAs: pool, ServerName: name, MinVersion: tls.VersionTLS12}, nil
+}
+
+// loadCertPool reads the PEM certificates of a file into a pool
+func loadCertPool(path string) (*x509.CertPool, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading CA certificate: %v", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("no certificates found in %s", path)
+	}
+	return pool, nil
+}
+
+// tlsHandshakeTimeout is how long a client has to complete the TLS handshake
+const tlsHandshakeTimeout = 10 * time.Second
+
+// listen opens a server listener, with TLS if config is set and only
+// admitting the connections guard allows if it is set. Connections are
+// checked before their TLS handshake.
+func listen(address string, config *tls.Config, guard *AbuseGuard) (net.Listener, error) {
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return nil, err
+	}
+	if guard != nil {
+		listener = &guardedListener{Listener: listener, guard: guard}
+	}
+	if config == nil {
+		return listener, nil
+	}
+	return newHandshakeListener(tls.NewListener(listener, config)), nil
+}
+
+// handshakeListener hands out TLS connections once their handshake is done.
+// The servers write to new connections while holding locks, so a client that
+// never completes its handshake must not get that far.
+type handshakeListener struct {
+	net.Listener
+	conns  chan net.Conn
+	err    chan error
+	closed chan struct{}
+	once   sync.Once
+}
+
+// newHandshakeListener starts accepting connections from a TLS listener
+func newHandshakeListener(listener net.Listener) *handshakeListener {
+	l := &handshakeListener{Listener: listener, conns: make(chan net.Conn), err: make(chan error, 1),
+		closed: make(chan struct{})}
+	go l.acceptLoop()
+	return l
+}
+
+// acceptLoop accepts connections and completes their handshakes in the background
+func (l *handshakeListener) acceptLoop() {
+	for {
+		conn, err := l.Listener.Accept()
+		if err != nil {
+			l.err <- err
+			return
+		}
+		go l.handshake(conn.(*tls.Conn))
+	}
+}
+
+// handshake completes a connection's handshake and hands it to Accept
+func (l *handshakeListener) handshake(conn *tls.Conn) {
+	conn.SetDeadline(time.Now().Add(tlsHandshakeTimeout))
+	if err := conn.Handshake(); err != nil {
+		slog.Info("TLS handshake failed", "remote", conn.RemoteAddr().String(), "error", err)
+		conn.Close()
+		return
+	}
+	conn.SetDeadline(time.Time{})
+
+	select {
+	case l.conns <- conn:
+	case <-l.closed:
+		conn.Close()
+	}
+}
+
+// Accept returns the next connection whose handshake is done
+func (l *handshakeListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.conns:
+		return conn, nil
+	case err := <-l.err:
+		// Keep the error for later calls too
+		l.err <- err
+		return nil, err
+	}
+}
+
+// Close stops the listener
+func (l *handshakeListener) Close() error {
+	l.once.Do(func() { close(l.closed) })
+	return l.Listener.Close()
+}
+
+// dialServer connects a client to a server, with TLS if configured
+func dialServer(address string) (net.Conn, error) {
+	if clientTLS != nil {
+		return tls.Dial("tcp", address, clientTLS)
+	}
+	return net.Dial("tcp", address)
+}
+
+// peerDialTimeout bounds connecting to another replica
+const peerDialTimeout = 5 * time.Second
+
+// dialPeer connects to another replica's game port, with TLS if this server
+// serves it
+func dialPeer(address string) (net.Conn, error) {
+	dialer := &net.Dialer{Timeout: peerDialTimeout}
+	if peerTLS != nil {
+		return tls.DialWithDialer(dialer, "tcp", address, peerTLS)
+	}
+	return dialer.Dial("tcp", address)
+}
+
+// GenerateSelfSignedCert creates a self-signed certificate and its private
+// key, both PEM encoded, valid for the given host names and IP addresses.
+// The certificate is its own CA, so clients can pin it with ClientTLSOptions.CAFile,
+// and it may also serve as an admin's client certificate.
+func GenerateSelfSignedCert(hosts []string, validFor time.Duration) ([]byte, []byte, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{Organization: []string{"Code Breaker"}, CommonName: "Code Breaker"},
+		NotBefore:             now.Add(-time.Hour), // Allow for clocks that are a little behind
+		NotAfter:              now.Add(validFor),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	for _, host := range hosts {
+		if ip := net.ParseIP(host); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else {
+			template.DNSNames = append(template.DNSNames, host)
+		}
+	}
+	if len(hosts) > 0 {
+		template.Subject.CommonName = hosts[0]
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER})
+	return certPEM, keyPEM, nil
+}
+
+// WriteSelfSignedCert generates a self-signed certificate and writes it and
+// its key to files; the key is only readable by the owner
+func WriteSelfSignedCert(certFile, keyFile string, hosts []string, validFor time.Duration) error {
+	certPEM, keyPEM, err := GenerateSelfSignedCert(hosts, validFor)
+	if err != nil {
+		return fmt.Errorf("error generating certificate: %v", err)
+	}
+	if err := os.WriteFile(certFile, certPEM, 0644); err != nil {
+		return err
+	}
+	return os.WriteFile(keyFile, keyPEM, 0600)
+}
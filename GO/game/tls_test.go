@@ -0,0 +1,136 @@
+package game
+
+import (
+	"crypto/tls"
+	"io"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// writeTestCert writes a self-signed certificate for localhost to a
+// temporary directory and returns the certificate and key files
+func writeTestCert(t *testing.T, name string) (string, string) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, name+".pem"), filepath.Join(dir, name+"-key.pem")
+	assert.NoError(t, WriteSelfSignedCert(certFile, keyFile, []string{"localhost", "127.0.0.1"}, time.Hour))
+	return certFile, keyFile
+}
+
+// echoOnce accepts a connection and echoes one message back
+func echoOnce(listener net.Listener) {
+	conn, err := listener.Accept()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	buffer := make([]byte, 64)
+	if n, err := conn.Read(buffer); err == nil {
+		conn.Write(buffer[:n])
+	}
+}
+
+func TestTLS_PinnedCertificate(t *testing.T) {
+	certFile, keyFile := writeTestCert(t, "server")
+	assert.NoError(t, ConfigureTLS(TLSOptions{CertFile: certFile, KeyFile: keyFile}))
+	assert.NoError(t, ConfigureClientTLS(ClientTLSOptions{CAFile: certFile}))
+	defer ConfigureTLS(TLSOptions{})
+	defer ConfigureClientTLS(ClientTLSOptions{})
+
+	listener, err := listen("127.0.0.1:0", gameTLS, nil)
+	assert.NoError(t, err)
+	defer listener.Close()
+	go echoOnce(listener)
+
+	conn, err := dialServer(listener.Addr().String())
+	assert.NoError(t, err)
+	defer conn.Close()
+	conn.Write([]byte("hello"))
+	reply := make([]byte, 5)
+	_, err = io.ReadFull(conn, reply)
+	assert.NoError(t, err)
+	assert.Equal(t, "hello", string(reply))
+
+	// A certificate from another CA isn't trusted
+	otherCert, _ := writeTestCert(t, "other")
+	assert.NoError(t, ConfigureClientTLS(ClientTLSOptions{CAFile: otherCert}))
+	_, err = dialServer(listener.Addr().String())
+	assert.Error(t, err)
+}
+
+func TestTLS_AdminRequiresClientCertificate(t *testing.T) {
+	certFile, keyFile := writeTestCert(t, "server")
+	adminCert, adminKey := writeTestCert(t, "admin")
+	assert.NoError(t, ConfigureTLS(TLSOptions{CertFile: certFile, KeyFile: keyFile, AdminClientCA: adminCert}))
+	defer ConfigureTLS(TLSOptions{})
+	defer ConfigureClientTLS(ClientTLSOptions{})
+
+	listener, err := listen("127.0.0.1:0", adminTLS, nil)
+	assert.NoError(t, err)
+	defer listener.Close()
+	go echoOnce(listener)
+	go echoOnce(listener)
+
+	// Without a client certificate the handshake fails
+	assert.NoError(t, ConfigureClientTLS(ClientTLSOptions{CAFile: certFile}))
+	if conn, err := dialServer(listener.Addr().String()); err == nil {
+		_, err = conn.Read(make([]byte, 1))
+		assert.Error(t, err)
+		conn.Close()
+	}
+
+	assert.NoError(t, ConfigureClientTLS(ClientTLSOptions{CAFile: certFile, CertFile: adminCert, KeyFile: adminKey}))
+	conn, err := dialServer(listener.Addr().String())
+	assert.NoError(t, err)
+	defer conn.Close()
+	conn.Write([]byte("stats"))
+	reply := make([]byte, 5)
+	_, err = io.ReadFull(conn, reply)
+	assert.NoError(t, err)
+}
+
+func TestTLS_SilentClientDoesNotBlockOthers(t *testing.T) {
+	certFile, keyFile := writeTestCert(t, "server")
+	assert.NoError(t, ConfigureTLS(TLSOptions{CertFile: certFile, KeyFile: keyFile}))
+	defer ConfigureTLS(TLSOptions{})
+
+	listener, err := listen("127.0.0.1:0", gameTLS, nil)
+	assert.NoError(t, err)
+	defer listener.Close()
+
+	// A plaintext client never starts the handshake
+	silent, err := net.Dial("tcp", listener.Addr().String())
+	assert.NoError(t, err)
+	defer silent.Close()
+
+	pool, err := loadCertPool(certFile)
+	assert.NoError(t, err)
+	go func() {
+		if conn, err := tls.Dial("tcp", listener.Addr().String(), &tls.Config{RootCAs: pool}); err == nil {
+			defer conn.Close()
+			conn.Read(make([]byte, 1))
+		}
+	}()
+
+	accepted := make(chan net.Conn)
+	go func() {
+		conn, _ := listener.Accept()
+		accepted <- conn
+	}()
+	select {
+	case conn := <-accepted:
+		assert.NotNil(t, conn)
+		conn.Close()
+	case <-time.After(5 * time.Second):
+		t.Fatal("the silent client held up the listener")
+	}
+}
+
+func TestConfigureTLS_RejectsIncompleteOptions(t *testing.T) {
+	assert.Error(t, ConfigureTLS(TLSOptions{CertFile: "cert.pem"}))
+	assert.Error(t, ConfigureTLS(TLSOptions{AdminClientCA: "ca.pem"}))
+	assert.Error(t, ConfigureClientTLS(ClientTLSOptions{CertFile: "cert.pem", KeyFile: "key.pem"}))
+}
@@ -0,0 +1,402 @@
+package game
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// TournamentFormat selects how the matches of a tournament are scheduled
+type TournamentFormat int
+
+const (
+	FormatSingleElimination TournamentFormat = iota // Players are out after one loss
+	FormatDoubleElimination                         // Players are out after two losses
+	FormatRoundRobin                                // Everyone plays everyone once
+)
+
+func (f TournamentFormat) String() string {
+	switch f {
+	case FormatSingleElimination:
+		return "single-elim"
+	case FormatDoubleElimination:
+		return "double-elim"
+	case FormatRoundRobin:
+		return "round-robin"
+	default:
+		return fmt.Sprintf("TournamentFormat(%d)", int(f))
+	}
+}
+
+// ParseTournamentFormat converts a format name such as "round-robin" into a
+// TournamentFormat
+func ParseTournamentFormat(name string) (TournamentFormat, error) {
+	formats := []TournamentFormat{FormatSingleElimination, FormatDoubleElimination, FormatRoundRobin}
+	for _, format := range formats {
+		if format.String() == name {
+			return format, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown tournament format %q (use single-elim, double-elim or round-robin)", name)
+}
+
+// Brackets of a double-elimination tournament
+const (
+	BracketWinners = "winners" // Players who haven't lost yet
+	BracketLosers  = "losers"  // Players who have lost once
+	BracketFinal   = "final"   // The last two players
+)
+
+// maxTournamentName is the longest name a tournament player can register
+const maxTournamentName = 20
+
+// Match is a game between two tournament players
+type Match struct {
+	ID      int
+	Round   int
+	Bracket string    // Double elimination: which bracket the match is in
+	Players [2]string // Names of the two players
+	Winner  string    // Name of the winner ("" until the match is played)
+}
+
+// Played reports whether the match has a result
+func (m Match) Played() bool {
+	return m.Winner != ""
+}
+
+// Loser returns the name of the player who lost the match
+func (m Match) Loser() string {
+	switch m.Winner {
+	case m.Players[0]:
+		return m.Players[1]
+	case m.Players[1]:
+		return m.Players[0]
+	default:
+		return ""
+	}
+}
+
+// Standing is a player's record in a tournament
+type Standing struct {
+	Name       string
+	Played     int  // Matches played
+	Wins       int  // Matches won
+	Losses     int  // Matches lost
+	Eliminated bool // Whether the player is out of an elimination tournament
+}
+
+// Errors returned by Tournament transitions
+var (
+	ErrTournamentStarted    = errors.New("the tournament has already started")
+	ErrTournamentNotStarted = errors.New("the tournament has not started yet")
+	ErrNameTaken            = errors.New("that name is already registered")
+	ErrInvalidName          = fmt.Errorf("names must be 1 to %d characters", maxTournamentName)
+	ErrUnknownMatch         = errors.New("there is no match with that ID")
+	ErrMatchPlayed          = errors.New("that match has already been played")
+	ErrNotInMatch           = errors.New("player is not in that match")
+)
+
+// Tournament schedules the matches between registered players and advances
+// through the rounds as results come in. Like Game it is transport-free and
+// not safe for concurrent use.
+type Tournament struct {
+	format   TournamentFormat
+	players  []string // Registered players in seed order
+	started  bool
+	round    int        // Current round (0 before the start)
+	matches  []*Match   // Every match scheduled so far
+	pending  [][]*Match // Round robin: rounds not scheduled yet
+	champion string     // Winner of the tournament, once finished
+}
+
+// NewTournament creates a tournament open for registration
+func NewTournament(format TournamentFormat) *Tournament {
+	return &Tournament{
+		format:  format,
+		players: make([]string, 0),
+		matches: make([]*Match, 0),
+	}
+}
+
+// Format returns the tournament's format
+func (t *Tournament) Format() TournamentFormat {
+	return t.format
+}
+
+// Started reports whether registration has closed and matches are scheduled
+func (t *Tournament) Started() bool {
+	return t.started
+}
+
+// Finished reports whether the tournament has a champion
+func (t *Tournament) Finished() bool {
+	return t.champion != ""
+}
+
+// Champion returns the winner of the tournament, or "" if it isn't over
+func (t *Tournament) Champion() string {
+	return t.champion
+}
+
+// Round returns the current round (0 before the start)
+func (t *Tournament) Round() int {
+	return t.round
+}
+
+// Players returns the registered players in seed order
+func (t *Tournament) Players() []string {
+	return append([]string(nil), t.players...)
+}
+
+// Register adds a player to the tournament
+func (t *Tournament) Register(name string) error {
+	if t.started {
+		return ErrTournamentStarted
+	}
+	name = strings.TrimSpace(name)
+	if name == "" || len(name) > maxTournamentName {
+		return ErrInvalidName
+	}
+	if t.seedOf(name) >= 0 {
+		return ErrNameTaken
+	}
+	t.players = append(t.players, name)
+	return nil
+}
+
+// Start closes registration and schedules the first round
+func (t *Tournament) Start() error {
+	if t.started {
+		return ErrTournamentStarted
+	}
+	if len(t.players) < 2 {
+		return ErrNotEnoughPlayers
+	}
+
+	t.started = true
+	if t.format == FormatRoundRobin {
+		t.pending = roundRobinRounds(t.players)
+	}
+	t.nextRound()
+	return nil
+}
+
+// Matches returns every match scheduled so far
+func (t *Tournament) Matches() []Match {
+	matches := make([]Match, len(t.matches))
+	for i, match := range t.matches {
+		matches[i] = *match
+	}
+	return matches
+}
+
+// ReadyMatches returns the matches of the current round that still need to
+// be played
+func (t *Tournament) ReadyMatches() []Match {
+	ready := make([]Match, 0)
+	for _, match := range t.matches {
+		if match.Round == t.round && !match.Played() {
+			ready = append(ready, *match)
+		}
+	}
+	return ready
+}
+
+// RecordResult records the winner of a match and, once every match of the
+// round is played, schedules the next round or crowns the champion
+func (t *Tournament) RecordResult(matchID int, winner string) error {
+	if !t.started {
+		return ErrTournamentNotStarted
+	}
+	if matchID < 1 || matchID > len(t.matches) {
+		return ErrUnknownMatch
+	}
+	match := t.matches[matchID-1]
+	if match.Played() {
+		return ErrMatchPlayed
+	}
+	if winner != match.Players[0] && winner != match.Players[1] {
+		return ErrNotInMatch
+	}
+
+	match.Winner = winner
+	if len(t.ReadyMatches()) == 0 {
+		t.nextRound()
+	}
+	return nil
+}
+
+// Standings returns every player's record, best first
+func (t *Tournament) Standings() []Standing {
+	standings := make([]Standing, len(t.players))
+	for i, name := range t.players {
+		standings[i].Name = name
+	}
+	for _, match := range t.matches {
+		if !match.Played() {
+			continue
+		}
+		for _, name := range match.Players {
+			standing := &standings[t.seedOf(name)]
+			standing.Played++
+			if name == match.Winner {
+				standing.Wins++
+			} else {
+				standing.Losses++
+			}
+		}
+	}
+	for i := range standings {
+		standings[i].Eliminated = t.eliminated(standings[i].Losses)
+	}
+
+	// The champion comes first, then the best records, then seed order
+	sort.SliceStable(standings, func(i, j int) bool {
+		a, b := standings[i], standings[j]
+		if (a.Name == t.champion) != (b.Name == t.champion) {
+			return a.Name == t.champion
+		}
+		if a.Eliminated != b.Eliminated {
+			return !a.Eliminated
+		}
+		if a.Wins != b.Wins {
+			return a.Wins > b.Wins
+		}
+		return a.Losses < b.Losses
+	})
+	return standings
+}
+
+// nextRound schedules the next round's matches, or crowns the champion if
+// there are none left to play
+func (t *Tournament) nextRound() {
+	t.round++
+
+	switch t.format {
+	case FormatRoundRobin:
+		if len(t.pending) == 0 {
+			t.champion = t.Standings()[0].Name
+			return
+		}
+		for _, match := range t.pending[0] {
+			t.schedule(match.Players, "")
+		}
+		t.pending = t.pending[1:]
+
+	case FormatSingleElimination:
+		alive := t.playersWithLosses(0)
+		if len(alive) == 1 {
+			t.champion = alive[0]
+			return
+		}
+		t.pairUp(alive, "")
+
+	case FormatDoubleElimination:
+		winners := t.playersWithLosses(0)
+		losers := t.playersWithLosses(1)
+		switch len(winners) + len(losers) {
+		case 1:
+			t.champion = append(winners, losers...)[0]
+		case 2:
+			// The final is replayed if the winners' bracket player loses it,
+			// since that is their first loss
+			final := append(winners, losers...)
+			t.schedule([2]string{final[0], final[1]}, BracketFinal)
+		default:
+			t.pairUp(winners, BracketWinners)
+			t.pairUp(losers, BracketLosers)
+		}
+	}
+}
+
+// pairUp schedules matches between players in seed order, the best seed
+// against the worst. With an odd number of players the best seed sits the
+// round out.
+func (t *Tournament) pairUp(players []string, bracket string) {
+	if len(players)%2 == 1 {
+		players = players[1:]
+	}
+	for i := 0; i < len(players)/2; i++ {
+		t.schedule([2]string{players[i], players[len(players)-1-i]}, bracket)
+	}
+}
+
+// schedule adds a match to the current round
+func (t *Tournament) schedule(players [2]string, bracket string) {
+	t.matches = append(t.matches, &Match{
+		ID:      len(t.matches) + 1,
+		Round:   t.round,
+		Bracket: bracket,
+		Players: players,
+	})
+}
+
+// playersWithLosses returns the players with exactly the given number of
+// losses, in seed order
+func (t *Tournament) playersWithLosses(losses int) []string {
+	counts := make(map[string]int, len(t.players))
+	for _, match := range t.matches {
+		if match.Played() {
+			counts[match.Loser()]++
+		}
+	}
+
+	players := make([]string, 0, len(t.players))
+	for _, name := range t.players {
+		if counts[name] == losses {
+			players = append(players, name)
+		}
+	}
+	return players
+}
+
+// eliminated reports whether a player with the given losses is out
+func (t *Tournament) eliminated(losses int) bool {
+	switch t.format {
+	case FormatSingleElimination:
+		return losses >= 1
+	case FormatDoubleElimination:
+		return losses >= 2
+	default:
+		return false
+	}
+}
+
+// seedOf returns a player's index in seed order, or -1 if not registered
+func (t *Tournament) seedOf(name string) int {
+	for i, player := range t.players {
+		if player == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// roundRobinRounds pairs every player with every other player once using the
+// circle method. With an odd number of players one sits out each round.
+func roundRobinRounds(players []string) [][]*Match {
+	circle := append([]string(nil), players...)
+	if len(circle)%2 == 1 {
+		circle = append(circle, "") // Playing "" means sitting the round out
+	}
+
+	n := len(circle)
+	rounds := make([][]*Match, 0, n-1)
+	for r := 0; r < n-1; r++ {
+		round := make([]*Match, 0, n/2)
+		for i := 0; i < n/2; i++ {
+			a, b := circle[i], circle[n-1-i]
+			if a != "" && b != "" {
+				round = append(round, &Match{Players: [2]string{a, b}})
+			}
+		}
+		rounds = append(rounds, round)
+
+		// Keep the first player in place and rotate everyone else
+		last := circle[n-1]
+		copy(circle[2:], circle[1:n-1])
+		circle[1] = last
+	}
+	return rounds
+}
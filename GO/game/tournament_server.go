@@ -0,0 +1,374 @@
+package game
+
+import (
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"strings"
+	"sync"
+)
+
+// TournamentOptions configures a tournament hosted by the server
+type TournamentOptions struct {
+	Format TournamentFormat // How matches are scheduled
+	Rules  GameRules        // Optional guess and time limits for every match
+}
+
+// TournamentManager runs a tournament over the network: it registers players
+// as they connect, starts a GameSession for every scheduled match and feeds
+// the results back into the tournament
+type TournamentManager struct {
+	mutex      sync.Mutex
+	tournament *Tournament
+	rules      GameRules
+	players    map[string]*lobbyPlayer // Registered players by name
+	playing    map[int]bool            // IDs of the matches being played
+	nextID     int                     // Last player ID handed out
+}
+
+// activeTournament is the tournament hosted by this server, if any
+var activeTournament *TournamentManager
+
+// NewTournamentManager creates a manager for a tournament open for registration
+func NewTournamentManager(options TournamentOptions) *TournamentManager {
+	// Matches are always one against one, taking turns
+	options.Rules.Mode = ModeTurns
+
+	return &TournamentManager{
+		tournament: NewTournament(options.Format),
+		rules:      options.Rules,
+		players:    make(map[string]*lobbyPlayer),
+		playing:    make(map[int]bool),
+	}
+}
+
+// StartTournamentServer starts the server hosting a tournament. Players
+// register by connecting on port 8080; an admin starts the tournament and
+// follows the standings through the command listener.
+func StartTournamentServer(options TournamentOptions) {
+	// Initialize analytics if not already done
+	if globalAnalytics == nil {
+		InitAnalytics()
+	}
+
+	activeTournament = NewTournamentManager(options)
+
+	slog.Info("Starting tournament server", "format", options.Format.String())
+	listener, err := listenGame()
+	if err != nil {
+		slog.Error("Error starting server", "error", err)
+		os.Exit(1)
+	}
+	defer listener.Close()
+
+	// Create command listener for admin commands
+	go startCommandListener()
+	cluster.serveLobby(LobbyTournament)
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			slog.Error("Error accepting connection", "error", err)
+			continue
+		}
+		go activeTournament.handleConnection(conn)
+	}
+}
+
+// handleConnection registers a new connection under a player name and then
+// routes the player's messages to their matches
+func (m *TournamentManager) handleConnection(conn net.Conn) {
+	if cluster.routeLobby(conn, LobbyTournament) {
+		return
+	}
+	writeToClient(conn, fmt.Sprintf("Welcome to the Code Breaker %s tournament!", m.tournament.Format()))
+	writeToClient(conn, "\nIt's your turn to register. Enter your name:")
+	serveLobbyConnection(conn, LobbyTournament, m.join, m.route)
+}
+
+// join registers a player under the given name, or reconnects them if the
+// name is registered and not connected. It returns nil if the name can't be
+// used.
+func (m *TournamentManager) join(player *Player, name string) *lobbyPlayer {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	name = strings.TrimSpace(name)
+	if entry, exists := m.players[name]; exists {
+		if entry.player != nil {
+			writeToClient(player.conn, "That name is already taken.\nTry again:")
+			return nil
+		}
+
+		// A registered player is back
+		player.id, player.name = entry.id, name
+		entry.player = player
+		slog.Info("Player reconnected to the tournament", logEvent, "player_reconnected", logPlayer, entry.id, "name", name)
+		writeToClient(player.conn, fmt.Sprintf("\nWelcome back, %s!", name))
+		m.schedule()
+		return entry
+	}
+
+	if err := m.tournament.Register(name); err != nil {
+		writeToClient(player.conn, err.Error()+"\nTry again:")
+		return nil
+	}
+
+	m.nextID++
+	player.id, player.name = m.nextID, name
+	entry := &lobbyPlayer{id: m.nextID, name: name, player: player}
+	m.players[name] = entry
+
+	slog.Info("Player registered for the tournament", logEvent, "player_registered", logPlayer, entry.id, "name", name)
+	writeToClient(player.conn, fmt.Sprintf("\nYou are registered as %s. Waiting for the tournament to start...", name))
+	m.broadcast(fmt.Sprintf("\n%s has registered. (%d players)", name, len(m.players)), entry)
+	return entry
+}
+
+// route hands a registered player's message to their match, or answers it
+// from the lobby between matches
+func (m *TournamentManager) route(entry *lobbyPlayer, input playerInput) {
+	delivered := deliverToSession(&m.mutex, entry, input)
+	if input.err != nil {
+		m.mutex.Lock()
+		entry.player = nil
+		m.mutex.Unlock()
+		slog.Info("Player left the tournament", logEvent, "player_left", logPlayer, entry.id, "name", entry.name,
+			"error", input.err)
+		return
+	}
+	if !delivered {
+		writeToClient(input.player.conn, "\nYour next match hasn't started yet. Please wait.")
+	}
+}
+
+// Start closes registration and starts the first round
+func (m *TournamentManager) Start() error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if err := m.tournament.Start(); err != nil {
+		return err
+	}
+	slog.Info("Tournament started", logEvent, "tournament_started", "players", len(m.players))
+	m.broadcast(fmt.Sprintf("\nThe tournament has started with %d players! Round 1 is under way.", len(m.players)), nil)
+	m.schedule()
+	return nil
+}
+
+// schedule starts every ready match whose players are both connected and
+// awards a forfeit when only one of them is. The caller must hold m.mutex.
+func (m *TournamentManager) schedule() {
+	// No new matches start once the server is shutting down
+	if serverHealth.Draining() {
+		return
+	}
+	for m.tournament.Started() && !m.tournament.Finished() {
+		forfeited := false
+		for _, match := range m.tournament.ReadyMatches() {
+			if m.playing[match.ID] {
+				continue
+			}
+			a, b := m.players[match.Players[0]], m.players[match.Players[1]]
+			switch {
+			case a.player == nil && b.player == nil:
+				// Wait for one of them to come back
+			case a.player == nil:
+				m.recordResult(match, match.Players[1], "by forfeit")
+				forfeited = true
+			case b.player == nil:
+				m.recordResult(match, match.Players[0], "by forfeit")
+				forfeited = true
+			default:
+				m.startMatch(match, a, b)
+			}
+			if forfeited {
+				break
+			}
+		}
+
+		// A forfeit may finish the round, so look again
+		if !forfeited {
+			return
+		}
+	}
+}
+
+// startMatch starts a GameSession for a match; the caller must hold m.mutex
+func (m *TournamentManager) startMatch(match Match, a, b *lobbyPlayer) {
+	session := newLobbySession([]*lobbyPlayer{a, b}, GenerateSecretCode(), m.rules)
+	m.playing[match.ID] = true
+
+	session.logger().Info("Starting tournament match", logEvent, "match_started", "match", match.ID,
+		"players", match.Players[0]+" vs "+match.Players[1])
+	description := fmt.Sprintf("\nMatch %d (%s) is starting: %s vs %s!",
+		match.ID, describeRound(match), match.Players[0], match.Players[1])
+	writeToClient(a.player.conn, description)
+	writeToClient(b.player.conn, description)
+
+	go m.playMatch(match, session)
+}
+
+// playMatch runs a match's GameSession and records its result
+func (m *TournamentManager) playMatch(match Match, session *GameSession) {
+	runGameSession(session)
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	delete(m.playing, match.ID)
+	for _, name := range match.Players {
+		m.players[name].session = nil
+	}
+
+	// A player left alone in an abandoned match wins by forfeit
+	winner, how := "", ""
+	switch {
+	case session.game.State() == StateWon:
+		winner = m.nameOf(session.game.WinnerID())
+	case session.game.State() == StateAbandoned && len(session.players) == 1:
+		winner = m.nameOf(session.players[0].id)
+		how = "by forfeit"
+	}
+
+	if winner == "" {
+		for _, name := range match.Players {
+			if p := m.players[name].player; p != nil {
+				writeToClient(p.conn, "\nThe match ended without a winner and will be replayed.")
+			}
+		}
+	} else {
+		m.recordResult(match, winner, how)
+	}
+	m.schedule()
+}
+
+// recordResult records the winner of a match and announces what happens
+// next; the caller must hold m.mutex
+func (m *TournamentManager) recordResult(match Match, winnerName string, how string) {
+	round := m.tournament.Round()
+	if err := m.tournament.RecordResult(match.ID, winnerName); err != nil {
+		slog.Error("Error recording a match result", "match", match.ID, "error", err)
+		return
+	}
+
+	result := fmt.Sprintf("\n%s won match %d", winnerName, match.ID)
+	if how != "" {
+		result += " " + how
+	}
+	slog.Info(strings.TrimSpace(result), logEvent, "match_finished", "match", match.ID, "winner", winnerName)
+	for _, name := range match.Players {
+		if p := m.players[name].player; p != nil {
+			writeToClient(p.conn, result+". Waiting for the next match...")
+		}
+	}
+
+	switch {
+	case m.tournament.Finished():
+		m.broadcast(fmt.Sprintf("\nThe tournament is over! %s is the champion!", m.tournament.Champion()), nil)
+	case m.tournament.Round() != round:
+		m.broadcast(fmt.Sprintf("\nRound %d is starting!", m.tournament.Round()), nil)
+	}
+}
+
+// nameOf returns the name a player registered with; the caller must hold m.mutex
+func (m *TournamentManager) nameOf(id int) string {
+	for name, entry := range m.players {
+		if entry.id == id {
+			return name
+		}
+	}
+	return ""
+}
+
+// broadcast sends a message to every connected player except the given one;
+// the caller must hold m.mutex
+func (m *TournamentManager) broadcast(message string, except *lobbyPlayer) {
+	for _, entry := range m.players {
+		if entry != except && entry.player != nil {
+			writeToClient(entry.player.conn, message)
+		}
+	}
+}
+
+// Report describes the tournament's status, standings and matches
+func (m *TournamentManager) Report() string {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	t := m.tournament
+	report := fmt.Sprintf("=== CODE BREAKER TOURNAMENT (%s) ===\n\n", t.Format())
+	switch {
+	case !t.Started():
+		report += fmt.Sprintf("Status: registration open (%d players)\n\n", len(t.Players()))
+	case t.Finished():
+		report += fmt.Sprintf("Status: finished, champion %s\n\n", t.Champion())
+	default:
+		report += fmt.Sprintf("Status: round %d\n\n", t.Round())
+	}
+
+	report += "STANDINGS:\n"
+	if len(t.Players()) == 0 {
+		report += "No players registered yet\n"
+	}
+	for i, standing := range t.Standings() {
+		report += fmt.Sprintf("%d. %s - %d wins, %d losses", i+1, standing.Name, standing.Wins, standing.Losses)
+		if standing.Eliminated {
+			report += " (eliminated)"
+		}
+		if m.players[standing.Name].player == nil {
+			report += " (disconnected)"
+		}
+		report += "\n"
+	}
+
+	report += "\nMATCHES:\n"
+	matches := t.Matches()
+	if len(matches) == 0 {
+		report += "No matches scheduled yet\n"
+	}
+	for _, match := range matches {
+		status := "waiting"
+		switch {
+		case match.Played():
+			status = match.Winner + " won"
+		case m.playing[match.ID]:
+			status = "playing"
+		}
+		report += fmt.Sprintf("#%d %s: %s vs %s - %s\n",
+			match.ID, describeRound(match), match.Players[0], match.Players[1], status)
+	}
+	return report
+}
+
+// describeRound names the round (and bracket) of a match
+func describeRound(match Match) string {
+	if match.Bracket == "" {
+		return fmt.Sprintf("round %d", match.Round)
+	}
+	return fmt.Sprintf("round %d, %s bracket", match.Round, match.Bracket)
+}
+
+// handleTournamentCommand lets admins follow the tournament with
+// "tournament" and start it with "tournament start"
+func handleTournamentCommand(args []string) string {
+	if activeTournament == nil {
+		return "No tournament is running. Start the server in tournament mode to host one."
+	}
+	if elsewhere := cluster.hostedElsewhere(LobbyTournament); elsewhere != "" {
+		return elsewhere
+	}
+
+	switch {
+	case len(args) == 0:
+		return activeTournament.Report()
+	case len(args) == 1 && args[0] == "start":
+		if err := activeTournament.Start(); err != nil {
+			return fmt.Sprintf("Could not start the tournament: %v", err)
+		}
+		return "The tournament has started.\n\n" + activeTournament.Report()
+	default:
+		return "Usage: tournament | tournament start"
+	}
+}
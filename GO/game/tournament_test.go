@@ -0,0 +1,139 @@
+package game
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// newTournament registers the given players in a tournament and starts it
+func newTournament(t *testing.T, format TournamentFormat, names ...string) *Tournament {
+	tournament := NewTournament(format)
+	for _, name := range names {
+		assert.NoError(t, tournament.Register(name))
+	}
+	assert.NoError(t, tournament.Start())
+	return tournament
+}
+
+// playRound records a win for the first player of every ready match
+func playRound(t *testing.T, tournament *Tournament) []Match {
+	ready := tournament.ReadyMatches()
+	for _, match := range ready {
+		assert.NoError(t, tournament.RecordResult(match.ID, match.Players[0]))
+	}
+	return ready
+}
+
+func TestTournament_Register(t *testing.T) {
+	tournament := NewTournament(FormatSingleElimination)
+	assert.NoError(t, tournament.Register("ann"))
+	assert.ErrorIs(t, tournament.Register("ann"), ErrNameTaken)
+	assert.ErrorIs(t, tournament.Register("  "), ErrInvalidName)
+	assert.ErrorIs(t, tournament.Start(), ErrNotEnoughPlayers)
+
+	assert.NoError(t, tournament.Register("bob"))
+	assert.NoError(t, tournament.Start())
+	assert.ErrorIs(t, tournament.Register("cat"), ErrTournamentStarted)
+	assert.Equal(t, []string{"ann", "bob"}, tournament.Players())
+}
+
+func TestTournament_SingleElimination(t *testing.T) {
+	tournament := newTournament(t, FormatSingleElimination, "a", "b", "c", "d", "e")
+
+	// The top seed sits out the first round; the rest play best against worst
+	round := playRound(t, tournament)
+	assert.Len(t, round, 2)
+	assert.Equal(t, [2]string{"b", "e"}, round[0].Players)
+	assert.Equal(t, [2]string{"c", "d"}, round[1].Players)
+
+	round = playRound(t, tournament)
+	assert.Equal(t, [2]string{"b", "c"}, round[0].Players)
+
+	round = playRound(t, tournament)
+	assert.Equal(t, [2]string{"a", "b"}, round[0].Players)
+	assert.True(t, tournament.Finished())
+	assert.Equal(t, "a", tournament.Champion())
+
+	standings := tournament.Standings()
+	assert.Equal(t, "a", standings[0].Name)
+	assert.False(t, standings[0].Eliminated)
+	assert.True(t, standings[1].Eliminated)
+}
+
+func TestTournament_RecordResultErrors(t *testing.T) {
+	tournament := newTournament(t, FormatSingleElimination, "a", "b", "c", "d")
+
+	assert.ErrorIs(t, tournament.RecordResult(99, "a"), ErrUnknownMatch)
+	assert.ErrorIs(t, tournament.RecordResult(1, "c"), ErrNotInMatch)
+	assert.NoError(t, tournament.RecordResult(1, "d"))
+	assert.ErrorIs(t, tournament.RecordResult(1, "a"), ErrMatchPlayed)
+
+	// The round isn't over until every match is played
+	assert.Equal(t, 1, tournament.Round())
+	assert.NoError(t, tournament.RecordResult(2, "b"))
+	assert.Equal(t, 2, tournament.Round())
+	assert.Equal(t, [2]string{"b", "d"}, tournament.ReadyMatches()[0].Players)
+}
+
+func TestTournament_DoubleEliminationNeedsTwoLosses(t *testing.T) {
+	tournament := newTournament(t, FormatDoubleElimination, "a", "b", "c", "d")
+
+	for !tournament.Finished() {
+		assert.NotEmpty(t, playRound(t, tournament))
+	}
+
+	// Everyone but the champion lost twice
+	for _, standing := range tournament.Standings() {
+		if standing.Name == tournament.Champion() {
+			assert.Less(t, standing.Losses, 2)
+		} else {
+			assert.Equal(t, 2, standing.Losses)
+		}
+	}
+}
+
+func TestTournament_DoubleEliminationFinalReset(t *testing.T) {
+	tournament := newTournament(t, FormatDoubleElimination, "a", "b")
+
+	// The undefeated player must lose twice to be knocked out
+	assert.NoError(t, tournament.RecordResult(1, "a"))
+	final := tournament.ReadyMatches()[0]
+	assert.Equal(t, BracketFinal, final.Bracket)
+	assert.NoError(t, tournament.RecordResult(final.ID, "b"))
+	assert.False(t, tournament.Finished())
+
+	final = tournament.ReadyMatches()[0]
+	assert.NoError(t, tournament.RecordResult(final.ID, "b"))
+	assert.Equal(t, "b", tournament.Champion())
+}
+
+func TestTournament_RoundRobin(t *testing.T) {
+	tournament := newTournament(t, FormatRoundRobin, "a", "b", "c")
+
+	pairs := make(map[[2]string]bool)
+	rounds := 0
+	for !tournament.Finished() {
+		for _, match := range playRound(t, tournament) {
+			pairs[match.Players] = true
+		}
+		rounds++
+	}
+
+	// Everyone plays everyone once, one player sitting out each round
+	assert.Equal(t, 3, rounds)
+	assert.Len(t, pairs, 3)
+	for _, standing := range tournament.Standings() {
+		assert.Equal(t, 2, standing.Played)
+	}
+	assert.Equal(t, tournament.Standings()[0].Name, tournament.Champion())
+}
+
+func TestParseTournamentFormat(t *testing.T) {
+	format, err := ParseTournamentFormat("double-elim")
+	assert.NoError(t, err)
+	assert.Equal(t, FormatDoubleElimination, format)
+
+	_, err = ParseTournamentFormat("swiss")
+	assert.Error(t, err)
+}
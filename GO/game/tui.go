@@ -0,0 +1,492 @@
+package game
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// ANSI escape sequences used to draw the full-screen client
+const (
+	ansiAltScreen  = "\x1b[?1049h"
+	ansiMainScreen = "\x1b[?1049l"
+	ansiHideCursor = "\x1b[?25l"
+	ansiShowCursor = "\x1b[?25h"
+	ansiClear      = "\x1b[2J"
+	ansiBold       = "\x1b[1m"
+	ansiReverse    = "\x1b[7m"
+	ansiReset      = "\x1b[0m"
+)
+
+// Keys understood by the full-screen client in raw mode
+const (
+	keyCtrlC     = 3
+	keyCtrlD     = 4
+	keyCtrlL     = 12
+	keyEnter     = 13
+	keyNewline   = 10
+	keyEscape    = 27
+	keyBackspace = 127
+	keyCtrlH     = 8
+)
+
+// tuiMessageLimit is how many server messages and chat lines the client keeps
+const tuiMessageLimit = 200
+
+// tuiModel is everything the full-screen client shows. It is updated from
+// protocol events and server text and drawn by render; it does no I/O.
+type tuiModel struct {
+	you      string
+	mode     string
+	players  []string
+	current  string            // Whose turn it is ("" if nobody's)
+	deadline time.Time         // End of the current turn or prompt (zero if none)
+	history  *GuessHistory     // Guesses on the board and the player's notes
+	progress map[string]string // Race: how each opponent is doing
+	chat     []string
+	messages []string
+	prompt   string // Input the server is waiting for, other than a guess
+	result   string // How the last game ended
+	input    string // Line being typed
+}
+
+// newTUIModel creates an empty model
+func newTUIModel() *tuiModel {
+	return &tuiModel{history: NewGuessHistory(), progress: make(map[string]string)}
+}
+
+// apply updates the model with a protocol event received at the given time
+func (m *tuiModel) apply(event ProtocolEvent, now time.Time) {
+	if event.You != "" {
+		m.you = event.You
+	}
+	m.history.Apply(event)
+
+	switch event.Type {
+	case ProtocolGameStarted:
+		m.mode, m.players = event.Mode, event.Players
+		m.current, m.deadline = "", time.Time{}
+		m.progress = make(map[string]string)
+		m.prompt, m.result = "", ""
+	case ProtocolPlayers:
+		m.players = event.Players
+	case ProtocolTurn:
+		m.current, m.prompt = event.Player, ""
+		m.deadline = now.Add(time.Duration(event.Seconds) * time.Second)
+	case ProtocolProgress:
+		m.progress[event.Player] = fmt.Sprintf("%d guesses, best %d/4", event.Guesses, event.BestExact)
+	case ProtocolTimeout:
+		m.deadline = time.Time{}
+	case ProtocolChat:
+		line := fmt.Sprintf("%s: %s", event.Player, event.Text)
+		if event.Team != "" {
+			line = fmt.Sprintf("[%s] %s", event.Team, line)
+		}
+		m.chat = appendLimited(m.chat, line)
+	case ProtocolGameOver:
+		m.current, m.deadline, m.prompt = "", time.Time{}, ""
+		m.result = describeOutcome(event)
+	case ProtocolPrompt:
+		m.prompt = event.Prompt
+		m.deadline = time.Time{}
+		if event.Seconds > 0 {
+			m.deadline = now.Add(time.Duration(event.Seconds) * time.Second)
+		}
+	}
+}
+
+// addText adds server text to the message pane. Chat is left to the chat pane.
+func (m *tuiModel) addText(line string) {
+	line = strings.TrimSpace(line)
+	if line == "" || strings.HasPrefix(line, "[Chat] ") || strings.HasPrefix(line, "[Team ") {
+		return
+	}
+	m.messages = appendLimited(m.messages, line)
+}
+
+// describeOutcome summarizes a game over event
+func describeOutcome(event ProtocolEvent) string {
+	outcome := "The game was abandoned."
+	switch event.Result {
+	case ResultWon:
+		outcome = event.Winner + " won!"
+		if event.Winner == event.You {
+			outcome = "You won!"
+		}
+	case ResultLost:
+		outcome = "Nobody cracked the code."
+	case ResultDraw:
+		outcome = "The duel is a draw."
+	}
+	if event.Secret != "" {
+		outcome += " The code was " + event.Secret + "."
+	}
+	return outcome
+}
+
+// appendLimited appends a line, dropping the oldest beyond tuiMessageLimit
+func appendLimited(lines []string, line string) []string {
+	lines = append(lines, line)
+	if len(lines) > tuiMessageLimit {
+		lines = lines[len(lines)-tuiMessageLimit:]
+	}
+	return lines
+}
+
+// status describes whose turn it is and how long is left
+func (m *tuiModel) status(now time.Time) string {
+	countdown := ""
+	if !m.deadline.IsZero() {
+		left := m.deadline.Sub(now).Round(time.Second)
+		if left < 0 {
+			left = 0
+		}
+		countdown = fmt.Sprintf(" (%ds left)", int(left.Seconds()))
+	}
+
+	switch {
+	case m.prompt == PromptPlayAgain:
+		return "Play again? Type yes or no"
+	case m.prompt == PromptCode:
+		return "Choose a 4-digit code for your opponent" + countdown
+	case m.prompt == PromptTeam:
+		return "Choose a team by name or number" + countdown
+	case m.result != "":
+		return m.result
+	case m.mode == ModeRace.String():
+		return "Race: guess whenever you like"
+	case m.current != "" && m.current == m.you:
+		return "Your turn! Enter a 4-digit guess" + countdown
+	case m.current != "":
+		return "Waiting for " + m.current + countdown
+	default:
+		return "Waiting for the game to start"
+	}
+}
+
+// render draws the model as height lines of the given width
+func (m *tuiModel) render(width, height int, now time.Time) []string {
+	if width < 40 {
+		width = 40
+	}
+	if height < 12 {
+		height = 12
+	}
+
+	leftWidth := width * 3 / 5
+	rightWidth := width - leftWidth - 1
+	bodyRows := height - 5
+
+	// Left: the guess board above the server messages
+	boardRows := bodyRows / 2
+	left := append(m.renderBoard(boardRows, leftWidth), renderPane("MESSAGES", m.messages, bodyRows-boardRows, leftWidth)...)
+
+	// Right: the players and the candidate count above the chat
+	right := m.renderPlayers(rightWidth)
+	fit, fitNotes := m.history.Candidates()
+	right = append(right,
+		padLine(fmt.Sprintf(" CANDIDATES: %d fit (%d with notes)", fit, fitNotes), rightWidth),
+		padLine(" NOTES: "+m.history.DescribeMarks(), rightWidth),
+		padLine("", rightWidth))
+	right = append(right, renderPane("CHAT (/say <message>)", m.chat, bodyRows-len(right), rightWidth)...)
+	for len(right) < bodyRows {
+		right = append(right, padLine("", rightWidth))
+	}
+
+	title := " CODE BREAKER"
+	if m.mode != "" {
+		title += " | " + m.mode
+	}
+	if m.you != "" {
+		title += " | you: " + m.you
+	}
+
+	lines := make([]string, 0, height)
+	lines = append(lines, ansiReverse+padLine(title, width)+ansiReset)
+	lines = append(lines, ansiBold+padLine(" "+m.status(now), width)+ansiReset)
+	lines = append(lines, strings.Repeat("-", width))
+	for i := 0; i < bodyRows; i++ {
+		lines = append(lines, left[i]+"|"+right[i])
+	}
+	lines = append(lines, strings.Repeat("-", width))
+	lines = append(lines, padLine("> "+m.input, width))
+	return lines
+}
+
+// renderBoard draws the most recent guesses that fit in rows lines
+func (m *tuiModel) renderBoard(rows, width int) []string {
+	lines := make([]string, 0, len(m.history.Guesses))
+	for i, guess := range m.history.Guesses {
+		lines = append(lines, fmt.Sprintf(" %3d  %-12s %s  %s", i+1, truncate(guess.Player, 12), guess.Guess, guess.DescribeFeedback()))
+	}
+	header := fmt.Sprintf("GUESSES\n   #  %-12s GUESS  FEEDBACK", "PLAYER")
+	return renderPane(header, lines, rows, width)
+}
+
+// renderPlayers lists the players, marking whose turn it is
+func (m *tuiModel) renderPlayers(width int) []string {
+	lines := []string{padLine(" PLAYERS", width)}
+	for _, name := range m.players {
+		line := "   " + name
+		if name == m.you {
+			line += " (you)"
+		}
+		if progress, ok := m.progress[name]; ok {
+			line += " - " + progress
+		}
+		if name == m.current {
+			lines = append(lines, ansiBold+padLine(" > "+line[3:], width)+ansiReset)
+			continue
+		}
+		lines = append(lines, padLine(line, width))
+	}
+	return append(lines, padLine("", width))
+}
+
+// renderPane draws a titled pane showing the last lines that fit in rows
+// lines, wrapping long ones. A title may span several lines.
+func renderPane(title string, lines []string, rows, width int) []string {
+	if rows <= 0 {
+		return nil
+	}
+	pane := make([]string, 0, rows)
+	for _, line := range strings.Split(title, "\n") {
+		pane = append(pane, padLine(" "+line, width))
+	}
+	space := rows - len(pane)
+	if space < 0 {
+		return pane[:rows]
+	}
+	lines = wrapLines(lines, width-1)
+	if len(lines) > space {
+		lines = lines[len(lines)-space:]
+	}
+	for _, line := range lines {
+		pane = append(pane, padLine(" "+line, width))
+	}
+	for len(pane) < rows {
+		pane = append(pane, padLine("", width))
+	}
+	return pane
+}
+
+// wrapLines splits lines longer than width characters
+func wrapLines(lines []string, width int) []string {
+	wrapped := make([]string, 0, len(lines))
+	for _, line := range lines {
+		runes := []rune(line)
+		for len(runes) > width {
+			wrapped = append(wrapped, string(runes[:width]))
+			runes = runes[width:]
+		}
+		wrapped = append(wrapped, string(runes))
+	}
+	return wrapped
+}
+
+// padLine cuts or pads a line to exactly width characters
+func padLine(line string, width int) string {
+	runes := []rune(truncate(line, width))
+	return string(runes) + strings.Repeat(" ", width-len(runes))
+}
+
+// truncate cuts a string to at most width characters
+func truncate(s string, width int) string {
+	runes := []rune(s)
+	if len(runes) > width {
+		return string(runes[:width])
+	}
+	return s
+}
+
+// StartTUIClient connects to a server and plays in a full-screen terminal
+// interface driven by the server's protocol events
+func StartTUIClient(address string) error {
+	conn, err := dialServer(address)
+	if err != nil {
+		return fmt.Errorf("error connecting to server: %v", err)
+	}
+	defer conn.Close()
+
+	// Ask the server for structured events
+	if _, err := conn.Write([]byte(eventsCommand + "\n")); err != nil {
+		return fmt.Errorf("error sending message to server: %v", err)
+	}
+
+	restore, err := enterRawMode()
+	if err != nil {
+		return fmt.Errorf("the full-screen client needs a terminal (%v); use 'client' instead", err)
+	}
+	fmt.Print(ansiAltScreen + ansiHideCursor)
+	defer func() {
+		fmt.Print(ansiShowCursor + ansiMainScreen)
+		restore()
+	}()
+
+	type serverChunk struct {
+		texts  []string
+		events []ProtocolEvent
+		err    error
+	}
+	chunks := make(chan serverChunk)
+	var beat heartbeat
+	go func() {
+		var reader protocolReader
+		buffer := make([]byte, 4096)
+		for {
+			n, err := conn.Read(buffer)
+			if err != nil {
+				chunks <- serverChunk{err: err}
+				return
+			}
+			beat.seen()
+			texts, events := reader.feed(string(buffer[:n]))
+			chunk := serverChunk{texts: texts}
+			for _, event := range events {
+				if !answerPing(conn, event) {
+					chunk.events = append(chunk.events, event)
+				}
+			}
+			chunks <- chunk
+		}
+	}()
+
+	stop := make(chan struct{})
+	defer close(stop)
+	startClientHeartbeat(conn, &beat, stop, func(err error) {
+		chunks <- serverChunk{err: fmt.Errorf("the server stopped responding: %v", err)}
+	})
+
+	keys := make(chan rune)
+	go readKeys(os.Stdin, keys)
+
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	model := newTUIModel()
+	width, height := terminalSize()
+	escaping := 0 // Bytes of an escape sequence left to skip
+	for {
+		drawScreen(model.render(width, height, time.Now()))
+
+		select {
+		case chunk := <-chunks:
+			if chunk.err != nil {
+				return fmt.Errorf("disconnected from server: %v", chunk.err)
+			}
+			for _, text := range chunk.texts {
+				model.addText(text)
+			}
+			for _, event := range chunk.events {
+				model.apply(event, time.Now())
+			}
+		case <-ticker.C:
+			// Redraw the countdown
+		case key, ok := <-keys:
+			if !ok {
+				return nil
+			}
+			switch {
+			case escaping > 0:
+				// Arrow and function keys are ignored
+				escaping--
+				if escaping == 1 && key != '[' && key != 'O' {
+					escaping = 0
+				}
+			case key == keyEscape:
+				escaping = 2
+			case key == keyCtrlC || key == keyCtrlD:
+				return nil
+			case key == keyCtrlL:
+				width, height = terminalSize()
+				fmt.Print(ansiClear)
+			case key == keyBackspace || key == keyCtrlH:
+				if runes := []rune(model.input); len(runes) > 0 {
+					model.input = string(runes[:len(runes)-1])
+				}
+			case key == keyEnter || key == keyNewline:
+				line := strings.TrimSpace(model.input)
+				model.input = ""
+				if line == "/quit" || line == "exit" {
+					return nil
+				}
+				if line == "" {
+					continue
+				}
+				// Notes are kept by the client; the server never sees them
+				if isNote, err := model.history.Note(line); isNote {
+					if err != nil {
+						model.addText(err.Error())
+					}
+					continue
+				}
+				if _, err := conn.Write([]byte(line + "\n")); err != nil {
+					return fmt.Errorf("error sending message to server: %v", err)
+				}
+			case key >= ' ' && key != utf8.RuneError:
+				model.input += string(key)
+			}
+		}
+	}
+}
+
+// readKeys sends the keys typed on the terminal as runes, decoding the UTF-8
+// bytes of a key that takes several, and closes keys once input ends
+func readKeys(input io.Reader, keys chan<- rune) {
+	reader := bufio.NewReader(input)
+	for {
+		key, _, err := reader.ReadRune()
+		if err != nil {
+			close(keys)
+			return
+		}
+		keys <- key
+	}
+}
+
+// drawScreen writes every line of the screen in place
+func drawScreen(lines []string) {
+	var screen strings.Builder
+	for i, line := range lines {
+		fmt.Fprintf(&screen, "\x1b[%d;1H%s", i+1, line)
+	}
+	os.Stdout.WriteString(screen.String())
+}
+
+// enterRawMode switches the terminal to raw mode so keys are read as they
+// are typed, and returns a function restoring the previous mode
+func enterRawMode() (func(), error) {
+	saved, err := stty("-g")
+	if err != nil {
+		return nil, err
+	}
+	if _, err := stty("raw", "-echo"); err != nil {
+		return nil, err
+	}
+	return func() { stty(strings.TrimSpace(saved)) }, nil
+}
+
+// terminalSize returns the terminal's width and height, or 80x24 if unknown
+func terminalSize() (int, int) {
+	size, err := stty("size")
+	if err == nil {
+		var rows, cols int
+		if _, err := fmt.Sscan(size, &rows, &cols); err == nil && rows > 0 && cols > 0 {
+			return cols, rows
+		}
+	}
+	return 80, 24
+}
+
+// stty runs stty on the terminal attached to stdin
+func stty(args ...string) (string, error) {
+	cmd := exec.Command("stty", args...)
+	cmd.Stdin = os.Stdin
+	output, err := cmd.Output()
+	return string(output), err
+}
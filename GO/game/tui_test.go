@@ -0,0 +1,49 @@
+package game
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTUIModel_FollowsTheGame(t *testing.T) {
+	now := time.Now()
+	model := newTUIModel()
+	model.apply(ProtocolEvent{Type: ProtocolGameStarted, You: "ann", Players: []string{"ann", "bob"}, Mode: "turns", Seconds: 30}, now)
+	assert.Equal(t, "Waiting for the game to start", model.status(now))
+
+	model.apply(ProtocolEvent{Type: ProtocolTurn, Player: "ann", Seconds: 30}, now)
+	assert.Equal(t, "Your turn! Enter a 4-digit guess (20s left)", model.status(now.Add(10*time.Second)))
+
+	model.apply(ProtocolEvent{Type: ProtocolGuess, Player: "ann", Guess: "1234"}, now)
+	model.apply(ProtocolEvent{Type: ProtocolTurn, Player: "bob", Seconds: 30}, now)
+	assert.Equal(t, "Waiting for bob (30s left)", model.status(now))
+
+	model.apply(ProtocolEvent{Type: ProtocolChat, Player: "bob", Text: "hi"}, now)
+	model.addText("[Chat] bob: hi")
+	model.addText("bob guessed 1234 (incorrect).")
+	assert.Equal(t, []string{"bob: hi"}, model.chat)
+	assert.Equal(t, []string{"bob guessed 1234 (incorrect)."}, model.messages)
+
+	model.apply(ProtocolEvent{Type: ProtocolGameOver, You: "ann", Result: ResultWon, Winner: "bob", Secret: "0042"}, now)
+	assert.Equal(t, "bob won! The code was 0042.", model.status(now))
+	model.apply(ProtocolEvent{Type: ProtocolPrompt, Prompt: PromptPlayAgain}, now)
+	assert.Equal(t, "Play again? Type yes or no", model.status(now))
+
+	screen := model.render(80, 24, now)
+	assert.Len(t, screen, 24)
+	assert.Contains(t, strings.Join(screen, "\n"), "1234")
+}
+
+func TestReadKeys_DecodesUTF8(t *testing.T) {
+	keys := make(chan rune)
+	go readKeys(strings.NewReader("héy 😀\x7f"), keys)
+
+	typed := make([]rune, 0)
+	for key := range keys {
+		typed = append(typed, key)
+	}
+	assert.Equal(t, []rune{'h', 'é', 'y', ' ', '😀', keyBackspace}, typed)
+}
@@ -2,42 +2,293 @@ package main
 
 import (
 	"CodeBreaker/game"
+	"crypto/rand"
+	"flag"
 	"log"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 )
 
 func main() {
 	if len(os.Args) < 2 {
-		log.Fatal("Usage: go run main.go <mode>\nMode can be 'server', 'client', or 'server <num_players>'")
+		log.Fatal("Usage: go run main.go <mode>\nMode can be 'server', 'client', 'tui', 'headless', 'offline', 'gencert', 'state-server', 'tournament', 'matchmaking', 'daily', or 'server <num_players>'")
 	}
 
 	mode := os.Args[1]
 
 	switch mode {
 	case "server":
+		// An optional number of players comes before any flags
+		args := os.Args[2:]
+		maxPlayers := 0
+		if len(args) > 0 {
+			if val, err := strconv.Atoi(args[0]); err == nil {
+				maxPlayers = val
+				args = args[1:]
+			}
+		}
+
+		options := game.ServerOptions{}
+		flags := flag.NewFlagSet(mode, flag.ExitOnError)
+		gameMode := flags.String("mode", game.ModeTurns.String(), "multiplayer mode: 'turns', 'race', 'duel' or 'teams'")
+		teams := flags.String("teams", strings.Join(game.DefaultTeamNames, ","), "comma-separated team names for team mode")
+		addRulesFlags(flags, &options.Rules)
+		server := addServerFlags(flags)
+		flags.Parse(args)
+		server.apply()
+
+		for _, name := range strings.Split(*teams, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				options.Rules.Teams = append(options.Rules.Teams, name)
+			}
+		}
+		var err error
+		if options.Rules.Mode, err = game.ParseGameMode(*gameMode); err != nil {
+			log.Fatal(err)
+		}
+		if options.Rules.Mode == game.ModeTeams && len(options.Rules.Teams) < 2 {
+			log.Fatal("Team mode needs at least two team names")
+		}
+
 		// Check if number of players is specified
-		if len(os.Args) > 2 {
+		if maxPlayers > 0 {
 			// Start the server in multiplayer mode with specified number of players
 			log.Println("Starting server in multiplayer mode...")
-			game.StartMultiplayerServer()
+			game.StartMultiplayerServer(maxPlayers, options)
 		} else {
 			// Start the server in single-player mode
 			log.Println("Starting server in single-player mode...")
-			game.StartSinglePlayerServer()
+			game.StartSinglePlayerServer(options)
+		}
+	case "tournament":
+		// Host a tournament; players register by connecting and an admin starts it
+		options := game.TournamentOptions{}
+		flags := flag.NewFlagSet(mode, flag.ExitOnError)
+		format := flags.String("format", game.FormatSingleElimination.String(), "tournament format: 'single-elim', 'double-elim' or 'round-robin'")
+		addRulesFlags(flags, &options.Rules)
+		server := addServerFlags(flags)
+		flags.Parse(os.Args[2:])
+		server.apply()
+
+		var err error
+		if options.Format, err = game.ParseTournamentFormat(*format); err != nil {
+			log.Fatal(err)
+		}
+		game.StartTournamentServer(options)
+	case "matchmaking":
+		// Match connecting players into games with others of similar rating
+		options := game.MatchmakingServerOptions{Matchmaking: game.DefaultMatchmakingOptions()}
+		flags := flag.NewFlagSet(mode, flag.ExitOnError)
+		flags.IntVar(&options.Matchmaking.GroupSize, "group-size", options.Matchmaking.GroupSize, "players per game in turns and race mode")
+		flags.IntVar(&options.Matchmaking.InitialBand, "band", options.Matchmaking.InitialBand, "rating difference accepted right away")
+		flags.IntVar(&options.Matchmaking.WidenBy, "widen-by", options.Matchmaking.WidenBy, "how much the accepted rating difference grows while waiting")
+		flags.DurationVar(&options.Matchmaking.WidenEvery, "widen-every", options.Matchmaking.WidenEvery, "how often the accepted rating difference grows")
+		addRulesFlags(flags, &options.Rules)
+		server := addServerFlags(flags)
+		flags.Parse(os.Args[2:])
+		server.apply()
+
+		game.StartMatchmakingServer(options)
+	case "daily":
+		// Host the daily challenge; every player gets the same code each day
+		options := game.DailyOptions{}
+		flags := flag.NewFlagSet(mode, flag.ExitOnError)
+		secret := flags.String("secret", os.Getenv("CODEBREAKER_DAILY_SECRET"), "server secret the daily codes are derived from (default $CODEBREAKER_DAILY_SECRET)")
+		addRulesFlags(flags, &options.Rules)
+		server := addServerFlags(flags)
+		flags.Parse(os.Args[2:])
+		server.apply()
+
+		options.Secret = []byte(*secret)
+		if *secret == "" {
+			// Without a fixed secret the day's code changes when the server restarts
+			log.Println("No daily secret set; generating one for this run")
+			options.Secret = make([]byte, 32)
+			if _, err := rand.Read(options.Secret); err != nil {
+				log.Fatal(err)
+			}
 		}
+		game.StartDailyServer(options)
 	case "client":
-		address := "server:8080"
 		// If an address is provided, use it (e.g., "localhost:8080")
 		// Otherwise, default to "server:8080"
-		if len(os.Args) > 2 {
-			address = os.Args[2]
-		}
+		address, args := clientAddress(os.Args[2:])
+		flags := flag.NewFlagSet(mode, flag.ExitOnError)
+		tlsOptions := game.ClientTLSOptions{}
+		addClientTLSFlags(flags, &tlsOptions)
+		flags.Parse(args)
+		configureClientTLS(tlsOptions)
+
 		log.Printf("Connecting to server at %s...\n", address)
 		err := game.StartClient(address)
 		if err != nil {
 			log.Fatal(err)
 		}
+	case "tui":
+		// Play in a full-screen terminal interface
+		address, args := clientAddress(os.Args[2:])
+		flags := flag.NewFlagSet(mode, flag.ExitOnError)
+		tlsOptions := game.ClientTLSOptions{}
+		addClientTLSFlags(flags, &tlsOptions)
+		flags.Parse(args)
+		configureClientTLS(tlsOptions)
+
+		if err := game.StartTUIClient(address); err != nil {
+			log.Fatal(err)
+		}
+	case "headless":
+		// Play with inputs from a script or another program, e.g.
+		// headless localhost:8080 -script moves.txt or headless localhost:8080 -- python3 bot.py
+		address, args := clientAddress(os.Args[2:])
+		options := game.HeadlessOptions{Output: os.Stdout}
+		flags := flag.NewFlagSet(mode, flag.ExitOnError)
+		tlsOptions := game.ClientTLSOptions{}
+		addClientTLSFlags(flags, &tlsOptions)
+		flags.StringVar(&options.Script, "script", "", "file with one input per line, sent whenever the server waits for one")
+		flags.StringVar(&options.Name, "name", "", "name to send first, for tournament, matchmaking and daily servers")
+		quiet := flags.Bool("quiet", false, "don't show the server's messages")
+		flags.Parse(args)
+		configureClientTLS(tlsOptions)
+		if *quiet {
+			options.Output = nil
+		}
+		if options.Script == "" {
+			// Without a script, the rest of the arguments is the bot program
+			options.Command = flags.Args()
+		}
+
+		if err := game.StartHeadlessClient(address, options); err != nil {
+			log.Fatal(err)
+		}
+	case "gencert":
+		// Create a self-signed certificate for trying TLS locally
+		flags := flag.NewFlagSet(mode, flag.ExitOnError)
+		hosts := flags.String("hosts", "localhost,127.0.0.1,::1,server", "comma-separated host names and IP addresses the certificate is valid for")
+		certFile := flags.String("cert", "cert.pem", "file to write the certificate to")
+		keyFile := flags.String("key", "key.pem", "file to write the private key to")
+		validFor := flags.Duration("valid-for", 365*24*time.Hour, "how long the certificate is valid")
+		flags.Parse(os.Args[2:])
+
+		if err := game.WriteSelfSignedCert(*certFile, *keyFile, strings.Split(*hosts, ","), *validFor); err != nil {
+			log.Fatal(err)
+		}
+		log.Printf("Wrote %s and %s", *certFile, *keyFile)
+	case "state-server":
+		// Share state between local server replicas without a Redis server
+		flags := flag.NewFlagSet(mode, flag.ExitOnError)
+		address := flags.String("addr", ":6379", "address to serve the Redis protocol on")
+		flags.Parse(os.Args[2:])
+
+		if err := game.StartStateServer(*address); err != nil {
+			log.Fatal(err)
+		}
+	case "offline", "play":
+		// Play a local single-player game without a server
+		options := game.DefaultOfflineOptions()
+		flags := flag.NewFlagSet(mode, flag.ExitOnError)
+		flags.StringVar(&options.SecretRules, "rules", options.SecretRules, "secret code rules: 'classic' or 'uniform'")
+		difficulty := flags.String("difficulty", string(options.Difficulty), "hint level: 'easy', 'normal' or 'hard'")
+		flags.Int64Var(&options.Seed, "seed", 0, "seed for the secret codes (0 for random)")
+		addRulesFlags(flags, &options.Rules)
+		flags.Parse(os.Args[2:])
+		options.Difficulty = game.Difficulty(*difficulty)
+
+		if err := game.StartSinglePlayerGame(options); err != nil {
+			log.Fatal(err)
+		}
 	default:
-		log.Fatal("Invalid mode. Use 'server', 'client', or 'server <num_players>'.")
+		log.Fatal("Invalid mode. Use 'server', 'client', 'tui', 'headless', 'offline', 'gencert', 'state-server', 'tournament', 'matchmaking', 'daily', or 'server <num_players>'.")
+	}
+}
+
+// addRulesFlags registers the flags for the limited-attempts and scoring mode
+func addRulesFlags(flags *flag.FlagSet, rules *game.GameRules) {
+	flags.IntVar(&rules.MaxGuesses, "max-guesses", 0, "guesses allowed across all players (0 for unlimited)")
+	flags.IntVar(&rules.MaxGuessesPerPlayer, "max-guesses-per-player", 0, "guesses allowed for each player (0 for unlimited)")
+	flags.DurationVar(&rules.TimeLimit, "time-limit", 0, "time allowed for the whole game, e.g. 5m (0 for unlimited)")
+}
+
+// serverFlags are the flags every server mode has for TLS, abuse protection,
+// logging, health endpoints, shutdown, sharing state with other replicas and
+// analytics memory
+type serverFlags struct {
+	tls          game.TLSOptions
+	limits       game.AbuseLimits
+	logging      game.LogOptions
+	healthAddr   string
+	drainTimeout time.Duration
+	cluster      game.ClusterOptions
+	recentGames  int
+}
+
+// addServerFlags registers the flags for serving over TLS, for the abuse
+// limits, for the log, for health checks and shutdown, for the cluster and
+// for analytics
+func addServerFlags(flags *flag.FlagSet) *serverFlags {
+	server := &serverFlags{limits: game.DefaultAbuseLimits()}
+	flags.IntVar(&server.recentGames, "analytics-recent-games", game.DefaultRecentGames, "finished games analytics keeps whole for exports; older ones are rolled up by the hour and day")
+	flags.StringVar(&server.cluster.StateStore, "state", os.Getenv("CODEBREAKER_STATE"), "state shared with other replicas: 'memory' or redis://host:port (default $CODEBREAKER_STATE, or memory)")
+	flags.StringVar(&server.cluster.ReplicaID, "replica-id", "", "name of this replica (default the host name)")
+	flags.StringVar(&server.cluster.Advertise, "advertise", os.Getenv("CODEBREAKER_ADVERTISE"), "host:port other replicas reach this one's game port at (default $CODEBREAKER_ADVERTISE, or the host name and port 8080)")
+	flags.StringVar(&server.healthAddr, "health-addr", ":8082", "address of the HTTP /healthz and /readyz endpoints (empty to disable)")
+	flags.DurationVar(&server.drainTimeout, "drain-timeout", 25*time.Second, "how long to wait for games to finish when asked to shut down")
+	flags.StringVar(&server.logging.Level, "log-level", "info", "least severe log records written: debug, info, warn or error (guesses are only logged at debug)")
+	flags.StringVar(&server.logging.Format, "log-format", game.LogText, "log format: text or json")
+	flags.StringVar(&server.tls.CertFile, "tls-cert", "", "certificate file for serving over TLS (plaintext if not set)")
+	flags.StringVar(&server.tls.KeyFile, "tls-key", "", "private key file of the TLS certificate")
+	flags.StringVar(&server.tls.AdminClientCA, "admin-client-ca", "", "CA file the admin port requires client certificates from (mutual TLS)")
+
+	limits := &server.limits
+	flags.IntVar(&limits.MaxConnectionsPerIP, "max-conns-per-ip", limits.MaxConnectionsPerIP, "open game connections allowed from one IP address (0 for unlimited)")
+	flags.IntVar(&limits.InputRate, "input-rate", limits.InputRate, "messages a player may send per -input-window (0 for unlimited)")
+	flags.DurationVar(&limits.InputWindow, "input-window", limits.InputWindow, "window for -input-rate")
+	flags.IntVar(&limits.MaxMessageSize, "max-message-size", limits.MaxMessageSize, "longest message in bytes (0 for unlimited)")
+	flags.IntVar(&limits.BanAfter, "ban-after", limits.BanAfter, "violations within -violation-window that get an IP address banned (0 to never ban)")
+	flags.DurationVar(&limits.ViolationWindow, "violation-window", limits.ViolationWindow, "window for -ban-after")
+	flags.DurationVar(&limits.BanDuration, "ban-for", limits.BanDuration, "how long a ban lasts")
+	return server
+}
+
+// apply configures the server from its flags
+func (server *serverFlags) apply() {
+	if err := game.ConfigureLogging(server.logging, os.Stderr); err != nil {
+		log.Fatal(err)
+	}
+	if err := game.ConfigureTLS(server.tls); err != nil {
+		log.Fatal(err)
+	}
+	game.ConfigureAbuseLimits(server.limits)
+	game.ConfigureAnalytics(server.recentGames)
+	if err := game.ConfigureCluster(server.cluster); err != nil {
+		log.Fatal(err)
+	}
+	if server.healthAddr != "" {
+		if err := game.StartHealthServer(server.healthAddr); err != nil {
+			log.Fatal(err)
+		}
+	}
+	game.HandleShutdown(server.drainTimeout)
+}
+
+// clientAddress splits a client's optional server address from its flags
+func clientAddress(args []string) (string, []string) {
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		return args[0], args[1:]
+	}
+	return "server:8080", args
+}
+
+// addClientTLSFlags registers the flags for connecting over TLS
+func addClientTLSFlags(flags *flag.FlagSet, options *game.ClientTLSOptions) {
+	flags.BoolVar(&options.Enabled, "tls", false, "connect over TLS, trusting the system's CAs")
+	flags.StringVar(&options.CAFile, "ca", "", "connect over TLS, only trusting certificates signed by this CA file")
+}
+
+// configureClientTLS applies the TLS flags of a client
+func configureClientTLS(options game.ClientTLSOptions) {
+	if err := game.ConfigureClientTLS(options); err != nil {
+		log.Fatal(err)
 	}
 }
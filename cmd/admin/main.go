@@ -2,7 +2,11 @@ package main
 
 import (
 	"bufio"
+	"crypto/tls"
+	"crypto/x509"
+	"flag"
 	"fmt"
+	"io"
 	"net"
 	"os"
 	"strings"
@@ -12,15 +16,46 @@ func main() {
 	if len(os.Args) < 2 {
 		fmt.Println("Usage: go run admin_client.go <server_address>")
 		fmt.Println("Example: go run admin_client.go localhost:8080")
+		fmt.Println("TLS: add -tls, -ca <file> to only trust that CA, and -cert <file> -key <file> for mutual TLS")
 		return
 	}
 
 	serverAddress := os.Args[1]
 
+	flags := flag.NewFlagSet("admin", flag.ExitOnError)
+	useTLS := flags.Bool("tls", false, "connect over TLS, trusting the system's CAs")
+	caFile := flags.String("ca", "", "connect over TLS, only trusting certificates signed by this CA file")
+	certFile := flags.String("cert", "", "client certificate file, for servers that require one")
+	keyFile := flags.String("key", "", "private key file of the client certificate")
+	flags.Parse(os.Args[2:])
+
+	tlsConfig, err := loadTLSConfig(*useTLS, *caFile, *certFile, *keyFile)
+	if err != nil {
+		fmt.Printf("Error setting up TLS: %v\n", err)
+		return
+	}
+
 	fmt.Println("Code Breaker Admin Client")
 	fmt.Println("========================")
 	fmt.Println("Available commands:")
 	fmt.Println("  stats - Display game statistics")
+	fmt.Println("  stats <hour|day|week> - Display statistics for the last hour, day or week")
+	fmt.Println("  stats <from> [to] - Display statistics for a time range")
+	fmt.Println("  export <games|guesses> [csv|jsonl] [from] [to] - Export the game history; add > <file> to save it")
+	fmt.Println("  efficiency [player ID] - Show the players who guess most efficiently, or one player's efficiency")
+	fmt.Println("  secrets [classic|uniform] [samples] - Audit the distribution of secret codes against the games played")
+	fmt.Println("  filter - List the words banned from chat")
+	fmt.Println("  filter add <word> - Ban a word from chat")
+	fmt.Println("  filter remove <word> - Allow a banned word again")
+	fmt.Println("  tournament - Show tournament standings and matches")
+	fmt.Println("  tournament start - Start the tournament")
+	fmt.Println("  queue - Show the matchmaking queue and ratings")
+	fmt.Println("  daily - Show the daily challenge leaderboard")
+	fmt.Println("  abuse - Show connection limits, bans and dropped messages")
+	fmt.Println("  abuse ban <ip> [duration] - Ban an IP address")
+	fmt.Println("  abuse unban <ip> - Lift a ban")
+	fmt.Println("  abuse set <limit> <value> - Change an abuse protection limit")
+	fmt.Println("  cluster - Show the replicas, their games and players, and cluster-wide analytics")
 	fmt.Println("  exit - Exit the admin client")
 
 	reader := bufio.NewReader(os.Stdin)
@@ -40,37 +75,95 @@ func main() {
 			break
 		}
 
-		if command == "stats" {
-			// Connect to the server
-			conn, err := net.Dial("tcp", serverAddress)
-			if err != nil {
-				fmt.Printf("Error connecting to server: %v\n", err)
-				continue
-			}
+		if command == "" {
+			continue
+		}
 
-			// Send the command
-			_, err = conn.Write([]byte(command))
-			if err != nil {
-				fmt.Printf("Error sending command: %v\n", err)
-				conn.Close()
+		// "command > file" saves the response to a file instead of showing it
+		var outputFile string
+		if i := strings.LastIndex(command, ">"); i >= 0 {
+			command, outputFile = strings.TrimSpace(command[:i]), strings.TrimSpace(command[i+1:])
+			if outputFile == "" {
+				fmt.Println("Missing the file to save the response to")
 				continue
 			}
+		}
 
-			// Read the response
-			buffer := make([]byte, 8192) // Large buffer for stats
-			n, err := conn.Read(buffer)
-			if err != nil {
-				fmt.Printf("Error reading response: %v\n", err)
-				conn.Close()
-				continue
-			}
+		// Connect to the server
+		conn, err := dial(serverAddress, tlsConfig)
+		if err != nil {
+			fmt.Printf("Error connecting to server: %v\n", err)
+			continue
+		}
+
+		// Send the command
+		_, err = conn.Write([]byte(command))
+		if err != nil {
+			fmt.Printf("Error sending command: %v\n", err)
+			conn.Close()
+			continue
+		}
 
-			// Display the response
-			fmt.Println("\n" + string(buffer[:n]))
+		// Read the response until the server closes the connection
+		response, err := io.ReadAll(conn)
+		if err != nil {
+			fmt.Printf("Error reading response: %v\n", err)
+			conn.Close()
+			continue
+		}
 
+		if outputFile != "" {
+			if err := os.WriteFile(outputFile, response, 0644); err != nil {
+				fmt.Printf("Error saving response: %v\n", err)
+			} else {
+				fmt.Printf("Saved %d bytes to %s\n", len(response), outputFile)
+			}
 			conn.Close()
-		} else {
-			fmt.Println("Unknown command. Available commands: stats, exit")
+			continue
 		}
+
+		// Display the response
+		fmt.Println("\n" + string(response))
+
+		conn.Close()
+	}
+}
+
+// loadTLSConfig builds the TLS configuration from the flags, or returns nil
+// for a plaintext connection
+func loadTLSConfig(useTLS bool, caFile, certFile, keyFile string) (*tls.Config, error) {
+	if !useTLS && caFile == "" {
+		if certFile != "" || keyFile != "" {
+			return nil, fmt.Errorf("a client certificate needs TLS; add -tls or -ca")
+		}
+		return nil, nil
+	}
+
+	config := &tls.Config{MinVersion: tls.VersionTLS12}
+	if caFile != "" {
+		data, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, err
+		}
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(data) {
+			return nil, fmt.Errorf("no certificates found in %s", caFile)
+		}
+	}
+	if certFile != "" || keyFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, err
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	return config, nil
+}
+
+// dial connects to the server, over TLS if config is set
+func dial(address string, config *tls.Config) (net.Conn, error) {
+	if config != nil {
+		return tls.Dial("tcp", address, config)
 	}
+	return net.Dial("tcp", address)
 }